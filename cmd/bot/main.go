@@ -21,6 +21,25 @@ import (
 var version = "dev"
 
 func main() {
+	if len(os.Args) > 1 {
+		var run func([]string) error
+		switch os.Args[1] {
+		case "export":
+			run = runExport
+		case "import":
+			run = runImport
+		case "rekey":
+			run = runRekey
+		}
+		if run != nil {
+			if err := run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[1], err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	var (
 		configPath  string
 		showVersion bool
@@ -119,11 +138,20 @@ func printUsage() {
 
 Usage:
   tg-bot [--config <path>] [--version] [--help]
+  tg-bot export [--config <path>] [--format json|ndjson] [--output <file>]
+  tg-bot import [--config <path>] [--dry-run] [--overwrite] <file|->
+  tg-bot rekey [--config <path>] --new-key-env <var> | --new-key-file <path>
 
 Options:
   --config <path>   Path to configuration file (default: config.toml)
   --version         Show version information
   --help            Show this help message
+
+Commands:
+  export            Write sessions, models and preferences to an archive
+  import            Load an archive into the configured storage; conflicting
+                    entries are kept unless --overwrite is given
+  rekey             Re-encrypt the state file with a new key
 `)
 }
 
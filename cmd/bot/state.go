@@ -0,0 +1,160 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"tg-bot/internal/config"
+	"tg-bot/internal/storage"
+)
+
+// openConfiguredStore opens the storage backend named in the config file.
+func openConfiguredStore(configPath string) (storage.Store, error) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	store, err := storage.NewStore(storage.Options{
+		Type:     cfg.Storage.Type,
+		FilePath: cfg.Storage.FilePath,
+		KeyEnv:   cfg.Storage.EncryptionKeyEnv,
+		KeyFile:  cfg.Storage.EncryptionKeyFile,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open storage: %w", err)
+	}
+	return store, nil
+}
+
+// runExport dumps the configured store to an archive.
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	configPath := fs.String("config", "", "Path to config file (default: config.toml)")
+	format := fs.String("format", storage.ArchiveJSON, "Archive format: json or ndjson")
+	output := fs.String("output", "-", "Archive file to write, - for stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != storage.ArchiveJSON && *format != storage.ArchiveNDJSON {
+		return fmt.Errorf("unsupported format %q, must be json or ndjson", *format)
+	}
+
+	store, err := openConfiguredStore(*configPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	archive, err := storage.ExportArchive(store)
+	if err != nil {
+		return fmt.Errorf("failed to export state: %w", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		f, err := os.OpenFile(*output, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to create archive: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := storage.WriteArchive(w, archive, *format); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d session(s), %d user session(s), %d model(s), %d model preference(s), %d chat render mode(s)\n",
+		len(archive.Sessions), len(archive.UserSessions), len(archive.Models), len(archive.UserLastModels), len(archive.ChatRenderModes))
+	return nil
+}
+
+// runImport loads an archive into the configured store.
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	configPath := fs.String("config", "", "Path to config file (default: config.toml)")
+	dryRun := fs.Bool("dry-run", false, "Report what would change and any conflicts without writing")
+	overwrite := fs.Bool("overwrite", false, "Replace existing entries that conflict with the archive")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: tg-bot import [--config <path>] [--dry-run] [--overwrite] <archive|->")
+	}
+
+	var r io.Reader = os.Stdin
+	if path := fs.Arg(0); path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open archive: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	archive, err := storage.ReadArchive(r)
+	if err != nil {
+		return err
+	}
+
+	store, err := openConfiguredStore(*configPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	report, err := storage.ImportArchive(store, archive, storage.ImportOptions{DryRun: *dryRun, Overwrite: *overwrite})
+	if err != nil {
+		return fmt.Errorf("failed to import state: %w", err)
+	}
+
+	for _, c := range report.Conflicts {
+		fmt.Printf("conflict %s %s\n  existing: %s\n  archive:  %s\n", c.Kind, c.Key, c.Existing, c.Incoming)
+	}
+	prefix := "Imported"
+	if *dryRun {
+		prefix = "Dry run, nothing written. Would import"
+	}
+	fmt.Printf("%s: %d added, %d unchanged, %d replaced, %d conflict(s) kept\n",
+		prefix, report.Added, report.Unchanged, report.Replaced, report.Skipped)
+	return nil
+}
+
+// runRekey re-encrypts the state file with a new key. The old key comes from
+// the config; the config must be pointed at the new key afterwards. The bot
+// must not be running, as it would save over the file with the old key.
+func runRekey(args []string) error {
+	fs := flag.NewFlagSet("rekey", flag.ContinueOnError)
+	configPath := fs.String("config", "", "Path to config file (default: config.toml)")
+	newKeyEnv := fs.String("new-key-env", "", "Environment variable holding the new base64 key")
+	newKeyFile := fs.String("new-key-file", "", "File holding the new base64 key")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if cfg.Storage.Type != "file" {
+		return fmt.Errorf("encryption is only supported for file storage, not %s", cfg.Storage.Type)
+	}
+	oldKey, err := storage.LoadKey(cfg.Storage.EncryptionKeyEnv, cfg.Storage.EncryptionKeyFile)
+	if err != nil {
+		return fmt.Errorf("current key: %w", err)
+	}
+	newKey, err := storage.LoadKey(*newKeyEnv, *newKeyFile)
+	if err != nil {
+		return fmt.Errorf("new key: %w", err)
+	}
+	if newKey == nil {
+		return fmt.Errorf("usage: tg-bot rekey [--config <path>] --new-key-env <var> | --new-key-file <path>")
+	}
+
+	fmt.Println("Make sure the bot is stopped: a running bot saves over the state file with the old key.")
+	if err := storage.RekeyFile(cfg.Storage.FilePath, oldKey, newKey); err != nil {
+		return fmt.Errorf("failed to re-encrypt %s: %w", cfg.Storage.FilePath, err)
+	}
+	fmt.Printf("Re-encrypted %s with the new key. Update storage.encryption_key_env or storage.encryption_key_file before starting the bot.\n", cfg.Storage.FilePath)
+	return nil
+}
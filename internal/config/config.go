@@ -1,22 +1,28 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"tg-bot/internal/render"
+
 	"github.com/pelletier/go-toml/v2"
 	log "github.com/sirupsen/logrus"
 )
 
 // Config represents the entire configuration structure
 type Config struct {
-	Telegram TelegramConfig `toml:"telegram"`
-	Proxy    ProxyConfig    `toml:"proxy"`
-	OpenCode OpenCodeConfig `toml:"opencode"`
-	Storage  StorageConfig  `toml:"storage"`
-	Render   RenderConfig   `toml:"render"`
-	Logging  LoggingConfig  `toml:"logging"`
+	Telegram    TelegramConfig    `toml:"telegram"`
+	Proxy       ProxyConfig       `toml:"proxy"`
+	OpenCode    OpenCodeConfig    `toml:"opencode"`
+	Storage     StorageConfig     `toml:"storage"`
+	Render      RenderConfig      `toml:"render"`
+	Logging     LoggingConfig     `toml:"logging"`
+	Access      AccessConfig      `toml:"access"`
+	Attachments AttachmentsConfig `toml:"attachments"`
+	Cleanup     CleanupConfig     `toml:"cleanup"`
 }
 
 // TelegramConfig contains Telegram Bot settings
@@ -34,19 +40,119 @@ type ProxyConfig struct {
 
 // OpenCodeConfig contains OpenCode API settings
 type OpenCodeConfig struct {
-	URL     string `toml:"url"`
-	Timeout int    `toml:"timeout"`
+	URL               string `toml:"url"`
+	Timeout           int    `toml:"timeout"`
+	PermissionTimeout int    `toml:"permission_timeout"` // seconds before a pending permission is auto-rejected
+	QueueSize         int    `toml:"queue_size"`         // prompts that may wait per session while a task runs
+
+	// AutoCompactThreshold compacts a session once its context reaches this
+	// fraction of the model's context limit; 0 disables automatic compaction.
+	AutoCompactThreshold float64 `toml:"auto_compact_threshold"`
 }
 
 // StorageConfig contains session storage settings
 type StorageConfig struct {
 	Type     string `toml:"type"`
-	FilePath string `toml:"file_path"` // path to JSON file for session storage
+	FilePath string `toml:"file_path"` // path to the JSON file or SQLite database
+
+	// Optional at-rest encryption of the JSON file: a base64 AES-256 key read
+	// from an environment variable or a key file
+	EncryptionKeyEnv  string `toml:"encryption_key_env"`
+	EncryptionKeyFile string `toml:"encryption_key_file"`
 }
 
 // RenderConfig controls Telegram rendering behavior for OpenCode output
 type RenderConfig struct {
-	Mode string `toml:"mode"` // plain | markdown_final | markdown_stream
+	Mode string `toml:"mode"` // plain | markdown_final | markdown_stream | markdownv2
+
+	// Replies longer than DocumentThreshold characters or split into more than
+	// DocumentMaxMessages messages are attached as a document; 0 disables a limit.
+	DocumentThreshold   int  `toml:"document_threshold"`
+	DocumentMaxMessages int  `toml:"document_max_messages"`
+	DocumentHTML        bool `toml:"document_html"` // also attach a rendered .html copy
+}
+
+// CleanupConfig controls the periodic removal of sessions nobody has used for a while
+type CleanupConfig struct {
+	MaxAgeDays    int `toml:"max_age_days"`   // sessions unused this long are cleaned up; 0 disables the janitor
+	IntervalHours int `toml:"interval_hours"` // how often the janitor runs
+
+	// DeleteOpenCodeSessions also deletes cleaned-up sessions in OpenCode;
+	// otherwise only the bot forgets them.
+	DeleteOpenCodeSessions bool `toml:"delete_opencode_sessions"`
+}
+
+// Access roles, from most to least privileged.
+const (
+	RoleAdmin    = "admin"
+	RoleOperator = "operator"
+	RoleReadOnly = "readonly"
+)
+
+// AccessConfig restricts which Telegram users and chats may use the bot.
+// When no users and no chats are configured, access control is disabled.
+type AccessConfig struct {
+	AdminUsers      []int64 `toml:"admin_users"`
+	OperatorUsers   []int64 `toml:"operator_users"`
+	ReadOnlyUsers   []int64 `toml:"readonly_users"`
+	AllowedChats    []int64 `toml:"allowed_chats"`
+	ChatDefaultRole string  `toml:"chat_default_role"` // role for unlisted members of allowed chats
+}
+
+// Enabled reports whether any access restriction is configured.
+func (a AccessConfig) Enabled() bool {
+	return len(a.AdminUsers) > 0 || len(a.OperatorUsers) > 0 || len(a.ReadOnlyUsers) > 0 || len(a.AllowedChats) > 0
+}
+
+// IsValidRole reports whether role is one of the supported access roles.
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleAdmin, RoleOperator, RoleReadOnly:
+		return true
+	default:
+		return false
+	}
+}
+
+// MaxAttachmentSizeMB is the largest file the Telegram Bot API lets bots download.
+const MaxAttachmentSizeMB = 20
+
+// DefaultAllowedMimeTypes are forwarded to OpenCode when allowed_mime_types is unset.
+var DefaultAllowedMimeTypes = []string{
+	"text/*",
+	"image/*",
+	"application/pdf",
+	"application/json",
+	"application/xml",
+	"application/yaml",
+	"application/x-yaml",
+}
+
+// AttachmentsConfig controls which Telegram documents and photos are forwarded to OpenCode.
+type AttachmentsConfig struct {
+	MaxSizeMB        int      `toml:"max_size_mb"`
+	AllowedMimeTypes []string `toml:"allowed_mime_types"` // exact types or "type/*" wildcards
+}
+
+// AllowsMIME reports whether mimeType matches one of the allowed MIME types.
+func (a AttachmentsConfig) AllowsMIME(mimeType string) bool {
+	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+	if i := strings.IndexByte(mimeType, ';'); i >= 0 {
+		mimeType = strings.TrimSpace(mimeType[:i])
+	}
+	if mimeType == "" {
+		return false
+	}
+	for _, allowed := range a.AllowedMimeTypes {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if allowed == "*/*" || allowed == mimeType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok && strings.HasPrefix(mimeType, prefix+"/") {
+			return true
+		}
+	}
+	return false
 }
 
 // LoggingConfig contains logging settings
@@ -111,14 +217,35 @@ func setDefaults(cfg *Config) {
 	if cfg.OpenCode.Timeout == 0 {
 		cfg.OpenCode.Timeout = 30
 	}
+	if cfg.OpenCode.PermissionTimeout == 0 {
+		cfg.OpenCode.PermissionTimeout = 300
+	}
+	if cfg.OpenCode.QueueSize == 0 {
+		cfg.OpenCode.QueueSize = 5
+	}
+	if cfg.Attachments.MaxSizeMB == 0 {
+		cfg.Attachments.MaxSizeMB = 10
+	}
+	if cfg.Attachments.AllowedMimeTypes == nil {
+		cfg.Attachments.AllowedMimeTypes = append([]string(nil), DefaultAllowedMimeTypes...)
+	}
 	if cfg.Storage.Type == "" {
 		cfg.Storage.Type = "file"
 	}
 	if cfg.Storage.FilePath == "" && cfg.Storage.Type == "file" {
 		cfg.Storage.FilePath = "opencode-tg-state.json"
 	}
+	if cfg.Storage.FilePath == "" && cfg.Storage.Type == "sqlite" {
+		cfg.Storage.FilePath = "opencode-tg-state.db"
+	}
+	if cfg.Cleanup.IntervalHours == 0 {
+		cfg.Cleanup.IntervalHours = 24
+	}
 	if cfg.Render.Mode == "" {
-		cfg.Render.Mode = "markdown_stream"
+		cfg.Render.Mode = render.ModeMarkdownStream
+	}
+	if cfg.Access.ChatDefaultRole == "" {
+		cfg.Access.ChatDefaultRole = RoleReadOnly
 	}
 	if cfg.Logging.Level == "" {
 		cfg.Logging.Level = "info"
@@ -139,9 +266,40 @@ func (c *Config) Validate() error {
 	if c.OpenCode.URL == "" {
 		return &ConfigError{Field: "opencode.url", Message: "OpenCode URL is required"}
 	}
-	// Render mode is always markdown_stream, other modes are deprecated
-	// Keep for backward compatibility but ignore value
-	_ = strings.ToLower(strings.TrimSpace(c.Render.Mode))
+	if c.OpenCode.QueueSize < 0 {
+		return &ConfigError{Field: "opencode.queue_size", Message: "queue size must not be negative"}
+	}
+	if c.OpenCode.AutoCompactThreshold < 0 || c.OpenCode.AutoCompactThreshold >= 1 {
+		return &ConfigError{Field: "opencode.auto_compact_threshold", Message: "threshold must be 0 (disabled) or a fraction below 1"}
+	}
+	if c.Attachments.MaxSizeMB < 0 || c.Attachments.MaxSizeMB > MaxAttachmentSizeMB {
+		return &ConfigError{Field: "attachments.max_size_mb", Message: fmt.Sprintf("max size must be 0 for the default or between 1 and %d MB", MaxAttachmentSizeMB)}
+	}
+	if c.Storage.EncryptionKeyEnv != "" && c.Storage.EncryptionKeyFile != "" {
+		return &ConfigError{Field: "storage", Message: "set only one of encryption_key_env and encryption_key_file"}
+	}
+	if (c.Storage.EncryptionKeyEnv != "" || c.Storage.EncryptionKeyFile != "") && c.Storage.Type == "sqlite" {
+		return &ConfigError{Field: "storage", Message: "encryption is only supported for file storage"}
+	}
+	if c.Render.DocumentThreshold < 0 || c.Render.DocumentMaxMessages < 0 {
+		return &ConfigError{Field: "render", Message: "document thresholds must not be negative"}
+	}
+	if c.Cleanup.MaxAgeDays < 0 || c.Cleanup.IntervalHours < 0 {
+		return &ConfigError{Field: "cleanup", Message: "max age and interval must not be negative"}
+	}
+	if mode := c.Render.Mode; mode != "" && !render.IsValidMode(mode) {
+		return &ConfigError{Field: "render.mode", Message: "mode must be one of " + strings.Join(render.Modes, ", ")}
+	}
+	if role := c.Access.ChatDefaultRole; role != "" && !IsValidRole(role) {
+		return &ConfigError{Field: "access.chat_default_role", Message: "role must be one of admin, operator, readonly"}
+	}
+	for _, ids := range [][]int64{c.Access.AdminUsers, c.Access.OperatorUsers, c.Access.ReadOnlyUsers, c.Access.AllowedChats} {
+		for _, id := range ids {
+			if id == 0 {
+				return &ConfigError{Field: "access", Message: "user and chat IDs must be non-zero"}
+			}
+		}
+	}
 	return nil
 }
 
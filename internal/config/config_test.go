@@ -121,6 +121,12 @@ url = "http://127.0.0.1:8080"
 	if cfg.OpenCode.Timeout != 30 {
 		t.Errorf("Expected default OpenCode timeout 30, got %d", cfg.OpenCode.Timeout)
 	}
+	if cfg.OpenCode.PermissionTimeout != 300 {
+		t.Errorf("Expected default OpenCode permission timeout 300, got %d", cfg.OpenCode.PermissionTimeout)
+	}
+	if cfg.OpenCode.QueueSize != 5 {
+		t.Errorf("Expected default OpenCode queue size 5, got %d", cfg.OpenCode.QueueSize)
+	}
 	if cfg.Storage.Type != "file" {
 		t.Errorf("Expected default storage type 'file', got %s", cfg.Storage.Type)
 	}
@@ -142,6 +148,96 @@ url = "http://127.0.0.1:8080"
 	if cfg.Logging.EnableTelegramInterfaceLogs {
 		t.Error("Expected enable_telegram_interface_logs default to be false")
 	}
+	if cfg.Attachments.MaxSizeMB != 10 {
+		t.Errorf("Expected default attachment size limit 10 MB, got %d", cfg.Attachments.MaxSizeMB)
+	}
+	if !cfg.Attachments.AllowsMIME("image/png") || cfg.Attachments.AllowsMIME("application/zip") {
+		t.Errorf("Unexpected default allowed MIME types: %v", cfg.Attachments.AllowedMimeTypes)
+	}
+	if cfg.Access.Enabled() {
+		t.Error("Expected access control to be disabled by default")
+	}
+	if cfg.Access.ChatDefaultRole != RoleReadOnly {
+		t.Errorf("Expected default chat role 'readonly', got %s", cfg.Access.ChatDefaultRole)
+	}
+	if cfg.Cleanup.MaxAgeDays != 0 || cfg.Cleanup.IntervalHours != 24 {
+		t.Errorf("Expected cleanup disabled with a 24 hour interval, got %+v", cfg.Cleanup)
+	}
+}
+
+func TestLoadConfigSQLiteStorageDefaultPath(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.toml")
+
+	configContent := `
+[telegram]
+token = "test_token"
+
+[opencode]
+url = "http://127.0.0.1:8080"
+
+[storage]
+type = "sqlite"
+`
+
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Storage.FilePath != "opencode-tg-state.db" {
+		t.Errorf("Expected default sqlite path 'opencode-tg-state.db', got %s", cfg.Storage.FilePath)
+	}
+}
+
+func TestLoadConfigAccess(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.toml")
+
+	configContent := `
+[telegram]
+token = "test_token"
+
+[opencode]
+url = "http://127.0.0.1:8080"
+
+[access]
+admin_users = [1001]
+operator_users = [1002, 1003]
+readonly_users = [1004]
+allowed_chats = [-100200300]
+chat_default_role = "operator"
+`
+
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if !cfg.Access.Enabled() {
+		t.Fatal("Expected access control to be enabled")
+	}
+	if len(cfg.Access.AdminUsers) != 1 || cfg.Access.AdminUsers[0] != 1001 {
+		t.Errorf("Unexpected admin users: %v", cfg.Access.AdminUsers)
+	}
+	if len(cfg.Access.OperatorUsers) != 2 {
+		t.Errorf("Unexpected operator users: %v", cfg.Access.OperatorUsers)
+	}
+	if len(cfg.Access.AllowedChats) != 1 || cfg.Access.AllowedChats[0] != -100200300 {
+		t.Errorf("Unexpected allowed chats: %v", cfg.Access.AllowedChats)
+	}
+	if cfg.Access.ChatDefaultRole != RoleOperator {
+		t.Errorf("Expected chat default role 'operator', got %s", cfg.Access.ChatDefaultRole)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Unexpected validation error: %v", err)
+	}
 }
 
 func TestValidateConfig(t *testing.T) {
@@ -200,8 +296,104 @@ func TestValidateConfig(t *testing.T) {
 				OpenCode: OpenCodeConfig{URL: "http://localhost:8080"},
 				Render:   RenderConfig{Mode: "invalid"},
 			},
+			wantErr: true,
+		},
+		{
+			name: "plain render mode",
+			config: &Config{
+				Telegram: TelegramConfig{Token: "valid_token"},
+				OpenCode: OpenCodeConfig{URL: "http://localhost:8080"},
+				Render:   RenderConfig{Mode: "plain"},
+			},
 			wantErr: false,
 		},
+		{
+			name: "negative queue size",
+			config: &Config{
+				Telegram: TelegramConfig{Token: "valid_token"},
+				OpenCode: OpenCodeConfig{URL: "http://localhost:8080", QueueSize: -1},
+			},
+			wantErr: true,
+		},
+		{
+			name: "auto compact threshold",
+			config: &Config{
+				Telegram: TelegramConfig{Token: "valid_token"},
+				OpenCode: OpenCodeConfig{URL: "http://localhost:8080", AutoCompactThreshold: 0.8},
+			},
+			wantErr: false,
+		},
+		{
+			name: "auto compact threshold out of range",
+			config: &Config{
+				Telegram: TelegramConfig{Token: "valid_token"},
+				OpenCode: OpenCodeConfig{URL: "http://localhost:8080", AutoCompactThreshold: 1.5},
+			},
+			wantErr: true,
+		},
+		{
+			name: "both storage encryption key sources",
+			config: &Config{
+				Telegram: TelegramConfig{Token: "valid_token"},
+				OpenCode: OpenCodeConfig{URL: "http://localhost:8080"},
+				Storage:  StorageConfig{EncryptionKeyEnv: "TG_BOT_KEY", EncryptionKeyFile: "bot.key"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "encrypted sqlite storage",
+			config: &Config{
+				Telegram: TelegramConfig{Token: "valid_token"},
+				OpenCode: OpenCodeConfig{URL: "http://localhost:8080"},
+				Storage:  StorageConfig{Type: "sqlite", EncryptionKeyEnv: "TG_BOT_KEY"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "encrypted file storage",
+			config: &Config{
+				Telegram: TelegramConfig{Token: "valid_token"},
+				OpenCode: OpenCodeConfig{URL: "http://localhost:8080"},
+				Storage:  StorageConfig{Type: "file", EncryptionKeyFile: "bot.key"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "negative document threshold",
+			config: &Config{
+				Telegram: TelegramConfig{Token: "valid_token"},
+				OpenCode: OpenCodeConfig{URL: "http://localhost:8080"},
+				Render:   RenderConfig{DocumentThreshold: -1},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative cleanup max age",
+			config: &Config{
+				Telegram: TelegramConfig{Token: "valid_token"},
+				OpenCode: OpenCodeConfig{URL: "http://localhost:8080"},
+				Cleanup:  CleanupConfig{MaxAgeDays: -1},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid access chat default role",
+			config: &Config{
+				Telegram: TelegramConfig{Token: "valid_token"},
+				OpenCode: OpenCodeConfig{URL: "http://localhost:8080"},
+				Access:   AccessConfig{ChatDefaultRole: "owner"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "zero access user ID",
+			config: &Config{
+				Telegram: TelegramConfig{Token: "valid_token"},
+				OpenCode: OpenCodeConfig{URL: "http://localhost:8080"},
+				Access:   AccessConfig{AdminUsers: []int64{0}},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -228,3 +420,23 @@ func TestConfigError(t *testing.T) {
 		t.Errorf("Expected error message %q, got %q", expected, err.Error())
 	}
 }
+
+func TestAttachmentsAllowsMIME(t *testing.T) {
+	cfg := AttachmentsConfig{AllowedMimeTypes: []string{"text/*", "application/pdf"}}
+
+	tests := []struct {
+		mime string
+		want bool
+	}{
+		{"text/plain", true},
+		{"text/x-diff; charset=utf-8", true},
+		{"APPLICATION/PDF", true},
+		{"image/png", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := cfg.AllowsMIME(tt.mime); got != tt.want {
+			t.Errorf("AllowsMIME(%q) = %v, want %v", tt.mime, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"tg-bot/internal/config"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/telebot.v4"
+)
+
+// unauthorizedMessage is the fixed reply for rejected updates. It intentionally
+// reveals nothing about the configured users, chats or roles.
+const unauthorizedMessage = "⛔ You are not authorized to use this command."
+
+// accessRole is ordered so that a higher value grants everything a lower one does.
+type accessRole int
+
+const (
+	roleNone accessRole = iota
+	roleReadOnly
+	roleOperator
+	roleAdmin
+)
+
+func (r accessRole) String() string {
+	switch r {
+	case roleReadOnly:
+		return config.RoleReadOnly
+	case roleOperator:
+		return config.RoleOperator
+	case roleAdmin:
+		return config.RoleAdmin
+	default:
+		return "none"
+	}
+}
+
+func parseAccessRole(role string) accessRole {
+	switch role {
+	case config.RoleAdmin:
+		return roleAdmin
+	case config.RoleOperator:
+		return roleOperator
+	case config.RoleReadOnly:
+		return roleReadOnly
+	default:
+		return roleNone
+	}
+}
+
+// accessPolicy resolves the role of a Telegram user in a given chat.
+type accessPolicy struct {
+	enabled         bool
+	users           map[int64]accessRole
+	allowedChats    map[int64]bool
+	chatDefaultRole accessRole
+}
+
+func newAccessPolicy(cfg config.AccessConfig) *accessPolicy {
+	policy := &accessPolicy{
+		enabled:         cfg.Enabled(),
+		users:           make(map[int64]accessRole),
+		allowedChats:    make(map[int64]bool, len(cfg.AllowedChats)),
+		chatDefaultRole: parseAccessRole(cfg.ChatDefaultRole),
+	}
+
+	// Later assignments win, so a user listed twice keeps the highest role.
+	for _, userID := range cfg.ReadOnlyUsers {
+		policy.users[userID] = roleReadOnly
+	}
+	for _, userID := range cfg.OperatorUsers {
+		policy.users[userID] = roleOperator
+	}
+	for _, userID := range cfg.AdminUsers {
+		policy.users[userID] = roleAdmin
+	}
+	for _, chatID := range cfg.AllowedChats {
+		policy.allowedChats[chatID] = true
+	}
+	return policy
+}
+
+// resolveRole returns the effective role for userID in chatID. Listed users may
+// talk to the bot privately or in any allowed chat; unlisted members of an
+// allowed chat get the chat default role. Without access control everyone is
+// an operator: admin commands act on other users' sessions and the host, so
+// they need admin_users.
+func (p *accessPolicy) resolveRole(userID, chatID int64, privateChat bool) accessRole {
+	if p == nil || !p.enabled {
+		return roleOperator
+	}
+
+	chatAllowed := p.allowedChats[chatID]
+	if len(p.allowedChats) > 0 && !chatAllowed && !privateChat {
+		return roleNone
+	}
+
+	if role, ok := p.users[userID]; ok {
+		return role
+	}
+	if chatAllowed {
+		return p.chatDefaultRole
+	}
+	return roleNone
+}
+
+// roleForContext resolves the caller role for a Telegram update.
+func (b *Bot) roleForContext(c telebot.Context) (role accessRole, userID, chatID int64) {
+	if c != nil {
+		if sender := c.Sender(); sender != nil {
+			userID = sender.ID
+		}
+		if chat := c.Chat(); chat != nil {
+			chatID = chat.ID
+		}
+	}
+	if b.access == nil || !b.access.enabled {
+		return roleOperator, userID, chatID
+	}
+	if userID == 0 {
+		return roleNone, userID, chatID
+	}
+
+	privateChat := false
+	if c.Chat() != nil {
+		privateChat = c.Chat().Type == telebot.ChatPrivate
+	}
+	return b.access.resolveRole(userID, chatID, privateChat), userID, chatID
+}
+
+// withAccessControl rejects updates whose sender lacks minRole before handler runs.
+func (b *Bot) withAccessControl(interfaceName string, minRole accessRole, handler func(telebot.Context) error) func(telebot.Context) error {
+	return func(c telebot.Context) error {
+		role, userID, chatID := b.roleForContext(c)
+		if role >= minRole {
+			return handler(c)
+		}
+
+		log.Warnf("Unauthorized Telegram access: interface=%s user=%d chat=%d role=%s required=%s", interfaceName, userID, chatID, role, minRole)
+		if c == nil {
+			return nil
+		}
+		if c.Callback() != nil {
+			return c.Respond(&telebot.CallbackResponse{Text: unauthorizedMessage, ShowAlert: true})
+		}
+		return c.Send(unauthorizedMessage)
+	}
+}
+
+// handle registers handler for endpoint behind access control and interface logging.
+func (b *Bot) handle(endpoint, interfaceName string, minRole accessRole, handler func(telebot.Context) error) {
+	b.tgBot.Handle(endpoint, b.withAccessControl(interfaceName, minRole, b.withTelegramInterfaceLog(interfaceName, handler)))
+}
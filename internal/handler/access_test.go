@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"tg-bot/internal/config"
+
+	"gopkg.in/telebot.v4"
+)
+
+// telegramAPIRecorder is a fake Telegram Bot API that records every call.
+type telegramAPIRecorder struct {
+	mu    sync.Mutex
+	calls []telegramAPICall
+}
+
+type telegramAPICall struct {
+	Method string
+	Body   string
+}
+
+func (r *telegramAPIRecorder) Calls(method string) []telegramAPICall {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var matched []telegramAPICall
+	for _, call := range r.calls {
+		if call.Method == method {
+			matched = append(matched, call)
+		}
+	}
+	return matched
+}
+
+func newTestTelegramBot(t *testing.T) (*telebot.Bot, *telegramAPIRecorder) {
+	t.Helper()
+	recorder := &telegramAPIRecorder{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		recorder.mu.Lock()
+		recorder.calls = append(recorder.calls, telegramAPICall{Method: method, Body: string(body)})
+		messageID := len(recorder.calls)
+		recorder.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch method {
+		case "sendMessage", "editMessageText", "sendDocument":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"ok": true,
+				"result": map[string]interface{}{
+					"message_id": messageID,
+					"chat":       map[string]interface{}{"id": 100, "type": "private"},
+				},
+			})
+		default:
+			_, _ = w.Write([]byte(`{"ok":true,"result":true}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	tgBot, err := telebot.NewBot(telebot.Settings{
+		URL:         server.URL,
+		Token:       "test-token",
+		Offline:     true,
+		Synchronous: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to create telegram bot: %v", err)
+	}
+	return tgBot, recorder
+}
+
+func newTestMessageContext(tgBot *telebot.Bot, userID, chatID int64, chatType telebot.ChatType, text string) telebot.Context {
+	return tgBot.NewContext(telebot.Update{
+		Message: &telebot.Message{
+			ID:     1,
+			Sender: &telebot.User{ID: userID},
+			Chat:   &telebot.Chat{ID: chatID, Type: chatType},
+			Text:   text,
+		},
+	})
+}
+
+func TestAccessPolicy_ResolveRole(t *testing.T) {
+	policy := newAccessPolicy(config.AccessConfig{
+		AdminUsers:      []int64{1},
+		OperatorUsers:   []int64{2},
+		ReadOnlyUsers:   []int64{3, 1},
+		AllowedChats:    []int64{-100},
+		ChatDefaultRole: config.RoleReadOnly,
+	})
+
+	tests := []struct {
+		name    string
+		userID  int64
+		chatID  int64
+		private bool
+		want    accessRole
+	}{
+		{"admin in private chat", 1, 1, true, roleAdmin},
+		{"operator in allowed group", 2, -100, false, roleOperator},
+		{"readonly in private chat", 3, 3, true, roleReadOnly},
+		{"unlisted user in allowed group gets default", 4, -100, false, roleReadOnly},
+		{"unlisted user in private chat", 4, 4, true, roleNone},
+		{"listed user in unknown group", 1, -200, false, roleNone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.resolveRole(tt.userID, tt.chatID, tt.private); got != tt.want {
+				t.Fatalf("resolveRole(%d, %d) = %s, want %s", tt.userID, tt.chatID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessPolicy_DisabledAllowsEveryoneButAdminCommands(t *testing.T) {
+	policy := newAccessPolicy(config.AccessConfig{})
+	if got := policy.resolveRole(42, 42, true); got != roleOperator {
+		t.Fatalf("expected disabled policy to grant operator, got %s", got)
+	}
+
+	tgBot, recorder := newTestTelegramBot(t)
+	b := &Bot{access: policy}
+	called := 0
+	handler := b.withAccessControl("/cleanup", roleAdmin, func(telebot.Context) error {
+		called++
+		return nil
+	})
+	if err := handler(newTestMessageContext(tgBot, 42, 42, telebot.ChatPrivate, "/cleanup")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if called != 0 {
+		t.Fatal("admin commands must be refused until admin_users is set")
+	}
+	if sent := recorder.Calls("sendMessage"); len(sent) != 1 || !strings.Contains(sent[0].Body, "not authorized") {
+		t.Fatalf("expected a refusal message, got %#v", sent)
+	}
+}
+
+func TestWithAccessControl_RejectsInsufficientRole(t *testing.T) {
+	tgBot, recorder := newTestTelegramBot(t)
+	b := &Bot{
+		access: newAccessPolicy(config.AccessConfig{
+			OperatorUsers: []int64{2},
+			ReadOnlyUsers: []int64{3},
+		}),
+	}
+
+	called := 0
+	handler := b.withAccessControl("/new", roleOperator, func(telebot.Context) error {
+		called++
+		return nil
+	})
+
+	if err := handler(newTestMessageContext(tgBot, 3, 3, telebot.ChatPrivate, "/new")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if called != 0 {
+		t.Fatalf("read-only user must not reach operator handler")
+	}
+	sent := recorder.Calls("sendMessage")
+	if len(sent) != 1 || !strings.Contains(sent[0].Body, "not authorized") {
+		t.Fatalf("expected a single refusal message, got %#v", sent)
+	}
+
+	if err := handler(newTestMessageContext(tgBot, 2, 2, telebot.ChatPrivate, "/new")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if called != 1 {
+		t.Fatalf("operator should reach operator handler, called=%d", called)
+	}
+}
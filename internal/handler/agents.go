@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"tg-bot/internal/opencode"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/telebot.v4"
+)
+
+// displayAgentName labels an empty agent as the server default.
+func displayAgentName(agent string) string {
+	if strings.TrimSpace(agent) == "" {
+		return "default"
+	}
+	return agent
+}
+
+// sortedAgents orders primary agents before subagents, then by name.
+func sortedAgents(agents []opencode.Agent) []opencode.Agent {
+	sorted := append([]opencode.Agent(nil), agents...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].IsSubagent() != sorted[j].IsSubagent() {
+			return !sorted[i].IsSubagent()
+		}
+		return strings.ToLower(sorted[i].Name) < strings.ToLower(sorted[j].Name)
+	})
+	return sorted
+}
+
+// findAgent looks up an agent by name, ignoring case.
+func findAgent(agents []opencode.Agent, name string) (opencode.Agent, bool) {
+	for _, agent := range agents {
+		if strings.EqualFold(agent.Name, name) {
+			return agent, true
+		}
+	}
+	return opencode.Agent{}, false
+}
+
+// currentSessionAgent returns the agent pinned to the user's current session.
+func (b *Bot) currentSessionAgent(userID int64) string {
+	sessionID, exists := b.sessionManager.GetUserSession(userID)
+	if !exists {
+		return ""
+	}
+	meta, exists := b.sessionManager.GetSessionMeta(sessionID)
+	if !exists || meta == nil {
+		return ""
+	}
+	return meta.Agent
+}
+
+func formatAgentList(agents []opencode.Agent, current string) string {
+	var sb strings.Builder
+	sb.WriteString("🧠 Available Agents\n\n")
+	if len(agents) == 0 {
+		sb.WriteString("No agents available.")
+		return sb.String()
+	}
+
+	for _, agent := range sortedAgents(agents) {
+		marker := "•"
+		if current != "" && strings.EqualFold(agent.Name, current) {
+			marker = "✅"
+		}
+		mode := agent.Mode
+		if mode == "" {
+			mode = "primary"
+		}
+		fmt.Fprintf(&sb, "%s %s (%s)\n", marker, agent.Name, mode)
+		if desc := strings.TrimSpace(agent.Description); desc != "" {
+			fmt.Fprintf(&sb, "   %s\n", truncateAndInline(desc, 120))
+		}
+	}
+
+	fmt.Fprintf(&sb, "\nCurrent session agent: %s\n", displayAgentName(current))
+	sb.WriteString("Use /agent <name> to switch, or /agent default to reset.")
+	return sb.String()
+}
+
+// handleAgents handles the /agents command
+func (b *Bot) handleAgents(c telebot.Context) error {
+	ctx, cancel := context.WithTimeout(b.ctx, 30*time.Second)
+	defer cancel()
+
+	agents, err := b.opencodeClient.GetAgents(ctx)
+	if err != nil {
+		log.Errorf("Failed to get agents: %v", err)
+		return c.Send(fmt.Sprintf("Failed to get agent list: %v", err))
+	}
+	return c.Send(formatAgentList(agents, b.currentSessionAgent(c.Sender().ID)))
+}
+
+// handleAgent handles the /agent command
+func (b *Bot) handleAgent(c telebot.Context) error {
+	userID := c.Sender().ID
+	name := strings.TrimSpace(c.Message().Payload)
+
+	sessionID, exists := b.sessionManager.GetUserSession(userID)
+	if !exists {
+		return c.Send("You don't have a current session. Use /new to create a new session.")
+	}
+	if name == "" {
+		return c.Send(fmt.Sprintf("Current session agent: %s\n\nUsage: /agent <name>\nUse /agents to list available agents.", displayAgentName(b.currentSessionAgent(userID))))
+	}
+
+	if strings.EqualFold(name, "default") {
+		if err := b.sessionManager.SetSessionAgent(sessionID, ""); err != nil {
+			log.Errorf("Failed to reset agent for session %s: %v", sessionID, err)
+			return c.Send(fmt.Sprintf("Failed to set agent: %v", err))
+		}
+		return c.Send("✅ Current session will use the default agent.")
+	}
+
+	ctx, cancel := context.WithTimeout(b.ctx, 30*time.Second)
+	defer cancel()
+
+	agents, err := b.opencodeClient.GetAgents(ctx)
+	if err != nil {
+		log.Errorf("Failed to get agents: %v", err)
+		return c.Send(fmt.Sprintf("Failed to get agent list: %v", err))
+	}
+	agent, ok := findAgent(agents, name)
+	if !ok {
+		return c.Send(fmt.Sprintf("❌ Unknown agent %q. Use /agents to list available agents.", name))
+	}
+	if agent.IsSubagent() {
+		return c.Send(fmt.Sprintf("❌ %s is a subagent and can only be invoked by other agents.", agent.Name))
+	}
+
+	if err := b.sessionManager.SetSessionAgent(sessionID, agent.Name); err != nil {
+		log.Errorf("Failed to set agent for session %s: %v", sessionID, err)
+		return c.Send(fmt.Sprintf("Failed to set agent: %v", err))
+	}
+	log.Infof("User %d set session %s agent to %s", userID, sessionID, agent.Name)
+	return c.Send(fmt.Sprintf("✅ Current session agent set to %s", agent.Name))
+}
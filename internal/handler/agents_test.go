@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tg-bot/internal/opencode"
+	"tg-bot/internal/session"
+	"tg-bot/internal/storage"
+
+	"gopkg.in/telebot.v4"
+)
+
+func TestFormatAgentList_PrimaryFirstAndMarksCurrent(t *testing.T) {
+	agents := []opencode.Agent{
+		{Name: "general", Mode: "subagent", Description: "General purpose subagent"},
+		{Name: "plan", Mode: "primary", Description: "Read-only planning"},
+		{Name: "build", Mode: "primary"},
+	}
+
+	text := formatAgentList(agents, "plan")
+	build, plan, general := strings.Index(text, "build"), strings.Index(text, "plan (primary)"), strings.Index(text, "general")
+	if build < 0 || plan < 0 || general < 0 || !(build < plan && plan < general) {
+		t.Fatalf("expected primary agents sorted before subagents:\n%s", text)
+	}
+	if !strings.Contains(text, "✅ plan (primary)") {
+		t.Fatalf("expected current agent to be marked:\n%s", text)
+	}
+	if !strings.Contains(text, "Read-only planning") {
+		t.Fatalf("expected agent description:\n%s", text)
+	}
+}
+
+func TestHandleAgent_PersistsSelection(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/agent" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode([]opencode.Agent{
+			{Name: "build", Mode: "primary"},
+			{Name: "plan", Mode: "primary"},
+			{Name: "general", Mode: "subagent"},
+		})
+	}))
+	defer server.Close()
+
+	store, err := storage.NewStore(storage.Options{
+		Type:     "file",
+		FilePath: filepath.Join(t.TempDir(), "bot-state.json"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	const userID int64 = 42
+	if err := store.StoreSessionMeta(&storage.SessionMeta{SessionID: "ses_1", UserID: userID, Name: "Work", CreatedAt: time.Now(), LastUsedAt: time.Now()}); err != nil {
+		t.Fatalf("failed to store session meta: %v", err)
+	}
+	if err := store.StoreUserSession(userID, "ses_1"); err != nil {
+		t.Fatalf("failed to store user session: %v", err)
+	}
+
+	client := opencode.NewClient(server.URL, 5)
+	b := &Bot{
+		ctx:            context.Background(),
+		opencodeClient: client,
+		sessionManager: session.NewManagerWithStore(client, store),
+	}
+	tgBot, recorder := newTestTelegramBot(t)
+	agentCommand := func(payload string) telebot.Context {
+		return tgBot.NewContext(telebot.Update{
+			Message: &telebot.Message{
+				ID:      1,
+				Sender:  &telebot.User{ID: userID},
+				Chat:    &telebot.Chat{ID: userID, Type: telebot.ChatPrivate},
+				Text:    "/agent " + payload,
+				Payload: payload,
+			},
+		})
+	}
+
+	if err := b.handleAgent(agentCommand("general")); err != nil {
+		t.Fatalf("handleAgent failed: %v", err)
+	}
+	if got := b.currentSessionAgent(userID); got != "" {
+		t.Fatalf("subagents must not be pinned, got %q", got)
+	}
+
+	if err := b.handleAgent(agentCommand("PLAN")); err != nil {
+		t.Fatalf("handleAgent failed: %v", err)
+	}
+	if got := b.currentSessionAgent(userID); got != "plan" {
+		t.Fatalf("expected agent plan, got %q", got)
+	}
+
+	if err := b.handleAgent(agentCommand("default")); err != nil {
+		t.Fatalf("handleAgent failed: %v", err)
+	}
+	if got := b.currentSessionAgent(userID); got != "" {
+		t.Fatalf("expected default agent after reset, got %q", got)
+	}
+
+	sent := recorder.Calls("sendMessage")
+	if len(sent) != 3 || !strings.Contains(sent[0].Body, "subagent") || !strings.Contains(sent[1].Body, "set to plan") {
+		t.Fatalf("unexpected replies: %#v", sent)
+	}
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"tg-bot/internal/config"
+	"tg-bot/internal/opencode"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/telebot.v4"
+)
+
+func (b *Bot) attachmentsConfig() config.AttachmentsConfig {
+	cfg := config.AttachmentsConfig{}
+	if b.config != nil {
+		cfg = b.config.Attachments
+	}
+	if cfg.MaxSizeMB <= 0 {
+		cfg.MaxSizeMB = 10
+	}
+	if cfg.AllowedMimeTypes == nil {
+		cfg.AllowedMimeTypes = config.DefaultAllowedMimeTypes
+	}
+	return cfg
+}
+
+// handleDocument forwards a Telegram document to OpenCode with its caption as the prompt.
+func (b *Bot) handleDocument(c telebot.Context) error {
+	doc := c.Message().Document
+	if doc == nil {
+		return nil
+	}
+
+	filename := strings.TrimSpace(doc.FileName)
+	if filename == "" {
+		filename = "document"
+	}
+	part, err := b.downloadAttachment(c, &doc.File, filename, doc.MIME)
+	if err != nil {
+		return c.Send(fmt.Sprintf("❌ %v", err))
+	}
+	return b.submitPrompt(c, strings.TrimSpace(c.Message().Caption), []opencode.MessagePart{part})
+}
+
+// handlePhoto forwards the largest size of a Telegram photo to OpenCode.
+func (b *Bot) handlePhoto(c telebot.Context) error {
+	photo := c.Message().Photo
+	if photo == nil {
+		return nil
+	}
+
+	filename := "photo.jpg"
+	if photo.UniqueID != "" {
+		filename = fmt.Sprintf("photo_%s.jpg", photo.UniqueID)
+	}
+	part, err := b.downloadAttachment(c, &photo.File, filename, "image/jpeg")
+	if err != nil {
+		return c.Send(fmt.Sprintf("❌ %v", err))
+	}
+	return b.submitPrompt(c, strings.TrimSpace(c.Message().Caption), []opencode.MessagePart{part})
+}
+
+// downloadAttachment fetches file through the Bot API and converts it to an OpenCode file part,
+// enforcing the configured size limit and MIME allowlist.
+func (b *Bot) downloadAttachment(c telebot.Context, file *telebot.File, filename, mimeType string) (opencode.MessagePart, error) {
+	cfg := b.attachmentsConfig()
+	limit := int64(cfg.MaxSizeMB) * 1024 * 1024
+	if file.FileSize > limit {
+		return opencode.MessagePart{}, fmt.Errorf("%s is too large (%s, limit %d MB)", filename, formatByteSize(file.FileSize), cfg.MaxSizeMB)
+	}
+
+	// Reject by declared type before downloading when Telegram knows it.
+	declared := normalizeMIME(mimeType)
+	if declared != "" && declared != "application/octet-stream" && !cfg.AllowsMIME(declared) {
+		return opencode.MessagePart{}, fmt.Errorf("file type %s is not allowed", declared)
+	}
+
+	reader, err := c.Bot().File(file)
+	if err != nil {
+		log.Errorf("Failed to download Telegram file %s: %v", file.FileID, err)
+		return opencode.MessagePart{}, fmt.Errorf("failed to download %s: %v", filename, err)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return opencode.MessagePart{}, fmt.Errorf("failed to download %s: %v", filename, err)
+	}
+	if int64(len(data)) > limit {
+		return opencode.MessagePart{}, fmt.Errorf("%s is too large (limit %d MB)", filename, cfg.MaxSizeMB)
+	}
+
+	detected := detectAttachmentMIME(declared, filename, data)
+	if !cfg.AllowsMIME(detected) {
+		return opencode.MessagePart{}, fmt.Errorf("file type %s is not allowed", detected)
+	}
+
+	log.Infof("Forwarding Telegram attachment to OpenCode: name=%s mime=%s size=%d", filename, detected, len(data))
+	return opencode.NewFilePart(detected, filename, data), nil
+}
+
+// detectAttachmentMIME resolves generic or missing MIME types from the file
+// extension, then from the content itself.
+func detectAttachmentMIME(declared, filename string, data []byte) string {
+	if declared != "" && declared != "application/octet-stream" {
+		return declared
+	}
+	if byExt := normalizeMIME(mime.TypeByExtension(strings.ToLower(filepath.Ext(filename)))); byExt != "" {
+		return byExt
+	}
+	return normalizeMIME(http.DetectContentType(data))
+}
+
+// normalizeMIME lowercases mimeType and strips parameters such as charset.
+func normalizeMIME(mimeType string) string {
+	mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+	if i := strings.IndexByte(mimeType, ';'); i >= 0 {
+		mimeType = strings.TrimSpace(mimeType[:i])
+	}
+	return mimeType
+}
+
+func formatByteSize(size int64) string {
+	switch {
+	case size >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1024*1024))
+	case size >= 1024:
+		return fmt.Sprintf("%.1f KB", float64(size)/1024)
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+
+	"tg-bot/internal/config"
+
+	"gopkg.in/telebot.v4"
+)
+
+func TestDetectAttachmentMIME(t *testing.T) {
+	tests := []struct {
+		name     string
+		declared string
+		filename string
+		data     string
+		want     string
+	}{
+		{"declared type wins", "image/png", "shot.bin", "", "image/png"},
+		{"generic type falls back to extension", "application/octet-stream", "fix.json", "{}", "application/json"},
+		{"unknown extension sniffs content", "", "crash.log123", "panic: boom\n", "text/plain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectAttachmentMIME(tt.declared, tt.filename, []byte(tt.data)); got != tt.want {
+				t.Fatalf("detectAttachmentMIME() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownloadAttachment_RejectsBeforeDownloading(t *testing.T) {
+	tgBot, recorder := newTestTelegramBot(t)
+	b := &Bot{config: &config.Config{Attachments: config.AttachmentsConfig{
+		MaxSizeMB:        1,
+		AllowedMimeTypes: []string{"text/*"},
+	}}}
+	c := newTestMessageContext(tgBot, 1, 1, telebot.ChatPrivate, "")
+
+	_, err := b.downloadAttachment(c, &telebot.File{FileID: "big", FileSize: 2 * 1024 * 1024}, "big.txt", "text/plain")
+	if err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Fatalf("expected size limit error, got %v", err)
+	}
+
+	_, err = b.downloadAttachment(c, &telebot.File{FileID: "pdf", FileSize: 10}, "doc.pdf", "application/pdf")
+	if err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Fatalf("expected MIME type error, got %v", err)
+	}
+
+	if calls := recorder.Calls("getFile"); len(calls) != 0 {
+		t.Fatalf("rejected files must not be downloaded, got %d getFile calls", len(calls))
+	}
+}
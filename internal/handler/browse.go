@@ -0,0 +1,344 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/telebot.v4"
+)
+
+const (
+	browseCallbackUnique = "browse"
+	browsePageSize       = 10
+	browseMaxResults     = 200
+
+	// Result sets are kept in memory so buttons only need to carry a short token.
+	browseResultTTL        = 30 * time.Minute
+	browseMaxCachedResults = 64
+)
+
+// browseEntry is one tappable line of a /ls, /find or /grep result.
+type browseEntry struct {
+	Label string
+	Path  string // relative to the project directory
+	IsDir bool
+}
+
+type browseResult struct {
+	title     string
+	directory string
+	entries   []browseEntry
+	createdAt time.Time
+	seq       uint64
+}
+
+// browseCache holds recent result sets keyed by random tokens.
+type browseCache struct {
+	mu      sync.Mutex
+	results map[string]*browseResult
+	nextSeq uint64
+}
+
+func (bc *browseCache) put(result *browseResult) string {
+	token := make([]byte, 6)
+	if _, err := rand.Read(token); err != nil {
+		log.Warnf("Failed to generate browse token: %v", err)
+	}
+	key := hex.EncodeToString(token)
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if bc.results == nil {
+		bc.results = make(map[string]*browseResult)
+	}
+
+	now := time.Now()
+	bc.nextSeq++
+	result.createdAt = now
+	result.seq = bc.nextSeq
+	for k, r := range bc.results {
+		if now.Sub(r.createdAt) > browseResultTTL {
+			delete(bc.results, k)
+		}
+	}
+	if len(bc.results) >= browseMaxCachedResults {
+		oldestKey := ""
+		for k, r := range bc.results {
+			if oldestKey == "" || r.seq < bc.results[oldestKey].seq {
+				oldestKey = k
+			}
+		}
+		delete(bc.results, oldestKey)
+	}
+	bc.results[key] = result
+	return key
+}
+
+func (bc *browseCache) get(token string) (*browseResult, bool) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	result, ok := bc.results[token]
+	if !ok || time.Since(result.createdAt) > browseResultTTL {
+		return nil, false
+	}
+	return result, true
+}
+
+// renderBrowsePage formats one page of result with open and pagination buttons.
+func renderBrowsePage(token string, result *browseResult, page int) (string, *telebot.ReplyMarkup) {
+	start, end, page, pages := pageBounds(len(result.entries), page, browsePageSize)
+
+	var sb strings.Builder
+	sb.WriteString(result.title)
+	if pages > 1 {
+		fmt.Fprintf(&sb, " (page %d/%d)", page+1, pages)
+	}
+	sb.WriteString("\n\n")
+	if len(result.entries) == 0 {
+		sb.WriteString("No results.")
+		return sb.String(), nil
+	}
+
+	markup := &telebot.ReplyMarkup{}
+	var rows []telebot.Row
+	for i := start; i < end; i++ {
+		entry := result.entries[i]
+		fmt.Fprintf(&sb, "%d. %s\n", i+1, entry.Label)
+
+		icon := "📄"
+		if entry.IsDir {
+			icon = "📁"
+		}
+		buttonText := fmt.Sprintf("%s %d. %s", icon, i+1, callbackButtonText(path.Base(entry.Path), 32))
+		rows = append(rows, markup.Row(markup.Data(buttonText, browseCallbackUnique, "open", token, strconv.Itoa(i))))
+	}
+
+	if pages > 1 {
+		nav := telebot.Row{}
+		if page > 0 {
+			nav = append(nav, markup.Data("◀️ Prev", browseCallbackUnique, "page", token, strconv.Itoa(page-1)))
+		}
+		nav = append(nav, markup.Data(fmt.Sprintf("%d/%d", page+1, pages), browseCallbackUnique, "page", token, strconv.Itoa(page)))
+		if page < pages-1 {
+			nav = append(nav, markup.Data("Next ▶️", browseCallbackUnique, "page", token, strconv.Itoa(page+1)))
+		}
+		rows = append(rows, nav)
+	}
+	markup.Inline(rows...)
+	return strings.TrimRight(sb.String(), "\n"), markup
+}
+
+// listDirectoryResult lists relDir with directories first.
+func (b *Bot) listDirectoryResult(ctx context.Context, directory, relDir string) (*browseResult, error) {
+	nodes, err := b.opencodeClient.ListFiles(ctx, directory, relDir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		leftDir, rightDir := nodes[i].Type == "directory", nodes[j].Type == "directory"
+		if leftDir != rightDir {
+			return leftDir
+		}
+		return strings.ToLower(nodes[i].Name) < strings.ToLower(nodes[j].Name)
+	})
+
+	result := &browseResult{
+		title:     fmt.Sprintf("📁 %s", displayWorkspacePath(relDir)),
+		directory: directory,
+	}
+	for _, node := range nodes {
+		isDir := node.Type == "directory"
+		label := node.Name
+		if isDir {
+			label += "/"
+		}
+		if node.Ignored {
+			label += " (ignored)"
+		}
+		entryPath := node.Path
+		if entryPath == "" {
+			entryPath = path.Join(relDir, node.Name)
+		}
+		result.entries = append(result.entries, browseEntry{Label: label, Path: entryPath, IsDir: isDir})
+	}
+	return result, nil
+}
+
+func displayWorkspacePath(relPath string) string {
+	if relPath == "" || relPath == "." {
+		return "./"
+	}
+	return relPath
+}
+
+// findGlobQuery extracts the literal part of a glob for OpenCode's fuzzy file search.
+func findGlobQuery(glob string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '*', '?', '[', ']':
+			return -1
+		}
+		return r
+	}, glob)
+}
+
+// matchFindGlob reports whether filePath matches glob by full path or base name.
+// Patterns without glob syntax match every result OpenCode returned.
+func matchFindGlob(glob, filePath string) bool {
+	if !strings.ContainsAny(glob, "*?[") {
+		return true
+	}
+	filePath = strings.TrimSuffix(filePath, "/")
+	if ok, _ := path.Match(glob, filePath); ok {
+		return true
+	}
+	ok, _ := path.Match(glob, path.Base(filePath))
+	return ok
+}
+
+// startBrowse resolves the caller's project and posts the first page of a result.
+func (b *Bot) startBrowse(c telebot.Context, build func(ctx context.Context, directory string) (*browseResult, error)) error {
+	ctx, cancel := context.WithTimeout(b.ctx, 30*time.Second)
+	defer cancel()
+
+	_, directory, err := b.currentSessionDirectory(ctx, c.Sender().ID)
+	if err != nil {
+		return c.Send(fmt.Sprintf("❌ %v", err))
+	}
+	result, err := build(ctx, directory)
+	if err != nil {
+		log.Errorf("Failed to browse project: %v", err)
+		return c.Send(fmt.Sprintf("❌ %v", err))
+	}
+
+	text, markup := renderBrowsePage(b.browse.put(result), result, 0)
+	return c.Send(text, markup)
+}
+
+// handleLs handles the /ls command
+func (b *Bot) handleLs(c telebot.Context) error {
+	input := strings.TrimSpace(c.Message().Payload)
+	return b.startBrowse(c, func(ctx context.Context, directory string) (*browseResult, error) {
+		relDir := "."
+		if input != "" {
+			resolved, err := resolveWorkspacePath(directory, input)
+			if err != nil {
+				return nil, err
+			}
+			relDir = resolved
+		}
+		return b.listDirectoryResult(ctx, directory, relDir)
+	})
+}
+
+// handleFind handles the /find command
+func (b *Bot) handleFind(c telebot.Context) error {
+	glob := strings.TrimSpace(c.Message().Payload)
+	if glob == "" {
+		return c.Send("Usage: /find <glob>\nExample: /find *.go")
+	}
+	return b.startBrowse(c, func(ctx context.Context, directory string) (*browseResult, error) {
+		paths, err := b.opencodeClient.FindFiles(ctx, directory, findGlobQuery(glob), false, browseMaxResults)
+		if err != nil {
+			return nil, err
+		}
+		result := &browseResult{title: fmt.Sprintf("🔎 Files matching %s", glob), directory: directory}
+		for _, p := range paths {
+			if !matchFindGlob(glob, p) {
+				continue
+			}
+			result.entries = append(result.entries, browseEntry{Label: p, Path: p})
+		}
+		return result, nil
+	})
+}
+
+// handleGrep handles the /grep command
+func (b *Bot) handleGrep(c telebot.Context) error {
+	pattern := strings.TrimSpace(c.Message().Payload)
+	if pattern == "" {
+		return c.Send("Usage: /grep <pattern>\nExample: /grep func main")
+	}
+	return b.startBrowse(c, func(ctx context.Context, directory string) (*browseResult, error) {
+		matches, err := b.opencodeClient.FindText(ctx, directory, pattern)
+		if err != nil {
+			return nil, err
+		}
+		result := &browseResult{title: fmt.Sprintf("🔎 Lines matching %s", pattern), directory: directory}
+		for _, match := range matches {
+			if len(result.entries) >= browseMaxResults {
+				break
+			}
+			label := fmt.Sprintf("%s:%d: %s", match.Path.Text, match.LineNumber, truncateAndInline(strings.TrimSpace(match.Lines.Text), 80))
+			result.entries = append(result.entries, browseEntry{Label: label, Path: match.Path.Text})
+		}
+		return result, nil
+	})
+}
+
+// handleBrowseCallback handles result paging and taps on /ls, /find and /grep entries.
+func (b *Bot) handleBrowseCallback(c telebot.Context) error {
+	parts := strings.Split(c.Callback().Data, "|")
+	if len(parts) != 3 {
+		return c.Respond(&telebot.CallbackResponse{Text: "Invalid button."})
+	}
+	action, token := parts[0], parts[1]
+	index, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "Invalid button."})
+	}
+
+	result, ok := b.browse.get(token)
+	if !ok {
+		return c.Respond(&telebot.CallbackResponse{Text: "These results have expired. Run the command again.", ShowAlert: true})
+	}
+
+	switch action {
+	case "page":
+		text, markup := renderBrowsePage(token, result, index)
+		if err := c.Edit(text, markup); err != nil && !isMessageNotModifiedError(err) {
+			return err
+		}
+		return c.Respond(&telebot.CallbackResponse{})
+	case "open":
+		if index < 0 || index >= len(result.entries) {
+			return c.Respond(&telebot.CallbackResponse{Text: "Invalid button."})
+		}
+		entry := result.entries[index]
+		relPath, err := resolveWorkspacePath(result.directory, entry.Path)
+		if err != nil {
+			return c.Respond(&telebot.CallbackResponse{Text: err.Error(), ShowAlert: true})
+		}
+
+		ctx, cancel := context.WithTimeout(b.ctx, 30*time.Second)
+		defer cancel()
+
+		if entry.IsDir {
+			listing, err := b.listDirectoryResult(ctx, result.directory, relPath)
+			if err != nil {
+				return c.Respond(&telebot.CallbackResponse{Text: fmt.Sprintf("Failed to list %s: %v", relPath, err), ShowAlert: true})
+			}
+			text, markup := renderBrowsePage(b.browse.put(listing), listing, 0)
+			if err := c.Edit(text, markup); err != nil && !isMessageNotModifiedError(err) {
+				return err
+			}
+			return c.Respond(&telebot.CallbackResponse{})
+		}
+
+		if err := c.Respond(&telebot.CallbackResponse{Text: relPath}); err != nil {
+			log.Warnf("Failed to answer browse callback: %v", err)
+		}
+		return b.sendWorkspaceFile(ctx, c, result.directory, relPath)
+	default:
+		return c.Respond(&telebot.CallbackResponse{Text: "Unknown action."})
+	}
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestMatchFindGlob(t *testing.T) {
+	tests := []struct {
+		glob, path string
+		want       bool
+	}{
+		{"*.go", "internal/handler/browse.go", true},
+		{"*.go", "README.md", false},
+		{"internal/*/browse.go", "internal/handler/browse.go", true},
+		{"handler", "internal/handler/browse.go", true},
+		{"browse_?est.go", "internal/handler/browse_test.go", true},
+	}
+	for _, tt := range tests {
+		if got := matchFindGlob(tt.glob, tt.path); got != tt.want {
+			t.Errorf("matchFindGlob(%q, %q) = %v, want %v", tt.glob, tt.path, got, tt.want)
+		}
+	}
+
+	if got := findGlobQuery("internal/*/[ab]rowse?.go"); got != "internal//abrowse.go" {
+		t.Errorf("findGlobQuery() = %q", got)
+	}
+}
+
+func TestBrowseCache_EvictsOldestResult(t *testing.T) {
+	var cache browseCache
+	first := cache.put(&browseResult{title: "first"})
+	for i := 1; i < browseMaxCachedResults; i++ {
+		cache.put(&browseResult{title: fmt.Sprintf("r%d", i)})
+	}
+	if _, ok := cache.get(first); !ok {
+		t.Fatal("cache should still hold the first result at capacity")
+	}
+
+	latest := cache.put(&browseResult{title: "latest"})
+	if _, ok := cache.get(first); ok {
+		t.Fatal("oldest result should be evicted beyond capacity")
+	}
+	if result, ok := cache.get(latest); !ok || result.title != "latest" {
+		t.Fatal("latest result should be retrievable")
+	}
+}
+
+func TestRenderBrowsePage_Pagination(t *testing.T) {
+	result := &browseResult{title: "📁 ./"}
+	for i := 0; i < 25; i++ {
+		result.entries = append(result.entries, browseEntry{Label: fmt.Sprintf("file%02d.go", i), Path: fmt.Sprintf("pkg/file%02d.go", i)})
+	}
+
+	text, markup := renderBrowsePage("0123456789ab", result, 2)
+	if !strings.Contains(text, "(page 3/3)") || !strings.Contains(text, "21. file20.go") {
+		t.Fatalf("unexpected page text:\n%s", text)
+	}
+	if len(markup.InlineKeyboard) != 6 {
+		t.Fatalf("expected 5 entry rows and a navigation row, got %d rows", len(markup.InlineKeyboard))
+	}
+	nav := markup.InlineKeyboard[5]
+	if len(nav) != 2 || nav[0].Text != "◀️ Prev" {
+		t.Fatalf("last page should only offer Prev, got %#v", nav)
+	}
+	for _, row := range markup.InlineKeyboard {
+		for _, button := range row {
+			if len("\f"+browseCallbackUnique+"|"+button.Data) > maxCallbackDataLen {
+				t.Fatalf("callback data %q exceeds Telegram limit", button.Data)
+			}
+		}
+	}
+
+	empty, markup := renderBrowsePage("tok", &browseResult{title: "🔎 Files matching *.rs"}, 0)
+	if markup != nil || !strings.Contains(empty, "No results.") {
+		t.Fatalf("empty result should have no keyboard, got %q", empty)
+	}
+}
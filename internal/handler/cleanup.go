@@ -0,0 +1,227 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"tg-bot/internal/session"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/telebot.v4"
+)
+
+// cleanupListLimit caps the sessions listed in one cleanup message, keeping
+// it under Telegram's message size limit.
+const cleanupListLimit = 40
+
+// cleanupStartupDelay is how long after startup the janitor runs its first
+// pass, so a bot restarted more often than interval_hours still cleans up.
+const cleanupStartupDelay = time.Minute
+
+// startSessionJanitor cleans up sessions older than cleanup.max_age_days
+// shortly after startup and then periodically until the bot is closed.
+func (b *Bot) startSessionJanitor() {
+	cfg := b.config.Cleanup
+	if cfg.MaxAgeDays <= 0 || cfg.IntervalHours <= 0 {
+		return
+	}
+	maxAge := cleanupMaxAge(cfg.MaxAgeDays)
+	interval := time.Duration(cfg.IntervalHours) * time.Hour
+	log.Infof("Cleaning up sessions unused for %d days every %d hours", cfg.MaxAgeDays, cfg.IntervalHours)
+
+	go func() {
+		timer := time.NewTimer(cleanupStartupDelay)
+		defer timer.Stop()
+		for {
+			select {
+			case <-b.ctx.Done():
+				return
+			case <-timer.C:
+				b.cleanupInactiveSessions(maxAge, false)
+				timer.Reset(interval)
+			}
+		}
+	}()
+}
+
+func cleanupMaxAge(days int) time.Duration {
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// cleanupInactiveSessions removes sessions unused for maxAge, optionally
+// deletes them in OpenCode, and tells each owner what was cleaned. A dry run
+// only lists what would be removed.
+func (b *Bot) cleanupInactiveSessions(maxAge time.Duration, dryRun bool) []*session.SessionMeta {
+	candidates := b.sessionManager.InactiveSessions(maxAge)
+	if dryRun || len(candidates) == 0 {
+		return candidates
+	}
+
+	removed := make(map[string]bool)
+	for _, sessionID := range b.sessionManager.CleanupInactiveSessions(maxAge) {
+		removed[sessionID] = true
+	}
+	// A session used since it was listed is kept, so report only what went.
+	var cleaned []*session.SessionMeta
+	for _, meta := range candidates {
+		if removed[meta.SessionID] {
+			cleaned = append(cleaned, meta)
+		}
+	}
+
+	if b.config.Cleanup.DeleteOpenCodeSessions {
+		b.deleteCleanedOpenCodeSessions(cleaned)
+	}
+	b.notifyCleanedSessions(cleaned, maxAge)
+	return cleaned
+}
+
+// deleteCleanedOpenCodeSessions deletes cleaned sessions in OpenCode. Sessions
+// without an owner were not created through the bot and are left alone.
+func (b *Bot) deleteCleanedOpenCodeSessions(cleaned []*session.SessionMeta) {
+	for _, meta := range cleaned {
+		if meta.UserID == 0 {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(b.ctx, 30*time.Second)
+		err := b.opencodeClient.DeleteSession(ctx, meta.SessionID)
+		cancel()
+		if err != nil {
+			log.Warnf("Failed to delete inactive session %s from OpenCode: %v", meta.SessionID, err)
+			continue
+		}
+		log.Infof("Deleted inactive session %s from OpenCode", meta.SessionID)
+	}
+}
+
+// notifyCleanedSessions tells each owner which of their sessions were cleaned up.
+func (b *Bot) notifyCleanedSessions(cleaned []*session.SessionMeta, maxAge time.Duration) {
+	if b.tgBot == nil {
+		return
+	}
+	for userID, sessions := range sessionsByOwner(cleaned) {
+		if userID == 0 {
+			continue
+		}
+		text := formatCleanupNotice(sessions, maxAge, b.config.Cleanup.DeleteOpenCodeSessions)
+		if _, err := b.tgBot.Send(telebot.ChatID(userID), text); err != nil {
+			log.Warnf("Failed to notify user %d about cleaned sessions: %v", userID, err)
+		}
+	}
+}
+
+func sessionsByOwner(sessions []*session.SessionMeta) map[int64][]*session.SessionMeta {
+	byOwner := make(map[int64][]*session.SessionMeta)
+	for _, meta := range sessions {
+		byOwner[meta.UserID] = append(byOwner[meta.UserID], meta)
+	}
+	return byOwner
+}
+
+func cleanupSessionLabel(meta *session.SessionMeta) string {
+	name := meta.Name
+	if name == "" {
+		name = "Unnamed"
+	}
+	return fmt.Sprintf("%s (%s), last used %s", name, meta.SessionID, meta.LastUsedAt.Format("2006-01-02"))
+}
+
+// writeCleanupList lists sessions until limit entries have been written and
+// returns how many it wrote.
+func writeCleanupList(sb *strings.Builder, sessions []*session.SessionMeta, limit int) int {
+	for i, meta := range sessions {
+		if i == limit {
+			fmt.Fprintf(sb, "• …and %d more\n", len(sessions)-i)
+			return i
+		}
+		fmt.Fprintf(sb, "• %s\n", cleanupSessionLabel(meta))
+	}
+	return len(sessions)
+}
+
+// formatCleanupNotice is the message sent to a user whose sessions were cleaned up.
+func formatCleanupNotice(sessions []*session.SessionMeta, maxAge time.Duration, deletedInOpenCode bool) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🧹 %d of your sessions went unused for %d days and were cleaned up:\n\n", len(sessions), int(maxAge.Hours()/24))
+	writeCleanupList(&sb, sessions, cleanupListLimit)
+	if deletedInOpenCode {
+		sb.WriteString("\nThey were deleted in OpenCode as well.")
+	} else {
+		sb.WriteString("\nThey are still available in OpenCode.")
+	}
+	sb.WriteString(" Your next message starts a new session if your current one was among them.")
+	return sb.String()
+}
+
+// formatCleanupReport is the /cleanup reply, listing sessions by owner.
+func formatCleanupReport(sessions []*session.SessionMeta, maxAge time.Duration, dryRun, deleteInOpenCode bool) string {
+	days := int(maxAge.Hours() / 24)
+	if len(sessions) == 0 {
+		return fmt.Sprintf("🧹 No sessions have gone unused for %d days.", days)
+	}
+
+	var sb strings.Builder
+	if dryRun {
+		fmt.Fprintf(&sb, "🧹 Dry run: %d session(s) unused for %d days would be cleaned up.\n", len(sessions), days)
+	} else {
+		fmt.Fprintf(&sb, "🧹 Cleaned up %d session(s) unused for %d days.\n", len(sessions), days)
+	}
+
+	byOwner := sessionsByOwner(sessions)
+	owners := make([]int64, 0, len(byOwner))
+	for userID := range byOwner {
+		owners = append(owners, userID)
+	}
+	sort.Slice(owners, func(i, j int) bool { return owners[i] < owners[j] })
+	listed := 0
+	for _, userID := range owners {
+		if userID == 0 {
+			sb.WriteString("\nNo owner:\n")
+		} else {
+			fmt.Fprintf(&sb, "\nUser %d:\n", userID)
+		}
+		listed += writeCleanupList(&sb, byOwner[userID], max(cleanupListLimit-listed, 0))
+	}
+
+	switch {
+	case dryRun && deleteInOpenCode:
+		sb.WriteString("\nOwned sessions would also be deleted in OpenCode. Nothing was changed; run /cleanup to clean them up.")
+	case dryRun:
+		sb.WriteString("\nNothing was changed; run /cleanup to clean them up.")
+	case deleteInOpenCode:
+		sb.WriteString("\nOwned sessions were also deleted in OpenCode and their owners notified.")
+	default:
+		sb.WriteString("\nTheir owners were notified.")
+	}
+	return sb.String()
+}
+
+// handleCleanup handles the /cleanup command
+func (b *Bot) handleCleanup(c telebot.Context) error {
+	usage := "Usage: /cleanup [--dry-run] [days]\nExample: /cleanup --dry-run 30"
+	dryRun := false
+	days := b.config.Cleanup.MaxAgeDays
+	for _, arg := range c.Args() {
+		if arg == "--dry-run" {
+			dryRun = true
+			continue
+		}
+		n, err := strconv.Atoi(arg)
+		if err != nil || n <= 0 {
+			return c.Send(usage)
+		}
+		days = n
+	}
+	if days <= 0 {
+		return c.Send("Automatic cleanup is off because cleanup.max_age_days is not set, so give an age in days.\n\n" + usage)
+	}
+
+	maxAge := cleanupMaxAge(days)
+	log.Infof("User %d running session cleanup: max_age=%dd dry_run=%t", c.Sender().ID, days, dryRun)
+	cleaned := b.cleanupInactiveSessions(maxAge, dryRun)
+	return c.Send(formatCleanupReport(cleaned, maxAge, dryRun, b.config.Cleanup.DeleteOpenCodeSessions))
+}
@@ -0,0 +1,255 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tg-bot/internal/config"
+	"tg-bot/internal/opencode"
+	"tg-bot/internal/session"
+	"tg-bot/internal/storage"
+
+	"gopkg.in/telebot.v4"
+)
+
+func TestHandleCleanup_DryRunThenClean(t *testing.T) {
+	var mu sync.Mutex
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/session/") {
+			mu.Lock()
+			deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/session/"))
+			mu.Unlock()
+			_, _ = w.Write([]byte("true"))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	store, err := storage.NewStore(storage.Options{
+		Type:     "file",
+		FilePath: filepath.Join(t.TempDir(), "bot-state.json"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	now := time.Now()
+	for _, meta := range []*storage.SessionMeta{
+		{SessionID: "ses_old", UserID: 42, Name: "Old work", LastUsedAt: now.Add(-40 * 24 * time.Hour)},
+		{SessionID: "ses_new", UserID: 42, Name: "Current work", LastUsedAt: now},
+		{SessionID: "ses_other", UserID: 43, Name: "Side project", LastUsedAt: now.Add(-35 * 24 * time.Hour)},
+		{SessionID: "ses_tui", Name: "From the TUI", LastUsedAt: now.Add(-60 * 24 * time.Hour)},
+	} {
+		if err := store.StoreSessionMeta(meta); err != nil {
+			t.Fatalf("failed to store session meta: %v", err)
+		}
+	}
+	if err := store.StoreUserSession(43, "ses_other"); err != nil {
+		t.Fatalf("failed to store user session: %v", err)
+	}
+
+	client := opencode.NewClient(server.URL, 5)
+	tgBot, recorder := newTestTelegramBot(t)
+	b := &Bot{
+		config:         &config.Config{Cleanup: config.CleanupConfig{MaxAgeDays: 30, DeleteOpenCodeSessions: true}},
+		tgBot:          tgBot,
+		ctx:            context.Background(),
+		opencodeClient: client,
+		sessionManager: session.NewManagerWithStore(client, store),
+	}
+	cleanupCommand := func(args ...string) telebot.Context {
+		return tgBot.NewContext(telebot.Update{
+			Message: &telebot.Message{
+				ID:      1,
+				Sender:  &telebot.User{ID: 1},
+				Chat:    &telebot.Chat{ID: 1, Type: telebot.ChatPrivate},
+				Text:    strings.TrimSpace("/cleanup " + strings.Join(args, " ")),
+				Payload: strings.Join(args, " "),
+			},
+		})
+	}
+
+	if err := b.handleCleanup(cleanupCommand("--dry-run")); err != nil {
+		t.Fatalf("handleCleanup failed: %v", err)
+	}
+	sent := recorder.Calls("sendMessage")
+	if len(sent) != 1 {
+		t.Fatalf("dry run should only reply to the admin, got %#v", sent)
+	}
+	for _, want := range []string{"Dry run: 3 session(s)", "User 42", "Old work", "User 43", "No owner", "Nothing was changed"} {
+		if !strings.Contains(sent[0].Body, want) {
+			t.Fatalf("dry run report should contain %q: %s", want, sent[0].Body)
+		}
+	}
+	if strings.Contains(sent[0].Body, "Current work") {
+		t.Fatalf("recently used session must not be listed: %s", sent[0].Body)
+	}
+	if sessions, _ := store.ListSessions(); len(sessions) != 4 || len(deleted) != 0 {
+		t.Fatalf("dry run must not change anything, got %d sessions and deletes %v", len(sessions), deleted)
+	}
+
+	if err := b.handleCleanup(cleanupCommand()); err != nil {
+		t.Fatalf("handleCleanup failed: %v", err)
+	}
+	sessions, _ := store.ListSessions()
+	if len(sessions) != 1 || sessions[0].SessionID != "ses_new" {
+		t.Fatalf("expected only ses_new to remain, got %#v", sessions)
+	}
+	if _, exists, _ := store.GetUserSession(43); exists {
+		t.Fatalf("current session mapping of a cleaned session should be removed")
+	}
+	mu.Lock()
+	sort.Strings(deleted)
+	gotDeleted := strings.Join(deleted, ",")
+	mu.Unlock()
+	if gotDeleted != "ses_old,ses_other" {
+		t.Fatalf("expected the owned sessions ses_old and ses_other deleted in OpenCode, got %v", deleted)
+	}
+
+	sent = recorder.Calls("sendMessage")
+	if len(sent) != 4 {
+		t.Fatalf("expected two owner notices and two admin replies, got %#v", sent)
+	}
+	var notices []string
+	for _, call := range sent[1:] {
+		if strings.Contains(call.Body, "of your sessions") {
+			notices = append(notices, call.Body)
+		}
+	}
+	if len(notices) != 2 {
+		t.Fatalf("expected a notice per owner, got %#v", sent[1:])
+	}
+	for _, notice := range notices {
+		switch {
+		case strings.Contains(notice, `"chat_id":"42"`):
+			if !strings.Contains(notice, "Old work") || strings.Contains(notice, "Side project") {
+				t.Fatalf("unexpected notice for user 42: %s", notice)
+			}
+		case strings.Contains(notice, `"chat_id":"43"`):
+			if !strings.Contains(notice, "Side project") || strings.Contains(notice, "Old work") {
+				t.Fatalf("unexpected notice for user 43: %s", notice)
+			}
+		default:
+			t.Fatalf("notice sent to an unexpected chat: %s", notice)
+		}
+	}
+	if !strings.Contains(sent[3].Body, "Cleaned up 3 session(s)") {
+		t.Fatalf("unexpected admin reply: %s", sent[3].Body)
+	}
+}
+
+func TestHandleCleanup_RequiresAge(t *testing.T) {
+	store, err := storage.NewStore(storage.Options{
+		Type:     "file",
+		FilePath: filepath.Join(t.TempDir(), "bot-state.json"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	tgBot, recorder := newTestTelegramBot(t)
+	b := &Bot{
+		config:         &config.Config{},
+		ctx:            context.Background(),
+		sessionManager: session.NewManagerWithStore(nil, store),
+	}
+	for _, payload := range []string{"", "soon", "--dry-run 0"} {
+		c := tgBot.NewContext(telebot.Update{
+			Message: &telebot.Message{
+				ID:      1,
+				Sender:  &telebot.User{ID: 1},
+				Chat:    &telebot.Chat{ID: 1, Type: telebot.ChatPrivate},
+				Text:    "/cleanup " + payload,
+				Payload: payload,
+			},
+		})
+		if err := b.handleCleanup(c); err != nil {
+			t.Fatalf("handleCleanup failed: %v", err)
+		}
+	}
+	for _, call := range recorder.Calls("sendMessage") {
+		if !strings.Contains(call.Body, "Usage: /cleanup") {
+			t.Fatalf("expected usage, got %s", call.Body)
+		}
+	}
+}
+
+func TestCleanupInactiveSessions_SurvivesSync(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-40 * 24 * time.Hour).UnixMilli()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.URL.Path == "/session" {
+			fmt.Fprintf(w, `[
+				{"id": "ses_known", "title": "Old work", "time": {"created": %[1]d, "updated": %[1]d}, "metadata": {"telegram_user_id": 42}},
+				{"id": "ses_new", "title": "Old TUI work", "time": {"created": %[1]d, "updated": %[1]d}},
+				{"id": "ses_fresh", "title": "Current work", "time": {"created": %[2]d, "updated": %[2]d}}
+			]`, old, now.UnixMilli())
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	store, err := storage.NewStore(storage.Options{
+		Type:     "file",
+		FilePath: filepath.Join(t.TempDir(), "bot-state.json"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	if err := store.StoreSessionMeta(&storage.SessionMeta{SessionID: "ses_known", UserID: 42, Name: "Old work", LastUsedAt: now.Add(-40 * 24 * time.Hour)}); err != nil {
+		t.Fatalf("failed to store session meta: %v", err)
+	}
+
+	client := opencode.NewClient(server.URL, 5)
+	tgBot, recorder := newTestTelegramBot(t)
+	b := &Bot{
+		config:         &config.Config{Cleanup: config.CleanupConfig{MaxAgeDays: 30}},
+		tgBot:          tgBot,
+		ctx:            context.Background(),
+		opencodeClient: client,
+		sessionManager: session.NewManagerWithStore(client, store),
+	}
+	maxAge := cleanupMaxAge(30)
+
+	if err := b.sessionManager.SyncSessions(context.Background()); err != nil {
+		t.Fatalf("SyncSessions failed: %v", err)
+	}
+	cleaned := b.cleanupInactiveSessions(maxAge, false)
+	if len(cleaned) != 2 {
+		t.Fatalf("syncing must not make old sessions look used, got %d cleaned", len(cleaned))
+	}
+	if sessions, _ := store.ListSessions(); len(sessions) != 1 || sessions[0].SessionID != "ses_fresh" {
+		t.Fatalf("expected only ses_fresh to remain, got %#v", sessions)
+	}
+	if sent := recorder.Calls("sendMessage"); len(sent) != 1 || !strings.Contains(sent[0].Body, "Old work") {
+		t.Fatalf("expected one notice to the owner, got %#v", sent)
+	}
+
+	// Sessions left in OpenCode are not picked up again, so owners are told once.
+	if err := b.sessionManager.SyncSessions(context.Background()); err != nil {
+		t.Fatalf("SyncSessions failed: %v", err)
+	}
+	if sessions, _ := store.ListSessions(); len(sessions) != 1 {
+		t.Fatalf("cleaned sessions must not be re-imported, got %#v", sessions)
+	}
+	if cleaned := b.cleanupInactiveSessions(maxAge, false); len(cleaned) != 0 {
+		t.Fatalf("expected nothing left to clean, got %#v", cleaned)
+	}
+	if sent := recorder.Calls("sendMessage"); len(sent) != 1 {
+		t.Fatalf("owners must not be notified again, got %#v", sent)
+	}
+}
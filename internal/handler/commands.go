@@ -0,0 +1,232 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"tg-bot/internal/opencode"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/telebot.v4"
+)
+
+// Telegram accepts at most 100 menu commands with descriptions of 3-256 characters.
+const (
+	telegramMaxMenuCommands     = 100
+	telegramMaxCommandNameLen   = 32
+	telegramMaxCommandDescLen   = 256
+	openCodeCommandFallbackDesc = "OpenCode command"
+)
+
+// builtinMenuCommands are the bot's own commands shown in Telegram's command menu.
+var builtinMenuCommands = []telebot.Command{
+	{Text: "help", Description: "Show command help"},
+	{Text: "sessions", Description: "List sessions"},
+	{Text: "new", Description: "Create a new session"},
+	{Text: "switch", Description: "Switch current session"},
+	{Text: "profile", Description: "Show current session, model and agent"},
+	{Text: "render", Description: "Set how replies are formatted"},
+	{Text: "rename", Description: "Rename a session"},
+	{Text: "delete", Description: "Delete a session"},
+	{Text: "abort", Description: "Abort the current task"},
+	{Text: "queue", Description: "Show or manage queued prompts"},
+	{Text: "pending", Description: "Show tool permission requests"},
+	{Text: "todos", Description: "Show the agent's todo list"},
+	{Text: "diff", Description: "Show the session's file changes"},
+	{Text: "undo", Description: "Revert the last response"},
+	{Text: "redo", Description: "Restore what /undo reverted"},
+	{Text: "compact", Description: "Summarize the session to free context"},
+	{Text: "fork", Description: "Branch the session at an earlier prompt"},
+	{Text: "cleanup", Description: "Clean up inactive sessions (admin only)"},
+	{Text: "get", Description: "Download a project file"},
+	{Text: "ls", Description: "List a project directory"},
+	{Text: "find", Description: "Find project files by name"},
+	{Text: "grep", Description: "Search project file contents"},
+	{Text: "sh", Description: "Run a shell command (admin only)"},
+	{Text: "models", Description: "List available models"},
+	{Text: "setmodel", Description: "Set model for current session"},
+	{Text: "agents", Description: "List available agents"},
+	{Text: "agent", Description: "Use an agent for current session"},
+	{Text: "commands", Description: "List OpenCode custom commands"},
+}
+
+// openCodeCommands caches the custom commands defined in OpenCode.
+type openCodeCommands struct {
+	mu       sync.RWMutex
+	commands []opencode.Command
+}
+
+func (oc *openCodeCommands) set(commands []opencode.Command) {
+	sorted := append([]opencode.Command(nil), commands...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+	oc.commands = sorted
+}
+
+func (oc *openCodeCommands) all() []opencode.Command {
+	oc.mu.RLock()
+	defer oc.mu.RUnlock()
+	return append([]opencode.Command(nil), oc.commands...)
+}
+
+// lookup finds a command by its OpenCode name or by its Telegram menu name.
+func (oc *openCodeCommands) lookup(name string) (opencode.Command, bool) {
+	oc.mu.RLock()
+	defer oc.mu.RUnlock()
+	for _, cmd := range oc.commands {
+		if cmd.Name == name {
+			return cmd, true
+		}
+	}
+	for _, cmd := range oc.commands {
+		if menuName, ok := telegramCommandName(cmd.Name); ok && menuName == strings.ToLower(name) {
+			return cmd, true
+		}
+	}
+	return opencode.Command{}, false
+}
+
+// telegramCommandName maps an OpenCode command name to the character set
+// Telegram allows in menu commands, e.g. release-notes -> release_notes.
+func telegramCommandName(name string) (string, bool) {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			sb.WriteRune(r)
+		case r == '-' || r == '.' || r == ' ':
+			sb.WriteByte('_')
+		default:
+			return "", false
+		}
+	}
+	menuName := sb.String()
+	if menuName == "" || len(menuName) > telegramMaxCommandNameLen {
+		return "", false
+	}
+	return menuName, true
+}
+
+// parseSlashCommand splits "/name@bot args" into the command name and its arguments.
+func parseSlashCommand(text string) (name, args string, ok bool) {
+	if !strings.HasPrefix(text, "/") {
+		return "", "", false
+	}
+	head, rest := text[1:], ""
+	if i := strings.IndexFunc(head, unicode.IsSpace); i >= 0 {
+		head, rest = head[:i], head[i+1:]
+	}
+	head, _, _ = strings.Cut(head, "@")
+	if head == "" {
+		return "", "", false
+	}
+	return head, strings.TrimSpace(rest), true
+}
+
+// commandMenu combines the built-in commands with OpenCode custom commands.
+// Built-in names win when an OpenCode command maps to the same menu name.
+func commandMenu(custom []opencode.Command) []telebot.Command {
+	menu := append([]telebot.Command(nil), builtinMenuCommands...)
+	seen := make(map[string]bool, len(menu))
+	for _, cmd := range menu {
+		seen[cmd.Text] = true
+	}
+
+	for _, cmd := range custom {
+		if len(menu) >= telegramMaxMenuCommands {
+			log.Warnf("Telegram command menu is full, skipping remaining OpenCode commands")
+			break
+		}
+		menuName, ok := telegramCommandName(cmd.Name)
+		if !ok {
+			log.Debugf("OpenCode command %q cannot be shown in the Telegram menu", cmd.Name)
+			continue
+		}
+		if seen[menuName] {
+			continue
+		}
+		seen[menuName] = true
+
+		description := strings.TrimSpace(strings.ReplaceAll(cmd.Description, "\n", " "))
+		if len(description) < 3 {
+			description = openCodeCommandFallbackDesc
+		}
+		menu = append(menu, telebot.Command{
+			Text:        menuName,
+			Description: truncateAndInline(description, telegramMaxCommandDescLen),
+		})
+	}
+	return menu
+}
+
+// refreshOpenCodeCommands reloads custom commands from OpenCode and updates the Telegram menu.
+func (b *Bot) refreshOpenCodeCommands(ctx context.Context) ([]opencode.Command, error) {
+	commands, err := b.opencodeClient.GetCommands(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b.commands.set(commands)
+
+	if b.tgBot != nil {
+		if err := b.tgBot.SetCommands(commandMenu(b.commands.all())); err != nil {
+			log.Warnf("Failed to update Telegram command menu: %v", err)
+		}
+	}
+	return b.commands.all(), nil
+}
+
+// syncCommandMenu loads OpenCode commands into the Telegram menu at startup.
+func (b *Bot) syncCommandMenu() {
+	ctx, cancel := context.WithTimeout(b.ctx, 30*time.Second)
+	defer cancel()
+	if _, err := b.refreshOpenCodeCommands(ctx); err != nil {
+		log.Warnf("Failed to load OpenCode commands: %v", err)
+	}
+}
+
+// handleCommands handles the /commands command
+func (b *Bot) handleCommands(c telebot.Context) error {
+	ctx, cancel := context.WithTimeout(b.ctx, 30*time.Second)
+	defer cancel()
+
+	commands, err := b.refreshOpenCodeCommands(ctx)
+	if err != nil {
+		log.Errorf("Failed to get OpenCode commands: %v", err)
+		return c.Send(fmt.Sprintf("Failed to get command list: %v", err))
+	}
+
+	var sb strings.Builder
+	sb.WriteString("🛠 OpenCode Commands\n\n")
+	if len(commands) == 0 {
+		sb.WriteString("No custom commands defined.")
+		return c.Send(sb.String())
+	}
+	for _, cmd := range commands {
+		name := cmd.Name
+		if menuName, ok := telegramCommandName(cmd.Name); ok {
+			name = menuName
+		}
+		fmt.Fprintf(&sb, "• /%s", name)
+		if desc := strings.TrimSpace(cmd.Description); desc != "" {
+			fmt.Fprintf(&sb, " - %s", truncateAndInline(desc, 120))
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\nSend /<command> [arguments] to run one in the current session.")
+	return c.Send(sb.String())
+}
+
+// submitCommand runs an OpenCode custom command in the user's current session.
+func (b *Bot) submitCommand(c telebot.Context, cmd opencode.Command, args string) error {
+	return b.submitTask(c, runtimeTaskRequest{
+		Text:    args,
+		Command: cmd.Name,
+	})
+}
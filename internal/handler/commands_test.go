@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"testing"
+
+	"tg-bot/internal/opencode"
+)
+
+func TestTelegramCommandName(t *testing.T) {
+	tests := []struct {
+		input  string
+		want   string
+		wantOK bool
+	}{
+		{"review", "review", true},
+		{"release-notes", "release_notes", true},
+		{"Deploy.Prod", "deploy_prod", true},
+		{"résumé", "", false},
+		{"", "", false},
+		{"this-command-name-is-far-too-long-for-telegram", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := telegramCommandName(tt.input)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("telegramCommandName(%q) = %q, %v; want %q, %v", tt.input, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestParseSlashCommand(t *testing.T) {
+	tests := []struct {
+		text     string
+		wantName string
+		wantArgs string
+		wantOK   bool
+	}{
+		{"/review", "review", "", true},
+		{"/review@opencode_bot main.go  ", "review", "main.go", true},
+		{"/release-notes v1.2.0\nfocus on fixes", "release-notes", "v1.2.0\nfocus on fixes", true},
+		{"/review\nplease", "review", "please", true},
+		{"hello /review", "", "", false},
+		{"/ space", "", "", false},
+	}
+	for _, tt := range tests {
+		name, args, ok := parseSlashCommand(tt.text)
+		if name != tt.wantName || args != tt.wantArgs || ok != tt.wantOK {
+			t.Errorf("parseSlashCommand(%q) = %q, %q, %v; want %q, %q, %v", tt.text, name, args, ok, tt.wantName, tt.wantArgs, tt.wantOK)
+		}
+	}
+}
+
+func TestOpenCodeCommandsLookup(t *testing.T) {
+	var commands openCodeCommands
+	commands.set([]opencode.Command{{Name: "release-notes"}, {Name: "review"}})
+
+	if cmd, ok := commands.lookup("release-notes"); !ok || cmd.Name != "release-notes" {
+		t.Fatalf("expected exact name lookup, got %#v, %v", cmd, ok)
+	}
+	if cmd, ok := commands.lookup("release_notes"); !ok || cmd.Name != "release-notes" {
+		t.Fatalf("expected menu name lookup, got %#v, %v", cmd, ok)
+	}
+	if _, ok := commands.lookup("deploy"); ok {
+		t.Fatal("unknown commands must not match")
+	}
+}
+
+func TestCommandMenu_BuiltinsWinAndInvalidNamesSkipped(t *testing.T) {
+	menu := commandMenu([]opencode.Command{
+		{Name: "help", Description: "Shadowed by the bot's own /help"},
+		{Name: "release-notes", Description: "Draft release notes"},
+		{Name: "réview"},
+		{Name: "ci"},
+	})
+
+	byName := make(map[string]string)
+	for _, cmd := range menu {
+		if _, dup := byName[cmd.Text]; dup {
+			t.Fatalf("duplicate menu entry %q", cmd.Text)
+		}
+		byName[cmd.Text] = cmd.Description
+	}
+	if byName["help"] != "Show command help" {
+		t.Fatalf("built-in /help should win, got %q", byName["help"])
+	}
+	if byName["release_notes"] != "Draft release notes" {
+		t.Fatalf("expected release_notes entry, got %#v", byName)
+	}
+	if byName["ci"] != openCodeCommandFallbackDesc {
+		t.Fatalf("commands without description need a fallback, got %q", byName["ci"])
+	}
+	if len(menu) != len(builtinMenuCommands)+2 {
+		t.Fatalf("expected %d entries, got %d", len(builtinMenuCommands)+2, len(menu))
+	}
+}
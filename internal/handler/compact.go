@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"tg-bot/internal/opencode"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/telebot.v4"
+)
+
+// contextOverflowMarkers are lower-case fragments of provider errors raised
+// when a prompt no longer fits into the model's context window.
+var contextOverflowMarkers = []string{
+	"context length",
+	"context window",
+	"context_length_exceeded",
+	"maximum context",
+	"prompt is too long",
+	"too many tokens",
+}
+
+// sessionContextTokens estimates how much of the context window the session
+// currently uses, based on the latest assistant message that reported tokens.
+// A compaction summary replaces the history, so only its output counts.
+func sessionContextTokens(messages []opencode.Message) int {
+	for i := len(messages) - 1; i >= 0; i-- {
+		msg := messages[i]
+		if msg.Role != "assistant" || msg.Tokens.Context() == 0 {
+			continue
+		}
+		if msg.Summary {
+			return msg.Tokens.Output
+		}
+		return msg.Tokens.Context()
+	}
+	return 0
+}
+
+// newSummaryMessage finds a compaction summary that was not in the earlier snapshot.
+func newSummaryMessage(messages []opencode.Message, known map[string]bool) (opencode.Message, bool) {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if msg := messages[i]; msg.Summary && !known[msg.ID] {
+			return msg, true
+		}
+	}
+	return opencode.Message{}, false
+}
+
+func formatTokenCount(tokens, limit int) string {
+	if limit <= 0 {
+		return fmt.Sprintf("%d tokens", tokens)
+	}
+	return fmt.Sprintf("%d tokens (%d%% of %d)", tokens, tokens*100/limit, limit)
+}
+
+func formatCompactionReport(before, after, limit int) string {
+	var sb strings.Builder
+	sb.WriteString("🗜 Session compacted\n\n")
+	fmt.Fprintf(&sb, "Context before: %s\n", formatTokenCount(before, limit))
+	fmt.Fprintf(&sb, "Context after: %s", formatTokenCount(after, limit))
+	return sb.String()
+}
+
+// messageErrorText extracts the readable message from an OpenCode message error.
+func messageErrorText(errValue interface{}) string {
+	switch v := errValue.(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		if data, ok := v["data"].(map[string]interface{}); ok {
+			if message, ok := data["message"].(string); ok {
+				return message
+			}
+		}
+		if message, ok := v["message"].(string); ok {
+			return message
+		}
+		if name, ok := v["name"].(string); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// contextOverflowHint suggests /compact when a message failed because the context is full.
+func contextOverflowHint(errValue interface{}) string {
+	text := strings.ToLower(messageErrorText(errValue))
+	if text == "" {
+		return ""
+	}
+	for _, marker := range contextOverflowMarkers {
+		if strings.Contains(text, marker) {
+			return "The session no longer fits into the model's context. Use /compact to summarize it, or /new to start over."
+		}
+	}
+	return ""
+}
+
+// modelContextLimit looks up the context window of a model, or 0 when unknown.
+func (b *Bot) modelContextLimit(ctx context.Context, providerID, modelID string) int {
+	models, err := b.opencodeClient.GetModels(ctx)
+	if err != nil {
+		log.Warnf("Failed to get models for context limit: %v", err)
+		return 0
+	}
+	for _, model := range models {
+		if model.ProviderID == providerID && model.ID == modelID {
+			return model.ContextLimit()
+		}
+	}
+	return 0
+}
+
+// handleCompact handles the /compact command
+func (b *Bot) handleCompact(c telebot.Context) error {
+	sessionID, exists := b.sessionManager.GetUserSession(c.Sender().ID)
+	if !exists {
+		return c.Send("You don't have a current session. Use /new to create a new session.")
+	}
+	meta, ok := b.sessionManager.GetSessionMeta(sessionID)
+	if !ok || meta == nil || meta.ProviderID == "" || meta.ModelID == "" {
+		return c.Send("⚠️ No AI model configured for this session.\n\nUse /models and /setmodel <number> first; the summary is written by the session's model.")
+	}
+	return b.compactSession(c, sessionID, meta.ProviderID, meta.ModelID)
+}
+
+// compactSession summarizes sessionID through the runtime, so progress streams
+// like a prompt, and reports the context size before and after.
+func (b *Bot) compactSession(c telebot.Context, sessionID, providerID, modelID string) error {
+	ctx, cancel := context.WithTimeout(b.ctx, 30*time.Second)
+	before, err := b.opencodeClient.GetMessages(ctx, sessionID)
+	if err != nil {
+		cancel()
+		log.Errorf("Failed to get messages before compacting session %s: %v", sessionID, err)
+		return c.Send(fmt.Sprintf("❌ Failed to get messages: %v", err))
+	}
+	limit := b.modelContextLimit(ctx, providerID, modelID)
+	cancel()
+
+	known := make(map[string]bool, len(before))
+	for _, msg := range before {
+		known[msg.ID] = true
+	}
+
+	log.Infof("User %d compacting session %s with %s/%s", c.Sender().ID, sessionID, providerID, modelID)
+	if err := b.submitTask(c, runtimeTaskRequest{Compact: true}); err != nil {
+		return err
+	}
+
+	ctx, cancel = context.WithTimeout(b.ctx, 30*time.Second)
+	defer cancel()
+	after, err := b.opencodeClient.GetMessages(ctx, sessionID)
+	if err != nil {
+		log.Warnf("Failed to get messages after compacting session %s: %v", sessionID, err)
+		return nil
+	}
+	summary, ok := newSummaryMessage(after, known)
+	if !ok {
+		// The task already reported why no summary was written.
+		return nil
+	}
+	return c.Send(formatCompactionReport(sessionContextTokens(before), summary.Tokens.Output, limit))
+}
+
+// maybeAutoCompact compacts the session once its context crosses the configured
+// fraction of the model's limit.
+func (b *Bot) maybeAutoCompact(c telebot.Context, sessionID string) {
+	if b.config == nil || b.config.OpenCode.AutoCompactThreshold <= 0 {
+		return
+	}
+	meta, ok := b.sessionManager.GetSessionMeta(sessionID)
+	if !ok || meta == nil || meta.ProviderID == "" || meta.ModelID == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(b.ctx, 30*time.Second)
+	defer cancel()
+	messages, err := b.opencodeClient.GetMessages(ctx, sessionID)
+	if err != nil {
+		log.Warnf("Failed to check context usage for session %s: %v", sessionID, err)
+		return
+	}
+	used := sessionContextTokens(messages)
+	limit := b.modelContextLimit(ctx, meta.ProviderID, meta.ModelID)
+	if used == 0 || limit <= 0 || float64(used) < b.config.OpenCode.AutoCompactThreshold*float64(limit) {
+		return
+	}
+
+	log.Infof("Session %s uses %d of %d context tokens, compacting automatically", sessionID, used, limit)
+	if err := c.Send(fmt.Sprintf("🗜 The session uses %s of the context window. Compacting it automatically...", formatTokenCount(used, limit))); err != nil {
+		log.Warnf("Failed to announce automatic compaction: %v", err)
+	}
+	if err := b.compactSession(c, sessionID, meta.ProviderID, meta.ModelID); err != nil {
+		log.Warnf("Automatic compaction of session %s failed: %v", sessionID, err)
+	}
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+
+	"tg-bot/internal/opencode"
+)
+
+func TestSessionContextTokens(t *testing.T) {
+	var usage, summary opencode.TokenUsage
+	usage.Input, usage.Output, usage.Cache.Read = 1000, 200, 5000
+	summary.Input, summary.Output = 6200, 300
+
+	messages := []opencode.Message{
+		{ID: "msg_1", Role: "user"},
+		{ID: "msg_2", Role: "assistant", Tokens: usage},
+		{ID: "msg_3", Role: "assistant"},
+	}
+	if got := sessionContextTokens(messages); got != 6200 {
+		t.Fatalf("expected 6200 tokens, got %d", got)
+	}
+
+	messages = append(messages, opencode.Message{ID: "msg_4", Role: "assistant", Summary: true, Tokens: summary})
+	if got := sessionContextTokens(messages); got != 300 {
+		t.Fatalf("after compaction only the summary should count, got %d", got)
+	}
+
+	if _, ok := newSummaryMessage(messages, map[string]bool{"msg_4": true}); ok {
+		t.Fatalf("known summary must not be reported as new")
+	}
+	if msg, ok := newSummaryMessage(messages, map[string]bool{}); !ok || msg.ID != "msg_4" {
+		t.Fatalf("expected msg_4 as new summary, got %#v", msg)
+	}
+}
+
+func TestFormatCompactionReport(t *testing.T) {
+	report := formatCompactionReport(150000, 3000, 200000)
+	for _, want := range []string{"150000 tokens (75% of 200000)", "3000 tokens (1% of 200000)"} {
+		if !strings.Contains(report, want) {
+			t.Fatalf("report should contain %q: %s", want, report)
+		}
+	}
+	if got := formatTokenCount(42, 0); got != "42 tokens" {
+		t.Fatalf("unexpected count without limit: %s", got)
+	}
+}
+
+func TestContextOverflowHint(t *testing.T) {
+	overflow := map[string]interface{}{
+		"name": "APIError",
+		"data": map[string]interface{}{"message": "prompt is too long: 210000 tokens > 200000 maximum"},
+	}
+	if hint := contextOverflowHint(overflow); !strings.Contains(hint, "/compact") {
+		t.Fatalf("expected /compact hint, got %q", hint)
+	}
+
+	other := map[string]interface{}{"name": "ProviderAuthError", "data": map[string]interface{}{"message": "invalid api key"}}
+	if hint := contextOverflowHint(other); hint != "" {
+		t.Fatalf("unexpected hint for unrelated error: %q", hint)
+	}
+	if hint := contextOverflowHint(nil); hint != "" {
+		t.Fatalf("unexpected hint for nil error: %q", hint)
+	}
+}
+
+func TestRuntimeTaskRequestDescribe(t *testing.T) {
+	cases := map[string]runtimeTaskRequest{
+		"/compact":       {Compact: true},
+		"/review main":   {Command: "review", Text: "main"},
+		"fix the tests":  {Text: "fix the tests"},
+		"/release-notes": {Command: "release-notes"},
+	}
+	for want, task := range cases {
+		if got := task.describe(); got != want {
+			t.Fatalf("describe() = %q, want %q", got, want)
+		}
+	}
+}
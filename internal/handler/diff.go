@@ -0,0 +1,414 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"tg-bot/internal/opencode"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/telebot.v4"
+)
+
+const (
+	diffContextLines = 3
+	// diffMaxLCSCells bounds the line-matching table; larger change blocks are
+	// shown as a plain removal followed by an addition.
+	diffMaxLCSCells = 1 << 22
+	// sessionDiffInlineLimit is the largest /diff patch shown in the chat.
+	sessionDiffInlineLimit = 3000
+)
+
+// diffOp is one line of an edit script: ' ' kept, '-' removed, '+' added.
+type diffOp struct {
+	kind byte
+	line string
+}
+
+func splitDiffLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(strings.ReplaceAll(text, "\r\n", "\n"), "\n"), "\n")
+}
+
+// diffLines computes a line edit script turning a into b.
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	ops = append(ops, diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+// diffMiddle matches lines by longest common subsequence.
+func diffMiddle(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	var ops []diffOp
+	if n == 0 || m == 0 || n*m > diffMaxLCSCells {
+		for _, line := range a {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range b {
+			ops = append(ops, diffOp{'+', line})
+		}
+		return ops
+	}
+
+	// lcs[i*(m+1)+j] is the LCS length of a[i:] and b[j:].
+	lcs := make([]int32, (n+1)*(m+1))
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i*(m+1)+j] = lcs[(i+1)*(m+1)+j+1] + 1
+			} else if down, right := lcs[(i+1)*(m+1)+j], lcs[i*(m+1)+j+1]; down >= right {
+				lcs[i*(m+1)+j] = down
+			} else {
+				lcs[i*(m+1)+j] = right
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[(i+1)*(m+1)+j] >= lcs[i*(m+1)+j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+func formatHunkRange(start, length int) string {
+	switch length {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, length)
+	}
+}
+
+// unifiedDiff renders the change from before to after as a unified diff of path.
+// It returns an empty string when nothing changed.
+func unifiedDiff(path, before, after string) string {
+	ops := diffLines(splitDiffLines(before), splitDiffLines(after))
+
+	// Line counts consumed before each op, for hunk headers.
+	oldNo := make([]int, len(ops)+1)
+	newNo := make([]int, len(ops)+1)
+	for i, op := range ops {
+		oldNo[i+1], newNo[i+1] = oldNo[i], newNo[i]
+		if op.kind != '+' {
+			oldNo[i+1]++
+		}
+		if op.kind != '-' {
+			newNo[i+1]++
+		}
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(ops); {
+		for i < len(ops) && ops[i].kind == ' ' {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+
+		// Extend the hunk over changes separated by at most 2*context kept lines.
+		end := i
+		for j := i; j < len(ops); {
+			if ops[j].kind != ' ' {
+				j++
+				end = j
+				continue
+			}
+			k := j
+			for k < len(ops) && ops[k].kind == ' ' {
+				k++
+			}
+			if k == len(ops) || k-j > 2*diffContextLines {
+				break
+			}
+			j = k
+		}
+		start := i - diffContextLines
+		if start < 0 {
+			start = 0
+		}
+		stop := end + diffContextLines
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+
+		if sb.Len() == 0 {
+			name := strings.TrimPrefix(filepath.ToSlash(path), "/")
+			fmt.Fprintf(&sb, "--- a/%s\n+++ b/%s\n", name, name)
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n",
+			formatHunkRange(oldNo[start], oldNo[stop]-oldNo[start]),
+			formatHunkRange(newNo[start], newNo[stop]-newNo[start]))
+		for _, op := range ops[start:stop] {
+			sb.WriteByte(op.kind)
+			sb.WriteString(op.line)
+			sb.WriteByte('\n')
+		}
+		i = stop
+	}
+	return sb.String()
+}
+
+// countDiffLines counts added and removed lines of a unified diff.
+func countDiffLines(diff string) (additions, deletions int) {
+	for _, line := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		case strings.HasPrefix(line, "+"):
+			additions++
+		case strings.HasPrefix(line, "-"):
+			deletions++
+		}
+	}
+	return additions, deletions
+}
+
+// truncateDiff shortens diff to at most maxLen bytes, cutting at a line boundary.
+func truncateDiff(diff string, maxLen int) (string, bool) {
+	diff = strings.TrimRight(diff, "\n")
+	if len(diff) <= maxLen {
+		return diff, false
+	}
+	cut := strings.LastIndexByte(diff[:maxLen], '\n')
+	if cut <= 0 {
+		cut = maxLen
+	}
+	hidden := strings.Count(diff[cut:], "\n")
+	return fmt.Sprintf("%s\n... %d more line(s)", diff[:cut], hidden), true
+}
+
+// isFileEditTool reports whether a tool part changes project files.
+func isFileEditTool(toolName string) bool {
+	switch strings.ToLower(strings.TrimSpace(toolName)) {
+	case "edit", "multiedit", "write", "patch", "apply_patch":
+		return true
+	default:
+		return false
+	}
+}
+
+func firstStringField(source map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if value, _ := source[key].(string); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// fileEditDiff returns the file an edit tool part changes and the change as a
+// unified diff. OpenCode reports the diff in the metadata once the call
+// completed; until then it is rebuilt from the tool input.
+func fileEditDiff(toolName string, state map[string]interface{}) (path, diff string) {
+	input := toStringAnyMap(state["input"])
+	metadata := toStringAnyMap(state["metadata"])
+	path = firstStringField(input, "filePath", "file_path", "path")
+	if path == "" {
+		path = firstStringField(metadata, "filepath", "filePath")
+	}
+	if diff = firstStringField(metadata, "diff"); strings.TrimSpace(diff) != "" {
+		return path, diff
+	}
+
+	switch strings.ToLower(toolName) {
+	case "edit":
+		return path, unifiedDiff(path, firstStringField(input, "oldString", "old_string"), firstStringField(input, "newString", "new_string"))
+	case "write":
+		return path, unifiedDiff(path, "", firstStringField(input, "content"))
+	case "multiedit":
+		edits, _ := input["edits"].([]interface{})
+		var sb strings.Builder
+		for _, raw := range edits {
+			edit := toStringAnyMap(raw)
+			hunk := unifiedDiff(path, firstStringField(edit, "oldString", "old_string"), firstStringField(edit, "newString", "new_string"))
+			if sb.Len() > 0 {
+				// Keep the file header of the first edit only.
+				if i := strings.Index(hunk, "@@"); i >= 0 {
+					hunk = hunk[i:]
+				}
+			}
+			sb.WriteString(hunk)
+		}
+		return path, sb.String()
+	default:
+		return path, firstStringField(input, "patchText", "patch")
+	}
+}
+
+func fileEditHeader(path, diff string) string {
+	additions, deletions := countDiffLines(diff)
+	if path == "" {
+		path = "files"
+	}
+	return fmt.Sprintf("✏️ %s (+%d −%d)", path, additions, deletions)
+}
+
+// formatFileEditPart renders an edit tool part as a compact unified diff.
+// It returns false when the part holds no diff, e.g. when the edit failed.
+func formatFileEditPart(toolName string, state interface{}) (string, bool) {
+	source := toStringAnyMap(state)
+	if source == nil {
+		return "", false
+	}
+	if status, _ := source["status"].(string); status == "error" {
+		return "", false
+	}
+	path, diff := fileEditDiff(toolName, source)
+	if strings.TrimSpace(diff) == "" {
+		return "", false
+	}
+
+	// The header stays visible above the collapsed diff.
+	header := fileEditHeader(path, diff)
+	body, truncated := truncateDiff(diff, toolOutputDisplayLimit)
+	if truncated {
+		header += " — full diff sent as a file"
+	}
+	fence := codeFence(body)
+	return header + "\n" + wrapInExpandableBlockquote(fmt.Sprintf("%sdiff\n%s\n%s", fence, body, fence)), true
+}
+
+// patchDocument wraps a diff into a .patch file named after path.
+func patchDocument(path, diff, caption string) *telebot.Document {
+	name := "changes"
+	if path != "" {
+		name = filepath.Base(path)
+	}
+	return &telebot.Document{
+		File:     telebot.FromReader(strings.NewReader(strings.TrimRight(diff, "\n") + "\n")),
+		FileName: name + ".patch",
+		MIME:     "text/x-diff",
+		Caption:  caption,
+	}
+}
+
+// oversizedPatchLocked returns a .patch document for a completed edit of
+// state's session whose diff does not fit in the tool block. Each part is
+// returned at most once.
+func oversizedPatchLocked(state *streamingState, sessionID string, event opencode.SessionEvent) *telebot.Document {
+	if event.Type != "message.part.updated" {
+		return nil
+	}
+	var payload opencode.MessagePartUpdatedProperties
+	if err := json.Unmarshal(event.Properties, &payload); err != nil {
+		return nil
+	}
+	part := payload.Part
+	if part.SessionID != sessionID || part.Type != "tool" || !isFileEditTool(part.Tool) || state.sentPatches[part.ID] {
+		return nil
+	}
+	source := toStringAnyMap(part.State)
+	if status, _ := source["status"].(string); status != "completed" {
+		return nil
+	}
+	path, diff := fileEditDiff(part.Tool, source)
+	if len(strings.TrimRight(diff, "\n")) <= toolOutputDisplayLimit {
+		return nil
+	}
+
+	if state.sentPatches == nil {
+		state.sentPatches = make(map[string]bool)
+	}
+	state.sentPatches[part.ID] = true
+	return patchDocument(path, diff, fileEditHeader(path, diff))
+}
+
+// sessionDiffPatch joins the per-file diffs of a session into one patch.
+func sessionDiffPatch(diffs []opencode.FileDiff) string {
+	var sb strings.Builder
+	for _, d := range diffs {
+		sb.WriteString(unifiedDiff(d.File, d.Before, d.After))
+	}
+	return sb.String()
+}
+
+func formatSessionDiffSummary(diffs []opencode.FileDiff) string {
+	additions, deletions := 0, 0
+	for _, d := range diffs {
+		additions += d.Additions
+		deletions += d.Deletions
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "📊 Session diff: %d file(s), +%d −%d\n", len(diffs), additions, deletions)
+	for _, d := range diffs {
+		fmt.Fprintf(&sb, "• %s (+%d −%d)\n", d.File, d.Additions, d.Deletions)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// handleDiff handles the /diff command
+func (b *Bot) handleDiff(c telebot.Context) error {
+	sessionID, exists := b.sessionManager.GetUserSession(c.Sender().ID)
+	if !exists {
+		return c.Send("You don't have a current session. Use /new to create a new session.")
+	}
+
+	ctx, cancel := context.WithTimeout(b.ctx, 30*time.Second)
+	defer cancel()
+
+	diffs, err := b.opencodeClient.GetSessionDiff(ctx, sessionID)
+	if err != nil {
+		log.Errorf("Failed to get diff for session %s: %v", sessionID, err)
+		return c.Send(fmt.Sprintf("❌ %v", err))
+	}
+	if len(diffs) == 0 {
+		return c.Send("📊 No files have been changed in this session.")
+	}
+
+	summary := formatSessionDiffSummary(diffs)
+	patch := sessionDiffPatch(diffs)
+	if len(patch) <= sessionDiffInlineLimit {
+		fence := codeFence(patch)
+		_, err = b.sendRenderedTelegramMessage(c, fmt.Sprintf("%s\n\n%sdiff\n%s%s", summary, fence, patch, fence), false)
+		return err
+	}
+
+	if _, err := b.sendRenderedTelegramMessage(c, summary, false); err != nil {
+		return err
+	}
+	doc := patchDocument("session-"+sessionID, patch, "Full session diff")
+	return c.Send(doc)
+}
@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"tg-bot/internal/opencode"
+	"tg-bot/internal/render"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	before := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\nn\n"
+	after := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\nn\no\n"
+	got := unifiedDiff("/repo/main.go", before, after)
+	want := strings.Join([]string{
+		"--- a/repo/main.go",
+		"+++ b/repo/main.go",
+		"@@ -1,5 +1,5 @@",
+		" a",
+		"-b",
+		"+B",
+		" c",
+		" d",
+		" e",
+		"@@ -12,3 +12,4 @@",
+		" l",
+		" m",
+		" n",
+		"+o",
+		"",
+	}, "\n")
+	if got != want {
+		t.Fatalf("unexpected diff:\n%s\nwant:\n%s", got, want)
+	}
+	if additions, deletions := countDiffLines(got); additions != 2 || deletions != 1 {
+		t.Fatalf("unexpected counts: +%d -%d", additions, deletions)
+	}
+	if unifiedDiff("x", "same\n", "same\n") != "" {
+		t.Fatal("identical content should produce no diff")
+	}
+}
+
+func TestUnifiedDiff_NewFileAndMergedHunks(t *testing.T) {
+	if got := unifiedDiff("new.txt", "", "one\ntwo\n"); got != "--- a/new.txt\n+++ b/new.txt\n@@ -0,0 +1,2 @@\n+one\n+two\n" {
+		t.Fatalf("unexpected new file diff: %q", got)
+	}
+
+	// Changes six unchanged lines apart share one hunk.
+	before := "1\n2\n3\n4\n5\n6\n7\n8\n"
+	after := "x\n2\n3\n4\n5\n6\n7\ny\n"
+	got := unifiedDiff("f", before, after)
+	if strings.Count(got, "@@ -") != 1 || !strings.Contains(got, "@@ -1,8 +1,8 @@") {
+		t.Fatalf("expected a single merged hunk:\n%s", got)
+	}
+}
+
+func TestFormatFileEditPart(t *testing.T) {
+	edit := map[string]interface{}{
+		"status": "running",
+		"input":  map[string]interface{}{"filePath": "/repo/a.go", "oldString": "x := 1\n", "newString": "x := 2\ny := 3\n"},
+	}
+	got := formatToolCallPart("edit", "", edit, "")
+	for _, want := range []string{"✏️ /repo/a.go (+2 −1)\n> ```diff\n", "> ```diff\n", "> -x := 1\n", "> +y := 3\n"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("edit part missing %q:\n%s", want, got)
+		}
+	}
+
+	write := map[string]interface{}{
+		"status": "completed",
+		"input":  map[string]interface{}{"filePath": "/repo/b.txt", "content": "hello\n"},
+	}
+	if got := formatToolCallPart("write", "", write, ""); !strings.Contains(got, "✏️ /repo/b.txt (+1 −0)") {
+		t.Fatalf("unexpected write part:\n%s", got)
+	}
+
+	metadataDiff := map[string]interface{}{
+		"status":   "completed",
+		"input":    map[string]interface{}{"filePath": "/repo/c.go"},
+		"metadata": map[string]interface{}{"diff": "--- a/c.go\n+++ b/c.go\n@@ -1 +1 @@\n-old\n+new\n"},
+	}
+	if got := formatToolCallPart("edit", "", metadataDiff, ""); !strings.Contains(got, "> -old\n> +new\n") {
+		t.Fatalf("metadata diff should be preferred:\n%s", got)
+	}
+
+	markdown := map[string]interface{}{
+		"status": "completed",
+		"input":  map[string]interface{}{"filePath": "/repo/README.md", "oldString": "Run:\n", "newString": "Run:\n```sh\nmake\n```\n"},
+	}
+	if got := formatToolCallPart("edit", "", markdown, ""); !strings.Contains(got, "> ````diff\n") || !strings.HasSuffix(strings.TrimSpace(got), "> ````") {
+		t.Fatalf("a diff containing a fence should use a longer one:\n%s", got)
+	}
+
+	// Fences in context lines stay inside the diff block once rendered.
+	context := map[string]interface{}{
+		"status": "completed",
+		"input":  map[string]interface{}{"filePath": "/repo/README.md", "oldString": "```sh\nmake\n```\n", "newString": "```sh\nmake all\n```\n"},
+	}
+	html := render.MarkdownToTelegramHTML(formatToolCallPart("edit", "", context, ""))
+	if strings.Count(html, "<pre>") != 1 || !strings.Contains(html, " ```sh\n-make\n+make all\n ```</code></pre>") {
+		t.Fatalf("context lines with fences should stay in the diff block:\n%s", html)
+	}
+
+	failed := map[string]interface{}{
+		"status": "error",
+		"error":  "oldString not found",
+		"input":  map[string]interface{}{"filePath": "/repo/a.go", "oldString": "a", "newString": "b"},
+	}
+	if got := formatToolCallPart("edit", "", failed, ""); strings.Contains(got, "```diff") {
+		t.Fatalf("failed edits should use the generic tool block:\n%s", got)
+	}
+}
+
+func TestFormatEventMessageParts_CachesCompletedEdits(t *testing.T) {
+	input := map[string]interface{}{"filePath": "/repo/a.go", "oldString": "x := 1\n", "newString": "x := 2\n"}
+	part := opencode.MessagePartResponse{
+		ID:    "prt_edit",
+		Type:  "tool",
+		Tool:  "edit",
+		State: map[string]interface{}{"status": "running", "input": input},
+	}
+	msg := &eventMessageState{
+		PartOrder: []string{part.ID},
+		Parts:     map[string]opencode.MessagePartResponse{part.ID: part},
+	}
+
+	formatEventMessageParts(msg)
+	if len(msg.editBlocks) != 0 {
+		t.Fatal("a running edit should not be cached")
+	}
+
+	part.State = map[string]interface{}{"status": "completed", "input": input}
+	msg.Parts[part.ID] = part
+	first := formatEventMessageParts(msg)
+	if _, ok := msg.editBlocks[part.ID]; !ok {
+		t.Fatal("a completed edit should be cached")
+	}
+
+	// Later rebuilds reuse the cached block instead of diffing again.
+	input["newString"] = "x := 3\n"
+	if got := formatEventMessageParts(msg); got != first || !strings.Contains(got, "> +x := 2\n") {
+		t.Fatalf("expected the cached edit block, got:\n%s", got)
+	}
+}
+
+func TestOversizedPatchLocked(t *testing.T) {
+	var content strings.Builder
+	for i := 0; i < 400; i++ {
+		fmt.Fprintf(&content, "line %d\n", i)
+	}
+	toolState := map[string]interface{}{
+		"status": "completed",
+		"input":  map[string]interface{}{"filePath": "/repo/big.txt", "content": content.String()},
+	}
+
+	got := formatToolCallPart("write", "", toolState, "")
+	if !strings.Contains(got, "(+400 −0) — full diff sent as a file") || !strings.Contains(got, "more line(s)") {
+		t.Fatalf("long diff should be truncated:\n%s", got[:200])
+	}
+	if strings.Contains(got, "line 399") {
+		t.Fatal("the end of a long diff should be cut from the tool block")
+	}
+
+	state := &streamingState{}
+	event := testEvent(t, "message.part.updated", opencode.MessagePartUpdatedProperties{
+		Part: opencode.MessagePartResponse{ID: "prt_1", SessionID: "ses_1", Type: "tool", Tool: "write", State: toolState},
+	})
+	doc := oversizedPatchLocked(state, "ses_1", event)
+	if doc == nil || doc.FileName != "big.txt.patch" {
+		t.Fatalf("expected a patch document, got %#v", doc)
+	}
+	if oversizedPatchLocked(state, "ses_1", event) != nil {
+		t.Fatal("a part's patch should be sent only once")
+	}
+	if oversizedPatchLocked(&streamingState{}, "ses_other", event) != nil {
+		t.Fatal("patches of other sessions must be ignored")
+	}
+}
+
+func TestSessionDiffSummary(t *testing.T) {
+	diffs := []opencode.FileDiff{
+		{File: "a.go", Before: "a\n", After: "b\n", Additions: 1, Deletions: 1},
+		{File: "new.txt", Before: "", After: "x\ny\n", Additions: 2},
+	}
+	if got := formatSessionDiffSummary(diffs); got != "📊 Session diff: 2 file(s), +3 −1\n• a.go (+1 −1)\n• new.txt (+2 −0)" {
+		t.Fatalf("unexpected summary:\n%s", got)
+	}
+	patch := sessionDiffPatch(diffs)
+	if !strings.Contains(patch, "--- a/a.go\n+++ b/a.go\n@@ -1 +1 @@\n-a\n+b\n--- a/new.txt") {
+		t.Fatalf("unexpected patch:\n%s", patch)
+	}
+}
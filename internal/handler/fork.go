@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"tg-bot/internal/opencode"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/telebot.v4"
+)
+
+const (
+	forkCallbackUnique = "fork"
+	forkListSize       = 5
+	// forkWholeSession is the /fork argument and button payload that copies every message.
+	forkWholeSession = "all"
+)
+
+// forkPoint is a user prompt a session can be forked at.
+type forkPoint struct {
+	MessageID string
+	Prompt    string
+}
+
+// recentPrompts lists user prompts before revertPoint, newest first.
+func recentPrompts(messages []opencode.Message, revertPoint string) []forkPoint {
+	var points []forkPoint
+	for _, msg := range messages {
+		if revertPoint != "" && msg.ID == revertPoint {
+			break
+		}
+		if msg.Role != "user" {
+			continue
+		}
+		prompt := strings.TrimSpace(msg.Content)
+		if prompt == "" {
+			prompt = "(attachment)"
+		}
+		points = append(points, forkPoint{MessageID: msg.ID, Prompt: prompt})
+	}
+	for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+		points[i], points[j] = points[j], points[i]
+	}
+	return points
+}
+
+// resolveForkPoint maps a /fork argument, a list number or a message ID, to a prompt.
+func resolveForkPoint(points []forkPoint, arg string) (forkPoint, bool) {
+	if n, err := strconv.Atoi(arg); err == nil {
+		if n < 1 || n > len(points) {
+			return forkPoint{}, false
+		}
+		return points[n-1], true
+	}
+	for _, point := range points {
+		if point.MessageID == arg {
+			return point, true
+		}
+	}
+	return forkPoint{}, false
+}
+
+// renderForkList shows recent prompts with a fork button each.
+func renderForkList(points []forkPoint) (string, *telebot.ReplyMarkup) {
+	if len(points) > forkListSize {
+		points = points[:forkListSize]
+	}
+
+	var sb strings.Builder
+	sb.WriteString("🌿 Choose where to fork. The new session keeps everything before the chosen prompt.\n\n")
+	markup := &telebot.ReplyMarkup{}
+	var rows []telebot.Row
+	for i, point := range points {
+		fmt.Fprintf(&sb, "%d. %s\n", i+1, truncateAndInline(point.Prompt, 80))
+		buttonText := fmt.Sprintf("🌿 %d. %s", i+1, callbackButtonText(point.Prompt, 32))
+		rows = append(rows, markup.Row(markup.Data(buttonText, forkCallbackUnique, point.MessageID)))
+	}
+	rows = append(rows, markup.Row(markup.Data("🌿 Copy the whole session", forkCallbackUnique, forkWholeSession)))
+	markup.Inline(rows...)
+	return strings.TrimRight(sb.String(), "\n"), markup
+}
+
+// forkCurrentSession forks sessionID before point and switches the user to the fork.
+// A zero point forks the whole session.
+func (b *Bot) forkCurrentSession(ctx context.Context, userID int64, sessionID string, point forkPoint) (string, error) {
+	parentName := sessionID
+	if parent, ok := b.sessionManager.GetSessionMeta(sessionID); ok && parent != nil && parent.Name != "" {
+		parentName = parent.Name
+	}
+
+	fork, err := b.sessionManager.ForkSession(ctx, userID, sessionID, point.MessageID)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🌿 Forked %s into: %s\n\n", parentName, fork.Name)
+	if point.MessageID == "" {
+		sb.WriteString("The fork holds a copy of the whole session.")
+	} else {
+		fmt.Fprintf(&sb, "The fork holds the history before: %s", truncateAndInline(point.Prompt, 80))
+	}
+	sb.WriteString("\n\nIt is now your current session. Use /sessions to see the session tree.")
+	return sb.String(), nil
+}
+
+// handleFork handles the /fork command
+func (b *Bot) handleFork(c telebot.Context) error {
+	userID := c.Sender().ID
+	sessionID, exists := b.sessionManager.GetUserSession(userID)
+	if !exists {
+		return c.Send("You don't have a current session. Use /new to create a new session.")
+	}
+
+	ctx, cancel := context.WithTimeout(b.ctx, 30*time.Second)
+	defer cancel()
+
+	arg := strings.TrimSpace(c.Message().Payload)
+	var point forkPoint
+	if !strings.EqualFold(arg, forkWholeSession) {
+		messages, revertPoint, err := b.loadRevertState(ctx, sessionID)
+		if err != nil {
+			log.Errorf("Failed to load session %s for fork: %v", sessionID, err)
+			return c.Send(fmt.Sprintf("❌ %v", err))
+		}
+		points := recentPrompts(messages, revertPoint)
+		if len(points) == 0 {
+			return c.Send("This session has no prompts yet. Use /fork all to copy it anyway.")
+		}
+		if arg == "" {
+			text, markup := renderForkList(points)
+			return c.Send(text, markup)
+		}
+		var ok bool
+		if point, ok = resolveForkPoint(points, arg); !ok {
+			return c.Send("Unknown prompt. Use /fork to pick one from the list.")
+		}
+	}
+
+	result, err := b.forkCurrentSession(ctx, userID, sessionID, point)
+	if err != nil {
+		log.Errorf("Failed to fork session %s: %v", sessionID, err)
+		return c.Send(fmt.Sprintf("❌ Failed to fork session: %v", err))
+	}
+	return c.Send(result)
+}
+
+// handleForkCallback forks at the prompt picked from the /fork list.
+func (b *Bot) handleForkCallback(c telebot.Context) error {
+	arg := strings.TrimSpace(c.Callback().Data)
+	if arg == "" {
+		return c.Respond(&telebot.CallbackResponse{Text: "Invalid button."})
+	}
+	userID := c.Sender().ID
+	sessionID, exists := b.sessionManager.GetUserSession(userID)
+	if !exists {
+		return c.Respond(&telebot.CallbackResponse{Text: "You don't have a current session.", ShowAlert: true})
+	}
+
+	ctx, cancel := context.WithTimeout(b.ctx, 30*time.Second)
+	defer cancel()
+
+	var point forkPoint
+	if arg != forkWholeSession {
+		messages, revertPoint, err := b.loadRevertState(ctx, sessionID)
+		if err != nil {
+			return c.Respond(&telebot.CallbackResponse{Text: err.Error(), ShowAlert: true})
+		}
+		var ok bool
+		if point, ok = resolveForkPoint(recentPrompts(messages, revertPoint), arg); !ok {
+			return c.Respond(&telebot.CallbackResponse{Text: "That prompt is no longer in your current session.", ShowAlert: true})
+		}
+	}
+
+	result, err := b.forkCurrentSession(ctx, userID, sessionID, point)
+	if err != nil {
+		log.Errorf("Failed to fork session %s: %v", sessionID, err)
+		return c.Respond(&telebot.CallbackResponse{Text: fmt.Sprintf("Failed to fork session: %v", err), ShowAlert: true})
+	}
+	if err := c.Respond(&telebot.CallbackResponse{Text: "Forked"}); err != nil {
+		log.Warnf("Failed to answer fork callback: %v", err)
+	}
+	return c.Edit(result)
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+
+	"tg-bot/internal/opencode"
+	"tg-bot/internal/session"
+)
+
+func TestRecentPromptsAndResolveForkPoint(t *testing.T) {
+	messages := []opencode.Message{
+		{ID: "msg_1", Role: "user", Content: "first"},
+		{ID: "msg_2", Role: "assistant"},
+		{ID: "msg_3", Role: "user", Content: "second"},
+		{ID: "msg_4", Role: "assistant"},
+		{ID: "msg_5", Role: "user", Content: "reverted"},
+	}
+
+	points := recentPrompts(messages, "msg_5")
+	if len(points) != 2 || points[0].MessageID != "msg_3" || points[1].MessageID != "msg_1" {
+		t.Fatalf("expected newest visible prompts first, got %#v", points)
+	}
+
+	if point, ok := resolveForkPoint(points, "2"); !ok || point.Prompt != "first" {
+		t.Fatalf("expected number 2 to resolve to the older prompt, got %#v", point)
+	}
+	if point, ok := resolveForkPoint(points, "msg_3"); !ok || point.Prompt != "second" {
+		t.Fatalf("expected message ID to resolve, got %#v", point)
+	}
+	for _, arg := range []string{"0", "3", "msg_5"} {
+		if _, ok := resolveForkPoint(points, arg); ok {
+			t.Fatalf("expected %q not to resolve", arg)
+		}
+	}
+}
+
+func TestRenderForkListCallbackData(t *testing.T) {
+	var points []forkPoint
+	for i := 0; i < forkListSize+2; i++ {
+		points = append(points, forkPoint{MessageID: "msg_01JZ8Q7X4M2N3P4Q5R6S7T8U9V", Prompt: strings.Repeat("long prompt ", 10)})
+	}
+	_, markup := renderForkList(points)
+	if len(markup.InlineKeyboard) != forkListSize+1 {
+		t.Fatalf("expected %d rows, got %d", forkListSize+1, len(markup.InlineKeyboard))
+	}
+	for _, row := range markup.InlineKeyboard {
+		for _, btn := range row {
+			if len(btn.Data) > maxCallbackDataLen {
+				t.Fatalf("callback data too long (%d): %q", len(btn.Data), btn.Data)
+			}
+		}
+	}
+}
+
+func TestWriteSessionEntry_RendersForkTree(t *testing.T) {
+	sessions := []*session.SessionMeta{
+		{SessionID: "a", Name: "Main"},
+		{SessionID: "b", Name: "Main (fork 1)", ParentID: "a"},
+		{SessionID: "c", Name: "Main (fork 1) (fork 1)", ParentID: "b"},
+		{SessionID: "d", Name: "Orphan fork", ParentID: "gone"},
+	}
+	depths := sessionTreeDepths(sessions)
+	if depths["a"] != 0 || depths["b"] != 1 || depths["c"] != 2 || depths["d"] != 0 {
+		t.Fatalf("unexpected depths: %v", depths)
+	}
+
+	var sb strings.Builder
+	writeSessionEntry(&sb, 3, sessions[2], false, depths["c"], 2)
+	text := sb.String()
+	if !strings.HasPrefix(text, "   └─ 3. Main (fork 1) (fork 1)\n") {
+		t.Fatalf("expected nested fork to be indented: %q", text)
+	}
+	if !strings.Contains(text, "• Forked from: #2") {
+		t.Fatalf("expected parent reference: %q", text)
+	}
+}
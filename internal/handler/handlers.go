@@ -3,6 +3,7 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sort"
 	"strconv"
@@ -35,6 +36,7 @@ type Bot struct {
 	opencodeClient *opencode.Client
 	sessionManager *session.Manager
 	runtime        *openCodeRuntime
+	access         *accessPolicy
 	ctx            context.Context
 	cancel         context.CancelFunc
 
@@ -54,6 +56,22 @@ type Bot struct {
 	streamingStateMu sync.RWMutex
 	streamingStates  map[string]*streamingState
 	renderer         *render.Renderer
+
+	// Rename prompts posted from the /sessions keyboard
+	renames pendingRenames
+
+	// Result sets behind /ls, /find and /grep buttons
+	browse browseCache
+
+	// Custom commands defined in OpenCode
+	commands openCodeCommands
+
+	// /sh commands whose output is being mirrored, by session
+	shells shellRuns
+
+	// Permission requests awaiting a Telegram answer (permissionID -> request)
+	permissionMu       sync.Mutex
+	pendingPermissions map[string]*pendingPermission
 }
 
 // streamingState tracks the state of an active streaming response
@@ -108,6 +126,16 @@ type streamingState struct {
 	sawBusyStatus         bool
 	sawIdleAfterBusy      bool
 
+	// Latest todo list of the session, pinned above the output.
+	todos []opencode.Todo
+
+	// Edit tool parts whose oversized diff was already sent as a .patch file.
+	sentPatches map[string]bool
+
+	// Child sessions spawned by the task, e.g. @explore subagents.
+	subagents     map[string]*subagentState
+	subagentOrder []string
+
 	isStreaming bool
 	isComplete  bool
 }
@@ -117,6 +145,10 @@ type eventMessageState struct {
 	PartOrder []string
 	Parts     map[string]opencode.MessagePartResponse
 	LastEvent time.Time
+
+	// Formatted blocks of completed edit parts by part ID, so their diff is
+	// not rebuilt on every display refresh.
+	editBlocks map[string]string
 }
 
 type pendingEventPart struct {
@@ -126,9 +158,10 @@ type pendingEventPart struct {
 
 // modelSelection represents a model selection with provider and model IDs
 type modelSelection struct {
-	ProviderID string
-	ModelID    string
-	ModelName  string
+	ProviderID   string
+	ProviderName string
+	ModelID      string
+	ModelName    string
 }
 
 // NewBot creates a new bot instance
@@ -162,6 +195,8 @@ func NewBot(cfg *config.Config) (*Bot, error) {
 	store, err := storage.NewStore(storage.Options{
 		Type:     cfg.Storage.Type,
 		FilePath: cfg.Storage.FilePath,
+		KeyEnv:   cfg.Storage.EncryptionKeyEnv,
+		KeyFile:  cfg.Storage.EncryptionKeyFile,
 	})
 	if err != nil {
 		returnErr = fmt.Errorf("failed to create storage: %w", err)
@@ -181,7 +216,12 @@ func NewBot(cfg *config.Config) (*Bot, error) {
 		globalModelMapping: make(map[int]modelSelection),
 		sessionMapping:     make(map[int64]map[int]string),
 		streamingStates:    make(map[string]*streamingState),
+		pendingPermissions: make(map[string]*pendingPermission),
 		renderer:           render.New(cfg.Render.Mode),
+		access:             newAccessPolicy(cfg.Access),
+	}
+	if !bot.access.enabled {
+		log.Warn("Access control is disabled: any Telegram user who finds this bot can use it. Admin commands are refused until [access] admin_users is set.")
 	}
 
 	// Initialize session manager before serving requests to ensure startup is healthy.
@@ -203,6 +243,7 @@ func NewBot(cfg *config.Config) (*Bot, error) {
 		return nil, returnErr
 	}
 	bot.runtime = runtime
+	bot.startSessionJanitor()
 
 	return bot, nil
 }
@@ -264,19 +305,47 @@ func (b *Bot) Start() {
 	}
 
 	// Register command handlers
-	b.tgBot.Handle("/help", b.withTelegramInterfaceLog("/help", b.handleHelp))
-	b.tgBot.Handle("/sessions", b.withTelegramInterfaceLog("/sessions", b.handleSessions))
-	b.tgBot.Handle("/new", b.withTelegramInterfaceLog("/new", b.handleNew))
-	b.tgBot.Handle("/switch", b.withTelegramInterfaceLog("/switch", b.handleSwitch))
-	b.tgBot.Handle("/profile", b.withTelegramInterfaceLog("/profile", b.handleProfile))
-	b.tgBot.Handle("/abort", b.withTelegramInterfaceLog("/abort", b.handleAbort))
-	b.tgBot.Handle("/models", b.withTelegramInterfaceLog("/models", b.handleModels))
-	b.tgBot.Handle("/setmodel", b.withTelegramInterfaceLog("/setmodel", b.handleSetModel))
-	b.tgBot.Handle("/rename", b.withTelegramInterfaceLog("/rename", b.handleRename))
-	b.tgBot.Handle("/delete", b.withTelegramInterfaceLog("/delete", b.handleDelete))
+	b.handle("/help", "/help", roleReadOnly, b.handleHelp)
+	b.handle("/sessions", "/sessions", roleReadOnly, b.handleSessions)
+	b.handle("/new", "/new", roleOperator, b.handleNew)
+	b.handle("/switch", "/switch", roleOperator, b.handleSwitch)
+	b.handle("/profile", "/profile", roleReadOnly, b.handleProfile)
+	b.handle("/abort", "/abort", roleOperator, b.handleAbort)
+	b.handle("/queue", "/queue", roleOperator, b.handleQueue)
+	b.handle("/models", "/models", roleReadOnly, b.handleModels)
+	b.handle("/setmodel", "/setmodel", roleOperator, b.handleSetModel)
+	b.handle("/agents", "/agents", roleReadOnly, b.handleAgents)
+	b.handle("/agent", "/agent", roleOperator, b.handleAgent)
+	b.handle("/commands", "/commands", roleReadOnly, b.handleCommands)
+	b.handle("/rename", "/rename", roleOperator, b.handleRename)
+	b.handle("/delete", "/delete", roleOperator, b.handleDelete)
+	b.handle("\f"+sessionsCallbackUnique, "callback:"+sessionsCallbackUnique, roleReadOnly, b.handleSessionsCallback)
+	b.handle("\f"+modelsCallbackUnique, "callback:"+modelsCallbackUnique, roleReadOnly, b.handleModelsCallback)
+	b.handle("/pending", "/pending", roleOperator, b.handlePending)
+	b.handle("/get", "/get", roleOperator, b.handleGet)
+	b.handle("/ls", "/ls", roleOperator, b.handleLs)
+	b.handle("/find", "/find", roleOperator, b.handleFind)
+	b.handle("/grep", "/grep", roleOperator, b.handleGrep)
+	b.handle("/sh", "/sh", roleAdmin, b.handleSh)
+	b.handle("/cleanup", "/cleanup", roleAdmin, b.handleCleanup)
+	b.handle("/undo", "/undo", roleOperator, b.handleUndo)
+	b.handle("/redo", "/redo", roleOperator, b.handleRedo)
+	b.handle("/compact", "/compact", roleOperator, b.handleCompact)
+	b.handle("/todos", "/todos", roleReadOnly, b.handleTodos)
+	b.handle("/diff", "/diff", roleOperator, b.handleDiff)
+	b.handle("/render", "/render", roleOperator, b.handleRender)
+	b.handle("/fork", "/fork", roleOperator, b.handleFork)
+	b.handle("\f"+forkCallbackUnique, "callback:"+forkCallbackUnique, roleOperator, b.handleForkCallback)
+	b.handle("\f"+undoCallbackUnique, "callback:"+undoCallbackUnique, roleOperator, b.handleUndoCallback)
+	b.handle("\f"+browseCallbackUnique, "callback:"+browseCallbackUnique, roleOperator, b.handleBrowseCallback)
+	b.handle("\f"+permissionCallbackUnique, "callback:"+permissionCallbackUnique, roleOperator, b.handlePermissionCallback)
 
 	// Handle plain text messages (non-commands)
-	b.tgBot.Handle(telebot.OnText, b.withTelegramInterfaceLog("OnText", b.handleText))
+	b.handle(telebot.OnText, "OnText", roleOperator, b.handleText)
+	b.handle(telebot.OnDocument, "OnDocument", roleOperator, b.handleDocument)
+	b.handle(telebot.OnPhoto, "OnPhoto", roleOperator, b.handlePhoto)
+
+	go b.syncCommandMenu()
 }
 
 // handleHelp handles the /help command
@@ -288,23 +357,48 @@ Core Commands:
 • /sessions - List all sessions
 • /new [name] - Create new session
 • /switch <number> - Switch current session
-• /profile - Show current session and current model
+• /profile - Show current session, model and agent
+• /render [mode|default] - Show or set how replies are formatted in this chat
 • /rename <number> <name> - Rename a session
 • /delete <number> - Delete a session
-• /abort - Abort current task
+• /abort [all] - Abort current task (all also clears the queue)
+• /queue [clear | drop <number>] - Show or manage queued prompts
+• /pending - Show tool permission requests waiting for approval in your sessions
+• /todos - Show the agent's todo list for the current session
+• /diff - Show the files changed in the current session as a diff
+• /undo [list] - Revert the last response and its file changes (list picks an earlier one)
+• /redo - Bring back what the last /undo reverted
+• /compact - Summarize the session to free up model context
+• /fork [number|all] - Branch the session before an earlier prompt and switch to it
+• /cleanup [--dry-run] [days] - Clean up sessions nobody has used for a while (admin only)
+
+Workspace:
+• /get <path> - Download a file from the session's project
+• /ls [dir] - List a project directory
+• /find <glob> - Find project files by name
+• /grep <pattern> - Search project file contents
+• /sh <command> - Run a shell command in the project (admin only)
 
 Model Selection:
 • /models - List available AI models (with numbers)
 • /setmodel <number> - Set model for current session
 
+Agents:
+• /agents - List available agents
+• /agent <name|default> - Use an agent for the current session
+
+OpenCode Commands:
+• /commands - List custom commands defined in OpenCode
+• /<command> [arguments] - Run a custom command in the current session
+
 Interactive Mode:
 Send any non-command text and I'll send it as an instruction to OpenCode and stream back the response.
 
 Notes:
 • Each user has one default session
 • Use /new to create multiple sessions for different tasks
-• Use /abort to abort long-running tasks
-• Sending a new message automatically aborts previous streaming response`
+• Messages sent while a task is running are queued and run in order; see them with /queue
+• Use /abort to stop the running task, or /abort all to also clear the queue`
 
 	return c.Send(helpText)
 }
@@ -317,67 +411,12 @@ func (b *Bot) handleSessions(c telebot.Context) error {
 		return c.Send(fmt.Sprintf("Failed to get session list: %v", err))
 	}
 
-	userID := c.Sender().ID
-	sessions, err := b.sessionManager.ListUserSessions(b.ctx, userID)
+	text, markup, err := b.renderSessionsPage(c.Sender().ID, 0)
 	if err != nil {
 		log.Errorf("Failed to list sessions: %v", err)
 		return c.Send(fmt.Sprintf("Failed to get session list: %v", err))
 	}
-
-	if len(sessions) == 0 {
-		return c.Send("You don't have any sessions yet. Use /new to create a new session.")
-	}
-
-	// Update session mapping for this user
-	b.sessionMappingMu.Lock()
-	b.sessionMapping[userID] = make(map[int]string)
-	for i, sess := range sessions {
-		b.sessionMapping[userID][i+1] = sess.SessionID
-	}
-	b.sessionMappingMu.Unlock()
-
-	var sb strings.Builder
-	sb.WriteString("📋 Available Sessions\n\n")
-
-	currentSessionID, hasCurrent := b.sessionManager.GetUserSession(userID)
-
-	for i, sess := range sessions {
-		// Determine if this is the current session
-		isCurrent := hasCurrent && sess.SessionID == currentSessionID
-
-		// Format the header line
-		if isCurrent {
-			fmt.Fprintf(&sb, "[✅ CURRENT] %d. %s\n", i+1, sess.Name)
-		} else {
-			fmt.Fprintf(&sb, "%d. %s\n", i+1, sess.Name)
-		}
-
-		// Add separator line (fixed length)
-		sb.WriteString("────────────────\n")
-
-		// Add session details with bullet points
-		fmt.Fprintf(&sb, "• Created: %s\n", sess.CreatedAt.Format("2006-01-02 15:04"))
-		fmt.Fprintf(&sb, "• Last used: %s\n", sess.LastUsedAt.Format("2006-01-02 15:04"))
-		fmt.Fprintf(&sb, "• Messages: %d\n", sess.MessageCount)
-
-		// Add model information
-		if sess.ProviderID != "" && sess.ModelID != "" {
-			fmt.Fprintf(&sb, "• Model: %s/%s\n", sess.ProviderID, sess.ModelID)
-		} else if sess.ModelID != "" {
-			fmt.Fprintf(&sb, "• Model: %s\n", sess.ModelID)
-		} else if sess.ProviderID != "" {
-			fmt.Fprintf(&sb, "• Model: %s\n", sess.ProviderID)
-		} else {
-			sb.WriteString("• Model: Default\n")
-		}
-
-		// Add empty line between sessions
-		sb.WriteString("\n")
-	}
-
-	sb.WriteString("Use /switch <number> to switch sessions, /rename <number> <name> to rename, or /delete <number> to delete.")
-
-	return c.Send(sb.String())
+	return c.Send(text, markup)
 }
 
 // handleNew handles the /new command
@@ -534,6 +573,14 @@ func (b *Bot) handleProfile(c telebot.Context) error {
 		sb.WriteString("• Current model: none\n")
 	}
 
+	if hasCurrent {
+		agent := ""
+		if meta, exists := b.sessionManager.GetSessionMeta(currentSessionID); exists && meta != nil {
+			agent = meta.Agent
+		}
+		fmt.Fprintf(&sb, "• Current agent: %s\n", displayAgentName(agent))
+	}
+
 	return c.Send(sb.String())
 }
 
@@ -546,7 +593,19 @@ func (b *Bot) handleAbort(c telebot.Context) error {
 		return c.Send("You don't have a current session. Use /new to create a new session.")
 	}
 
-	// First, try to cancel any local streaming state
+	// /abort all also drops queued prompts so nothing starts after the abort.
+	cleared := 0
+	clearQueue := strings.EqualFold(strings.TrimSpace(c.Message().Payload), "all")
+	if clearQueue && b.runtime != nil {
+		if actor := b.runtime.getActor(sessionID); actor != nil {
+			cleared = actor.clearQueue(errTaskDequeued)
+		}
+	}
+
+	// Send abort to OpenCode before canceling the local task, otherwise the next
+	// queued prompt could start and be interrupted by this abort.
+	abortErr := b.opencodeClient.AbortSession(b.ctx, sessionID)
+
 	b.streamingStateMu.Lock()
 	if state, ok := b.streamingStates[sessionID]; ok && state.isStreaming {
 		state.cancel()
@@ -555,15 +614,77 @@ func (b *Bot) handleAbort(c telebot.Context) error {
 	}
 	b.streamingStateMu.Unlock()
 
-	// Then send abort to OpenCode
-	if err := b.opencodeClient.AbortSession(b.ctx, sessionID); err != nil {
-		log.Errorf("Failed to abort session: %v", err)
-		return c.Send(fmt.Sprintf("Failed to abort session: %v", err))
+	if abortErr != nil {
+		log.Errorf("Failed to abort session: %v", abortErr)
+		return c.Send(fmt.Sprintf("Failed to abort session: %v", abortErr))
 	}
 
+	if clearQueue {
+		return c.Send(fmt.Sprintf("🛑 Abort signal sent. Current task will be interrupted and %d queued prompt(s) were cleared.", cleared))
+	}
 	return c.Send("🛑 Abort signal sent. Current task will be interrupted.")
 }
 
+// handleQueue handles the /queue command
+func (b *Bot) handleQueue(c telebot.Context) error {
+	userID := c.Sender().ID
+	sessionID, exists := b.sessionManager.GetUserSession(userID)
+	if !exists {
+		return c.Send("You don't have a current session. Use /new to create a new session.")
+	}
+
+	var actor *sessionActor
+	if b.runtime != nil {
+		actor = b.runtime.getActor(sessionID)
+	}
+
+	args := strings.Fields(c.Message().Payload)
+	if len(args) > 0 {
+		switch strings.ToLower(args[0]) {
+		case "clear":
+			cleared := 0
+			if actor != nil {
+				cleared = actor.clearQueue(errTaskDequeued)
+			}
+			return c.Send(fmt.Sprintf("🧹 Cleared %d queued prompt(s).", cleared))
+		case "drop":
+			if len(args) != 2 {
+				return c.Send("Usage: /queue drop <number>")
+			}
+			position, err := strconv.Atoi(args[1])
+			if err != nil {
+				return c.Send("Invalid number. Use /queue to see queued prompts.")
+			}
+			if actor == nil {
+				return c.Send("📭 The queue is empty.")
+			}
+			task, err := actor.dropQueued(position)
+			if err != nil {
+				return c.Send(fmt.Sprintf("❌ %v", err))
+			}
+			return c.Send(fmt.Sprintf("🗑️ Dropped queued prompt #%d: %s", position, truncateAndInline(task.describe(), 80)))
+		default:
+			return c.Send("Usage: /queue [clear | drop <number>]")
+		}
+	}
+
+	var tasks []runtimeTaskRequest
+	if actor != nil {
+		tasks = actor.queuedTasks()
+	}
+	if len(tasks) == 0 {
+		return c.Send("📭 The queue is empty.")
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "📋 Queued prompts (%d):\n\n", len(tasks))
+	for i, task := range tasks {
+		fmt.Fprintf(&sb, "%d. %s\n", i+1, truncateAndInline(task.describe(), 80))
+	}
+	sb.WriteString("\nUse /queue drop <number> or /queue clear to manage them.")
+	return c.Send(sb.String())
+}
+
 // formatMessageParts formats message parts for display
 func formatMessageParts(parts []interface{}) string {
 	return formatMessagePartsWithOptions(parts, true)
@@ -629,11 +750,22 @@ func formatMessagePartsWithOptions(parts []interface{}, includeReplyContent bool
 	return result
 }
 
+// Tool output longer than this is truncated in rendered messages.
+const toolOutputDisplayLimit = 2500
+
 func formatToolCallPart(toolName, snapshot string, state interface{}, text string) string {
 	snapshotData := parseJSONMap(snapshot)
 	if toolName == "" {
 		toolName = extractToolName(snapshotData)
 	}
+	if isTodoTool(toolName) {
+		return formatTodoToolPart(toolName, state)
+	}
+	if isFileEditTool(toolName) {
+		if part, ok := formatFileEditPart(toolName, state); ok {
+			return part
+		}
+	}
 	sourceData := toStringAnyMap(state)
 	if sourceData == nil {
 		sourceData = snapshotData
@@ -663,7 +795,7 @@ func formatToolCallPart(toolName, snapshot string, state interface{}, text strin
 		lines = append(lines, "$ "+truncateAndInline(command, 500))
 	}
 	if output != "" {
-		outputText := truncateMultiline(output, 2500)
+		outputText := truncateMultiline(output, toolOutputDisplayLimit)
 		if outputText != "" {
 			if len(lines) > 0 {
 				lines = append(lines, "")
@@ -753,6 +885,7 @@ func (b *Bot) buildDisplayChunksFromMessagesWithCache(messages []opencode.Messag
 		if sessionMeta.ProviderID != "" && sessionMeta.ModelID != "" {
 			fmt.Fprintf(&sb, "- Model: %s/%s\n", sessionMeta.ProviderID, sessionMeta.ModelID)
 		}
+		fmt.Fprintf(&sb, "- Agent: %s\n", displayAgentName(sessionMeta.Agent))
 		sb.WriteString("\n")
 		sessionInfo := sb.String()
 		// Session info is typically short, no need to split
@@ -985,82 +1118,8 @@ func (b *Bot) handleModels(c telebot.Context) error {
 	// Keep /setmodel fast even when /models was called in another goroutine.
 	b.storeModelMapping(c.Sender().ID, modelMapping)
 
-	var sb strings.Builder
-	sb.WriteString("📋 Connected Providers\n\n")
-
-	type numberedModel struct {
-		Number    int
-		Selection modelSelection
-	}
-	providerNames := make(map[string]string, len(providersResp.All))
-	for _, provider := range providersResp.All {
-		name := strings.TrimSpace(provider.Name)
-		if name == "" {
-			name = provider.ID
-		}
-		providerNames[provider.ID] = name
-	}
-	groupedModels := make(map[string][]numberedModel)
-	for number, selection := range modelMapping {
-		groupedModels[selection.ProviderID] = append(groupedModels[selection.ProviderID], numberedModel{
-			Number:    number,
-			Selection: selection,
-		})
-	}
-
-	if len(groupedModels) == 0 {
-		sb.WriteString("⚠️ No connected AI providers.\n")
-		sb.WriteString("Please configure API keys for at least one AI provider first.")
-		return c.Send(sb.String())
-	}
-
-	providerIDs := make([]string, 0, len(groupedModels))
-	for providerID := range groupedModels {
-		providerIDs = append(providerIDs, providerID)
-	}
-	sort.Slice(providerIDs, func(i, j int) bool {
-		leftName := strings.ToLower(providerNames[providerIDs[i]])
-		rightName := strings.ToLower(providerNames[providerIDs[j]])
-		if leftName == rightName {
-			return providerIDs[i] < providerIDs[j]
-		}
-		return leftName < rightName
-	})
-
-	for _, providerID := range providerIDs {
-		models := groupedModels[providerID]
-		sort.Slice(models, func(i, j int) bool {
-			if models[i].Number == models[j].Number {
-				if strings.EqualFold(models[i].Selection.ModelName, models[j].Selection.ModelName) {
-					return models[i].Selection.ModelID < models[j].Selection.ModelID
-				}
-				return strings.ToLower(models[i].Selection.ModelName) < strings.ToLower(models[j].Selection.ModelName)
-			}
-			return models[i].Number < models[j].Number
-		})
-
-		providerName := providerNames[providerID]
-		if providerName == "" {
-			providerName = providerID
-		}
-		fmt.Fprintf(&sb, "%s (%s)\n", providerName, providerID)
-		sb.WriteString("────────────────\n")
-
-		for _, model := range models {
-			fmt.Fprintf(&sb, "%d. %s\n", model.Number, model.Selection.ModelName)
-		}
-
-		sb.WriteString("\n")
-	}
-
-	sb.WriteString("Use /setmodel <number> to set model for current session.\n")
-	sb.WriteString("Use /new <name> to create new session (uses your current model).")
-
-	result := sb.String()
-	if len(result) > 4000 {
-		result = result[:4000] + "\n...(content too long, truncated)"
-	}
-	return c.Send(result)
+	text, markup := b.renderModelsPage(c.Sender().ID, 0)
+	return c.Send(text, markup)
 }
 
 // handleSetModel sets the model for the current session
@@ -1116,11 +1175,32 @@ func (b *Bot) handleSetModel(c telebot.Context) error {
 
 // handleText handles plain text messages (non-commands) through attach-like runtime actors.
 func (b *Bot) handleText(c telebot.Context) error {
-	userID := c.Sender().ID
 	text := strings.TrimSpace(c.Text())
 	if text == "" {
 		return nil
 	}
+	if handled, err := b.consumePendingRename(c); handled {
+		return err
+	}
+	if name, args, ok := parseSlashCommand(text); ok {
+		if cmd, found := b.commands.lookup(name); found {
+			return b.submitCommand(c, cmd, args)
+		}
+	}
+	return b.submitPrompt(c, text, nil)
+}
+
+// submitPrompt sends text and optional file parts to the user's current session.
+func (b *Bot) submitPrompt(c telebot.Context, text string, files []opencode.MessagePart) error {
+	return b.submitTask(c, runtimeTaskRequest{
+		Text:  text,
+		Files: files,
+	})
+}
+
+// submitTask fills in the user's session, model and agent and hands task to the runtime.
+func (b *Bot) submitTask(c telebot.Context, task runtimeTaskRequest) error {
+	userID := c.Sender().ID
 
 	sessionID, err := b.sessionManager.GetOrCreateSession(b.ctx, userID)
 	if err != nil {
@@ -1147,17 +1227,22 @@ func (b *Bot) handleText(c telebot.Context) error {
 		return c.Send("Processing error: runtime is not initialized")
 	}
 
-	err = b.runtime.SubmitTextTask(runtimeTaskRequest{
-		SessionID:      sessionID,
-		RequestTraceID: requestTraceID,
-		Text:           text,
-		Model:          messageModel,
-		TelegramCtx:    c,
-	})
+	task.SessionID = sessionID
+	task.RequestTraceID = requestTraceID
+	task.Model = messageModel
+	task.Agent = meta.Agent
+	task.TelegramCtx = c
+	err = b.runtime.SubmitTextTask(task)
+	if errors.Is(err, errTaskDequeued) {
+		return nil
+	}
 	if err != nil {
 		log.Warnf("OpenCode runtime task failed for session %s request_trace_id=%s: %v", sessionID, requestTraceID, err)
 		return c.Send(fmt.Sprintf("Processing error: %v", err))
 	}
+	if !task.Compact {
+		b.maybeAutoCompact(c, sessionID)
+	}
 	return nil
 }
 
@@ -1288,9 +1373,10 @@ func (b *Bot) buildGlobalModelMappingFromProviders(providersResp *opencode.Provi
 		number := persistedByExactKey[exactKey]
 		number = allocateNumber(number)
 		globalMapping[number] = modelSelection{
-			ProviderID: entry.ProviderID,
-			ModelID:    entry.ModelID,
-			ModelName:  entry.ModelName,
+			ProviderID:   entry.ProviderID,
+			ProviderName: entry.ProviderName,
+			ModelID:      entry.ModelID,
+			ModelName:    entry.ModelName,
 		}
 	}
 
@@ -1744,11 +1830,20 @@ func isEventMessageCompleted(msg *eventMessageState) bool {
 }
 
 func (b *Bot) buildEventDrivenDisplaysLocked(state *streamingState) []string {
+	displays, _ := b.buildEventDrivenReplyLocked(state)
+	return displays
+}
+
+// buildEventDrivenReplyLocked returns the pages to show for state and, when
+// the reply is over the document thresholds, the full content to attach.
+// An oversized reply is shown as a single page with its latest part.
+func (b *Bot) buildEventDrivenReplyLocked(state *streamingState) ([]string, string) {
 	if state == nil {
-		return nil
+		return nil, ""
 	}
 
-	renderedMessages := make([]string, 0, len(state.displayOrder))
+	checklist := formatTodoChecklist(state.todos)
+	renderedMessages := make([]string, 0, len(state.displayOrder)+1)
 	for _, messageID := range state.displayOrder {
 		msgState := state.eventMessages[messageID]
 		if msgState == nil {
@@ -1760,19 +1855,43 @@ func (b *Bot) buildEventDrivenDisplaysLocked(state *streamingState) []string {
 		}
 		renderedMessages = append(renderedMessages, block)
 	}
+	if section := formatSubagentSectionLocked(state); section != "" {
+		renderedMessages = append(renderedMessages, section)
+	}
 	if len(renderedMessages) == 0 {
+		if checklist != "" {
+			return []string{checklist}, ""
+		}
 		if state.isComplete {
-			return nil
+			return nil, ""
 		}
-		return []string{"🤖 Processing..."}
+		return []string{"🤖 Processing..."}, ""
 	}
 
 	content := strings.Join(renderedMessages, "\n\n")
 	chunks := b.splitLongContentPreserveCodeBlocks(content)
+	if b.isOversizedReply(content, len(chunks)) {
+		return pinTodoChecklist([]string{formatLongReplyTail(content, state.isComplete)}, checklist), content
+	}
 	if len(chunks) == 0 {
-		return []string{content}
+		chunks = []string{content}
 	}
-	return chunks
+	return pinTodoChecklist(chunks, checklist), ""
+}
+
+// pinTodoChecklist puts the checklist on top of the last display, the one
+// edited as the reply grows, so it stays in view on multi-page replies. When
+// both do not fit one message the checklist gets a message of its own.
+func pinTodoChecklist(displays []string, checklist string) []string {
+	if checklist == "" || len(displays) == 0 {
+		return displays
+	}
+	last := len(displays) - 1
+	if combined := checklist + "\n\n" + displays[last]; len(combined) <= todoChecklistPinSize {
+		displays[last] = combined
+		return displays
+	}
+	return append(displays, checklist)
 }
 
 func formatEventMessageForDisplay(msg *eventMessageState) string {
@@ -1799,7 +1918,7 @@ func formatEventMessageForDisplay(msg *eventMessageState) string {
 		fmt.Fprintf(&sb, "[%s]\n---\n", roleLabel)
 	}
 
-	partStr := formatEventMessageParts(sortedEventParts(msg))
+	partStr := formatEventMessageParts(msg)
 	if partStr != "" {
 		sb.WriteString(partStr)
 	}
@@ -1808,6 +1927,9 @@ func formatEventMessageForDisplay(msg *eventMessageState) string {
 			sb.WriteString("\n\n")
 		}
 		sb.WriteString("⚠️ Execution ended with an error.")
+		if hint := contextOverflowHint(msg.Info.Error); hint != "" {
+			sb.WriteString("\n" + hint)
+		}
 	}
 	return strings.TrimSpace(sb.String())
 }
@@ -1820,7 +1942,8 @@ func sortedEventParts(msg *eventMessageState) []opencode.MessagePartResponse {
 	return orderedParts(msg.PartOrder, msg.Parts)
 }
 
-func formatEventMessageParts(parts []opencode.MessagePartResponse) string {
+func formatEventMessageParts(msg *eventMessageState) string {
+	parts := sortedEventParts(msg)
 	if len(parts) == 0 {
 		return ""
 	}
@@ -1838,7 +1961,7 @@ func formatEventMessageParts(parts []opencode.MessagePartResponse) string {
 			reasoningText := strings.ReplaceAll(strings.TrimSpace(part.Text), "\n", "\n> ")
 			fmt.Fprintf(&reasoningAndTools, "> Thinking: %s\n", reasoningText)
 		case "tool":
-			reasoningAndTools.WriteString(formatToolCallPart(part.Tool, part.Snapshot, part.State, part.Text))
+			reasoningAndTools.WriteString(msg.formatToolPart(part))
 		case "step-start", "step-finish":
 			// Step boundaries are structural markers; skip to keep stream concise.
 		default:
@@ -1859,6 +1982,25 @@ func formatEventMessageParts(parts []opencode.MessagePartResponse) string {
 	return strings.TrimSpace(strings.Join(sections, "\n\n"))
 }
 
+// formatToolPart formats a tool part of msg. A completed edit no longer
+// changes, so its block is formatted once and reused.
+func (msg *eventMessageState) formatToolPart(part opencode.MessagePartResponse) string {
+	if !isFileEditTool(part.Tool) || part.ID == "" {
+		return formatToolCallPart(part.Tool, part.Snapshot, part.State, part.Text)
+	}
+	if block, ok := msg.editBlocks[part.ID]; ok {
+		return block
+	}
+	block := formatToolCallPart(part.Tool, part.Snapshot, part.State, part.Text)
+	if status, _ := toStringAnyMap(part.State)["status"].(string); status == "completed" {
+		if msg.editBlocks == nil {
+			msg.editBlocks = make(map[string]string)
+		}
+		msg.editBlocks[part.ID] = block
+	}
+	return block
+}
+
 func (b *Bot) reconcileEventStateWithLatestMessages(state *streamingState) bool {
 	if state == nil || state.sessionID == "" || b.opencodeClient == nil {
 		return false
@@ -2385,7 +2527,7 @@ func (b *Bot) updateTelegramMessage(c telebot.Context, msg *telebot.Message, con
 	}
 	content = safeChunks[0]
 
-	rendered := b.buildTelegramRenderResult(content, streaming)
+	rendered := b.buildTelegramRenderResultForMode(b.chatRenderMode(c), content, streaming)
 	primary := rendered.primaryText
 	if len(primary) > telegramMessageMaxLength {
 		log.Warnf("Skipping Telegram edit because rendered content exceeds limit (%d)", len(primary))
@@ -2406,10 +2548,10 @@ func (b *Bot) updateTelegramMessage(c telebot.Context, msg *telebot.Message, con
 			return
 		}
 
-		// If it's an HTML parse error and we're using HTML mode, try editing with plain text
-		if isHTMLParseError(err) && rendered.primaryMode == telebot.ModeHTML {
-			log.Warnf("HTML parse error during edit, trying plain text: %v", err)
-			_, err = b.editTelegramWithMode(c, msg, primary, telebot.ModeDefault)
+		// If Telegram could not parse the formatted text, try editing with plain text
+		if isHTMLParseError(err) && rendered.primaryMode != telebot.ModeDefault {
+			log.Warnf("%s parse error during edit, trying plain text: %v", parseModeLabel(rendered.primaryMode), err)
+			_, err = b.editTelegramWithMode(c, msg, rendered.fallbackText, telebot.ModeDefault)
 		}
 
 		if err != nil {
@@ -2453,22 +2595,36 @@ func isHTMLParseError(err error) bool {
 }
 
 type telegramRenderResult struct {
-	primaryText string
-	primaryMode telebot.ParseMode
+	primaryText  string
+	primaryMode  telebot.ParseMode
+	fallbackText string
 }
 
 func (b *Bot) buildTelegramRenderResult(content string, streaming bool) telegramRenderResult {
+	return b.buildTelegramRenderResultForMode(b.renderer.Mode(), content, streaming)
+}
+
+func (b *Bot) buildTelegramRenderResultForMode(mode, content string, streaming bool) telegramRenderResult {
 	if b.renderer == nil {
 		return telegramRenderResult{
-			primaryText: content,
-			primaryMode: telebot.ModeDefault,
+			primaryText:  content,
+			primaryMode:  telebot.ModeDefault,
+			fallbackText: content,
 		}
 	}
 
-	rendered := b.renderer.Render(content, streaming)
+	rendered := b.renderer.RenderMode(mode, content, streaming)
+	primaryMode := telebot.ModeDefault
+	switch {
+	case rendered.UseHTML:
+		primaryMode = telebot.ModeHTML
+	case rendered.UseMarkdownV2:
+		primaryMode = telebot.ModeMarkdownV2
+	}
 	return telegramRenderResult{
-		primaryText: rendered.Text,
-		primaryMode: telebot.ModeHTML,
+		primaryText:  rendered.Text,
+		primaryMode:  primaryMode,
+		fallbackText: rendered.FallbackText,
 	}
 }
 
@@ -2544,7 +2700,7 @@ func (b *Bot) sendRenderedTelegramMessage(c telebot.Context, content string, str
 	}
 	content = safeChunks[0]
 
-	rendered := b.buildTelegramRenderResult(content, streaming)
+	rendered := b.buildTelegramRenderResultForMode(b.chatRenderMode(c), content, streaming)
 	primary := rendered.primaryText
 	if len(primary) > telegramMessageMaxLength {
 		return nil, fmt.Errorf("rendered content exceeds telegram limit: %d", len(primary))
@@ -2553,11 +2709,11 @@ func (b *Bot) sendRenderedTelegramMessage(c telebot.Context, content string, str
 	// Try sending with the preferred mode (usually HTML)
 	msg, err := b.sendTelegramWithMode(c, primary, rendered.primaryMode)
 
-	// If it's an HTML parse error and we're using HTML mode, fall back to plain text
-	if err != nil && isHTMLParseError(err) && rendered.primaryMode == telebot.ModeHTML {
-		log.Warnf("HTML parse error, falling back to plain text: %v", err)
+	// If Telegram could not parse the formatted text, fall back to plain text
+	if err != nil && isHTMLParseError(err) && rendered.primaryMode != telebot.ModeDefault {
+		log.Warnf("%s parse error, falling back to plain text: %v", parseModeLabel(rendered.primaryMode), err)
 		// Retry with plain text mode
-		msg, err = b.sendTelegramWithMode(c, primary, telebot.ModeDefault)
+		msg, err = b.sendTelegramWithMode(c, rendered.fallbackText, telebot.ModeDefault)
 	}
 
 	if err == nil {
@@ -2878,9 +3034,19 @@ func (b *Bot) splitDisplayToTelegramSafe(content string, streaming bool) []strin
 	return parts
 }
 
+// renderedLengthWithinTelegramLimit checks content against the limit in plain,
+// HTML and MarkdownV2 form, so pages fit whatever render mode the chat uses.
 func (b *Bot) renderedLengthWithinTelegramLimit(content string, streaming bool) bool {
-	rendered := b.buildTelegramRenderResult(content, streaming)
-	return len(rendered.primaryText) <= telegramMessageMaxLength
+	if len(content) > telegramMessageMaxLength {
+		return false
+	}
+	for _, mode := range []string{render.ModeMarkdownStream, render.ModeMarkdownV2} {
+		rendered := b.buildTelegramRenderResultForMode(mode, content, streaming)
+		if len(rendered.primaryText) > telegramMessageMaxLength {
+			return false
+		}
+	}
+	return true
 }
 
 func splitContentNearMiddle(content string) (string, string) {
@@ -2944,7 +3110,10 @@ func (b *Bot) updateStreamingTelegramMessages(state *streamingState, displays []
 		return
 	}
 
-	displays = b.ensureTelegramRenderSafeDisplays(displays, true)
+	// The final update of a finished task is rendered as non-streaming, which
+	// is when markdown_final converts to HTML.
+	streaming := !state.isComplete
+	displays = b.ensureTelegramRenderSafeDisplays(displays, streaming)
 	if len(displays) == 0 {
 		return
 	}
@@ -2964,7 +3133,7 @@ func (b *Bot) updateStreamingTelegramMessages(state *streamingState, displays []
 	// Ensure we have enough Telegram messages.
 	for len(state.telegramMessages) < len(displays) {
 		idx := len(state.telegramMessages)
-		newMsg, err := b.sendRenderedTelegramMessage(state.telegramCtx, displays[idx], true)
+		newMsg, err := b.sendRenderedTelegramMessage(state.telegramCtx, displays[idx], streaming)
 		if err != nil {
 			log.Errorf("Failed to create additional streaming message #%d: %v", idx+1, err)
 			// Keep updating already-existing pages; we'll retry creating missing pages
@@ -2976,11 +3145,23 @@ func (b *Bot) updateStreamingTelegramMessages(state *streamingState, displays []
 		state.lastRendered = append(state.lastRendered, displays[idx])
 	}
 
+	// Drop pages the reply no longer needs, e.g. once it collapses to its tail.
+	for len(state.telegramMessages) > len(displays) {
+		last := len(state.telegramMessages) - 1
+		if err := state.telegramCtx.Bot().Delete(state.telegramMessages[last]); err != nil {
+			log.Warnf("Failed to delete surplus streaming message #%d: %v", last+1, err)
+		}
+		state.telegramMessages = state.telegramMessages[:last]
+		if last < len(state.lastRendered) {
+			state.lastRendered = state.lastRendered[:last]
+		}
+	}
+
 	for i, display := range displays {
-		if i < len(state.lastRendered) && state.lastRendered[i] == display {
+		if streaming && i < len(state.lastRendered) && state.lastRendered[i] == display {
 			continue
 		}
-		b.updateTelegramMessage(state.telegramCtx, state.telegramMessages[i], display, true)
+		b.updateTelegramMessage(state.telegramCtx, state.telegramMessages[i], display, streaming)
 		if i < len(state.lastRendered) {
 			state.lastRendered[i] = display
 		}
@@ -3051,6 +3232,7 @@ func (b *Bot) splitLongContentPreserveCodeBlocks(content string) []string {
 	var currentChunk strings.Builder
 	inCodeBlock := false
 	codeBlockMarker := ""
+	codeBlockFenceLen := 0
 	codeBlockQuotePrefix := ""
 	truncated := false
 
@@ -3062,20 +3244,18 @@ func (b *Bot) splitLongContentPreserveCodeBlocks(content string) []string {
 		// Check if this line starts or ends a code block
 		trimmed := strings.TrimSpace(line)
 		normalizedFenceLine, quotePrefix := normalizeFenceLineForSplit(trimmed)
-		if strings.HasPrefix(normalizedFenceLine, "```") {
-			if !inCodeBlock {
+		if !inCodeBlock {
+			if n := render.CodeFenceLength(normalizedFenceLine); n > 0 {
 				// Starting a code block
 				inCodeBlock = true
 				codeBlockMarker = normalizedFenceLine
+				codeBlockFenceLen = n
 				codeBlockQuotePrefix = quotePrefix
-			} else {
-				// Check if this ends the current code block
-				if strings.HasPrefix(normalizedFenceLine, codeBlockMarker) ||
-					(len(normalizedFenceLine) >= 3 && normalizedFenceLine[:3] == "```") {
-					// Ending the code block
-					inCodeBlock = false
-				}
 			}
+		} else if render.ClosesCodeFence(normalizedFenceLine, codeBlockFenceLen) {
+			// Ending the code block; like the renderer, only a bare fence
+			// at least as long as the opening one closes it
+			inCodeBlock = false
 		}
 
 		lineWithNewline := line + "\n"
@@ -3085,7 +3265,7 @@ func (b *Bot) splitLongContentPreserveCodeBlocks(content string) []string {
 			// Current chunk is full, start a new one
 			// If we're in a code block, close it before ending the chunk
 			if inCodeBlock {
-				currentChunk.WriteString(codeBlockQuotePrefix + "```\n")
+				currentChunk.WriteString(codeBlockQuotePrefix + strings.Repeat("`", codeBlockFenceLen) + "\n")
 			}
 
 			chunkStr := strings.TrimSuffix(currentChunk.String(), "\n")
@@ -3143,6 +3323,8 @@ func normalizeFenceLineForSplit(trimmedLine string) (fenceLine string, quotePref
 
 // Close closes the bot and releases resources
 func (b *Bot) Close() error {
+	b.stopPermissionTimers()
+
 	if b.runtime != nil {
 		b.runtime.Close()
 	}
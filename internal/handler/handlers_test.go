@@ -589,6 +589,29 @@ func TestSplitLongContentPreserveCodeBlocks_QuotedFenceReopensCorrectly(t *testi
 	}
 }
 
+func TestSplitLongContentPreserveCodeBlocks_LongerFence(t *testing.T) {
+	b := &Bot{}
+	var sb strings.Builder
+	sb.WriteString("````diff\n")
+	for i := 0; i < 400; i++ {
+		sb.WriteString(" ```sh\n-make\n+make all\n ```\n")
+	}
+	sb.WriteString("````")
+
+	chunks := b.splitLongContentPreserveCodeBlocks(sb.String())
+	if len(chunks) < 2 {
+		t.Fatalf("expected the diff to split into multiple chunks")
+	}
+	for i, chunk := range chunks {
+		if !strings.HasPrefix(chunk, "````") || !strings.HasSuffix(chunk, "\n````") {
+			t.Fatalf("expected chunk %d to be wrapped in the four-backtick fence, got: %q", i, chunk)
+		}
+		if got := render.MarkdownToTelegramHTML(chunk); strings.Count(got, "<pre>") != 1 {
+			t.Fatalf("expected chunk %d to render as one code block, got: %q", i, got)
+		}
+	}
+}
+
 func TestFormatStreamingDisplays_LongSingleLineCreatesMultipleParts(t *testing.T) {
 	b := &Bot{}
 	content := strings.Repeat("a", 7600)
@@ -0,0 +1,519 @@
+package handler
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"tg-bot/internal/session"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/telebot.v4"
+)
+
+// Callback uniques for the /sessions and /models inline keyboards. Payloads carry
+// stable session IDs and provider/model keys instead of per-user list numbers.
+const (
+	sessionsCallbackUnique = "sess"
+	modelsCallbackUnique   = "model"
+
+	sessionsPageSize = 5
+	modelsPageSize   = 10
+
+	// Telegram rejects callback data longer than 64 bytes.
+	maxCallbackDataLen = 64
+)
+
+// pendingRename remembers which session a rename prompt was posted for.
+type pendingRename struct {
+	sessionID string
+	promptID  int
+}
+
+type pendingRenames struct {
+	mu     sync.Mutex
+	byUser map[int64]pendingRename
+}
+
+func (p *pendingRenames) set(userID int64, rename pendingRename) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.byUser == nil {
+		p.byUser = make(map[int64]pendingRename)
+	}
+	p.byUser[userID] = rename
+}
+
+// take returns and clears the rename for userID when replyToID answers its prompt.
+func (p *pendingRenames) take(userID int64, replyToID int) (pendingRename, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	rename, ok := p.byUser[userID]
+	if !ok || rename.promptID != replyToID {
+		return pendingRename{}, false
+	}
+	delete(p.byUser, userID)
+	return rename, true
+}
+
+// pageBounds clamps page into range and returns the slice bounds for it.
+func pageBounds(total, page, pageSize int) (start, end, clampedPage, pages int) {
+	pages = (total + pageSize - 1) / pageSize
+	if pages < 1 {
+		pages = 1
+	}
+	if page < 0 {
+		page = 0
+	}
+	if page >= pages {
+		page = pages - 1
+	}
+	start = page * pageSize
+	end = start + pageSize
+	if end > total {
+		end = total
+	}
+	return start, end, page, pages
+}
+
+// paginationRow builds the prev/position/next row shared by paginated keyboards.
+func paginationRow(markup *telebot.ReplyMarkup, unique string, page, pages int) telebot.Row {
+	if pages <= 1 {
+		return nil
+	}
+	row := telebot.Row{}
+	if page > 0 {
+		row = append(row, markup.Data("◀️ Prev", unique, "page", strconv.Itoa(page-1)))
+	}
+	row = append(row, markup.Data(fmt.Sprintf("%d/%d", page+1, pages), unique, "page", strconv.Itoa(page)))
+	if page < pages-1 {
+		row = append(row, markup.Data("Next ▶️", unique, "page", strconv.Itoa(page+1)))
+	}
+	return row
+}
+
+// splitCallbackData splits a callback payload into its action and argument.
+func splitCallbackData(data string) (action, arg string) {
+	action, arg, _ = strings.Cut(data, "|")
+	return action, arg
+}
+
+func callbackButtonText(text string, maxRunes int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= maxRunes {
+		return text
+	}
+	return string(runes[:maxRunes-1]) + "…"
+}
+
+// renderSessionsPage lists one page of sessions for userID with per-session buttons.
+// It also refreshes the numeric mapping used by the text commands.
+func (b *Bot) renderSessionsPage(userID int64, page int) (string, *telebot.ReplyMarkup, error) {
+	sessions, err := b.sessionManager.ListUserSessions(b.ctx, userID)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(sessions) == 0 {
+		return "You don't have any sessions yet. Use /new to create a new session.", nil, nil
+	}
+
+	b.sessionMappingMu.Lock()
+	b.sessionMapping[userID] = make(map[int]string)
+	numbers := make(map[string]int, len(sessions))
+	for i, sess := range sessions {
+		b.sessionMapping[userID][i+1] = sess.SessionID
+		numbers[sess.SessionID] = i + 1
+	}
+	b.sessionMappingMu.Unlock()
+	depths := sessionTreeDepths(sessions)
+
+	currentSessionID, hasCurrent := b.sessionManager.GetUserSession(userID)
+	start, end, page, pages := pageBounds(len(sessions), page, sessionsPageSize)
+
+	var sb strings.Builder
+	if pages > 1 {
+		fmt.Fprintf(&sb, "📋 Available Sessions (page %d/%d)\n\n", page+1, pages)
+	} else {
+		sb.WriteString("📋 Available Sessions\n\n")
+	}
+
+	markup := &telebot.ReplyMarkup{}
+	var rows []telebot.Row
+	for i := start; i < end; i++ {
+		sess := sessions[i]
+		isCurrent := hasCurrent && sess.SessionID == currentSessionID
+		writeSessionEntry(&sb, i+1, sess, isCurrent, depths[sess.SessionID], numbers[sess.ParentID])
+
+		label := fmt.Sprintf("%d. %s", i+1, callbackButtonText(sess.Name, 24))
+		if isCurrent {
+			label = "✅ " + label
+		}
+		rows = append(rows, markup.Row(
+			markup.Data(label, sessionsCallbackUnique, "switch", sess.SessionID),
+			markup.Data("✏️", sessionsCallbackUnique, "rename", sess.SessionID),
+			markup.Data("🗑️", sessionsCallbackUnique, "delete", sess.SessionID),
+		))
+	}
+	if row := paginationRow(markup, sessionsCallbackUnique, page, pages); row != nil {
+		rows = append(rows, row)
+	}
+	markup.Inline(rows...)
+
+	sb.WriteString("Tap a session to switch to it, or use /switch <number>, /rename <number> <name> and /delete <number>.")
+	return sb.String(), markup, nil
+}
+
+// sessionTreeDepths returns how deep each session is nested below the sessions
+// it was forked from. Sessions are expected in tree order, parents first.
+func sessionTreeDepths(sessions []*session.SessionMeta) map[string]int {
+	depths := make(map[string]int, len(sessions))
+	for _, sess := range sessions {
+		if parentDepth, ok := depths[sess.ParentID]; ok && sess.ParentID != "" {
+			depths[sess.SessionID] = parentDepth + 1
+		} else {
+			depths[sess.SessionID] = 0
+		}
+	}
+	return depths
+}
+
+// writeSessionEntry writes one /sessions entry; forks are indented below their
+// parent, whose list number is parentNumber (0 when not listed).
+func writeSessionEntry(sb *strings.Builder, number int, sess *session.SessionMeta, isCurrent bool, depth, parentNumber int) {
+	if depth > 0 {
+		sb.WriteString(strings.Repeat("   ", depth-1) + "└─ ")
+	}
+	if isCurrent {
+		fmt.Fprintf(sb, "[✅ CURRENT] %d. %s\n", number, sess.Name)
+	} else {
+		fmt.Fprintf(sb, "%d. %s\n", number, sess.Name)
+	}
+	sb.WriteString("────────────────\n")
+	if parentNumber > 0 {
+		fmt.Fprintf(sb, "• Forked from: #%d\n", parentNumber)
+	}
+	fmt.Fprintf(sb, "• Created: %s\n", sess.CreatedAt.Format("2006-01-02 15:04"))
+	fmt.Fprintf(sb, "• Last used: %s\n", sess.LastUsedAt.Format("2006-01-02 15:04"))
+	fmt.Fprintf(sb, "• Messages: %d\n", sess.MessageCount)
+
+	switch {
+	case sess.ProviderID != "" && sess.ModelID != "":
+		fmt.Fprintf(sb, "• Model: %s/%s\n", sess.ProviderID, sess.ModelID)
+	case sess.ModelID != "":
+		fmt.Fprintf(sb, "• Model: %s\n", sess.ModelID)
+	case sess.ProviderID != "":
+		fmt.Fprintf(sb, "• Model: %s\n", sess.ProviderID)
+	default:
+		sb.WriteString("• Model: Default\n")
+	}
+	sb.WriteString("\n")
+}
+
+// findUserSession returns the 0-based index and meta of sessionID among userID's sessions.
+func (b *Bot) findUserSession(userID int64, sessionID string) (int, *session.SessionMeta, error) {
+	sessions, err := b.sessionManager.ListUserSessions(b.ctx, userID)
+	if err != nil {
+		return 0, nil, err
+	}
+	for i, sess := range sessions {
+		if sess.SessionID == sessionID {
+			return i, sess, nil
+		}
+	}
+	return 0, nil, nil
+}
+
+// handleSessionsCallback handles presses on /sessions keyboard buttons.
+func (b *Bot) handleSessionsCallback(c telebot.Context) error {
+	action, arg := splitCallbackData(c.Callback().Data)
+	switch action {
+	case "page":
+		page, _ := strconv.Atoi(arg)
+		return b.editSessionsPage(c, page, "")
+	case "switch":
+		return b.withAccessControl("callback:sess:switch", roleOperator, b.handleSessionSwitchCallback)(c)
+	case "rename":
+		return b.withAccessControl("callback:sess:rename", roleOperator, b.handleSessionRenameCallback)(c)
+	case "delete", "delok":
+		return b.withAccessControl("callback:sess:delete", roleOperator, b.handleSessionDeleteCallback)(c)
+	default:
+		return c.Respond(&telebot.CallbackResponse{Text: "Unknown action."})
+	}
+}
+
+func (b *Bot) editSessionsPage(c telebot.Context, page int, notice string) error {
+	text, markup, err := b.renderSessionsPage(c.Sender().ID, page)
+	if err != nil {
+		log.Errorf("Failed to list sessions: %v", err)
+		return c.Respond(&telebot.CallbackResponse{Text: fmt.Sprintf("Failed to get session list: %v", err), ShowAlert: true})
+	}
+	if err := c.Edit(text, markup); err != nil && !isMessageNotModifiedError(err) {
+		return err
+	}
+	return c.Respond(&telebot.CallbackResponse{Text: notice})
+}
+
+func (b *Bot) handleSessionSwitchCallback(c telebot.Context) error {
+	userID := c.Sender().ID
+	_, sessionID := splitCallbackData(c.Callback().Data)
+
+	index, sess, err := b.findUserSession(userID, sessionID)
+	if err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: fmt.Sprintf("Failed to get session list: %v", err), ShowAlert: true})
+	}
+	if sess == nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "Session not found.", ShowAlert: true})
+	}
+	if err := b.sessionManager.SetUserSession(userID, sessionID); err != nil {
+		log.Errorf("Failed to switch session: %v", err)
+		return c.Respond(&telebot.CallbackResponse{Text: fmt.Sprintf("Failed to switch session: %v", err), ShowAlert: true})
+	}
+	return b.editSessionsPage(c, index/sessionsPageSize, fmt.Sprintf("✅ Switched to %s", sess.Name))
+}
+
+func (b *Bot) handleSessionRenameCallback(c telebot.Context) error {
+	userID := c.Sender().ID
+	_, sessionID := splitCallbackData(c.Callback().Data)
+
+	_, sess, err := b.findUserSession(userID, sessionID)
+	if err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: fmt.Sprintf("Failed to get session list: %v", err), ShowAlert: true})
+	}
+	if sess == nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "Session not found.", ShowAlert: true})
+	}
+
+	prompt, err := c.Bot().Send(c.Chat(), fmt.Sprintf("✏️ Reply to this message with the new name for '%s'.", sess.Name), &telebot.ReplyMarkup{ForceReply: true, Selective: true})
+	if err != nil {
+		return err
+	}
+	b.renames.set(userID, pendingRename{sessionID: sessionID, promptID: prompt.ID})
+	return c.Respond(&telebot.CallbackResponse{})
+}
+
+// consumePendingRename applies a rename when the message answers a rename prompt.
+func (b *Bot) consumePendingRename(c telebot.Context) (bool, error) {
+	msg := c.Message()
+	if msg == nil || msg.ReplyTo == nil || c.Sender() == nil {
+		return false, nil
+	}
+	rename, ok := b.renames.take(c.Sender().ID, msg.ReplyTo.ID)
+	if !ok {
+		return false, nil
+	}
+
+	newName := strings.TrimSpace(msg.Text)
+	if newName == "" {
+		return true, c.Send("Session name cannot be empty.")
+	}
+	if err := b.sessionManager.RenameSession(b.ctx, c.Sender().ID, rename.sessionID, newName); err != nil {
+		log.Errorf("Failed to rename session: %v", err)
+		return true, c.Send(fmt.Sprintf("Failed to rename session: %v", err))
+	}
+	return true, c.Send(fmt.Sprintf("✅ Session renamed to '%s'", newName))
+}
+
+func (b *Bot) handleSessionDeleteCallback(c telebot.Context) error {
+	userID := c.Sender().ID
+	action, sessionID := splitCallbackData(c.Callback().Data)
+
+	index, sess, err := b.findUserSession(userID, sessionID)
+	if err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: fmt.Sprintf("Failed to get session list: %v", err), ShowAlert: true})
+	}
+	if sess == nil {
+		return c.Respond(&telebot.CallbackResponse{Text: "Session not found.", ShowAlert: true})
+	}
+	page := index / sessionsPageSize
+
+	if action == "delete" {
+		markup := &telebot.ReplyMarkup{}
+		markup.Inline(markup.Row(
+			markup.Data("🗑️ Yes, delete", sessionsCallbackUnique, "delok", sessionID),
+			markup.Data("Cancel", sessionsCallbackUnique, "page", strconv.Itoa(page)),
+		))
+		text := fmt.Sprintf("Delete session %d. %s?\n\nThis cannot be undone.", index+1, sess.Name)
+		if err := c.Edit(text, markup); err != nil && !isMessageNotModifiedError(err) {
+			return err
+		}
+		return c.Respond(&telebot.CallbackResponse{})
+	}
+
+	if err := b.sessionManager.DeleteSession(b.ctx, sessionID); err != nil {
+		log.Errorf("Failed to delete session: %v", err)
+		return c.Respond(&telebot.CallbackResponse{Text: fmt.Sprintf("Failed to delete session: %v", err), ShowAlert: true})
+	}
+	return b.editSessionsPage(c, page, "🗑️ Session deleted")
+}
+
+// modelCallbackKey encodes a provider/model pair for callback data, hashing keys
+// that would not fit. Both forms are stable across restarts.
+func modelCallbackKey(providerID, modelID string) string {
+	key := modelMappingKey(providerID, modelID)
+	if len("\f"+modelsCallbackUnique+"|set|"+key) <= maxCallbackDataLen {
+		return key
+	}
+	sum := sha1.Sum([]byte(key))
+	return "#" + hex.EncodeToString(sum[:])[:20]
+}
+
+// sortedModelSelections returns the global model mapping grouped by provider and ordered by number.
+func (b *Bot) sortedModelSelections() []numberedModelSelection {
+	b.globalModelMappingMu.RLock()
+	models := make([]numberedModelSelection, 0, len(b.globalModelMapping))
+	for number, selection := range b.globalModelMapping {
+		models = append(models, numberedModelSelection{Number: number, Selection: selection})
+	}
+	b.globalModelMappingMu.RUnlock()
+
+	sort.Slice(models, func(i, j int) bool {
+		left, right := models[i].Selection, models[j].Selection
+		if left.ProviderID != right.ProviderID {
+			leftName, rightName := strings.ToLower(providerDisplayName(left)), strings.ToLower(providerDisplayName(right))
+			if leftName != rightName {
+				return leftName < rightName
+			}
+			return left.ProviderID < right.ProviderID
+		}
+		return models[i].Number < models[j].Number
+	})
+	return models
+}
+
+type numberedModelSelection struct {
+	Number    int
+	Selection modelSelection
+}
+
+func providerDisplayName(selection modelSelection) string {
+	if name := strings.TrimSpace(selection.ProviderName); name != "" {
+		return name
+	}
+	return selection.ProviderID
+}
+
+// findModelByCallbackKey resolves a key produced by modelCallbackKey.
+func (b *Bot) findModelByCallbackKey(key string) (modelSelection, bool) {
+	for _, model := range b.sortedModelSelections() {
+		if modelCallbackKey(model.Selection.ProviderID, model.Selection.ModelID) == key {
+			return model.Selection, true
+		}
+	}
+	return modelSelection{}, false
+}
+
+// renderModelsPage lists one page of connected models with a button per model.
+func (b *Bot) renderModelsPage(userID int64, page int) (string, *telebot.ReplyMarkup) {
+	models := b.sortedModelSelections()
+	if len(models) == 0 {
+		return "📋 Connected Providers\n\n⚠️ No connected AI providers.\nPlease configure API keys for at least one AI provider first.", nil
+	}
+
+	var currentKey string
+	if sessionID, ok := b.sessionManager.GetUserSession(userID); ok {
+		if meta, exists := b.sessionManager.GetSessionMeta(sessionID); exists && meta.ProviderID != "" && meta.ModelID != "" {
+			currentKey = modelMappingKey(meta.ProviderID, meta.ModelID)
+		}
+	}
+
+	start, end, page, pages := pageBounds(len(models), page, modelsPageSize)
+
+	var sb strings.Builder
+	if pages > 1 {
+		fmt.Fprintf(&sb, "📋 Connected Providers (page %d/%d)\n", page+1, pages)
+	} else {
+		sb.WriteString("📋 Connected Providers\n")
+	}
+
+	markup := &telebot.ReplyMarkup{}
+	var rows []telebot.Row
+	lastProvider := ""
+	for _, model := range models[start:end] {
+		selection := model.Selection
+		if selection.ProviderID != lastProvider {
+			fmt.Fprintf(&sb, "\n%s (%s)\n────────────────\n", providerDisplayName(selection), selection.ProviderID)
+			lastProvider = selection.ProviderID
+		}
+
+		marker := ""
+		if modelMappingKey(selection.ProviderID, selection.ModelID) == currentKey {
+			marker = "✅ "
+		}
+		fmt.Fprintf(&sb, "%s%d. %s\n", marker, model.Number, selection.ModelName)
+
+		label := fmt.Sprintf("%s%d. %s (%s)", marker, model.Number, callbackButtonText(selection.ModelName, 28), callbackButtonText(selection.ProviderID, 16))
+		rows = append(rows, markup.Row(markup.Data(label, modelsCallbackUnique, "set", modelCallbackKey(selection.ProviderID, selection.ModelID))))
+	}
+	if row := paginationRow(markup, modelsCallbackUnique, page, pages); row != nil {
+		rows = append(rows, row)
+	}
+	markup.Inline(rows...)
+
+	sb.WriteString("\nTap a model or use /setmodel <number> to set it for the current session.\n")
+	sb.WriteString("Use /new <name> to create new session (uses your current model).")
+	return sb.String(), markup
+}
+
+// handleModelsCallback handles presses on /models keyboard buttons.
+func (b *Bot) handleModelsCallback(c telebot.Context) error {
+	action, arg := splitCallbackData(c.Callback().Data)
+	switch action {
+	case "page":
+		page, _ := strconv.Atoi(arg)
+		return b.editModelsPage(c, page, "")
+	case "set":
+		return b.withAccessControl("callback:model:set", roleOperator, b.handleModelSetCallback)(c)
+	default:
+		return c.Respond(&telebot.CallbackResponse{Text: "Unknown action."})
+	}
+}
+
+func (b *Bot) editModelsPage(c telebot.Context, page int, notice string) error {
+	text, markup := b.renderModelsPage(c.Sender().ID, page)
+	if err := c.Edit(text, markup); err != nil && !isMessageNotModifiedError(err) {
+		return err
+	}
+	return c.Respond(&telebot.CallbackResponse{Text: notice})
+}
+
+func (b *Bot) handleModelSetCallback(c telebot.Context) error {
+	userID := c.Sender().ID
+	_, key := splitCallbackData(c.Callback().Data)
+
+	selection, ok := b.findModelByCallbackKey(key)
+	if !ok {
+		// The mapping may predate a provider change; refresh once before giving up.
+		b.buildGlobalModelMapping(b.ctx)
+		selection, ok = b.findModelByCallbackKey(key)
+	}
+	if !ok {
+		return c.Respond(&telebot.CallbackResponse{Text: "Model is no longer available. Use /models to refresh.", ShowAlert: true})
+	}
+
+	sessionID, exists := b.sessionManager.GetUserSession(userID)
+	if !exists {
+		return c.Respond(&telebot.CallbackResponse{Text: "You don't have a current session. Use /new to create a new session.", ShowAlert: true})
+	}
+	if err := b.sessionManager.SetSessionModel(b.ctx, sessionID, selection.ProviderID, selection.ModelID); err != nil {
+		log.Errorf("Failed to set session model: %v", err)
+		return c.Respond(&telebot.CallbackResponse{Text: fmt.Sprintf("Failed to set model: %v", err), ShowAlert: true})
+	}
+	if err := b.sessionManager.SetUserLastModel(userID, selection.ProviderID, selection.ModelID); err != nil {
+		log.Warnf("Failed to persist user %d current model after model button: %v", userID, err)
+	}
+
+	log.Infof("Successfully set model for user %d session %s to %s/%s", userID, sessionID, selection.ProviderID, selection.ModelID)
+	page := 0
+	for i, model := range b.sortedModelSelections() {
+		if model.Selection == selection {
+			page = i / modelsPageSize
+			break
+		}
+	}
+	return b.editModelsPage(c, page, fmt.Sprintf("✅ Model set to %s", selection.ModelName))
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tg-bot/internal/opencode"
+	"tg-bot/internal/session"
+	"tg-bot/internal/storage"
+)
+
+func TestPageBounds(t *testing.T) {
+	tests := []struct {
+		name                string
+		total, page, size   int
+		wantStart, wantEnd  int
+		wantPage, wantPages int
+	}{
+		{"empty list", 0, 0, 5, 0, 0, 0, 1},
+		{"first page", 12, 0, 5, 0, 5, 0, 3},
+		{"last partial page", 12, 2, 5, 10, 12, 2, 3},
+		{"page past end is clamped", 12, 9, 5, 10, 12, 2, 3},
+		{"negative page is clamped", 12, -1, 5, 0, 5, 0, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, page, pages := pageBounds(tt.total, tt.page, tt.size)
+			if start != tt.wantStart || end != tt.wantEnd || page != tt.wantPage || pages != tt.wantPages {
+				t.Fatalf("pageBounds(%d, %d, %d) = %d, %d, %d, %d; want %d, %d, %d, %d",
+					tt.total, tt.page, tt.size, start, end, page, pages,
+					tt.wantStart, tt.wantEnd, tt.wantPage, tt.wantPages)
+			}
+		})
+	}
+}
+
+func TestModelCallbackKey_FitsTelegramLimit(t *testing.T) {
+	short := modelCallbackKey("openai", "gpt-4o")
+	if short != "openai/gpt-4o" {
+		t.Fatalf("short keys should be encoded verbatim, got %q", short)
+	}
+
+	longModelID := strings.Repeat("very-long-model-name-", 4)
+	long := modelCallbackKey("openrouter", longModelID)
+	if !strings.HasPrefix(long, "#") {
+		t.Fatalf("long keys should be hashed, got %q", long)
+	}
+	if got := len("\f" + modelsCallbackUnique + "|set|" + long); got > maxCallbackDataLen {
+		t.Fatalf("callback data is %d bytes, limit is %d", got, maxCallbackDataLen)
+	}
+	if again := modelCallbackKey("openrouter", longModelID); again != long {
+		t.Fatalf("hashed key must be stable, got %q and %q", long, again)
+	}
+}
+
+func TestRenderModelsPage_EncodesStableKeys(t *testing.T) {
+	store, err := storage.NewStore(storage.Options{
+		Type:     "file",
+		FilePath: filepath.Join(t.TempDir(), "bot-state.json"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	longModelID := strings.Repeat("m", 80)
+	b := &Bot{
+		sessionManager: session.NewManagerWithStore(opencode.NewClient("http://127.0.0.1:8080", 1), store),
+		globalModelMapping: map[int]modelSelection{
+			1: {ProviderID: "zeta", ProviderName: "Zeta", ModelID: "z-1", ModelName: "Z One"},
+			2: {ProviderID: "alpha", ProviderName: "Alpha", ModelID: "a-1", ModelName: "A One"},
+			3: {ProviderID: "alpha", ProviderName: "Alpha", ModelID: longModelID, ModelName: "A Long"},
+		},
+	}
+
+	text, markup := b.renderModelsPage(42, 0)
+	if strings.Index(text, "Alpha (alpha)") > strings.Index(text, "Zeta (zeta)") {
+		t.Fatalf("providers should be grouped alphabetically:\n%s", text)
+	}
+	if markup == nil || len(markup.InlineKeyboard) != 3 {
+		t.Fatalf("expected one button row per model, got %#v", markup)
+	}
+
+	for _, row := range markup.InlineKeyboard {
+		data := row[0].Data
+		if len("\f"+modelsCallbackUnique+"|"+data) > maxCallbackDataLen {
+			t.Fatalf("callback data %q exceeds Telegram limit", data)
+		}
+		action, key := splitCallbackData(data)
+		if action != "set" {
+			t.Fatalf("unexpected action %q", action)
+		}
+		if _, ok := b.findModelByCallbackKey(key); !ok {
+			t.Fatalf("callback key %q does not resolve to a model", key)
+		}
+	}
+}
+
+func TestPendingRenames_TakeRequiresMatchingPrompt(t *testing.T) {
+	var renames pendingRenames
+	renames.set(7, pendingRename{sessionID: "ses_1", promptID: 100})
+
+	if _, ok := renames.take(7, 99); ok {
+		t.Fatal("reply to another message must not consume the rename")
+	}
+	rename, ok := renames.take(7, 100)
+	if !ok || rename.sessionID != "ses_1" {
+		t.Fatalf("expected rename for ses_1, got %#v, %v", rename, ok)
+	}
+	if _, ok := renames.take(7, 100); ok {
+		t.Fatal("rename should only be consumed once")
+	}
+}
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"tg-bot/internal/render"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/telebot.v4"
+)
+
+// longReplyTailSize is roughly how much of an oversized reply stays visible in chat.
+const longReplyTailSize = 1500
+
+// isOversizedReply reports whether content, split into chunks messages, is
+// over one of the configured document thresholds.
+func (b *Bot) isOversizedReply(content string, chunks int) bool {
+	if b.config == nil {
+		return false
+	}
+	cfg := b.config.Render
+	if cfg.DocumentThreshold > 0 && utf8.RuneCountInString(content) > cfg.DocumentThreshold {
+		return true
+	}
+	return cfg.DocumentMaxMessages > 0 && chunks > cfg.DocumentMaxMessages
+}
+
+// replyTail returns the end of content, cut at a line boundary. A code fence
+// left open by the cut is reopened so the tail still renders as code.
+func replyTail(content string, size int) string {
+	if len(content) <= size {
+		return content
+	}
+	cut := len(content) - size
+	if nl := strings.IndexByte(content[cut:], '\n'); nl >= 0 && nl < size/2 {
+		cut += nl + 1
+	} else {
+		for cut < len(content) && !utf8.RuneStart(content[cut]) {
+			cut++
+		}
+	}
+
+	tail := content[cut:]
+	fenceLen := 0
+	for _, line := range strings.Split(content[:cut], "\n") {
+		trimmed := strings.TrimSpace(line)
+		if fenceLen == 0 {
+			fenceLen = render.CodeFenceLength(trimmed)
+		} else if render.ClosesCodeFence(trimmed, fenceLen) {
+			fenceLen = 0
+		}
+	}
+	if fenceLen > 0 {
+		tail = strings.Repeat("`", fenceLen) + "\n" + tail
+	}
+	return tail
+}
+
+// formatLongReplyTail is the single message shown in place of an oversized
+// reply: a note followed by the latest part of the reply.
+func formatLongReplyTail(content string, complete bool) string {
+	note := "📄 Long reply — showing the latest part; the full reply will be attached when it finishes."
+	if complete {
+		note = fmt.Sprintf("📄 The reply is too long for chat (%d characters, %d lines), so it is attached as reply.md. Its last part:",
+			utf8.RuneCountInString(content), strings.Count(content, "\n")+1)
+	}
+	return note + "\n\n…\n" + replyTail(content, longReplyTailSize)
+}
+
+// formatLongReplyStopped replaces the streaming note of an oversized reply
+// that ended early, since the reply would otherwise never be attached.
+func formatLongReplyStopped(content string, taskErr error) string {
+	reason := "The task was aborted"
+	if !errors.Is(taskErr, context.Canceled) {
+		reason = fmt.Sprintf("The task failed: %v", taskErr)
+	}
+	note := fmt.Sprintf("📄 %s. The reply so far (%d characters, %d lines) is attached as reply.md. Its last part:",
+		reason, utf8.RuneCountInString(content), strings.Count(content, "\n")+1)
+	return note + "\n\n…\n" + replyTail(content, longReplyTailSize)
+}
+
+// sendLongReply shows the final view of an oversized reply and attaches it.
+func (b *Bot) sendLongReply(state *streamingState, displays []string, content string) {
+	b.updateStreamingTelegramMessages(state, displays)
+	if state.telegramCtx == nil {
+		return
+	}
+	for _, doc := range b.longReplyDocuments(content) {
+		if err := state.telegramCtx.Send(doc); err != nil {
+			log.Warnf("Failed to send %s for session %s: %v", doc.FileName, state.sessionID, err)
+		}
+	}
+}
+
+// longReplyDocuments returns the attachments for an oversized reply: the
+// markdown source and, when enabled, a rendered HTML copy.
+func (b *Bot) longReplyDocuments(content string) []*telebot.Document {
+	docs := []*telebot.Document{{
+		File:     telebot.FromReader(strings.NewReader(strings.TrimRight(content, "\n") + "\n")),
+		FileName: "reply.md",
+		MIME:     "text/markdown",
+		Caption:  "Full reply",
+	}}
+	if b.config != nil && b.config.Render.DocumentHTML {
+		page := "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>OpenCode reply</title>\n" +
+			"<style>body { font-family: sans-serif; white-space: pre-wrap; max-width: 60em; margin: 2em auto; }</style>\n" +
+			"</head>\n<body>\n" + render.MarkdownToTelegramHTML(content) + "\n</body>\n</html>\n"
+		docs = append(docs, &telebot.Document{
+			File:     telebot.FromReader(strings.NewReader(page)),
+			FileName: "reply.html",
+			MIME:     "text/html",
+			Caption:  "Full reply (rendered)",
+		})
+	}
+	return docs
+}
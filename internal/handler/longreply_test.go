@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"tg-bot/internal/config"
+	"tg-bot/internal/opencode"
+	"tg-bot/internal/render"
+
+	"gopkg.in/telebot.v4"
+)
+
+func TestReplyTail(t *testing.T) {
+	if got := replyTail("short", 100); got != "short" {
+		t.Fatalf("short content should be kept whole, got %q", got)
+	}
+
+	content := "intro\n```go\n" + strings.Repeat("x := 1\n", 100) + "```"
+	tail := replyTail(content, 50)
+	if !strings.HasPrefix(tail, "```\nx := 1\n") {
+		t.Fatalf("tail cut inside a fence should reopen it, got %q", tail)
+	}
+	if !strings.HasSuffix(content, strings.TrimPrefix(tail, "```\n")) {
+		t.Fatalf("tail should be the end of the content, got %q", tail)
+	}
+
+	content = "````diff\n ```sh\n" + strings.Repeat("+make all\n", 100) + "````"
+	if tail := replyTail(content, 50); !strings.HasPrefix(tail, "````\n+make all\n") {
+		t.Fatalf("tail should reopen the diff's longer fence, got %q", tail)
+	}
+
+	tail = replyTail(strings.Repeat("é", 100), 51)
+	if !strings.HasPrefix(tail, "é") || strings.Count(tail, "é") != 25 {
+		t.Fatalf("tail should be cut at a rune boundary, got %q", tail)
+	}
+}
+
+func TestBuildEventDrivenReply_Oversized(t *testing.T) {
+	var text strings.Builder
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&text, "Step %d of the plan\n", i)
+	}
+	state := &streamingState{
+		updateMutex:  &sync.Mutex{},
+		displayOrder: []string{"msg_1"},
+		eventMessages: map[string]*eventMessageState{
+			"msg_1": {
+				Info:      opencode.MessageInfo{ID: "msg_1", SessionID: "ses_1", Role: "assistant"},
+				PartOrder: []string{"prt_1"},
+				Parts: map[string]opencode.MessagePartResponse{
+					"prt_1": {ID: "prt_1", SessionID: "ses_1", MessageID: "msg_1", Type: "text", Text: text.String()},
+				},
+			},
+		},
+	}
+
+	if displays, longReply := (&Bot{}).buildEventDrivenReplyLocked(state); longReply != "" || len(displays) != 2 {
+		t.Fatalf("without thresholds the reply should be paged as usual: %d page(s), long reply %q", len(displays), longReply)
+	}
+
+	b := &Bot{config: &config.Config{Render: config.RenderConfig{DocumentThreshold: 500}}}
+	displays, longReply := b.buildEventDrivenReplyLocked(state)
+	if len(displays) != 1 || !strings.Contains(displays[0], "showing the latest part") {
+		t.Fatalf("expected a single tail page while streaming, got %#v", displays)
+	}
+	if !strings.Contains(displays[0], "Step 199 of the plan") || strings.Contains(displays[0], "Step 1 of the plan") {
+		t.Fatalf("expected only the latest part, got %q", displays[0])
+	}
+	if !strings.Contains(longReply, "Step 1 of the plan") {
+		t.Fatalf("expected the full reply for the document, got %q", longReply)
+	}
+
+	state.todos = []opencode.Todo{{ID: "1", Content: "Write the plan", Status: "in_progress"}}
+	displays, longReply = b.buildEventDrivenReplyLocked(state)
+	if len(displays) != 1 || !strings.HasPrefix(displays[0], "📝 Todo (0/1 done)") || strings.Contains(longReply, "Write the plan") {
+		t.Fatalf("checklist should stay on the tail page and out of the document: %#v", displays)
+	}
+
+	state.isComplete = true
+	displays, _ = b.buildEventDrivenReplyLocked(state)
+	if !strings.Contains(displays[0], "attached as reply.md") {
+		t.Fatalf("expected the final summary, got %q", displays[0])
+	}
+
+	b.config.Render = config.RenderConfig{DocumentMaxMessages: 2}
+	if _, longReply := b.buildEventDrivenReplyLocked(state); longReply != "" {
+		t.Fatal("a reply within the message limit is not oversized")
+	}
+	b.config.Render = config.RenderConfig{DocumentMaxMessages: 1}
+	if _, longReply := b.buildEventDrivenReplyLocked(state); longReply == "" {
+		t.Fatal("a reply over the message limit should be oversized")
+	}
+}
+
+func TestLongReplyDocuments(t *testing.T) {
+	b := &Bot{config: &config.Config{}}
+	docs := b.longReplyDocuments("**done**")
+	if len(docs) != 1 || docs[0].FileName != "reply.md" {
+		t.Fatalf("expected only reply.md, got %#v", docs)
+	}
+
+	b.config.Render.DocumentHTML = true
+	docs = b.longReplyDocuments("**done**")
+	if len(docs) != 2 || docs[1].FileName != "reply.html" || docs[1].MIME != "text/html" {
+		t.Fatalf("expected reply.md and reply.html, got %#v", docs)
+	}
+}
+
+func TestUpdateStreamingTelegramMessages_DropsSurplusPages(t *testing.T) {
+	tgBot, recorder := newTestTelegramBot(t)
+	b := &Bot{renderer: render.New("plain")}
+	state := &streamingState{
+		telegramCtx: tgBot.NewContext(telebot.Update{Message: &telebot.Message{
+			ID:   1,
+			Chat: &telebot.Chat{ID: 100, Type: telebot.ChatPrivate},
+		}}),
+	}
+
+	b.updateStreamingTelegramMessages(state, []string{"page 1", "page 2", "page 3"})
+	if len(state.telegramMessages) != 3 {
+		t.Fatalf("expected 3 pages, got %d", len(state.telegramMessages))
+	}
+
+	b.updateStreamingTelegramMessages(state, []string{"tail"})
+	if len(state.telegramMessages) != 1 || len(state.lastRendered) != 1 || state.lastRendered[0] != "tail" {
+		t.Fatalf("expected a single page left, got %d message(s), rendered %#v", len(state.telegramMessages), state.lastRendered)
+	}
+	if deleted := recorder.Calls("deleteMessage"); len(deleted) != 2 {
+		t.Fatalf("expected the 2 surplus pages to be deleted, got %d call(s)", len(deleted))
+	}
+}
+
+func TestSendLongReply_AttachesStoppedReply(t *testing.T) {
+	tgBot, recorder := newTestTelegramBot(t)
+	b := &Bot{config: &config.Config{}, renderer: render.New("plain")}
+	state := &streamingState{
+		sessionID: "ses_1",
+		telegramCtx: tgBot.NewContext(telebot.Update{Message: &telebot.Message{
+			ID:   1,
+			Chat: &telebot.Chat{ID: 100, Type: telebot.ChatPrivate},
+		}}),
+	}
+	content := strings.Repeat("partial line\n", 300)
+
+	aborted := formatLongReplyStopped(content, context.Canceled)
+	if !strings.Contains(aborted, "aborted") || strings.Contains(aborted, "will be attached when it finishes") {
+		t.Fatalf("unexpected note for an aborted reply: %q", aborted)
+	}
+	failed := formatLongReplyStopped(content, errors.New("session error"))
+	if !strings.Contains(failed, "failed: session error") {
+		t.Fatalf("unexpected note for a failed reply: %q", failed)
+	}
+
+	b.sendLongReply(state, []string{aborted}, content)
+	if docs := recorder.Calls("sendDocument"); len(docs) != 1 || !strings.Contains(docs[0].Body, "reply.md") {
+		t.Fatalf("expected the partial reply as reply.md, got %#v", docs)
+	}
+	if sent := recorder.Calls("sendMessage"); len(sent) != 1 || !strings.Contains(sent[0].Body, "aborted") {
+		t.Fatalf("expected the stopped note in chat, got %#v", sent)
+	}
+}
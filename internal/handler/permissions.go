@@ -0,0 +1,397 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"tg-bot/internal/opencode"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/telebot.v4"
+)
+
+// permissionCallbackUnique identifies inline buttons of permission prompts.
+const permissionCallbackUnique = "perm"
+
+const (
+	// A failed auto-reject is retried after permissionRetryDelay, doubling up
+	// to permissionRetryMaxDelay, so the request does not stay pending forever.
+	permissionRetryDelay    = 10 * time.Second
+	permissionRetryMaxDelay = 5 * time.Minute
+)
+
+// pendingPermission is an OpenCode permission request awaiting a Telegram answer.
+type pendingPermission struct {
+	request   *opencode.PermissionRequest
+	createdAt time.Time
+
+	// telegramCtx and message locate the prompt; both are nil when no task
+	// of this bot was running for the session when the request arrived.
+	telegramCtx telebot.Context
+	message     *telebot.Message
+
+	timer     *time.Timer
+	resolving bool
+	retries   int // failed auto-reject attempts
+}
+
+func (b *Bot) permissionTimeout() time.Duration {
+	if b.config == nil || b.config.OpenCode.PermissionTimeout <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(b.config.OpenCode.PermissionTimeout) * time.Second
+}
+
+// handlePermissionRequestEvent registers a permission request and posts an approval prompt
+// to the chat that started the session's running task.
+func (b *Bot) handlePermissionRequestEvent(event opencode.SessionEvent) {
+	req, err := opencode.ParsePermissionRequest(event)
+	if err != nil {
+		log.Warnf("Ignoring malformed permission event: %v", err)
+		return
+	}
+
+	b.permissionMu.Lock()
+	if b.pendingPermissions == nil {
+		b.pendingPermissions = make(map[string]*pendingPermission)
+	}
+	if _, exists := b.pendingPermissions[req.ID]; exists {
+		b.permissionMu.Unlock()
+		return
+	}
+	pending := &pendingPermission{
+		request:   req,
+		createdAt: time.Now(),
+	}
+	b.pendingPermissions[req.ID] = pending
+	b.armPermissionTimerLocked(pending, b.permissionTimeout())
+	b.permissionMu.Unlock()
+
+	log.Infof("OpenCode permission requested: session=%s permission=%s type=%s", req.SessionID, req.ID, req.Type)
+
+	b.streamingStateMu.RLock()
+	state := b.streamingStates[req.SessionID]
+	b.streamingStateMu.RUnlock()
+	if state == nil || state.telegramCtx == nil {
+		log.Warnf("No active Telegram chat for permission %s in session %s; waiting for /pending", req.ID, req.SessionID)
+		return
+	}
+
+	msg, err := state.telegramCtx.Bot().Send(state.telegramCtx.Chat(), formatPermissionPrompt(req), permissionKeyboard(req.ID))
+	if err != nil {
+		log.Warnf("Failed to post permission prompt %s: %v", req.ID, err)
+		return
+	}
+
+	b.permissionMu.Lock()
+	pending.telegramCtx = state.telegramCtx
+	pending.message = msg
+	b.permissionMu.Unlock()
+}
+
+// armPermissionTimerLocked schedules the auto-reject of pending after delay.
+// The caller must hold permissionMu.
+func (b *Bot) armPermissionTimerLocked(pending *pendingPermission, delay time.Duration) {
+	pending.timer = time.AfterFunc(delay, func() {
+		b.autoRejectPermission(pending)
+	})
+}
+
+// autoRejectPermission rejects a request nobody answered in time. When
+// OpenCode cannot be reached the attempt is retried with a growing delay.
+func (b *Bot) autoRejectPermission(pending *pendingPermission) {
+	permissionID := pending.request.ID
+	err := b.resolvePermission(permissionID, opencode.PermissionResponseReject, "⌛ Timed out, rejected automatically")
+	if err == nil {
+		return
+	}
+
+	b.permissionMu.Lock()
+	defer b.permissionMu.Unlock()
+	if b.pendingPermissions[permissionID] != pending || b.ctx.Err() != nil {
+		return
+	}
+	pending.retries++
+	delay := permissionRetryDelay << min(pending.retries-1, 5)
+	if delay > permissionRetryMaxDelay {
+		delay = permissionRetryMaxDelay
+	}
+	log.Warnf("Failed to auto-reject permission %s, retrying in %v: %v", permissionID, delay, err)
+	b.armPermissionTimerLocked(pending, delay)
+}
+
+// handlePermissionRepliedEvent clears a prompt that was answered outside Telegram.
+func (b *Bot) handlePermissionRepliedEvent(event opencode.SessionEvent) {
+	var payload opencode.PermissionRepliedProperties
+	if err := json.Unmarshal(event.Properties, &payload); err != nil {
+		return
+	}
+	permissionID := payload.PermissionID
+	if permissionID == "" {
+		permissionID = payload.RequestID
+	}
+	response := payload.Response
+	if response == "" {
+		response = payload.Reply
+	}
+
+	b.permissionMu.Lock()
+	pending, exists := b.pendingPermissions[permissionID]
+	if !exists || pending.resolving {
+		b.permissionMu.Unlock()
+		return
+	}
+	delete(b.pendingPermissions, permissionID)
+	if pending.timer != nil {
+		pending.timer.Stop()
+	}
+	b.permissionMu.Unlock()
+
+	b.finalizePermissionPrompt(pending, fmt.Sprintf("Answered in OpenCode: %s", response))
+}
+
+// resolvePermission sends response to OpenCode and updates the Telegram prompt with outcome.
+func (b *Bot) resolvePermission(permissionID, response, outcome string) error {
+	b.permissionMu.Lock()
+	pending, exists := b.pendingPermissions[permissionID]
+	if !exists {
+		b.permissionMu.Unlock()
+		return fmt.Errorf("permission request not found or already answered")
+	}
+	if pending.resolving {
+		b.permissionMu.Unlock()
+		return fmt.Errorf("permission request is already being answered")
+	}
+	pending.resolving = true
+	b.permissionMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(b.ctx, 10*time.Second)
+	err := b.opencodeClient.RespondPermission(ctx, pending.request.SessionID, permissionID, response)
+	cancel()
+
+	b.permissionMu.Lock()
+	pending.resolving = false
+	if err == nil {
+		delete(b.pendingPermissions, permissionID)
+		if pending.timer != nil {
+			pending.timer.Stop()
+		}
+	}
+	b.permissionMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("OpenCode permission answered: session=%s permission=%s response=%s", pending.request.SessionID, permissionID, response)
+	b.finalizePermissionPrompt(pending, outcome)
+	return nil
+}
+
+// finalizePermissionPrompt replaces the prompt buttons with the final outcome.
+func (b *Bot) finalizePermissionPrompt(pending *pendingPermission, outcome string) {
+	b.permissionMu.Lock()
+	c, msg := pending.telegramCtx, pending.message
+	b.permissionMu.Unlock()
+	if c == nil || msg == nil {
+		return
+	}
+
+	text := formatPermissionPrompt(pending.request) + "\n\n" + outcome
+	if _, err := c.Bot().Edit(msg, text); err != nil && !isMessageNotModifiedError(err) {
+		log.Warnf("Failed to update permission prompt %s: %v", pending.request.ID, err)
+	}
+}
+
+// hasPendingPermission reports whether sessionID is blocked on a permission request.
+func (b *Bot) hasPendingPermission(sessionID string) bool {
+	b.permissionMu.Lock()
+	defer b.permissionMu.Unlock()
+	for _, pending := range b.pendingPermissions {
+		if pending.request.SessionID == sessionID {
+			return true
+		}
+	}
+	return false
+}
+
+// stopPermissionTimers cancels all auto-reject timers on shutdown.
+func (b *Bot) stopPermissionTimers() {
+	b.permissionMu.Lock()
+	defer b.permissionMu.Unlock()
+	for _, pending := range b.pendingPermissions {
+		if pending.timer != nil {
+			pending.timer.Stop()
+		}
+	}
+}
+
+// canAnswerPermission reports whether the sender of c may see and answer req.
+// Admins may answer any request, everyone else only those in their own sessions.
+func (b *Bot) canAnswerPermission(c telebot.Context, req *opencode.PermissionRequest) bool {
+	if role, _, _ := b.roleForContext(c); role >= roleAdmin {
+		return true
+	}
+	sender := c.Sender()
+	if sender == nil || b.sessionManager == nil {
+		return false
+	}
+	meta, exists := b.sessionManager.GetSessionMeta(req.SessionID)
+	return exists && meta != nil && meta.UserID == sender.ID
+}
+
+// handlePermissionCallback handles presses on permission prompt buttons.
+func (b *Bot) handlePermissionCallback(c telebot.Context) error {
+	callback := c.Callback()
+	if callback == nil {
+		return nil
+	}
+
+	response, permissionID, ok := strings.Cut(callback.Data, "|")
+	if !ok || permissionID == "" {
+		return c.Respond(&telebot.CallbackResponse{Text: "Invalid permission button."})
+	}
+
+	var outcome string
+	switch response {
+	case opencode.PermissionResponseOnce:
+		outcome = "✅ Allowed once"
+	case opencode.PermissionResponseAlways:
+		outcome = "✅ Always allowed"
+	case opencode.PermissionResponseReject:
+		outcome = "🚫 Rejected"
+	default:
+		return c.Respond(&telebot.CallbackResponse{Text: "Invalid permission button."})
+	}
+	if sender := c.Sender(); sender != nil {
+		outcome = fmt.Sprintf("%s by %s", outcome, telegramUserLabel(sender))
+	}
+
+	b.permissionMu.Lock()
+	pending, exists := b.pendingPermissions[permissionID]
+	b.permissionMu.Unlock()
+	if exists && !b.canAnswerPermission(c, pending.request) {
+		log.Warnf("User %d may not answer permission %s in session %s", c.Sender().ID, permissionID, pending.request.SessionID)
+		return c.Respond(&telebot.CallbackResponse{Text: "This permission request belongs to another user's session.", ShowAlert: true})
+	}
+
+	b.permissionMu.Lock()
+	if exists && pending.message == nil {
+		// Prompt was re-posted from /pending; adopt this message for the final edit.
+		pending.telegramCtx = c
+		pending.message = callback.Message
+	}
+	b.permissionMu.Unlock()
+
+	if err := b.resolvePermission(permissionID, response, outcome); err != nil {
+		log.Warnf("Failed to answer permission %s: %v", permissionID, err)
+		return c.Respond(&telebot.CallbackResponse{Text: fmt.Sprintf("Failed: %v", err)})
+	}
+	return c.Respond(&telebot.CallbackResponse{Text: outcome})
+}
+
+// handlePending lists permission requests that are still waiting for an
+// answer in the caller's sessions, or in every session for admins.
+func (b *Bot) handlePending(c telebot.Context) error {
+	b.permissionMu.Lock()
+	candidates := make([]*pendingPermission, 0, len(b.pendingPermissions))
+	for _, pending := range b.pendingPermissions {
+		if !pending.resolving {
+			candidates = append(candidates, pending)
+		}
+	}
+	b.permissionMu.Unlock()
+
+	pendings := candidates[:0]
+	for _, pending := range candidates {
+		if b.canAnswerPermission(c, pending.request) {
+			pendings = append(pendings, pending)
+		}
+	}
+
+	if len(pendings) == 0 {
+		return c.Send("✅ No pending permission requests.")
+	}
+
+	sort.Slice(pendings, func(i, j int) bool {
+		return pendings[i].createdAt.Before(pendings[j].createdAt)
+	})
+
+	timeout := b.permissionTimeout()
+	for _, pending := range pendings {
+		remaining := time.Until(pending.createdAt.Add(timeout)).Round(time.Second)
+		if remaining < 0 {
+			remaining = 0
+		}
+		text := fmt.Sprintf("%s\n\n⏳ Auto-reject in %v", formatPermissionPrompt(pending.request), remaining)
+		msg, err := c.Bot().Send(c.Chat(), text, permissionKeyboard(pending.request.ID))
+		if err != nil {
+			return err
+		}
+
+		b.permissionMu.Lock()
+		if pending.message == nil {
+			pending.telegramCtx = c
+			pending.message = msg
+		}
+		b.permissionMu.Unlock()
+	}
+	return nil
+}
+
+func permissionKeyboard(permissionID string) *telebot.ReplyMarkup {
+	markup := &telebot.ReplyMarkup{}
+	markup.Inline(
+		markup.Row(
+			markup.Data("✅ Allow once", permissionCallbackUnique, opencode.PermissionResponseOnce, permissionID),
+			markup.Data("♾️ Always allow", permissionCallbackUnique, opencode.PermissionResponseAlways, permissionID),
+		),
+		markup.Row(
+			markup.Data("🚫 Reject", permissionCallbackUnique, opencode.PermissionResponseReject, permissionID),
+		),
+	)
+	return markup
+}
+
+// formatPermissionPrompt describes the tool and its arguments in plain text.
+func formatPermissionPrompt(req *opencode.PermissionRequest) string {
+	var sb strings.Builder
+	sb.WriteString("🔐 Permission requested\n\n")
+	if req.Type != "" {
+		fmt.Fprintf(&sb, "• Tool: %s\n", req.Type)
+	}
+	if title := strings.TrimSpace(req.Title); title != "" {
+		fmt.Fprintf(&sb, "• Action: %s\n", truncateAndInline(title, 300))
+	}
+	if len(req.Patterns) > 0 {
+		fmt.Fprintf(&sb, "• Patterns: %s\n", truncateAndInline(strings.Join(req.Patterns, ", "), 300))
+	}
+
+	keys := make([]string, 0, len(req.Metadata))
+	for key := range req.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := strings.TrimSpace(stringifyToolValue(req.Metadata[key]))
+		if value == "" || value == "null" {
+			continue
+		}
+		fmt.Fprintf(&sb, "• %s: %s\n", key, truncateMultiline(value, 600))
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+func telegramUserLabel(user *telebot.User) string {
+	if user.Username != "" {
+		return "@" + user.Username
+	}
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if name != "" {
+		return name
+	}
+	return fmt.Sprintf("user %d", user.ID)
+}
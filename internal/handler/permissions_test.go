@@ -0,0 +1,225 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tg-bot/internal/config"
+	"tg-bot/internal/opencode"
+	"tg-bot/internal/session"
+	"tg-bot/internal/storage"
+
+	"gopkg.in/telebot.v4"
+)
+
+func TestPermissionRequestFlow(t *testing.T) {
+	var mu sync.Mutex
+	var responses []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/session/ses_1/permissions/perm_1" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		responses = append(responses, body["response"])
+		mu.Unlock()
+		_, _ = w.Write([]byte("true"))
+	}))
+	defer server.Close()
+
+	tgBot, recorder := newTestTelegramBot(t)
+	b := &Bot{
+		config:         &config.Config{OpenCode: config.OpenCodeConfig{PermissionTimeout: 60}},
+		opencodeClient: opencode.NewClient(server.URL, 5),
+		ctx:            context.Background(),
+		access:         newAccessPolicy(config.AccessConfig{AdminUsers: []int64{1}}),
+		streamingStates: map[string]*streamingState{
+			"ses_1": {telegramCtx: newTestMessageContext(tgBot, 1, 100, telebot.ChatPrivate, "run it")},
+		},
+	}
+	defer b.stopPermissionTimers()
+
+	event := opencode.SessionEvent{
+		Type:       "permission.updated",
+		Properties: json.RawMessage(`{"id":"perm_1","sessionID":"ses_1","type":"bash","title":"go test ./...","metadata":{"command":"go test ./..."}}`),
+	}
+	b.handlePermissionRequestEvent(event)
+	b.handlePermissionRequestEvent(event) // duplicate event must not post twice
+
+	sent := recorder.Calls("sendMessage")
+	if len(sent) != 1 {
+		t.Fatalf("expected one permission prompt, got %d", len(sent))
+	}
+	if !strings.Contains(sent[0].Body, "go test ./...") || !strings.Contains(sent[0].Body, "inline_keyboard") {
+		t.Fatalf("prompt should describe the command and carry buttons: %s", sent[0].Body)
+	}
+	if !b.hasPendingPermission("ses_1") {
+		t.Fatal("expected session to have a pending permission")
+	}
+
+	callback := tgBot.NewContext(telebot.Update{
+		Callback: &telebot.Callback{
+			ID:      "cb_1",
+			Sender:  &telebot.User{ID: 1, Username: "alice"},
+			Data:    opencode.PermissionResponseOnce + "|perm_1",
+			Message: &telebot.Message{ID: 1, Chat: &telebot.Chat{ID: 100, Type: telebot.ChatPrivate}},
+		},
+	})
+	if err := b.handlePermissionCallback(callback); err != nil {
+		t.Fatalf("callback returned error: %v", err)
+	}
+
+	mu.Lock()
+	got := append([]string(nil), responses...)
+	mu.Unlock()
+	if len(got) != 1 || got[0] != opencode.PermissionResponseOnce {
+		t.Fatalf("expected a single %q response, got %v", opencode.PermissionResponseOnce, got)
+	}
+	if b.hasPendingPermission("ses_1") {
+		t.Fatal("permission should be cleared after answering")
+	}
+	edits := recorder.Calls("editMessageText")
+	if len(edits) != 1 || !strings.Contains(edits[0].Body, "Allowed once by @alice") {
+		t.Fatalf("expected prompt to be edited with the outcome, got %#v", edits)
+	}
+
+	// A second press on the stale button must not answer again.
+	if err := b.handlePermissionCallback(callback); err != nil {
+		t.Fatalf("callback returned error: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(responses) != 1 {
+		t.Fatalf("stale button must not send another response, got %v", responses)
+	}
+}
+
+func TestPermissionsLimitedToSessionOwner(t *testing.T) {
+	var mu sync.Mutex
+	var responses int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		responses++
+		mu.Unlock()
+		_, _ = w.Write([]byte("true"))
+	}))
+	defer server.Close()
+
+	store, err := storage.NewStore(storage.Options{
+		Type:     "file",
+		FilePath: filepath.Join(t.TempDir(), "bot-state.json"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	if err := store.StoreSessionMeta(&storage.SessionMeta{SessionID: "ses_1", UserID: 1, LastUsedAt: time.Now()}); err != nil {
+		t.Fatalf("failed to store session meta: %v", err)
+	}
+
+	client := opencode.NewClient(server.URL, 5)
+	tgBot, recorder := newTestTelegramBot(t)
+	b := &Bot{
+		config:         &config.Config{OpenCode: config.OpenCodeConfig{PermissionTimeout: 60}},
+		opencodeClient: client,
+		sessionManager: session.NewManagerWithStore(client, store),
+		access:         newAccessPolicy(config.AccessConfig{AdminUsers: []int64{9}, OperatorUsers: []int64{1, 2}}),
+		ctx:            context.Background(),
+	}
+	defer b.stopPermissionTimers()
+
+	b.handlePermissionRequestEvent(opencode.SessionEvent{
+		Type:       "permission.updated",
+		Properties: json.RawMessage(`{"id":"perm_1","sessionID":"ses_1","type":"bash","title":"rm -rf build","metadata":{"command":"rm -rf build"}}`),
+	})
+
+	pendingFor := func(userID int64) string {
+		before := len(recorder.Calls("sendMessage"))
+		if err := b.handlePending(newTestMessageContext(tgBot, userID, userID, telebot.ChatPrivate, "/pending")); err != nil {
+			t.Fatalf("handlePending failed: %v", err)
+		}
+		sent := recorder.Calls("sendMessage")[before:]
+		if len(sent) != 1 {
+			t.Fatalf("expected one reply for user %d, got %#v", userID, sent)
+		}
+		return sent[0].Body
+	}
+	if body := pendingFor(2); strings.Contains(body, "rm -rf build") || !strings.Contains(body, "No pending") {
+		t.Fatalf("another operator must not see the request: %s", body)
+	}
+	if body := pendingFor(1); !strings.Contains(body, "rm -rf build") {
+		t.Fatalf("the session owner should see the request: %s", body)
+	}
+	if body := pendingFor(9); !strings.Contains(body, "rm -rf build") {
+		t.Fatalf("admins should see every request: %s", body)
+	}
+
+	press := func(userID int64) {
+		callback := tgBot.NewContext(telebot.Update{
+			Callback: &telebot.Callback{
+				ID:      "cb_1",
+				Sender:  &telebot.User{ID: userID},
+				Data:    opencode.PermissionResponseOnce + "|perm_1",
+				Message: &telebot.Message{ID: 1, Chat: &telebot.Chat{ID: userID, Type: telebot.ChatPrivate}},
+			},
+		})
+		if err := b.handlePermissionCallback(callback); err != nil {
+			t.Fatalf("callback returned error: %v", err)
+		}
+	}
+	press(2)
+	mu.Lock()
+	got := responses
+	mu.Unlock()
+	if got != 0 || !b.hasPendingPermission("ses_1") {
+		t.Fatalf("another operator must not answer the request, got %d responses", got)
+	}
+	press(1)
+	if b.hasPendingPermission("ses_1") {
+		t.Fatal("the session owner should be able to answer the request")
+	}
+}
+
+func TestAutoRejectPermission_RetriesOnFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	b := &Bot{
+		config:         &config.Config{OpenCode: config.OpenCodeConfig{PermissionTimeout: 60}},
+		opencodeClient: opencode.NewClient(server.URL, 5),
+		ctx:            context.Background(),
+	}
+	defer b.stopPermissionTimers()
+
+	b.handlePermissionRequestEvent(opencode.SessionEvent{
+		Type:       "permission.updated",
+		Properties: json.RawMessage(`{"id":"perm_1","sessionID":"ses_1","type":"bash","title":"make"}`),
+	})
+	b.permissionMu.Lock()
+	pending := b.pendingPermissions["perm_1"]
+	firstTimer := pending.timer
+	b.permissionMu.Unlock()
+
+	b.autoRejectPermission(pending)
+
+	b.permissionMu.Lock()
+	defer b.permissionMu.Unlock()
+	if b.pendingPermissions["perm_1"] != pending {
+		t.Fatal("a failed auto-reject must keep the request pending")
+	}
+	if pending.retries != 1 || pending.timer == firstTimer || pending.resolving {
+		t.Fatalf("expected the auto-reject to be re-armed, got retries=%d resolving=%t", pending.retries, pending.resolving)
+	}
+}
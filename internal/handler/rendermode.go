@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+
+	"tg-bot/internal/render"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/telebot.v4"
+)
+
+// renderModeDescriptions explains each mode in /render.
+var renderModeDescriptions = map[string]string{
+	render.ModePlain:          "plain text, no formatting",
+	render.ModeMarkdownFinal:  "plain text while streaming, formatted when done",
+	render.ModeMarkdownStream: "formatted while streaming",
+	render.ModeMarkdownV2:     "formatted while streaming, using Telegram MarkdownV2",
+}
+
+// chatRenderMode returns the render mode of the chat behind c: its /render
+// override if set, otherwise the configured mode.
+func (b *Bot) chatRenderMode(c telebot.Context) string {
+	mode := b.renderer.Mode()
+	if c == nil || c.Chat() == nil || b.sessionManager == nil {
+		return mode
+	}
+	override, exists, err := b.sessionManager.GetChatRenderMode(c.Chat().ID)
+	if err != nil {
+		log.Warnf("Failed to get render mode of chat %d: %v", c.Chat().ID, err)
+		return mode
+	}
+	if exists && render.IsValidMode(override) {
+		return render.NormalizeMode(override)
+	}
+	return mode
+}
+
+func formatRenderModes(current string, overridden bool) string {
+	var sb strings.Builder
+	source := "configured default"
+	if overridden {
+		source = "set for this chat"
+	}
+	fmt.Fprintf(&sb, "🖋 Render mode: %s (%s)\n\n", current, source)
+	for _, mode := range render.Modes {
+		marker := "•"
+		if mode == current {
+			marker = "✅"
+		}
+		fmt.Fprintf(&sb, "%s %s - %s\n", marker, mode, renderModeDescriptions[mode])
+	}
+	sb.WriteString("\nUse /render <mode> to change it for this chat, or /render default to reset.")
+	return sb.String()
+}
+
+// handleRender handles the /render command
+func (b *Bot) handleRender(c telebot.Context) error {
+	chatID := c.Chat().ID
+	arg := strings.ToLower(strings.TrimSpace(c.Message().Payload))
+
+	switch {
+	case arg == "":
+		_, overridden, err := b.sessionManager.GetChatRenderMode(chatID)
+		if err != nil {
+			log.Errorf("Failed to get render mode of chat %d: %v", chatID, err)
+		}
+		return c.Send(formatRenderModes(b.chatRenderMode(c), overridden))
+	case arg == "default":
+		if err := b.sessionManager.SetChatRenderMode(chatID, ""); err != nil {
+			log.Errorf("Failed to reset render mode of chat %d: %v", chatID, err)
+			return c.Send(fmt.Sprintf("Failed to set render mode: %v", err))
+		}
+		return c.Send(fmt.Sprintf("✅ This chat now uses the configured render mode (%s).", b.renderer.Mode()))
+	case !render.IsValidMode(arg):
+		return c.Send(fmt.Sprintf("❌ Unknown render mode %q. Choose one of: %s, or default.", arg, strings.Join(render.Modes, ", ")))
+	}
+
+	if err := b.sessionManager.SetChatRenderMode(chatID, arg); err != nil {
+		log.Errorf("Failed to set render mode of chat %d: %v", chatID, err)
+		return c.Send(fmt.Sprintf("Failed to set render mode: %v", err))
+	}
+	log.Infof("User %d set render mode of chat %d to %s", c.Sender().ID, chatID, arg)
+	return c.Send(fmt.Sprintf("✅ Render mode for this chat set to %s", arg))
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tg-bot/internal/render"
+	"tg-bot/internal/session"
+	"tg-bot/internal/storage"
+
+	"gopkg.in/telebot.v4"
+)
+
+func TestHandleRender_OverridesModePerChat(t *testing.T) {
+	store, err := storage.NewStore(storage.Options{
+		Type:     "file",
+		FilePath: filepath.Join(t.TempDir(), "bot-state.json"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	b := &Bot{
+		ctx:            context.Background(),
+		renderer:       render.New("markdown_stream"),
+		sessionManager: session.NewManagerWithStore(nil, store),
+	}
+	tgBot, recorder := newTestTelegramBot(t)
+	renderCommand := func(chatID int64, payload string) telebot.Context {
+		return tgBot.NewContext(telebot.Update{
+			Message: &telebot.Message{
+				ID:      1,
+				Sender:  &telebot.User{ID: 7},
+				Chat:    &telebot.Chat{ID: chatID, Type: telebot.ChatPrivate},
+				Text:    "/render " + payload,
+				Payload: payload,
+			},
+		})
+	}
+
+	if err := b.handleRender(renderCommand(7, "fancy")); err != nil {
+		t.Fatalf("handleRender failed: %v", err)
+	}
+	if err := b.handleRender(renderCommand(7, "Plain")); err != nil {
+		t.Fatalf("handleRender failed: %v", err)
+	}
+	if got := b.chatRenderMode(renderCommand(7, "")); got != render.ModePlain {
+		t.Fatalf("expected plain mode for chat 7, got %q", got)
+	}
+	if got := b.chatRenderMode(renderCommand(8, "")); got != render.ModeMarkdownStream {
+		t.Fatalf("other chats should keep the configured mode, got %q", got)
+	}
+
+	if _, err := b.sendRenderedTelegramMessage(renderCommand(7, ""), "**done**", false); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if _, err := b.sendRenderedTelegramMessage(renderCommand(8, ""), "**done**", false); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	if err := b.handleRender(renderCommand(7, "default")); err != nil {
+		t.Fatalf("handleRender failed: %v", err)
+	}
+	if got := b.chatRenderMode(renderCommand(7, "")); got != render.ModeMarkdownStream {
+		t.Fatalf("expected reset to the configured mode, got %q", got)
+	}
+
+	sent := recorder.Calls("sendMessage")
+	if len(sent) != 5 {
+		t.Fatalf("unexpected number of messages: %d", len(sent))
+	}
+	if !strings.Contains(sent[0].Body, "Unknown render mode") || !strings.Contains(sent[1].Body, "set to plain") {
+		t.Fatalf("unexpected replies: %#v", sent[:2])
+	}
+	if strings.Contains(sent[2].Body, "parse_mode") || !strings.Contains(sent[2].Body, "**done**") {
+		t.Fatalf("plain chat should get raw text without a parse mode: %s", sent[2].Body)
+	}
+	if !strings.Contains(sent[3].Body, `"parse_mode":"HTML"`) || !strings.Contains(sent[3].Body, `\u003cb\u003edone`) {
+		t.Fatalf("default chat should get HTML: %s", sent[3].Body)
+	}
+}
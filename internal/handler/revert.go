@@ -0,0 +1,324 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"tg-bot/internal/opencode"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/telebot.v4"
+)
+
+const (
+	undoCallbackUnique = "undo"
+	undoListSize       = 5
+)
+
+// revertTurn is a prompt and the assistant messages that answered it.
+type revertTurn struct {
+	MessageID string // first assistant message, the revert target
+	Prompt    string
+	Files     []string
+}
+
+// recentTurns groups messages into prompt/response turns, oldest first.
+// Messages from revertPoint on are already hidden and are skipped.
+func recentTurns(messages []opencode.Message, revertPoint string) []revertTurn {
+	var turns []revertTurn
+	prompt := ""
+	open := false
+	for _, msg := range messages {
+		if revertPoint != "" && msg.ID == revertPoint {
+			break
+		}
+		switch msg.Role {
+		case "user":
+			prompt = strings.TrimSpace(msg.Content)
+			if prompt == "" {
+				prompt = "(attachment)"
+			}
+			open = false
+		case "assistant":
+			if !open {
+				turns = append(turns, revertTurn{MessageID: msg.ID, Prompt: prompt})
+				open = true
+			}
+			last := &turns[len(turns)-1]
+			last.Files = appendUniqueStrings(last.Files, patchedFiles(msg)...)
+		}
+	}
+	return turns
+}
+
+// filesChangedFrom lists files patched by messages from fromID up to, but not
+// including, untilID. An empty untilID means the end of the session.
+func filesChangedFrom(messages []opencode.Message, fromID, untilID string) []string {
+	var files []string
+	inRange := false
+	for _, msg := range messages {
+		if msg.ID == fromID {
+			inRange = true
+		}
+		if untilID != "" && msg.ID == untilID && msg.ID != fromID {
+			break
+		}
+		if inRange {
+			files = appendUniqueStrings(files, patchedFiles(msg)...)
+		}
+	}
+	return files
+}
+
+// visibleMessageCount counts the messages before revertPoint.
+func visibleMessageCount(messages []opencode.Message, revertPoint string) int {
+	for i, msg := range messages {
+		if revertPoint != "" && msg.ID == revertPoint {
+			return i
+		}
+	}
+	return len(messages)
+}
+
+func patchedFiles(msg opencode.Message) []string {
+	var files []string
+	for _, part := range msg.Parts {
+		if p, ok := part.(opencode.MessagePartResponse); ok && p.Type == "patch" {
+			files = append(files, p.Files...)
+		}
+	}
+	return files
+}
+
+func appendUniqueStrings(list []string, values ...string) []string {
+	for _, v := range values {
+		seen := false
+		for _, existing := range list {
+			if existing == v {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// formatFileList shows files relative to the project directory when possible.
+func formatFileList(directory string, files []string) string {
+	if len(files) == 0 {
+		return "No file changes were recorded."
+	}
+	var sb strings.Builder
+	for _, file := range files {
+		display := file
+		if directory != "" {
+			if rel, err := filepath.Rel(directory, file); err == nil && !strings.HasPrefix(rel, "..") {
+				display = filepath.ToSlash(rel)
+			}
+		}
+		fmt.Fprintf(&sb, "• %s\n", display)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// isSessionBusy reports whether a task is currently streaming in sessionID.
+func (b *Bot) isSessionBusy(sessionID string) bool {
+	b.streamingStateMu.RLock()
+	defer b.streamingStateMu.RUnlock()
+	state, ok := b.streamingStates[sessionID]
+	return ok && state.isStreaming
+}
+
+// loadRevertState fetches the session's messages and its current revert point, if any.
+func (b *Bot) loadRevertState(ctx context.Context, sessionID string) (messages []opencode.Message, revertPoint string, err error) {
+	messages, err = b.opencodeClient.GetMessages(ctx, sessionID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get messages: %w", err)
+	}
+	sess, err := b.opencodeClient.GetSession(ctx, sessionID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get session: %w", err)
+	}
+	if sess.Revert != nil {
+		revertPoint = sess.Revert.MessageID
+	}
+	return messages, revertPoint, nil
+}
+
+// revertToMessage reverts sessionID to before messageID and describes the result.
+func (b *Bot) revertToMessage(ctx context.Context, sessionID, messageID string, messages []opencode.Message, previousPoint string) (string, error) {
+	prompt := ""
+	for _, turn := range recentTurns(messages, previousPoint) {
+		if turn.MessageID == messageID {
+			prompt = turn.Prompt
+		}
+	}
+
+	sess, err := b.opencodeClient.RevertSession(ctx, sessionID, messageID)
+	if err != nil {
+		return "", err
+	}
+	log.Infof("Reverted session %s to before message %s", sessionID, messageID)
+
+	files := filesChangedFrom(messages, messageID, previousPoint)
+	var sb strings.Builder
+	sb.WriteString("↩️ Reverted the response")
+	if prompt != "" {
+		fmt.Fprintf(&sb, " to: %s", truncateAndInline(prompt, 80))
+	}
+	fmt.Fprintf(&sb, "\n\nRestored files:\n%s", formatFileList(sess.Directory, files))
+	sb.WriteString(b.refreshSessionView(sessionID, messages, messageID))
+	sb.WriteString("\n\nUse /redo to bring the changes back.")
+	return sb.String(), nil
+}
+
+// refreshSessionView updates the stored message count and summarizes what is left.
+func (b *Bot) refreshSessionView(sessionID string, messages []opencode.Message, revertPoint string) string {
+	count := visibleMessageCount(messages, revertPoint)
+	if err := b.sessionManager.SetSessionMessageCount(sessionID, count); err != nil {
+		log.Warnf("Failed to update message count for session %s: %v", sessionID, err)
+	}
+
+	turns := recentTurns(messages, revertPoint)
+	if len(turns) == 0 {
+		return fmt.Sprintf("\n\nSession now has %d message(s) and no responses.", count)
+	}
+	return fmt.Sprintf("\n\nSession now has %d message(s); last prompt: %s", count, truncateAndInline(turns[len(turns)-1].Prompt, 80))
+}
+
+// handleUndo handles the /undo command
+func (b *Bot) handleUndo(c telebot.Context) error {
+	sessionID, exists := b.sessionManager.GetUserSession(c.Sender().ID)
+	if !exists {
+		return c.Send("You don't have a current session. Use /new to create a new session.")
+	}
+	if b.isSessionBusy(sessionID) {
+		return c.Send("⚠️ A task is still running in this session. Use /abort first.")
+	}
+
+	ctx, cancel := context.WithTimeout(b.ctx, 30*time.Second)
+	defer cancel()
+
+	messages, revertPoint, err := b.loadRevertState(ctx, sessionID)
+	if err != nil {
+		log.Errorf("Failed to load session %s for undo: %v", sessionID, err)
+		return c.Send(fmt.Sprintf("❌ %v", err))
+	}
+
+	turns := recentTurns(messages, revertPoint)
+	if len(turns) == 0 {
+		return c.Send("Nothing to undo in this session.")
+	}
+
+	if strings.EqualFold(strings.TrimSpace(c.Message().Payload), "list") {
+		text, markup := renderUndoList(turns)
+		return c.Send(text, markup)
+	}
+
+	result, err := b.revertToMessage(ctx, sessionID, turns[len(turns)-1].MessageID, messages, revertPoint)
+	if err != nil {
+		log.Errorf("Failed to revert session %s: %v", sessionID, err)
+		return c.Send(fmt.Sprintf("❌ Failed to undo: %v", err))
+	}
+	return c.Send(result)
+}
+
+// renderUndoList shows the most recent turns, newest first, with a revert button each.
+func renderUndoList(turns []revertTurn) (string, *telebot.ReplyMarkup) {
+	start := len(turns) - undoListSize
+	if start < 0 {
+		start = 0
+	}
+
+	var sb strings.Builder
+	sb.WriteString("↩️ Choose a response to revert. It and everything after it will be undone.\n\n")
+	markup := &telebot.ReplyMarkup{}
+	var rows []telebot.Row
+	for i := len(turns) - 1; i >= start; i-- {
+		turn := turns[i]
+		number := len(turns) - i
+		fmt.Fprintf(&sb, "%d. %s", number, truncateAndInline(turn.Prompt, 80))
+		if len(turn.Files) > 0 {
+			fmt.Fprintf(&sb, " (%d file(s))", len(turn.Files))
+		}
+		sb.WriteString("\n")
+		buttonText := fmt.Sprintf("↩️ %d. %s", number, callbackButtonText(turn.Prompt, 32))
+		rows = append(rows, markup.Row(markup.Data(buttonText, undoCallbackUnique, turn.MessageID)))
+	}
+	markup.Inline(rows...)
+	return strings.TrimRight(sb.String(), "\n"), markup
+}
+
+// handleUndoCallback reverts to the turn picked from the /undo list.
+func (b *Bot) handleUndoCallback(c telebot.Context) error {
+	messageID := strings.TrimSpace(c.Callback().Data)
+	if messageID == "" {
+		return c.Respond(&telebot.CallbackResponse{Text: "Invalid button."})
+	}
+	sessionID, exists := b.sessionManager.GetUserSession(c.Sender().ID)
+	if !exists {
+		return c.Respond(&telebot.CallbackResponse{Text: "You don't have a current session.", ShowAlert: true})
+	}
+	if b.isSessionBusy(sessionID) {
+		return c.Respond(&telebot.CallbackResponse{Text: "A task is still running. Use /abort first.", ShowAlert: true})
+	}
+
+	ctx, cancel := context.WithTimeout(b.ctx, 30*time.Second)
+	defer cancel()
+
+	messages, revertPoint, err := b.loadRevertState(ctx, sessionID)
+	if err != nil {
+		return c.Respond(&telebot.CallbackResponse{Text: err.Error(), ShowAlert: true})
+	}
+	result, err := b.revertToMessage(ctx, sessionID, messageID, messages, revertPoint)
+	if err != nil {
+		log.Errorf("Failed to revert session %s: %v", sessionID, err)
+		return c.Respond(&telebot.CallbackResponse{Text: fmt.Sprintf("Failed to undo: %v", err), ShowAlert: true})
+	}
+	if err := c.Respond(&telebot.CallbackResponse{Text: "Reverted"}); err != nil {
+		log.Warnf("Failed to answer undo callback: %v", err)
+	}
+	return c.Edit(result)
+}
+
+// handleRedo handles the /redo command
+func (b *Bot) handleRedo(c telebot.Context) error {
+	sessionID, exists := b.sessionManager.GetUserSession(c.Sender().ID)
+	if !exists {
+		return c.Send("You don't have a current session. Use /new to create a new session.")
+	}
+	if b.isSessionBusy(sessionID) {
+		return c.Send("⚠️ A task is still running in this session. Use /abort first.")
+	}
+
+	ctx, cancel := context.WithTimeout(b.ctx, 30*time.Second)
+	defer cancel()
+
+	messages, revertPoint, err := b.loadRevertState(ctx, sessionID)
+	if err != nil {
+		log.Errorf("Failed to load session %s for redo: %v", sessionID, err)
+		return c.Send(fmt.Sprintf("❌ %v", err))
+	}
+	if revertPoint == "" {
+		return c.Send("Nothing to redo. Only the last /undo can be redone, before a new prompt is sent.")
+	}
+
+	sess, err := b.opencodeClient.UnrevertSession(ctx, sessionID)
+	if err != nil {
+		log.Errorf("Failed to unrevert session %s: %v", sessionID, err)
+		return c.Send(fmt.Sprintf("❌ Failed to redo: %v", err))
+	}
+	log.Infof("Unreverted session %s from message %s", sessionID, revertPoint)
+
+	var sb strings.Builder
+	sb.WriteString("↪️ Restored the reverted responses.")
+	fmt.Fprintf(&sb, "\n\nRe-applied files:\n%s", formatFileList(sess.Directory, filesChangedFrom(messages, revertPoint, "")))
+	sb.WriteString(b.refreshSessionView(sessionID, messages, ""))
+	return c.Send(sb.String())
+}
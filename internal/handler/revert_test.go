@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tg-bot/internal/opencode"
+	"tg-bot/internal/session"
+	"tg-bot/internal/storage"
+
+	"gopkg.in/telebot.v4"
+)
+
+func patchPart(files ...string) opencode.MessagePartResponse {
+	return opencode.MessagePartResponse{Type: "patch", Hash: "abc", Files: files}
+}
+
+func revertTestMessages() []opencode.Message {
+	return []opencode.Message{
+		{ID: "msg_1", Role: "user", Content: "add a README"},
+		{ID: "msg_2", Role: "assistant", ParentID: "msg_1", Parts: []interface{}{patchPart("/repo/README.md")}},
+		{ID: "msg_3", Role: "user", Content: "fix the build"},
+		{ID: "msg_4", Role: "assistant", ParentID: "msg_3", Parts: []interface{}{patchPart("/repo/main.go")}},
+		{ID: "msg_5", Role: "assistant", ParentID: "msg_3", Parts: []interface{}{patchPart("/repo/main.go", "/repo/go.mod")}},
+	}
+}
+
+func TestRecentTurns_GroupsAssistantStepsAndSkipsReverted(t *testing.T) {
+	turns := recentTurns(revertTestMessages(), "")
+	if len(turns) != 2 {
+		t.Fatalf("expected 2 turns, got %#v", turns)
+	}
+	last := turns[1]
+	if last.MessageID != "msg_4" || last.Prompt != "fix the build" {
+		t.Fatalf("last turn should target the first assistant message, got %#v", last)
+	}
+	if strings.Join(last.Files, ",") != "/repo/main.go,/repo/go.mod" {
+		t.Fatalf("expected de-duplicated files, got %v", last.Files)
+	}
+
+	turns = recentTurns(revertTestMessages(), "msg_4")
+	if len(turns) != 1 || turns[0].MessageID != "msg_2" {
+		t.Fatalf("messages from the revert point on must be skipped, got %#v", turns)
+	}
+}
+
+func TestFilesChangedFrom(t *testing.T) {
+	messages := revertTestMessages()
+	if got := strings.Join(filesChangedFrom(messages, "msg_2", ""), ","); got != "/repo/README.md,/repo/main.go,/repo/go.mod" {
+		t.Fatalf("unexpected files: %s", got)
+	}
+	if got := strings.Join(filesChangedFrom(messages, "msg_2", "msg_3"), ","); got != "/repo/README.md" {
+		t.Fatalf("files at or after the previous revert point must be excluded: %s", got)
+	}
+}
+
+func TestHandleUndo_RevertsLastTurn(t *testing.T) {
+	var revertedTo string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/session/ses_1/message":
+			var resp []opencode.MessageResponse
+			for _, msg := range revertTestMessages() {
+				var parts []opencode.MessagePartResponse
+				for _, part := range msg.Parts {
+					parts = append(parts, part.(opencode.MessagePartResponse))
+				}
+				if msg.Content != "" {
+					parts = append(parts, opencode.MessagePartResponse{Type: "text", Text: msg.Content})
+				}
+				resp = append(resp, opencode.MessageResponse{
+					Info:  opencode.MessageInfo{ID: msg.ID, SessionID: "ses_1", Role: msg.Role, ParentID: msg.ParentID},
+					Parts: parts,
+				})
+			}
+			_ = json.NewEncoder(w).Encode(resp)
+		case r.Method == "GET" && r.URL.Path == "/session/ses_1":
+			_ = json.NewEncoder(w).Encode(opencode.Session{ID: "ses_1", Directory: "/repo"})
+		case r.Method == "POST" && r.URL.Path == "/session/ses_1/revert":
+			var body map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			revertedTo = body["messageID"]
+			_ = json.NewEncoder(w).Encode(opencode.Session{
+				ID:        "ses_1",
+				Directory: "/repo",
+				Revert:    &opencode.SessionRevert{MessageID: revertedTo},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	store, err := storage.NewStore(storage.Options{
+		Type:     "file",
+		FilePath: filepath.Join(t.TempDir(), "bot-state.json"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	const userID int64 = 11
+	if err := store.StoreSessionMeta(&storage.SessionMeta{SessionID: "ses_1", UserID: userID, MessageCount: 5, CreatedAt: time.Now(), LastUsedAt: time.Now()}); err != nil {
+		t.Fatalf("failed to store session meta: %v", err)
+	}
+	if err := store.StoreUserSession(userID, "ses_1"); err != nil {
+		t.Fatalf("failed to store user session: %v", err)
+	}
+
+	client := opencode.NewClient(server.URL, 5)
+	b := &Bot{
+		ctx:             context.Background(),
+		opencodeClient:  client,
+		sessionManager:  session.NewManagerWithStore(client, store),
+		streamingStates: make(map[string]*streamingState),
+	}
+	tgBot, recorder := newTestTelegramBot(t)
+
+	if err := b.handleUndo(newTestMessageContext(tgBot, userID, userID, telebot.ChatPrivate, "/undo")); err != nil {
+		t.Fatalf("handleUndo failed: %v", err)
+	}
+
+	if revertedTo != "msg_4" {
+		t.Fatalf("expected revert to msg_4, got %q", revertedTo)
+	}
+	sent := recorder.Calls("sendMessage")
+	if len(sent) != 1 {
+		t.Fatalf("expected one reply, got %#v", sent)
+	}
+	for _, want := range []string{"fix the build", "main.go", "go.mod", "3 message(s)", "add a README"} {
+		if !strings.Contains(sent[0].Body, want) {
+			t.Fatalf("reply should mention %q: %s", want, sent[0].Body)
+		}
+	}
+	if strings.Contains(sent[0].Body, "/repo/main.go") {
+		t.Fatalf("files should be shown relative to the project: %s", sent[0].Body)
+	}
+	if meta, ok := b.sessionManager.GetSessionMeta("ses_1"); !ok || meta.MessageCount != 3 {
+		t.Fatalf("expected message count to be refreshed to 3, got %#v", meta)
+	}
+}
@@ -23,8 +23,12 @@ const (
 	runtimeNoOutputGrace     = 15 * time.Second
 	runtimeReconcileInterval = 1200 * time.Millisecond
 	runtimeBootstrapTimeout  = 8 * time.Second
+	runtimeDefaultQueueSize  = 5
 )
 
+// errTaskDequeued is returned to submitters whose queued prompt was cleared or dropped.
+var errTaskDequeued = errors.New("queued prompt was removed")
+
 type openCodeRuntime struct {
 	bot    *Bot
 	ctx    context.Context
@@ -37,16 +41,36 @@ type openCodeRuntime struct {
 
 	statusMu      sync.RWMutex
 	sessionStatus map[string]opencode.SessionStatusInfo
+
+	// Child sessions of running tasks, mapped to the root session whose actor shows them.
+	childMu    sync.RWMutex
+	childRoots map[string]string
 }
 
 type runtimeTaskRequest struct {
 	SessionID      string
 	RequestTraceID string
 	Text           string
+	Files          []opencode.MessagePart
 	Model          *opencode.MessageModel
+	Agent          string
+	Command        string // OpenCode custom command; Text holds its arguments
+	Compact        bool   // summarize the session instead of sending a prompt
 	TelegramCtx    telebot.Context
 }
 
+// describe summarizes the task for queue listings.
+func (t runtimeTaskRequest) describe() string {
+	switch {
+	case t.Compact:
+		return "/compact"
+	case t.Command != "":
+		return strings.TrimSpace("/" + t.Command + " " + t.Text)
+	default:
+		return t.Text
+	}
+}
+
 type sessionActor struct {
 	runtime   *openCodeRuntime
 	bot       *Bot
@@ -54,11 +78,23 @@ type sessionActor struct {
 
 	submitCh chan *actorSubmitRequest
 	eventCh  chan opencode.SessionEvent
+
+	// Prompts accepted while a task is running, started in FIFO order.
+	queueMu sync.Mutex
+	queue   []*actorSubmitRequest
+
+	// busyMu guards who holds the session: a task started by the actor or a
+	// /sh command, which must not run at the same time. Taken before queueMu.
+	busyMu  sync.Mutex
+	running bool
+	shell   bool
 }
 
 type actorSubmitRequest struct {
 	task     runtimeTaskRequest
 	resultCh chan error
+	queuedCh chan int
+	queuedAt time.Time
 }
 
 type actorRunningTask struct {
@@ -110,7 +146,7 @@ func (r *openCodeRuntime) SubmitTextTask(req runtimeTaskRequest) error {
 	if strings.TrimSpace(req.SessionID) == "" {
 		return fmt.Errorf("empty session id")
 	}
-	if strings.TrimSpace(req.Text) == "" {
+	if strings.TrimSpace(req.Text) == "" && len(req.Files) == 0 && req.Command == "" && !req.Compact {
 		return fmt.Errorf("empty task text")
 	}
 	if req.TelegramCtx == nil {
@@ -188,8 +224,10 @@ func (r *openCodeRuntime) bootstrapNonBlocking() {
 	}
 
 	commandCtx, cancelCommands := context.WithTimeout(r.ctx, runtimeBootstrapTimeout)
-	if _, err := r.bot.opencodeClient.GetCommands(commandCtx); err != nil {
+	if commands, err := r.bot.opencodeClient.GetCommands(commandCtx); err != nil {
 		log.Warnf("OpenCode runtime non-blocking bootstrap failed at GET /command: %v", err)
+	} else {
+		r.bot.commands.set(commands)
 	}
 	cancelCommands()
 
@@ -237,6 +275,25 @@ func (r *openCodeRuntime) routeEvent(event opencode.SessionEvent) {
 	if event.Type == "server.connected" || event.Type == "server.heartbeat" {
 		return
 	}
+	// Permission prompts must not wait behind the actor queue: the session is
+	// blocked until the request is answered.
+	if opencode.IsPermissionRequestEvent(event.Type) {
+		go r.bot.handlePermissionRequestEvent(event)
+		return
+	}
+	if event.Type == "permission.replied" {
+		go r.bot.handlePermissionRepliedEvent(event)
+		return
+	}
+
+	if info, ok := childSessionInfo(event); ok {
+		if root, tracked := r.trackChildSession(info); tracked {
+			if actor := r.getActor(root); actor != nil {
+				actor.publishEvent(event)
+			}
+		}
+		return
+	}
 
 	sessionID, status := sessionEventSessionIDAndStatus(event)
 	if sessionID == "" {
@@ -247,7 +304,11 @@ func (r *openCodeRuntime) routeEvent(event opencode.SessionEvent) {
 		r.sessionStatus[sessionID] = *status
 		r.statusMu.Unlock()
 	}
+	r.bot.observeShellEvent(sessionID, event)
 
+	if root, ok := r.childRoot(sessionID); ok {
+		sessionID = root
+	}
 	actor := r.getActor(sessionID)
 	if actor == nil {
 		return
@@ -296,6 +357,7 @@ func (a *sessionActor) submit(task runtimeTaskRequest) error {
 	req := &actorSubmitRequest{
 		task:     task,
 		resultCh: make(chan error, 1),
+		queuedCh: make(chan int, 1),
 	}
 
 	select {
@@ -304,11 +366,152 @@ func (a *sessionActor) submit(task runtimeTaskRequest) error {
 	case a.submitCh <- req:
 	}
 
-	select {
-	case <-a.runtime.ctx.Done():
-		return fmt.Errorf("runtime closed")
-	case err := <-req.resultCh:
-		return err
+	for {
+		select {
+		case <-a.runtime.ctx.Done():
+			return fmt.Errorf("runtime closed")
+		case position := <-req.queuedCh:
+			if _, err := task.TelegramCtx.Bot().Send(task.TelegramCtx.Chat(), fmt.Sprintf("⏳ Queued (#%d). It will start when the current task finishes. Use /queue to manage it.", position)); err != nil {
+				log.Warnf("Failed to acknowledge queued prompt for session %s: %v", a.sessionID, err)
+			}
+		case err := <-req.resultCh:
+			return err
+		}
+	}
+}
+
+func (a *sessionActor) queueLimit() int {
+	if a.bot == nil || a.bot.config == nil || a.bot.config.OpenCode.QueueSize <= 0 {
+		return runtimeDefaultQueueSize
+	}
+	return a.bot.config.OpenCode.QueueSize
+}
+
+// enqueue appends req to the session queue and returns its 1-based position.
+func (a *sessionActor) enqueue(req *actorSubmitRequest) (int, error) {
+	a.queueMu.Lock()
+	defer a.queueMu.Unlock()
+
+	if len(a.queue) >= a.queueLimit() {
+		return 0, fmt.Errorf("session is busy and its queue is full (%d prompts): %s", len(a.queue), a.sessionID)
+	}
+	req.queuedAt = time.Now()
+	a.queue = append(a.queue, req)
+	return len(a.queue), nil
+}
+
+// dequeue removes and returns the oldest queued prompt, or nil.
+func (a *sessionActor) dequeue() *actorSubmitRequest {
+	a.queueMu.Lock()
+	defer a.queueMu.Unlock()
+
+	if len(a.queue) == 0 {
+		return nil
+	}
+	req := a.queue[0]
+	a.queue[0] = nil
+	a.queue = a.queue[1:]
+	return req
+}
+
+// queuedTasks returns a snapshot of the queued prompts in start order.
+func (a *sessionActor) queuedTasks() []runtimeTaskRequest {
+	a.queueMu.Lock()
+	defer a.queueMu.Unlock()
+
+	tasks := make([]runtimeTaskRequest, 0, len(a.queue))
+	for _, req := range a.queue {
+		tasks = append(tasks, req.task)
+	}
+	return tasks
+}
+
+// clearQueue fails every queued prompt with err and returns how many were removed.
+func (a *sessionActor) clearQueue(err error) int {
+	a.queueMu.Lock()
+	queue := a.queue
+	a.queue = nil
+	a.queueMu.Unlock()
+
+	for _, req := range queue {
+		req.resultCh <- err
+	}
+	return len(queue)
+}
+
+// dropQueued removes the prompt at 1-based position.
+func (a *sessionActor) dropQueued(position int) (runtimeTaskRequest, error) {
+	a.queueMu.Lock()
+	if position < 1 || position > len(a.queue) {
+		size := len(a.queue)
+		a.queueMu.Unlock()
+		return runtimeTaskRequest{}, fmt.Errorf("no queued prompt #%d (queue has %d)", position, size)
+	}
+	req := a.queue[position-1]
+	a.queue = append(a.queue[:position-1], a.queue[position:]...)
+	a.queueMu.Unlock()
+
+	req.resultCh <- errTaskDequeued
+	return req.task, nil
+}
+
+// reserveTask marks the session as running a task, unless a /sh command holds it.
+func (a *sessionActor) reserveTask() bool {
+	a.busyMu.Lock()
+	defer a.busyMu.Unlock()
+	if a.shell {
+		return false
+	}
+	a.running = true
+	return true
+}
+
+func (a *sessionActor) releaseTask() {
+	a.busyMu.Lock()
+	defer a.busyMu.Unlock()
+	a.running = false
+}
+
+// reserveShell marks the session as held by a /sh command, unless a task is
+// running or queued or another command holds it. Prompts submitted meanwhile
+// are queued until releaseShell.
+func (a *sessionActor) reserveShell() bool {
+	a.busyMu.Lock()
+	defer a.busyMu.Unlock()
+	a.queueMu.Lock()
+	queued := len(a.queue)
+	a.queueMu.Unlock()
+	if a.running || a.shell || queued > 0 {
+		return false
+	}
+	a.shell = true
+	return true
+}
+
+func (a *sessionActor) releaseShell() {
+	a.busyMu.Lock()
+	defer a.busyMu.Unlock()
+	a.shell = false
+}
+
+// startNextQueued starts queued prompts until one starts successfully or the queue is empty.
+func (a *sessionActor) startNextQueued() *actorRunningTask {
+	for {
+		if !a.reserveTask() {
+			return nil
+		}
+		req := a.dequeue()
+		if req == nil {
+			a.releaseTask()
+			return nil
+		}
+		log.Infof("Starting queued prompt for session %s after %v", a.sessionID, time.Since(req.queuedAt).Round(time.Millisecond))
+		task, err := a.startTask(req)
+		if err != nil {
+			req.resultCh <- err
+			continue
+		}
+		return task
 	}
 }
 
@@ -320,16 +523,28 @@ func (a *sessionActor) run() {
 
 	var current *actorRunningTask
 	for {
+		if current == nil {
+			a.releaseTask()
+			current = a.startNextQueued()
+		}
+
 		select {
 		case <-a.runtime.ctx.Done():
 			if current != nil {
 				a.finishTask(current, a.runtime.ctx.Err())
 			}
+			a.clearQueue(fmt.Errorf("runtime closed"))
 			return
 
 		case submitReq := <-a.submitCh:
-			if current != nil {
-				submitReq.resultCh <- fmt.Errorf("session is busy: %s", a.sessionID)
+			// Wait behind the running task or /sh command
+			if current != nil || !a.reserveTask() {
+				position, err := a.enqueue(submitReq)
+				if err != nil {
+					submitReq.resultCh <- err
+					continue
+				}
+				submitReq.queuedCh <- position
 				continue
 			}
 			task, err := a.startTask(submitReq)
@@ -355,7 +570,7 @@ func (a *sessionActor) run() {
 				continue
 			}
 			if current.state != nil && current.state.ctx != nil && current.state.ctx.Err() != nil {
-				a.finishTask(current, current.state.ctx.Err())
+				a.finishTask(current, context.Cause(current.state.ctx))
 				current.req.resultCh <- nil
 				current = nil
 				continue
@@ -376,7 +591,10 @@ func (a *sessionActor) run() {
 				hasRecentEvents := time.Since(current.state.lastEventAt) < 30*time.Second
 				current.state.updateMutex.Unlock()
 
-				if hasRecentEvents {
+				if a.bot.hasPendingPermission(a.sessionID) {
+					// Waiting for a user decision, which has its own timeout
+					current.deadline = time.Now().Add(30 * time.Second)
+				} else if hasRecentEvents {
 					// Events are still updating, extend the deadline
 					current.deadline = time.Now().Add(30 * time.Second)
 					log.Infof("Extending deadline for session %s due to recent events", a.sessionID)
@@ -394,7 +612,9 @@ func (a *sessionActor) run() {
 
 func (a *sessionActor) startTask(req *actorSubmitRequest) (*actorRunningTask, error) {
 	startedAt := time.Now()
-	taskCtx, taskCancel := context.WithCancel(a.runtime.ctx)
+	// The cause lets a failed command dispatch end the task with its error.
+	taskCtx, taskCancelCause := context.WithCancelCause(a.runtime.ctx)
+	taskCancel := func() { taskCancelCause(nil) }
 	requestTraceID := req.task.RequestTraceID
 
 	initialMessagesCtx, cancelInitial := context.WithTimeout(taskCtx, 4*time.Second)
@@ -415,39 +635,13 @@ func (a *sessionActor) startTask(req *actorSubmitRequest) (*actorRunningTask, er
 		initialDigests[msg.ID] = snapshotMessageDigest(msg)
 	}
 
-	sendReq := &opencode.SendMessageRequest{
-		Parts: []opencode.MessagePart{
-			{
-				Type: "text",
-				Text: req.task.Text,
-			},
-		},
-	}
-	if req.task.Model != nil {
-		sendReq.Model = req.task.Model
-	}
-
-	modelLabel := "unknown"
-	if req.task.Model != nil {
-		modelLabel = req.task.Model.ProviderID + "/" + req.task.Model.ModelID
-	}
-	if a.bot != nil && a.bot.config != nil && a.bot.config.Logging.EnableOpenCodeRequestLogs {
-		log.Infof("Dispatching OpenCode message: session=%s request_trace_id=%s request_message_id=auto model=%s text_len=%d", a.sessionID, requestTraceID, modelLabel, len(req.task.Text))
-	}
-
-	sendTimeout := time.Duration(a.bot.config.OpenCode.Timeout) * time.Second
-	if sendTimeout < 8*time.Second {
-		sendTimeout = 8 * time.Second
-	}
-	sendCtx, cancelSend := context.WithTimeout(taskCtx, sendTimeout)
-	sendErr := a.bot.opencodeClient.PromptAsync(sendCtx, a.sessionID, sendReq)
-	cancelSend()
-	if sendErr != nil {
+	if req.task.Compact {
+		a.dispatchCompact(taskCtx, taskCancelCause, req.task)
+	} else if req.task.Command != "" {
+		a.dispatchCommand(taskCtx, taskCancelCause, req.task)
+	} else if err := a.dispatchPrompt(taskCtx, req.task); err != nil {
 		taskCancel()
-		return nil, fmt.Errorf("failed to dispatch prompt_async: %w", sendErr)
-	}
-	if a.bot != nil && a.bot.config != nil && a.bot.config.Logging.EnableOpenCodeRequestLogs {
-		log.Infof("OpenCode prompt_async acknowledged for session %s request_trace_id=%s", a.sessionID, requestTraceID)
+		return nil, err
 	}
 
 	processingMsg, err := a.bot.sendRenderedTelegramMessage(req.task.TelegramCtx, "🤖 Processing...", true)
@@ -495,6 +689,86 @@ func (a *sessionActor) startTask(req *actorSubmitRequest) (*actorRunningTask, er
 	}, nil
 }
 
+// dispatchPrompt sends task through prompt_async, which returns once OpenCode has accepted it.
+func (a *sessionActor) dispatchPrompt(taskCtx context.Context, task runtimeTaskRequest) error {
+	sendReq := &opencode.SendMessageRequest{}
+	if strings.TrimSpace(task.Text) != "" {
+		sendReq.Parts = append(sendReq.Parts, opencode.MessagePart{
+			Type: "text",
+			Text: task.Text,
+		})
+	}
+	sendReq.Parts = append(sendReq.Parts, task.Files...)
+	if task.Model != nil {
+		sendReq.Model = task.Model
+	}
+	sendReq.Agent = task.Agent
+
+	modelLabel := "unknown"
+	if task.Model != nil {
+		modelLabel = task.Model.ProviderID + "/" + task.Model.ModelID
+	}
+	if a.bot != nil && a.bot.config != nil && a.bot.config.Logging.EnableOpenCodeRequestLogs {
+		log.Infof("Dispatching OpenCode message: session=%s request_trace_id=%s request_message_id=auto model=%s agent=%s text_len=%d files=%d", a.sessionID, task.RequestTraceID, modelLabel, displayAgentName(task.Agent), len(task.Text), len(task.Files))
+	}
+
+	sendTimeout := time.Duration(a.bot.config.OpenCode.Timeout) * time.Second
+	if sendTimeout < 8*time.Second {
+		sendTimeout = 8 * time.Second
+	}
+	sendCtx, cancelSend := context.WithTimeout(taskCtx, sendTimeout)
+	sendErr := a.bot.opencodeClient.PromptAsync(sendCtx, a.sessionID, sendReq)
+	cancelSend()
+	if sendErr != nil {
+		return fmt.Errorf("failed to dispatch prompt_async: %w", sendErr)
+	}
+	if a.bot != nil && a.bot.config != nil && a.bot.config.Logging.EnableOpenCodeRequestLogs {
+		log.Infof("OpenCode prompt_async acknowledged for session %s request_trace_id=%s", a.sessionID, task.RequestTraceID)
+	}
+	return nil
+}
+
+// dispatchCommand runs a custom command in the background. OpenCode only answers
+// when the command has finished, so its output is followed through events like a
+// prompt; a failed request cancels the task with the error as cause.
+func (a *sessionActor) dispatchCommand(taskCtx context.Context, cancel context.CancelCauseFunc, task runtimeTaskRequest) {
+	cmdReq := &opencode.CommandRequest{
+		Command:   task.Command,
+		Arguments: task.Text,
+		Agent:     task.Agent,
+	}
+	if task.Model != nil {
+		cmdReq.Model = task.Model.ProviderID + "/" + task.Model.ModelID
+	}
+	log.Infof("Dispatching OpenCode command: session=%s request_trace_id=%s command=%s args_len=%d", a.sessionID, task.RequestTraceID, task.Command, len(task.Text))
+
+	go func() {
+		err := a.bot.opencodeClient.RunCommand(taskCtx, a.sessionID, cmdReq)
+		if err != nil && taskCtx.Err() == nil {
+			log.Warnf("OpenCode command /%s failed for session %s: %v", task.Command, a.sessionID, err)
+			cancel(err)
+		}
+	}()
+}
+
+// dispatchCompact summarizes the session in the background; the summary streams
+// in through events and a failed request cancels the task like dispatchCommand.
+func (a *sessionActor) dispatchCompact(taskCtx context.Context, cancel context.CancelCauseFunc, task runtimeTaskRequest) {
+	var providerID, modelID string
+	if task.Model != nil {
+		providerID, modelID = task.Model.ProviderID, task.Model.ModelID
+	}
+	log.Infof("Dispatching OpenCode summarize: session=%s request_trace_id=%s model=%s/%s", a.sessionID, task.RequestTraceID, providerID, modelID)
+
+	go func() {
+		err := a.bot.opencodeClient.SummarizeSession(taskCtx, a.sessionID, providerID, modelID)
+		if err != nil && taskCtx.Err() == nil {
+			log.Warnf("OpenCode summarize failed for session %s: %v", a.sessionID, err)
+			cancel(err)
+		}
+	}()
+}
+
 func (a *sessionActor) applyTaskEvent(task *actorRunningTask, event opencode.SessionEvent) {
 	if task == nil || task.state == nil {
 		return
@@ -502,6 +776,13 @@ func (a *sessionActor) applyTaskEvent(task *actorRunningTask, event opencode.Ses
 
 	task.state.updateMutex.Lock()
 	changed, forceFlush := a.bot.applySessionEventLocked(task.state, a.sessionID, event)
+	if applySubagentEventLocked(task.state, a.sessionID, event) {
+		changed = true
+	}
+	if applyTodoEventLocked(task.state, a.sessionID, event) {
+		changed = true
+	}
+	patch := oversizedPatchLocked(task.state, a.sessionID, event)
 	if changed {
 		task.state.hasEventUpdates = true
 		task.state.lastEventAt = time.Now()
@@ -511,6 +792,13 @@ func (a *sessionActor) applyTaskEvent(task *actorRunningTask, event opencode.Ses
 	}
 	task.state.updateMutex.Unlock()
 
+	if patch != nil && task.state.telegramCtx != nil {
+		go func(c telebot.Context) {
+			if err := c.Send(patch); err != nil {
+				log.Warnf("Failed to send patch for session %s: %v", a.sessionID, err)
+			}
+		}(task.state.telegramCtx)
+	}
 	if forceFlush {
 		a.maybeFlushTask(task, true)
 	}
@@ -654,19 +942,25 @@ func (a *sessionActor) finishTask(task *actorRunningTask, taskErr error) {
 	state := task.state
 
 	var finalDisplays []string
+	var longReply string
 
 	state.updateMutex.Lock()
 	state.isComplete = true
-	finalDisplays = a.bot.buildEventDrivenDisplaysLocked(state)
+	finalDisplays, longReply = a.bot.buildEventDrivenReplyLocked(state)
 	state.updateMutex.Unlock()
 
 	switch {
+	case taskErr != nil && longReply != "":
+		// Only the tail of an oversized reply is in chat; attach what arrived.
+		a.bot.sendLongReply(state, []string{formatLongReplyStopped(longReply, taskErr)}, longReply)
 	case taskErr != nil && errors.Is(taskErr, context.Canceled):
 		// Task was canceled by user (/abort) or shutdown; keep current content as-is.
 	case taskErr != nil:
 		if state.telegramMsg != nil {
 			a.bot.updateTelegramMessage(state.telegramCtx, state.telegramMsg, fmt.Sprintf("Processing error: %v", taskErr), false)
 		}
+	case longReply != "":
+		a.bot.sendLongReply(state, finalDisplays, longReply)
 	case len(finalDisplays) > 0:
 		a.bot.updateStreamingTelegramMessages(state, finalDisplays)
 	default:
@@ -683,6 +977,7 @@ func (a *sessionActor) finishTask(task *actorRunningTask, taskErr error) {
 	}
 
 	state.isStreaming = false
+	a.runtime.forgetChildSessions(a.sessionID)
 
 	a.bot.streamingStateMu.Lock()
 	current, exists := a.bot.streamingStates[a.sessionID]
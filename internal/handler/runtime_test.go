@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"tg-bot/internal/config"
+)
+
+func newQueuedRequest(text string) *actorSubmitRequest {
+	return &actorSubmitRequest{
+		task:     runtimeTaskRequest{SessionID: "ses_1", Text: text},
+		resultCh: make(chan error, 1),
+		queuedCh: make(chan int, 1),
+	}
+}
+
+func TestSessionActorQueue_FIFOAndLimit(t *testing.T) {
+	actor := &sessionActor{
+		bot:       &Bot{config: &config.Config{OpenCode: config.OpenCodeConfig{QueueSize: 2}}},
+		sessionID: "ses_1",
+	}
+
+	first, second, third := newQueuedRequest("first"), newQueuedRequest("second"), newQueuedRequest("third")
+	if pos, err := actor.enqueue(first); err != nil || pos != 1 {
+		t.Fatalf("enqueue(first) = %d, %v; want 1, nil", pos, err)
+	}
+	if pos, err := actor.enqueue(second); err != nil || pos != 2 {
+		t.Fatalf("enqueue(second) = %d, %v; want 2, nil", pos, err)
+	}
+	if _, err := actor.enqueue(third); err == nil {
+		t.Fatal("expected enqueue beyond queue_size to fail")
+	}
+
+	if got := actor.dequeue(); got != first {
+		t.Fatalf("expected first prompt to be dequeued first")
+	}
+	if got := actor.dequeue(); got != second {
+		t.Fatalf("expected second prompt to be dequeued second")
+	}
+	if got := actor.dequeue(); got != nil {
+		t.Fatalf("expected empty queue, got %q", got.task.Text)
+	}
+}
+
+func TestSessionActorQueue_DropAndClear(t *testing.T) {
+	actor := &sessionActor{sessionID: "ses_1"}
+	reqs := []*actorSubmitRequest{newQueuedRequest("a"), newQueuedRequest("b"), newQueuedRequest("c")}
+	for _, req := range reqs {
+		if _, err := actor.enqueue(req); err != nil {
+			t.Fatalf("enqueue failed: %v", err)
+		}
+	}
+
+	if _, err := actor.dropQueued(4); err == nil {
+		t.Fatal("expected dropping an out-of-range position to fail")
+	}
+	task, err := actor.dropQueued(2)
+	if err != nil || task.Text != "b" {
+		t.Fatalf("dropQueued(2) = %q, %v; want b, nil", task.Text, err)
+	}
+	if err := <-reqs[1].resultCh; !errors.Is(err, errTaskDequeued) {
+		t.Fatalf("dropped submitter should get errTaskDequeued, got %v", err)
+	}
+
+	tasks := actor.queuedTasks()
+	if len(tasks) != 2 || tasks[0].Text != "a" || tasks[1].Text != "c" {
+		t.Fatalf("unexpected queue after drop: %#v", tasks)
+	}
+
+	if cleared := actor.clearQueue(errTaskDequeued); cleared != 2 {
+		t.Fatalf("clearQueue removed %d prompts, want 2", cleared)
+	}
+	for _, req := range []*actorSubmitRequest{reqs[0], reqs[2]} {
+		if err := <-req.resultCh; !errors.Is(err, errTaskDequeued) {
+			t.Fatalf("cleared submitter should get errTaskDequeued, got %v", err)
+		}
+	}
+	if len(actor.queuedTasks()) != 0 {
+		t.Fatal("expected empty queue after clear")
+	}
+}
+
+func TestSessionActor_ShellReservation(t *testing.T) {
+	actor := &sessionActor{sessionID: "ses_1"}
+
+	if !actor.reserveShell() {
+		t.Fatal("expected an idle session to be reserved for /sh")
+	}
+	if actor.reserveShell() {
+		t.Fatal("a second /sh should not reserve the session")
+	}
+	if actor.reserveTask() {
+		t.Fatal("a task should not start while /sh holds the session")
+	}
+	actor.releaseShell()
+
+	if !actor.reserveTask() {
+		t.Fatal("expected a task to start once /sh is done")
+	}
+	if actor.reserveShell() {
+		t.Fatal("/sh should not reserve the session while a task runs")
+	}
+	actor.releaseTask()
+
+	if _, err := actor.enqueue(newQueuedRequest("queued")); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	if actor.reserveShell() {
+		t.Fatal("/sh should not jump ahead of queued prompts")
+	}
+}
+
+func TestSessionActor_QueuesPromptWhileShellRuns(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &openCodeRuntime{
+		bot:    &Bot{},
+		ctx:    ctx,
+		cancel: cancel,
+		actors: make(map[string]*sessionActor),
+	}
+	actor := r.getOrCreateActor("ses_1")
+	if !actor.reserveShell() {
+		t.Fatal("expected an idle session to be reserved for /sh")
+	}
+
+	req := newQueuedRequest("prompt")
+	actor.submitCh <- req
+	select {
+	case position := <-req.queuedCh:
+		if position != 1 {
+			t.Fatalf("queued at position %d, want 1", position)
+		}
+	case err := <-req.resultCh:
+		t.Fatalf("prompt should be queued while /sh runs, got %v", err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the prompt to be queued")
+	}
+
+	cancel()
+	r.wg.Wait()
+	if err := <-req.resultCh; err == nil {
+		t.Fatal("queued prompt should be cleared when the runtime closes")
+	}
+}
@@ -0,0 +1,254 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"tg-bot/internal/opencode"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/telebot.v4"
+)
+
+const (
+	// shellDefaultAgent is used when the session has no pinned agent; OpenCode requires one.
+	shellDefaultAgent   = "build"
+	shellUpdateInterval = time.Second
+)
+
+// shellRun is a /sh command whose tool part is mirrored into a Telegram message.
+type shellRun struct {
+	mu         sync.Mutex
+	telegram   telebot.Context
+	message    *telebot.Message
+	partID     string
+	lastUpdate time.Time
+	done       bool
+}
+
+// shellRuns tracks running /sh commands by session.
+type shellRuns struct {
+	mu   sync.Mutex
+	runs map[string]*shellRun
+}
+
+func (sr *shellRuns) start(sessionID string, run *shellRun) bool {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	if sr.runs == nil {
+		sr.runs = make(map[string]*shellRun)
+	}
+	if _, busy := sr.runs[sessionID]; busy {
+		return false
+	}
+	sr.runs[sessionID] = run
+	return true
+}
+
+func (sr *shellRuns) get(sessionID string) *shellRun {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	return sr.runs[sessionID]
+}
+
+func (sr *shellRuns) finish(sessionID string) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	delete(sr.runs, sessionID)
+}
+
+// shellPartState returns the tool state with live output lifted out of the
+// metadata, where OpenCode keeps it while the command is still running.
+func shellPartState(state interface{}) map[string]interface{} {
+	source := toStringAnyMap(state)
+	if source == nil {
+		return nil
+	}
+	lifted := make(map[string]interface{}, len(source)+1)
+	for k, v := range source {
+		lifted[k] = v
+	}
+	if output, _ := lifted["output"].(string); strings.TrimSpace(output) == "" {
+		if metadata, ok := source["metadata"].(map[string]interface{}); ok {
+			if output, ok := metadata["output"]; ok {
+				lifted["output"] = output
+			}
+		}
+	}
+	return lifted
+}
+
+// shellExitStatus describes how a shell tool part ended.
+func shellExitStatus(state map[string]interface{}) string {
+	if status, _ := state["status"].(string); status == "error" {
+		if errText, _ := state["error"].(string); strings.TrimSpace(errText) != "" {
+			return "❌ Failed: " + truncateAndInline(errText, 200)
+		}
+		return "❌ Failed"
+	}
+
+	if metadata, ok := state["metadata"].(map[string]interface{}); ok {
+		for _, key := range []string{"exit", "exitCode", "exit_code"} {
+			code, ok := metadata[key].(float64)
+			if !ok || code != math.Trunc(code) {
+				continue
+			}
+			if code == 0 {
+				return "✅ Exit status: 0"
+			}
+			return fmt.Sprintf("❌ Exit status: %d", int(code))
+		}
+	}
+	return "✅ Finished (exit status not reported)"
+}
+
+// formatShellPart renders a shell tool part like any other tool call.
+func formatShellPart(part opencode.MessagePartResponse) string {
+	return formatToolCallPart(part.Tool, part.Snapshot, shellPartState(part.State), part.Text)
+}
+
+// observeShellEvent mirrors tool part updates of a running /sh command into its message.
+func (b *Bot) observeShellEvent(sessionID string, event opencode.SessionEvent) {
+	if event.Type != "message.part.updated" {
+		return
+	}
+	run := b.shells.get(sessionID)
+	if run == nil {
+		return
+	}
+
+	var payload opencode.MessagePartUpdatedProperties
+	if err := json.Unmarshal(event.Properties, &payload); err != nil {
+		return
+	}
+	part := payload.Part
+	if part.Type != "tool" || part.SessionID != sessionID {
+		return
+	}
+
+	run.mu.Lock()
+	if run.done || (run.partID != "" && run.partID != part.ID) || time.Since(run.lastUpdate) < shellUpdateInterval {
+		run.mu.Unlock()
+		return
+	}
+	run.partID = part.ID
+	run.lastUpdate = time.Now()
+	run.mu.Unlock()
+
+	// Edit off the event pump; the final result is written under the same lock.
+	go func() {
+		run.mu.Lock()
+		defer run.mu.Unlock()
+		if !run.done {
+			b.updateTelegramMessage(run.telegram, run.message, formatShellPart(part), true)
+		}
+	}()
+}
+
+// reserveSessionForShell holds sessionID for a /sh command so no prompt starts
+// while it runs; prompts sent meanwhile are queued. It fails if a task is
+// running or queued. Call release when the command is done.
+func (b *Bot) reserveSessionForShell(sessionID string) (release func(), ok bool) {
+	if b.runtime == nil {
+		if b.isSessionBusy(sessionID) {
+			return nil, false
+		}
+		return func() {}, true
+	}
+	actor := b.runtime.getOrCreateActor(sessionID)
+	if !actor.reserveShell() {
+		return nil, false
+	}
+	return actor.releaseShell, true
+}
+
+// handleSh handles the /sh command
+func (b *Bot) handleSh(c telebot.Context) error {
+	command := strings.TrimSpace(c.Message().Payload)
+	if command == "" {
+		return c.Send("Usage: /sh <command>\nExample: /sh git status")
+	}
+
+	userID := c.Sender().ID
+	sessionID, exists := b.sessionManager.GetUserSession(userID)
+	if !exists {
+		return c.Send("You don't have a current session. Use /new to create a new session.")
+	}
+	// The command would run in the middle of the streaming prompt and ahead of
+	// any queued ones, so wait until the session is idle and keep it that way.
+	release, ok := b.reserveSessionForShell(sessionID)
+	if !ok {
+		return c.Send("⚠️ A task is still running or queued in this session. Wait for it to finish or use /abort first.")
+	}
+	defer release()
+
+	req := &opencode.ShellRequest{Agent: shellDefaultAgent, Command: command}
+	if meta, ok := b.sessionManager.GetSessionMeta(sessionID); ok && meta != nil {
+		if meta.Agent != "" {
+			req.Agent = meta.Agent
+		}
+		if meta.ProviderID != "" && meta.ModelID != "" {
+			req.Model = &opencode.MessageModel{ProviderID: meta.ProviderID, ModelID: meta.ModelID}
+		}
+	}
+
+	shown := "$ " + truncateAndInline(command, 500)
+	fence := codeFence(shown)
+	placeholder := fmt.Sprintf("%sbash\n%s\n%s", fence, shown, fence)
+	msg, err := b.sendRenderedTelegramMessage(c, placeholder, true)
+	if err != nil {
+		return err
+	}
+
+	run := &shellRun{telegram: c, message: msg, lastUpdate: time.Now()}
+	if !b.shells.start(sessionID, run) {
+		b.updateTelegramMessage(c, msg, "❌ Another /sh command is still running in this session.", false)
+		return nil
+	}
+	defer b.shells.finish(sessionID)
+
+	openCodeTimeout := 0
+	if b.config != nil {
+		openCodeTimeout = b.config.OpenCode.Timeout
+	}
+	ctx, cancel := context.WithTimeout(b.ctx, taskWaitTimeout(openCodeTimeout))
+	defer cancel()
+
+	log.Infof("User %d running shell command in session %s: %s", userID, sessionID, truncateAndInline(command, 200))
+	result, err := b.opencodeClient.RunShell(ctx, sessionID, req)
+
+	run.mu.Lock()
+	run.done = true
+	run.mu.Unlock()
+
+	if err != nil {
+		log.Warnf("Shell command failed for session %s: %v", sessionID, err)
+		b.updateTelegramMessage(c, msg, fmt.Sprintf("%s\n\n❌ %v", placeholder, err), false)
+		return nil
+	}
+	part, ok := result.ToolPart()
+	if !ok {
+		b.updateTelegramMessage(c, msg, placeholder+"\n\n✅ Finished with no output.", false)
+		return nil
+	}
+
+	state := shellPartState(part.State)
+	b.updateTelegramMessage(c, msg, formatShellPart(part)+"\n\n"+shellExitStatus(state), false)
+
+	output := strings.TrimSpace(extractToolOutput(state))
+	if len(output) <= toolOutputDisplayLimit {
+		return nil
+	}
+	doc := &telebot.Document{
+		File:     telebot.FromReader(strings.NewReader(output + "\n")),
+		FileName: "output.txt",
+		MIME:     "text/plain",
+		Caption:  "$ " + truncateAndInline(command, 200),
+	}
+	return c.Send(doc)
+}
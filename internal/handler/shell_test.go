@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tg-bot/internal/opencode"
+	"tg-bot/internal/render"
+	"tg-bot/internal/session"
+	"tg-bot/internal/storage"
+
+	"gopkg.in/telebot.v4"
+)
+
+func TestShellPartState_LiftsRunningOutput(t *testing.T) {
+	state := shellPartState(map[string]interface{}{
+		"status":   "running",
+		"input":    map[string]interface{}{"command": "go test ./..."},
+		"metadata": map[string]interface{}{"output": "ok  tg-bot/internal/config"},
+	})
+	if got := extractToolOutput(state); got != "ok  tg-bot/internal/config" {
+		t.Fatalf("expected metadata output to be lifted, got %q", got)
+	}
+
+	state = shellPartState(map[string]interface{}{
+		"status":   "completed",
+		"output":   "final",
+		"metadata": map[string]interface{}{"output": "partial"},
+	})
+	if got := extractToolOutput(state); got != "final" {
+		t.Fatalf("completed output must win over metadata, got %q", got)
+	}
+}
+
+func TestShellExitStatus(t *testing.T) {
+	tests := []struct {
+		name  string
+		state map[string]interface{}
+		want  string
+	}{
+		{"zero exit", map[string]interface{}{"status": "completed", "metadata": map[string]interface{}{"exit": float64(0)}}, "✅ Exit status: 0"},
+		{"non-zero exit", map[string]interface{}{"status": "completed", "metadata": map[string]interface{}{"exitCode": float64(2)}}, "❌ Exit status: 2"},
+		{"tool error", map[string]interface{}{"status": "error", "error": "command not found"}, "❌ Failed: command not found"},
+		{"no exit code", map[string]interface{}{"status": "completed"}, "✅ Finished (exit status not reported)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shellExitStatus(tt.state); got != tt.want {
+				t.Fatalf("shellExitStatus() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleSh_SendsLongOutputAsDocument(t *testing.T) {
+	longOutput := strings.Repeat("line of build output\n", 200)
+	var gotReq opencode.ShellRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/session/ses_1/shell" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&gotReq)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(opencode.MessageResponse{
+			Info: opencode.MessageInfo{ID: "msg_1", SessionID: "ses_1", Role: "assistant"},
+			Parts: []opencode.MessagePartResponse{{
+				ID:        "prt_1",
+				SessionID: "ses_1",
+				MessageID: "msg_1",
+				Type:      "tool",
+				Tool:      "bash",
+				State: map[string]interface{}{
+					"status":   "completed",
+					"input":    map[string]interface{}{"command": "make build"},
+					"output":   longOutput,
+					"metadata": map[string]interface{}{"exit": 1},
+				},
+			}},
+		})
+	}))
+	defer server.Close()
+
+	store, err := storage.NewStore(storage.Options{
+		Type:     "file",
+		FilePath: filepath.Join(t.TempDir(), "bot-state.json"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	const userID int64 = 7
+	if err := store.StoreSessionMeta(&storage.SessionMeta{SessionID: "ses_1", UserID: userID, Agent: "plan", CreatedAt: time.Now(), LastUsedAt: time.Now()}); err != nil {
+		t.Fatalf("failed to store session meta: %v", err)
+	}
+	if err := store.StoreUserSession(userID, "ses_1"); err != nil {
+		t.Fatalf("failed to store user session: %v", err)
+	}
+
+	client := opencode.NewClient(server.URL, 5)
+	b := &Bot{
+		ctx:            context.Background(),
+		opencodeClient: client,
+		sessionManager: session.NewManagerWithStore(client, store),
+		renderer:       render.New("markdown_stream"),
+	}
+	tgBot, recorder := newTestTelegramBot(t)
+	c := tgBot.NewContext(telebot.Update{
+		Message: &telebot.Message{
+			ID:      1,
+			Sender:  &telebot.User{ID: userID},
+			Chat:    &telebot.Chat{ID: userID, Type: telebot.ChatPrivate},
+			Text:    "/sh make build",
+			Payload: "make build",
+		},
+	})
+
+	if err := b.handleSh(c); err != nil {
+		t.Fatalf("handleSh failed: %v", err)
+	}
+
+	if gotReq.Command != "make build" || gotReq.Agent != "plan" {
+		t.Fatalf("unexpected shell request: %#v", gotReq)
+	}
+	edits := recorder.Calls("editMessageText")
+	if len(edits) != 1 || !strings.Contains(edits[0].Body, "Exit status: 1") {
+		t.Fatalf("expected the placeholder to be edited with the exit status, got %#v", edits)
+	}
+	docs := recorder.Calls("sendDocument")
+	if len(docs) != 1 || !strings.Contains(docs[0].Body, "output.txt") {
+		t.Fatalf("expected long output as a document, got %#v", docs)
+	}
+	if b.shells.get("ses_1") != nil {
+		t.Fatal("shell run should be cleared after completion")
+	}
+}
+
+func TestHandleSh_RefusesWhileSessionBusy(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	store, err := storage.NewStore(storage.Options{
+		Type:     "file",
+		FilePath: filepath.Join(t.TempDir(), "bot-state.json"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	const userID int64 = 7
+	if err := store.StoreUserSession(userID, "ses_1"); err != nil {
+		t.Fatalf("failed to store user session: %v", err)
+	}
+
+	client := opencode.NewClient(server.URL, 5)
+	b := &Bot{
+		ctx:             context.Background(),
+		opencodeClient:  client,
+		sessionManager:  session.NewManagerWithStore(client, store),
+		renderer:        render.New("markdown_stream"),
+		streamingStates: map[string]*streamingState{"ses_1": {isStreaming: true}},
+	}
+	tgBot, recorder := newTestTelegramBot(t)
+	c := tgBot.NewContext(telebot.Update{
+		Message: &telebot.Message{
+			ID:      1,
+			Sender:  &telebot.User{ID: userID},
+			Chat:    &telebot.Chat{ID: userID, Type: telebot.ChatPrivate},
+			Text:    "/sh git status",
+			Payload: "git status",
+		},
+	})
+
+	if err := b.handleSh(c); err != nil {
+		t.Fatalf("handleSh failed: %v", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 0 {
+		t.Fatalf("no shell request should reach OpenCode while a task runs, got %d", n)
+	}
+	sent := recorder.Calls("sendMessage")
+	if len(sent) != 1 || !strings.Contains(sent[0].Body, "still running") {
+		t.Fatalf("expected a busy notice, got %#v", sent)
+	}
+}
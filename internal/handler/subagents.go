@@ -0,0 +1,248 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"tg-bot/internal/opencode"
+)
+
+// subagentState follows a child session spawned by a running task.
+type subagentState struct {
+	SessionID  string
+	Title      string
+	Agent      string
+	Tools      map[string]bool // tool part IDs
+	LastTool   string
+	LastText   string
+	Error      string
+	Done       bool
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// childSessionInfo extracts the session from session.created/session.updated events.
+func childSessionInfo(event opencode.SessionEvent) (opencode.Session, bool) {
+	if event.Type != "session.created" && event.Type != "session.updated" {
+		return opencode.Session{}, false
+	}
+	var payload struct {
+		Info opencode.Session `json:"info"`
+	}
+	if err := json.Unmarshal(event.Properties, &payload); err != nil || payload.Info.ID == "" {
+		return opencode.Session{}, false
+	}
+	return payload.Info, true
+}
+
+// trackChildSession remembers child sessions of sessions with a running task
+// and returns the root session whose actor should see the child's events.
+func (r *openCodeRuntime) trackChildSession(info opencode.Session) (string, bool) {
+	if info.ParentID == "" {
+		return "", false
+	}
+	r.childMu.Lock()
+	defer r.childMu.Unlock()
+
+	root := info.ParentID
+	if parentRoot, ok := r.childRoots[root]; ok {
+		root = parentRoot
+	}
+	if !r.bot.isSessionBusy(root) {
+		return "", false
+	}
+	if r.childRoots == nil {
+		r.childRoots = make(map[string]string)
+	}
+	r.childRoots[info.ID] = root
+	return root, true
+}
+
+// childRoot returns the root session a tracked child session belongs to.
+func (r *openCodeRuntime) childRoot(sessionID string) (string, bool) {
+	r.childMu.RLock()
+	defer r.childMu.RUnlock()
+	root, ok := r.childRoots[sessionID]
+	return root, ok
+}
+
+// forgetChildSessions drops the children tracked for root once its task is over.
+func (r *openCodeRuntime) forgetChildSessions(root string) {
+	r.childMu.Lock()
+	defer r.childMu.Unlock()
+	for child, childRoot := range r.childRoots {
+		if childRoot == root {
+			delete(r.childRoots, child)
+		}
+	}
+}
+
+func (state *streamingState) subagentLocked(sessionID string) *subagentState {
+	if state.subagents == nil {
+		state.subagents = make(map[string]*subagentState)
+	}
+	sub, ok := state.subagents[sessionID]
+	if !ok {
+		sub = &subagentState{SessionID: sessionID, Tools: make(map[string]bool), StartedAt: time.Now()}
+		state.subagents[sessionID] = sub
+		state.subagentOrder = append(state.subagentOrder, sessionID)
+	}
+	return sub
+}
+
+// applySubagentEventLocked records progress of a child session of state's session.
+func applySubagentEventLocked(state *streamingState, sessionID string, event opencode.SessionEvent) bool {
+	if info, ok := childSessionInfo(event); ok {
+		if info.ID == sessionID {
+			return false
+		}
+		sub := state.subagentLocked(info.ID)
+		if info.Title == "" || info.Title == sub.Title {
+			return false
+		}
+		sub.Title = info.Title
+		return true
+	}
+
+	childID, status := sessionEventSessionIDAndStatus(event)
+	if childID == "" || childID == sessionID {
+		return false
+	}
+	sub := state.subagentLocked(childID)
+
+	switch event.Type {
+	case "message.updated":
+		var payload opencode.MessageUpdatedProperties
+		if err := json.Unmarshal(event.Properties, &payload); err != nil || payload.Info.Role != "assistant" {
+			return false
+		}
+		changed := false
+		agent := payload.Info.Agent
+		if agent == "" {
+			agent = payload.Info.Mode
+		}
+		if agent != "" && agent != sub.Agent {
+			sub.Agent = agent
+			changed = true
+		}
+		if payload.Info.Error != nil && sub.Error == "" {
+			sub.Error = messageErrorText(payload.Info.Error)
+			if sub.Error == "" {
+				sub.Error = "unknown error"
+			}
+			changed = true
+		}
+		return changed
+	case "message.part.updated":
+		var payload opencode.MessagePartUpdatedProperties
+		if err := json.Unmarshal(event.Properties, &payload); err != nil {
+			return false
+		}
+		part := payload.Part
+		switch part.Type {
+		case "tool":
+			sub.Tools[part.ID] = true
+			sub.LastTool = part.Tool
+			return true
+		case "text":
+			if text := lastNonEmptyLine(part.Text); text != "" && text != sub.LastText {
+				sub.LastText = text
+				return true
+			}
+		}
+		return false
+	case "session.status", "session.idle":
+		idle := event.Type == "session.idle" || (status != nil && strings.EqualFold(status.Type, "idle"))
+		if idle == sub.Done {
+			return false
+		}
+		sub.Done = idle
+		if idle {
+			sub.FinishedAt = time.Now()
+		}
+		return true
+	}
+	return false
+}
+
+func lastNonEmptyLine(text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if line := strings.TrimSpace(lines[i]); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// subagentLabel names a subagent; OpenCode titles child sessions
+// "<description> (@<agent> subagent)", which is shortened to "@<agent> · <description>".
+func subagentLabel(sub *subagentState) string {
+	title := strings.TrimSpace(sub.Title)
+	agent := sub.Agent
+	if i := strings.LastIndex(title, " (@"); i >= 0 && strings.HasSuffix(title, " subagent)") {
+		if agent == "" {
+			agent = strings.TrimSuffix(title[i+len(" (@"):], " subagent)")
+		}
+		title = strings.TrimSpace(title[:i])
+	}
+	switch {
+	case agent != "" && title != "":
+		return fmt.Sprintf("@%s · %s", agent, truncateAndInline(title, 60))
+	case agent != "":
+		return "@" + agent
+	case title != "":
+		return truncateAndInline(title, 60)
+	default:
+		return "subagent"
+	}
+}
+
+// formatSubagentLine is one subagent's status, or its summary once finished.
+func formatSubagentLine(sub *subagentState, complete bool) string {
+	tools := len(sub.Tools)
+	switch {
+	case sub.Error != "":
+		return fmt.Sprintf("❌ %s — failed after %d tool call(s): %s", subagentLabel(sub), tools, truncateAndInline(sub.Error, 120))
+	case sub.Done:
+		elapsed := sub.FinishedAt.Sub(sub.StartedAt).Round(time.Second)
+		return fmt.Sprintf("✅ %s — %d tool call(s) in %s", subagentLabel(sub), tools, elapsed)
+	case complete:
+		return fmt.Sprintf("⏹ %s — stopped after %d tool call(s)", subagentLabel(sub), tools)
+	}
+	line := fmt.Sprintf("⏳ %s — %d tool call(s)", subagentLabel(sub), tools)
+	if sub.LastTool != "" {
+		line += ", now: " + sub.LastTool
+	}
+	if sub.LastText != "" {
+		line += "\n> ↳ " + truncateAndInline(sub.LastText, 100)
+	}
+	return line
+}
+
+// formatSubagentSectionLocked renders the subagents of a task as a collapsed
+// quote block; Telegram shows it expandable below the parent's output.
+func formatSubagentSectionLocked(state *streamingState) string {
+	if len(state.subagentOrder) == 0 {
+		return ""
+	}
+	running := 0
+	for _, id := range state.subagentOrder {
+		if sub := state.subagents[id]; !sub.Done && sub.Error == "" {
+			running++
+		}
+	}
+
+	var sb strings.Builder
+	if running > 0 && !state.isComplete {
+		fmt.Fprintf(&sb, "🧩 Subagents (%d running, %d total)\n", running, len(state.subagentOrder))
+	} else {
+		fmt.Fprintf(&sb, "🧩 Subagents (%d)\n", len(state.subagentOrder))
+	}
+	for _, id := range state.subagentOrder {
+		sb.WriteString("> " + formatSubagentLine(state.subagents[id], state.isComplete) + "\n")
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"tg-bot/internal/opencode"
+)
+
+func testEvent(t *testing.T, eventType string, properties interface{}) opencode.SessionEvent {
+	t.Helper()
+	raw, err := json.Marshal(properties)
+	if err != nil {
+		t.Fatalf("failed to marshal event properties: %v", err)
+	}
+	return opencode.SessionEvent{Type: eventType, Properties: raw}
+}
+
+func TestRouteEvent_ForwardsChildSessionsToRunningParent(t *testing.T) {
+	b := &Bot{streamingStates: map[string]*streamingState{"ses_root": {isStreaming: true}}}
+	actor := &sessionActor{sessionID: "ses_root", eventCh: make(chan opencode.SessionEvent, 16)}
+	r := &openCodeRuntime{
+		bot:           b,
+		ctx:           context.Background(),
+		actors:        map[string]*sessionActor{"ses_root": actor},
+		sessionStatus: make(map[string]opencode.SessionStatusInfo),
+	}
+	actor.runtime = r
+
+	r.routeEvent(testEvent(t, "session.created", map[string]interface{}{
+		"info": opencode.Session{ID: "ses_child", ParentID: "ses_root", Title: "Find auth code (@explore subagent)"},
+	}))
+	r.routeEvent(testEvent(t, "session.created", map[string]interface{}{
+		"info": opencode.Session{ID: "ses_grandchild", ParentID: "ses_child"},
+	}))
+	r.routeEvent(testEvent(t, "session.created", map[string]interface{}{
+		"info": opencode.Session{ID: "ses_unrelated", ParentID: "ses_idle"},
+	}))
+	r.routeEvent(testEvent(t, "message.part.updated", opencode.MessagePartUpdatedProperties{
+		Part: opencode.MessagePartResponse{ID: "prt_1", SessionID: "ses_grandchild", Type: "tool", Tool: "grep"},
+	}))
+
+	if got := len(actor.eventCh); got != 3 {
+		t.Fatalf("expected 3 events routed to the root actor, got %d", got)
+	}
+	if root, ok := r.childRoot("ses_grandchild"); !ok || root != "ses_root" {
+		t.Fatalf("grandchild should resolve to the root session, got %q", root)
+	}
+	if _, ok := r.childRoot("ses_unrelated"); ok {
+		t.Fatal("children of sessions without a running task must not be tracked")
+	}
+
+	r.forgetChildSessions("ses_root")
+	if _, ok := r.childRoot("ses_child"); ok {
+		t.Fatal("children should be forgotten once the parent task finished")
+	}
+}
+
+func TestApplySubagentEventLocked_RendersProgressAndSummary(t *testing.T) {
+	state := &streamingState{updateMutex: &sync.Mutex{}}
+
+	events := []opencode.SessionEvent{
+		testEvent(t, "session.created", map[string]interface{}{
+			"info": opencode.Session{ID: "ses_child", ParentID: "ses_1", Title: "Find auth code (@explore subagent)"},
+		}),
+		testEvent(t, "message.part.updated", opencode.MessagePartUpdatedProperties{
+			Part: opencode.MessagePartResponse{ID: "prt_1", SessionID: "ses_child", Type: "tool", Tool: "glob"},
+		}),
+		testEvent(t, "message.part.updated", opencode.MessagePartUpdatedProperties{
+			Part: opencode.MessagePartResponse{ID: "prt_2", SessionID: "ses_child", Type: "tool", Tool: "grep"},
+		}),
+		testEvent(t, "message.part.updated", opencode.MessagePartUpdatedProperties{
+			Part: opencode.MessagePartResponse{ID: "prt_3", SessionID: "ses_child", Type: "text", Text: "Looking at\nauth/login.go"},
+		}),
+	}
+	for _, event := range events {
+		if !applySubagentEventLocked(state, "ses_1", event) {
+			t.Fatalf("expected %s to change subagent state", event.Type)
+		}
+	}
+	if applySubagentEventLocked(state, "ses_1", testEvent(t, "message.part.updated", opencode.MessagePartUpdatedProperties{
+		Part: opencode.MessagePartResponse{ID: "prt_9", SessionID: "ses_1", Type: "tool", Tool: "task"},
+	})) {
+		t.Fatal("the parent's own events are not subagent progress")
+	}
+
+	section := formatSubagentSectionLocked(state)
+	for _, want := range []string{"1 running", "> ⏳ @explore · Find auth code — 2 tool call(s), now: grep", "> ↳ auth/login.go"} {
+		if !strings.Contains(section, want) {
+			t.Fatalf("running section should contain %q:\n%s", want, section)
+		}
+	}
+
+	idle := testEvent(t, "session.status", map[string]interface{}{
+		"sessionID": "ses_child",
+		"status":    opencode.SessionStatusInfo{Type: "idle"},
+	})
+	if !applySubagentEventLocked(state, "ses_1", idle) {
+		t.Fatal("expected idle status to finish the subagent")
+	}
+	state.isComplete = true
+	section = formatSubagentSectionLocked(state)
+	if !strings.Contains(section, "> ✅ @explore · Find auth code — 2 tool call(s) in") || strings.Contains(section, "↳") {
+		t.Fatalf("expected a final summary line:\n%s", section)
+	}
+
+	displays := (&Bot{}).buildEventDrivenDisplaysLocked(state)
+	if len(displays) == 0 || !strings.Contains(strings.Join(displays, "\n"), "🧩 Subagents (1)") {
+		t.Fatalf("subagent section should be part of the streaming display: %#v", displays)
+	}
+}
@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"tg-bot/internal/opencode"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/telebot.v4"
+)
+
+// todoChecklistPinSize is the largest live message the checklist is added to,
+// matching the page size replies are split at.
+const todoChecklistPinSize = 3000
+
+// isTodoTool reports whether a tool part reads or writes the agent's todo list.
+func isTodoTool(toolName string) bool {
+	switch strings.ToLower(strings.TrimSpace(toolName)) {
+	case "todowrite", "todoread":
+		return true
+	default:
+		return false
+	}
+}
+
+// todosFromToolState extracts the list a todowrite call wrote, preferring the
+// metadata OpenCode fills in once the call completed.
+func todosFromToolState(state interface{}) ([]opencode.Todo, bool) {
+	source := toStringAnyMap(state)
+	if source == nil {
+		return nil, false
+	}
+	for _, key := range []string{"metadata", "input"} {
+		container := toStringAnyMap(source[key])
+		if container == nil {
+			continue
+		}
+		raw, ok := container["todos"]
+		if !ok {
+			continue
+		}
+		data, err := json.Marshal(raw)
+		if err != nil {
+			continue
+		}
+		var todos []opencode.Todo
+		if err := json.Unmarshal(data, &todos); err == nil {
+			return todos, true
+		}
+	}
+	return nil, false
+}
+
+func todoCheckbox(status string) string {
+	switch status {
+	case "completed":
+		return "☑"
+	case "in_progress":
+		return "◐"
+	case "cancelled":
+		return "☒"
+	default:
+		return "☐"
+	}
+}
+
+func todoPriorityLabel(priority string) string {
+	switch priority {
+	case "high":
+		return " ‼️"
+	case "medium":
+		return " ❕"
+	default:
+		return ""
+	}
+}
+
+func todoProgress(todos []opencode.Todo) (done, total int) {
+	for _, todo := range todos {
+		if todo.Status == "cancelled" {
+			continue
+		}
+		total++
+		if todo.Status == "completed" {
+			done++
+		}
+	}
+	return done, total
+}
+
+// formatTodoChecklist renders todos as a checklist; ‼️ marks high and ❕ medium priority.
+func formatTodoChecklist(todos []opencode.Todo) string {
+	if len(todos) == 0 {
+		return ""
+	}
+	done, total := todoProgress(todos)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "📝 Todo (%d/%d done)\n", done, total)
+	for _, todo := range todos {
+		content := truncateAndInline(todo.Content, 120)
+		if todo.Status == "cancelled" {
+			content = "~~" + content + "~~"
+		}
+		fmt.Fprintf(&sb, "%s %s%s\n", todoCheckbox(todo.Status), content, todoPriorityLabel(todo.Priority))
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// formatTodoToolPart replaces the generic tool block for todo tools with a
+// single line, newline-terminated like the blocks; the list itself is shown
+// pinned on the live message of the output.
+func formatTodoToolPart(toolName string, state interface{}) string {
+	todos, ok := todosFromToolState(state)
+	if !ok {
+		if strings.EqualFold(toolName, "todoread") {
+			return "📝 Read the todo list\n"
+		}
+		return "📝 Updating the todo list\n"
+	}
+	done, total := todoProgress(todos)
+	return fmt.Sprintf("📝 Updated the todo list (%d/%d done)\n", done, total)
+}
+
+// applyTodoEventLocked keeps the latest todo list of state's session from
+// todo.updated events and todowrite tool parts.
+func applyTodoEventLocked(state *streamingState, sessionID string, event opencode.SessionEvent) bool {
+	var todos []opencode.Todo
+	switch event.Type {
+	case "todo.updated":
+		var payload opencode.TodoUpdatedProperties
+		if err := json.Unmarshal(event.Properties, &payload); err != nil || payload.SessionID != sessionID {
+			return false
+		}
+		todos = payload.Todos
+	case "message.part.updated":
+		var payload opencode.MessagePartUpdatedProperties
+		if err := json.Unmarshal(event.Properties, &payload); err != nil {
+			return false
+		}
+		part := payload.Part
+		if part.SessionID != sessionID || part.Type != "tool" || !strings.EqualFold(part.Tool, "todowrite") {
+			return false
+		}
+		var ok bool
+		if todos, ok = todosFromToolState(part.State); !ok {
+			return false
+		}
+	default:
+		return false
+	}
+
+	if sameTodos(state.todos, todos) {
+		return false
+	}
+	state.todos = todos
+	return true
+}
+
+func sameTodos(a, b []opencode.Todo) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// handleTodos handles the /todos command
+func (b *Bot) handleTodos(c telebot.Context) error {
+	sessionID, exists := b.sessionManager.GetUserSession(c.Sender().ID)
+	if !exists {
+		return c.Send("You don't have a current session. Use /new to create a new session.")
+	}
+
+	ctx, cancel := context.WithTimeout(b.ctx, 30*time.Second)
+	defer cancel()
+
+	todos, err := b.opencodeClient.GetTodos(ctx, sessionID)
+	if err != nil {
+		log.Errorf("Failed to get todos for session %s: %v", sessionID, err)
+		return c.Send(fmt.Sprintf("❌ %v", err))
+	}
+	if len(todos) == 0 {
+		return c.Send("📝 The agent has no todo list in this session.")
+	}
+	_, err = b.sendRenderedTelegramMessage(c, formatTodoChecklist(todos), false)
+	return err
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"tg-bot/internal/opencode"
+)
+
+func TestFormatTodoChecklist(t *testing.T) {
+	todos := []opencode.Todo{
+		{ID: "1", Content: "Read the code", Status: "completed", Priority: "high"},
+		{ID: "2", Content: "Write tests", Status: "in_progress", Priority: "medium"},
+		{ID: "3", Content: "Update docs", Status: "pending", Priority: "low"},
+		{ID: "4", Content: "Rewrite in Rust", Status: "cancelled", Priority: "low"},
+	}
+	got := formatTodoChecklist(todos)
+	want := strings.Join([]string{
+		"📝 Todo (1/3 done)",
+		"☑ Read the code ‼️",
+		"◐ Write tests ❕",
+		"☐ Update docs",
+		"☒ ~~Rewrite in Rust~~",
+	}, "\n")
+	if got != want {
+		t.Fatalf("unexpected checklist:\n%s\nwant:\n%s", got, want)
+	}
+	if formatTodoChecklist(nil) != "" {
+		t.Fatal("empty todo list should render nothing")
+	}
+}
+
+func TestApplyTodoEventLocked(t *testing.T) {
+	state := &streamingState{updateMutex: &sync.Mutex{}}
+
+	other := testEvent(t, "todo.updated", opencode.TodoUpdatedProperties{
+		SessionID: "ses_other",
+		Todos:     []opencode.Todo{{ID: "1", Content: "elsewhere", Status: "pending"}},
+	})
+	if applyTodoEventLocked(state, "ses_1", other) {
+		t.Fatal("todos of other sessions must be ignored")
+	}
+
+	updated := testEvent(t, "todo.updated", opencode.TodoUpdatedProperties{
+		SessionID: "ses_1",
+		Todos:     []opencode.Todo{{ID: "1", Content: "Plan", Status: "in_progress", Priority: "high"}},
+	})
+	if !applyTodoEventLocked(state, "ses_1", updated) {
+		t.Fatal("expected todo.updated to set the list")
+	}
+	if applyTodoEventLocked(state, "ses_1", updated) {
+		t.Fatal("an unchanged list should not count as a change")
+	}
+
+	toolState := map[string]interface{}{
+		"status": "running",
+		"input": map[string]interface{}{
+			"todos": []interface{}{
+				map[string]interface{}{"id": "1", "content": "Plan", "status": "completed", "priority": "high"},
+				map[string]interface{}{"id": "2", "content": "Build", "status": "pending", "priority": "medium"},
+			},
+		},
+	}
+	part := testEvent(t, "message.part.updated", opencode.MessagePartUpdatedProperties{
+		Part: opencode.MessagePartResponse{ID: "prt_1", SessionID: "ses_1", Type: "tool", Tool: "todowrite", State: toolState},
+	})
+	if !applyTodoEventLocked(state, "ses_1", part) || len(state.todos) != 2 {
+		t.Fatalf("expected todowrite input to update the list, got %#v", state.todos)
+	}
+
+	state.displayOrder = nil
+	displays := (&Bot{}).buildEventDrivenDisplaysLocked(state)
+	if len(displays) != 1 || !strings.HasPrefix(displays[0], "📝 Todo (1/2 done)") {
+		t.Fatalf("checklist should be shown while nothing else is: %#v", displays)
+	}
+
+	if got := formatToolCallPart("todowrite", "", toolState, ""); got != "📝 Updated the todo list (1/2 done)\n" {
+		t.Fatalf("unexpected todowrite tool line: %q", got)
+	}
+}
+
+func TestPinTodoChecklist_StaysOnLiveMessage(t *testing.T) {
+	checklist := "📝 Todo (1/2 done)\n☑ Plan\n☐ Build"
+
+	pages := pinTodoChecklist([]string{"page one", "page two"}, checklist)
+	if len(pages) != 2 || pages[0] != "page one" || !strings.HasPrefix(pages[1], checklist+"\n\npage two") {
+		t.Fatalf("checklist should top the last page: %#v", pages)
+	}
+
+	full := strings.Repeat("x", todoChecklistPinSize)
+	pages = pinTodoChecklist([]string{"page one", full}, checklist)
+	if len(pages) != 3 || pages[1] != full || pages[2] != checklist {
+		t.Fatalf("checklist should get its own last message when it does not fit: %#v", pages)
+	}
+
+	if pages := pinTodoChecklist([]string{"only"}, ""); len(pages) != 1 || pages[0] != "only" {
+		t.Fatalf("no checklist should leave pages unchanged: %#v", pages)
+	}
+}
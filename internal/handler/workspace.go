@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/telebot.v4"
+)
+
+// Files up to this size are shown inline as a code block; larger ones are sent as documents.
+const inlineFileMaxBytes = 3000
+
+// currentSessionDirectory returns the user's current session and its project directory.
+func (b *Bot) currentSessionDirectory(ctx context.Context, userID int64) (sessionID, directory string, err error) {
+	sessionID, exists := b.sessionManager.GetUserSession(userID)
+	if !exists {
+		return "", "", fmt.Errorf("you don't have a current session. Use /new to create a new session")
+	}
+	sess, err := b.opencodeClient.GetSession(ctx, sessionID)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get session: %w", err)
+	}
+	if strings.TrimSpace(sess.Directory) == "" {
+		return "", "", fmt.Errorf("session has no project directory")
+	}
+	return sessionID, sess.Directory, nil
+}
+
+// resolveWorkspacePath resolves input against root and returns it relative to root.
+// Paths that escape root, including absolute paths elsewhere, are rejected.
+func resolveWorkspacePath(root, input string) (string, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return "", fmt.Errorf("path is required")
+	}
+	root = filepath.Clean(root)
+
+	target := input
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(root, target)
+	}
+	target = filepath.Clean(target)
+
+	rel, err := filepath.Rel(root, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %q is outside the project directory", input)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// fileBlockLanguage picks a code block language from a file name.
+func fileBlockLanguage(name string) string {
+	base := strings.ToLower(path.Base(filepath.ToSlash(name)))
+	switch base {
+	case "dockerfile":
+		return "dockerfile"
+	case "makefile":
+		return "makefile"
+	}
+
+	switch strings.TrimPrefix(path.Ext(base), ".") {
+	case "go":
+		return "go"
+	case "py":
+		return "python"
+	case "js", "mjs", "cjs", "jsx":
+		return "javascript"
+	case "ts", "tsx":
+		return "typescript"
+	case "sh", "bash", "zsh":
+		return "bash"
+	case "sql":
+		return "sql"
+	case "json":
+		return "json"
+	case "yaml", "yml":
+		return "yaml"
+	case "toml":
+		return "toml"
+	case "md", "markdown":
+		return "markdown"
+	case "html", "htm":
+		return "html"
+	case "css":
+		return "css"
+	case "rs":
+		return "rust"
+	case "java":
+		return "java"
+	case "c", "h":
+		return "c"
+	case "cc", "cpp", "hpp":
+		return "cpp"
+	case "rb":
+		return "ruby"
+	case "diff", "patch":
+		return "diff"
+	}
+	return "text"
+}
+
+// codeFence returns a backtick fence longer than any backtick run in text.
+func codeFence(text string) string {
+	longest, run := 0, 0
+	for _, r := range text {
+		if r == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+	if longest < 3 {
+		return "```"
+	}
+	return strings.Repeat("`", longest+1)
+}
+
+// handleGet handles the /get command
+func (b *Bot) handleGet(c telebot.Context) error {
+	input := strings.TrimSpace(c.Message().Payload)
+	if input == "" {
+		return c.Send("Usage: /get <path>\nPaths are relative to the current session's project directory.")
+	}
+
+	ctx, cancel := context.WithTimeout(b.ctx, 30*time.Second)
+	defer cancel()
+
+	_, directory, err := b.currentSessionDirectory(ctx, c.Sender().ID)
+	if err != nil {
+		return c.Send(fmt.Sprintf("❌ %v", err))
+	}
+	relPath, err := resolveWorkspacePath(directory, input)
+	if err != nil {
+		return c.Send(fmt.Sprintf("❌ %v", err))
+	}
+
+	return b.sendWorkspaceFile(ctx, c, directory, relPath)
+}
+
+// sendWorkspaceFile sends a project file inline when it is small text, otherwise as a document.
+func (b *Bot) sendWorkspaceFile(ctx context.Context, c telebot.Context, directory, relPath string) error {
+	content, err := b.opencodeClient.ReadFile(ctx, directory, relPath)
+	if err != nil {
+		log.Errorf("Failed to read workspace file %s: %v", relPath, err)
+		return c.Send(fmt.Sprintf("❌ Failed to read %s: %v", relPath, err))
+	}
+	data, err := content.Bytes()
+	if err != nil {
+		return c.Send(fmt.Sprintf("❌ Failed to decode %s: %v", relPath, err))
+	}
+
+	if !content.IsBinary() && len(data) <= inlineFileMaxBytes && utf8.Valid(data) {
+		text := strings.TrimRight(string(data), "\n")
+		fence := codeFence(text)
+		markdown := fmt.Sprintf("📄 `%s`\n\n%s%s\n%s\n%s", relPath, fence, fileBlockLanguage(relPath), text, fence)
+		_, err := b.sendRenderedTelegramMessage(c, markdown, false)
+		if err == nil {
+			return nil
+		}
+		log.Warnf("Failed to send %s inline, falling back to document: %v", relPath, err)
+	}
+
+	doc := &telebot.Document{
+		File:     telebot.FromReader(bytes.NewReader(data)),
+		FileName: path.Base(relPath),
+		Caption:  relPath,
+	}
+	if content.MimeType != "" {
+		doc.MIME = content.MimeType
+	}
+	return c.Send(doc)
+}
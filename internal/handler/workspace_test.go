@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tg-bot/internal/opencode"
+	"tg-bot/internal/render"
+	"tg-bot/internal/session"
+	"tg-bot/internal/storage"
+
+	"gopkg.in/telebot.v4"
+)
+
+func TestResolveWorkspacePath(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"relative file", "internal/main.go", "internal/main.go", false},
+		{"dot segments stay inside", "./a/../b.txt", "b.txt", false},
+		{"absolute inside root", "/srv/project/go.mod", "go.mod", false},
+		{"parent escape", "../secret", "", true},
+		{"nested escape", "a/../../secret", "", true},
+		{"absolute outside root", "/etc/passwd", "", true},
+		{"sibling with shared prefix", "/srv/project-other/x", "", true},
+		{"empty path", "  ", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveWorkspacePath("/srv/project", tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error for %q, got %q", tt.input, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("resolveWorkspacePath(%q) = %q, %v; want %q", tt.input, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileBlockLanguage(t *testing.T) {
+	tests := map[string]string{
+		"cmd/bot/main.go":     "go",
+		"scripts/build.sh":    "bash",
+		"Dockerfile":          "dockerfile",
+		"web/app.tsx":         "typescript",
+		"config.example.toml": "toml",
+		"notes":               "text",
+	}
+	for name, want := range tests {
+		if got := fileBlockLanguage(name); got != want {
+			t.Errorf("fileBlockLanguage(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestCodeFence(t *testing.T) {
+	if got := codeFence("plain"); got != "```" {
+		t.Fatalf("expected default fence, got %q", got)
+	}
+	if got := codeFence("has ```go fences```"); got != "````" {
+		t.Fatalf("expected longer fence, got %q", got)
+	}
+}
+
+func TestHandleGet_MarkdownWithNestedFence(t *testing.T) {
+	readme := "# Build\n\nRun:\n\n```sh\nmake\n```\n\nafter **bold**"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/session/ses_1":
+			_ = json.NewEncoder(w).Encode(opencode.Session{ID: "ses_1", Directory: "/srv/project"})
+		case "/file/content":
+			_ = json.NewEncoder(w).Encode(opencode.FileContent{Type: "text", Content: readme})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	store, err := storage.NewStore(storage.Options{
+		Type:     "file",
+		FilePath: filepath.Join(t.TempDir(), "bot-state.json"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	const userID int64 = 7
+	if err := store.StoreUserSession(userID, "ses_1"); err != nil {
+		t.Fatalf("failed to store user session: %v", err)
+	}
+
+	client := opencode.NewClient(server.URL, 5)
+	b := &Bot{
+		ctx:            context.Background(),
+		opencodeClient: client,
+		sessionManager: session.NewManagerWithStore(client, store),
+		renderer:       render.New("markdown_final"),
+	}
+	tgBot, recorder := newTestTelegramBot(t)
+	c := tgBot.NewContext(telebot.Update{
+		Message: &telebot.Message{
+			ID:      1,
+			Sender:  &telebot.User{ID: userID},
+			Chat:    &telebot.Chat{ID: userID, Type: telebot.ChatPrivate},
+			Text:    "/get README.md",
+			Payload: "README.md",
+		},
+	})
+
+	if err := b.handleGet(c); err != nil {
+		t.Fatalf("handleGet failed: %v", err)
+	}
+	sent := recorder.Calls("sendMessage")
+	if len(sent) != 1 {
+		t.Fatalf("expected the file inline, got %#v", sent)
+	}
+	var msg struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal([]byte(sent[0].Body), &msg); err != nil {
+		t.Fatalf("failed to decode message: %v", err)
+	}
+	if strings.Count(msg.Text, "<pre>") != 1 || strings.Contains(msg.Text, "<b>") {
+		t.Fatalf("the whole file should stay in one code block, got %q", msg.Text)
+	}
+	if !strings.Contains(msg.Text, "```sh\nmake\n```\n\nafter **bold**</code></pre>") {
+		t.Fatalf("expected the nested fence kept verbatim, got %q", msg.Text)
+	}
+}
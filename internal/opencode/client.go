@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -82,6 +83,7 @@ type Session struct {
 	Metadata   map[string]interface{} `json:"metadata,omitempty"`
 	ParentID   string                 `json:"parentID,omitempty"`
 	Permission json.RawMessage        `json:"permission,omitempty"`
+	Revert     *SessionRevert         `json:"revert,omitempty"`
 }
 
 // SessionTime represents the time fields in a session
@@ -105,6 +107,8 @@ type Message struct {
 	Finish      string                 `json:"finish,omitempty"`
 	ModelID     string                 `json:"model_id,omitempty"`
 	ProviderID  string                 `json:"provider_id,omitempty"`
+	Tokens      TokenUsage             `json:"tokens,omitempty"`
+	Summary     bool                   `json:"summary,omitempty"` // assistant message written by compaction
 }
 
 // MessageResponse represents the actual API response for a message
@@ -153,6 +157,8 @@ type MessagePartResponse struct {
 	CallID    string      `json:"callID,omitempty"`
 	Tool      string      `json:"tool,omitempty"`
 	State     interface{} `json:"state,omitempty"`
+	Hash      string      `json:"hash,omitempty"`  // patch parts
+	Files     []string    `json:"files,omitempty"` // patch parts
 }
 
 // SessionEvent represents a streamed event from /event.
@@ -186,8 +192,21 @@ type CreateSessionRequest struct {
 
 // MessagePart represents a part of a message
 type MessagePart struct {
-	Type string `json:"type"`
-	Text string `json:"text,omitempty"`
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	Mime     string `json:"mime,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	URL      string `json:"url,omitempty"`
+}
+
+// NewFilePart builds a file part that inlines data as a base64 data URL.
+func NewFilePart(mime, filename string, data []byte) MessagePart {
+	return MessagePart{
+		Type:     "file",
+		Mime:     mime,
+		Filename: filename,
+		URL:      "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(data),
+	}
 }
 
 // SendMessageRequest represents a request to send a message
@@ -195,6 +214,7 @@ type SendMessageRequest struct {
 	MessageID string        `json:"messageID,omitempty"`
 	Parts     []MessagePart `json:"parts"`
 	Model     *MessageModel `json:"model,omitempty"`
+	Agent     string        `json:"agent,omitempty"`
 }
 
 // MessageModel represents a model selection for a message
@@ -504,6 +524,10 @@ func convertMessageResponses(msgResponses []MessageResponse) []Message {
 			ModelID:    msgResp.Info.ModelID,
 			ProviderID: msgResp.Info.ProviderID,
 		}
+		msg.Tokens, _ = ParseTokenUsage(msgResp.Info.Tokens)
+		if summary, ok := msgResp.Info.Summary.(bool); ok {
+			msg.Summary = summary
+		}
 
 		var content strings.Builder
 		for j, part := range msgResp.Parts {
@@ -634,14 +658,27 @@ func (c *Client) GetConfig(ctx context.Context) (map[string]interface{}, error)
 	return config, nil
 }
 
+// Agent represents an OpenCode agent
+type Agent struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Mode        string `json:"mode,omitempty"` // "primary", "subagent" or "all"
+	BuiltIn     bool   `json:"builtIn,omitempty"`
+}
+
+// IsSubagent reports whether the agent can only be invoked by other agents.
+func (a Agent) IsSubagent() bool {
+	return a.Mode == "subagent"
+}
+
 // GetAgents gets available agents from /agent.
-func (c *Client) GetAgents(ctx context.Context) ([]map[string]interface{}, error) {
+func (c *Client) GetAgents(ctx context.Context) ([]Agent, error) {
 	resp, err := c.request(ctx, "GET", "/agent", nil)
 	if err != nil {
 		return nil, err
 	}
 
-	var agents []map[string]interface{}
+	var agents []Agent
 	if err := decodeResponse(resp, &agents); err != nil {
 		return nil, err
 	}
@@ -649,13 +686,13 @@ func (c *Client) GetAgents(ctx context.Context) ([]map[string]interface{}, error
 }
 
 // GetCommands gets available commands from /command.
-func (c *Client) GetCommands(ctx context.Context) ([]map[string]interface{}, error) {
+func (c *Client) GetCommands(ctx context.Context) ([]Command, error) {
 	resp, err := c.request(ctx, "GET", "/command", nil)
 	if err != nil {
 		return nil, err
 	}
 
-	var commands []map[string]interface{}
+	var commands []Command
 	if err := decodeResponse(resp, &commands); err != nil {
 		return nil, err
 	}
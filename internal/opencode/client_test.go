@@ -179,6 +179,16 @@ func TestPostMessage(t *testing.T) {
 	}
 }
 
+func TestNewFilePart(t *testing.T) {
+	part := NewFilePart("text/plain", "trace.log", []byte("panic: boom"))
+	if part.Type != "file" || part.Mime != "text/plain" || part.Filename != "trace.log" {
+		t.Fatalf("unexpected file part: %+v", part)
+	}
+	if part.URL != "data:text/plain;base64,cGFuaWM6IGJvb20=" {
+		t.Fatalf("unexpected data URL: %s", part.URL)
+	}
+}
+
 func TestPromptAsync(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "POST" || !strings.HasPrefix(r.URL.Path, "/session/test-session/prompt_async") {
@@ -196,6 +206,9 @@ func TestPromptAsync(t *testing.T) {
 		if req.MessageID != "msg_custom_async_1" {
 			t.Errorf("expected messageID msg_custom_async_1, got %q", req.MessageID)
 		}
+		if req.Agent != "plan" {
+			t.Errorf("expected agent plan, got %q", req.Agent)
+		}
 
 		w.WriteHeader(http.StatusNoContent)
 	}))
@@ -210,6 +223,7 @@ func TestPromptAsync(t *testing.T) {
 				Text: "hello async",
 			},
 		},
+		Agent: "plan",
 	})
 	if err != nil {
 		t.Fatalf("PromptAsync failed: %v", err)
@@ -282,7 +296,8 @@ func TestGetAgentsAndCommands(t *testing.T) {
 				return
 			}
 			resp := []map[string]interface{}{
-				{"id": "build", "name": "Build"},
+				{"name": "build", "description": "Default agent", "mode": "primary", "builtIn": true},
+				{"name": "general", "mode": "subagent"},
 			}
 			w.Header().Set("Content-Type", "application/json")
 			_ = json.NewEncoder(w).Encode(resp)
@@ -293,7 +308,7 @@ func TestGetAgentsAndCommands(t *testing.T) {
 				return
 			}
 			resp := []map[string]interface{}{
-				{"name": "fix"},
+				{"name": "fix", "description": "Fix failing tests", "template": "Fix $ARGUMENTS"},
 			}
 			w.Header().Set("Content-Type", "application/json")
 			_ = json.NewEncoder(w).Encode(resp)
@@ -309,16 +324,66 @@ func TestGetAgentsAndCommands(t *testing.T) {
 	if err != nil {
 		t.Fatalf("GetAgents failed: %v", err)
 	}
-	if len(agents) != 1 {
-		t.Fatalf("expected 1 agent, got %d", len(agents))
+	if len(agents) != 2 {
+		t.Fatalf("expected 2 agents, got %d", len(agents))
+	}
+	if agents[0].Name != "build" || agents[0].Description != "Default agent" || !agents[0].BuiltIn || agents[0].IsSubagent() {
+		t.Fatalf("unexpected primary agent: %#v", agents[0])
+	}
+	if !agents[1].IsSubagent() {
+		t.Fatalf("expected general to be a subagent: %#v", agents[1])
 	}
 
 	commands, err := client.GetCommands(context.Background())
 	if err != nil {
 		t.Fatalf("GetCommands failed: %v", err)
 	}
-	if len(commands) != 1 {
-		t.Fatalf("expected 1 command, got %d", len(commands))
+	if len(commands) != 1 || commands[0].Name != "fix" || commands[0].Description != "Fix failing tests" {
+		t.Fatalf("unexpected commands: %#v", commands)
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/session/ses_1/command" {
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var req CommandRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if req.Command == "missing" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"command not found"}`))
+			return
+		}
+		if req.Command != "review" || req.Arguments != "main.go" || req.Model != "openai/gpt-4o" || req.Agent != "plan" {
+			t.Errorf("unexpected command request: %#v", req)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"info":{"id":"msg_1"},"parts":[]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 5)
+	err := client.RunCommand(context.Background(), "ses_1", &CommandRequest{
+		Command:   "review",
+		Arguments: "main.go",
+		Model:     "openai/gpt-4o",
+		Agent:     "plan",
+	})
+	if err != nil {
+		t.Fatalf("RunCommand failed: %v", err)
+	}
+
+	err = client.RunCommand(context.Background(), "ses_1", &CommandRequest{Command: "missing"})
+	if err == nil || !strings.Contains(err.Error(), "command not found") {
+		t.Fatalf("expected command error, got %v", err)
 	}
 }
 
@@ -495,6 +560,185 @@ func TestAbortSession(t *testing.T) {
 	}
 }
 
+func TestRespondPermission(t *testing.T) {
+	var gotResponse string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/session/test-session/permissions/perm_1" {
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		gotResponse = body["response"]
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("true"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 5)
+
+	if err := client.RespondPermission(context.Background(), "test-session", "perm_1", PermissionResponseAlways); err != nil {
+		t.Fatalf("Failed to respond to permission: %v", err)
+	}
+	if gotResponse != PermissionResponseAlways {
+		t.Errorf("Expected response %q, got %q", PermissionResponseAlways, gotResponse)
+	}
+
+	if err := client.RespondPermission(context.Background(), "test-session", "perm_1", "maybe"); err == nil {
+		t.Error("Expected error for invalid permission response")
+	}
+}
+
+func TestParsePermissionRequest(t *testing.T) {
+	tests := []struct {
+		name         string
+		event        SessionEvent
+		wantType     string
+		wantPatterns []string
+		wantCallID   string
+	}{
+		{
+			name: "permission.updated with string pattern",
+			event: SessionEvent{
+				Type:       "permission.updated",
+				Properties: json.RawMessage(`{"id":"perm_1","sessionID":"ses_1","type":"bash","title":"rm -rf build","pattern":"rm *","metadata":{"command":"rm -rf build"},"callID":"call_1"}`),
+			},
+			wantType:     "bash",
+			wantPatterns: []string{"rm *"},
+			wantCallID:   "call_1",
+		},
+		{
+			name: "permission.updated with pattern list",
+			event: SessionEvent{
+				Type:       "permission.updated",
+				Properties: json.RawMessage(`{"id":"perm_2","sessionID":"ses_1","type":"edit","pattern":["a.go","b.go"]}`),
+			},
+			wantType:     "edit",
+			wantPatterns: []string{"a.go", "b.go"},
+		},
+		{
+			name: "permission.asked",
+			event: SessionEvent{
+				Type:       "permission.asked",
+				Properties: json.RawMessage(`{"id":"per_3","sessionID":"ses_1","permission":"webfetch","patterns":["https://example.com"],"tool":{"messageID":"msg_1","callID":"call_3"}}`),
+			},
+			wantType:     "webfetch",
+			wantPatterns: []string{"https://example.com"},
+			wantCallID:   "call_3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := ParsePermissionRequest(tt.event)
+			if err != nil {
+				t.Fatalf("ParsePermissionRequest returned error: %v", err)
+			}
+			if req.Type != tt.wantType {
+				t.Errorf("Expected type %q, got %q", tt.wantType, req.Type)
+			}
+			if strings.Join(req.Patterns, ",") != strings.Join(tt.wantPatterns, ",") {
+				t.Errorf("Expected patterns %v, got %v", tt.wantPatterns, req.Patterns)
+			}
+			if req.CallID != tt.wantCallID {
+				t.Errorf("Expected callID %q, got %q", tt.wantCallID, req.CallID)
+			}
+		})
+	}
+
+	if _, err := ParsePermissionRequest(SessionEvent{Type: "permission.updated", Properties: json.RawMessage(`{"sessionID":"ses_1"}`)}); err == nil {
+		t.Error("Expected error for permission event without id")
+	}
+}
+
+func TestReadFileAndListFiles(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("directory"); got != "/srv/project" {
+			t.Errorf("Unexpected directory query: %q", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/file/content":
+			if got := r.URL.Query().Get("path"); got != "bin/logo.png" {
+				t.Errorf("Unexpected path query: %q", got)
+			}
+			w.Write([]byte(`{"type":"binary","content":"iVBORw==","encoding":"base64","mimeType":"image/png"}`))
+		case "/file":
+			w.Write([]byte(`[{"name":"main.go","path":"cmd/main.go","type":"file"},{"name":"internal","path":"cmd/internal","type":"directory"}]`))
+		default:
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 5)
+
+	content, err := client.ReadFile(context.Background(), "/srv/project", "bin/logo.png")
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	data, err := content.Bytes()
+	if err != nil {
+		t.Fatalf("Failed to decode file: %v", err)
+	}
+	if !content.IsBinary() || string(data) != "\x89PNG" {
+		t.Errorf("Unexpected file content: %+v (%q)", content, data)
+	}
+
+	nodes, err := client.ListFiles(context.Background(), "/srv/project", "cmd")
+	if err != nil {
+		t.Fatalf("Failed to list files: %v", err)
+	}
+	if len(nodes) != 2 || nodes[1].Type != "directory" {
+		t.Errorf("Unexpected file nodes: %+v", nodes)
+	}
+}
+
+func TestFindFilesAndText(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/find/file":
+			if r.URL.Query().Get("query") != ".go" || r.URL.Query().Get("dirs") != "false" || r.URL.Query().Get("limit") != "50" {
+				t.Errorf("Unexpected find/file query: %s", r.URL.RawQuery)
+			}
+			w.Write([]byte(`["cmd/bot/main.go","internal/config/config.go"]`))
+		case "/find":
+			if r.URL.Query().Get("pattern") != "func main" {
+				t.Errorf("Unexpected find query: %s", r.URL.RawQuery)
+			}
+			w.Write([]byte(`[{"path":{"text":"cmd/bot/main.go"},"lines":{"text":"func main() {\n"},"line_number":12,"absolute_offset":200,"submatches":[]}]`))
+		default:
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 5)
+
+	paths, err := client.FindFiles(context.Background(), "", ".go", false, 50)
+	if err != nil {
+		t.Fatalf("Failed to find files: %v", err)
+	}
+	if len(paths) != 2 {
+		t.Errorf("Expected 2 paths, got %v", paths)
+	}
+
+	matches, err := client.FindText(context.Background(), "", "func main")
+	if err != nil {
+		t.Fatalf("Failed to find text: %v", err)
+	}
+	if len(matches) != 1 || matches[0].Path.Text != "cmd/bot/main.go" || matches[0].LineNumber != 12 {
+		t.Errorf("Unexpected matches: %+v", matches)
+	}
+}
+
 func TestErrorResponse(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		errorResp := ErrorResponse{
@@ -640,3 +884,196 @@ func TestStreamSessionEvents(t *testing.T) {
 		t.Fatalf("unexpected second event type: %q", events[1].Type)
 	}
 }
+
+func TestRunShell(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/session/ses_1/shell" {
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var req ShellRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if req.Command != "git status" || req.Agent != "build" {
+			t.Errorf("unexpected shell request: %#v", req)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"info":{"id":"msg_1","sessionID":"ses_1","role":"assistant"},"parts":[{"id":"prt_0","type":"step-start"},{"id":"prt_1","type":"tool","tool":"bash","state":{"status":"completed","output":"clean"}}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 5)
+	result, err := client.RunShell(context.Background(), "ses_1", &ShellRequest{Agent: "build", Command: "git status"})
+	if err != nil {
+		t.Fatalf("RunShell failed: %v", err)
+	}
+	part, ok := result.ToolPart()
+	if !ok || part.ID != "prt_1" || part.Tool != "bash" {
+		t.Fatalf("expected bash tool part, got %#v, %v", part, ok)
+	}
+}
+
+func TestRevertAndUnrevertSession(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/session/ses_1/revert":
+			var body map[string]string
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body["messageID"] != "msg_2" {
+				t.Errorf("unexpected revert body: %v %v", body, err)
+			}
+			_, _ = w.Write([]byte(`{"id":"ses_1","revert":{"messageID":"msg_2","diff":"--- a/x"}}`))
+		case r.Method == "POST" && r.URL.Path == "/session/ses_1/unrevert":
+			_, _ = w.Write([]byte(`{"id":"ses_1"}`))
+		default:
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 5)
+	sess, err := client.RevertSession(context.Background(), "ses_1", "msg_2")
+	if err != nil {
+		t.Fatalf("RevertSession failed: %v", err)
+	}
+	if sess.Revert == nil || sess.Revert.MessageID != "msg_2" {
+		t.Fatalf("expected revert point msg_2, got %#v", sess.Revert)
+	}
+
+	sess, err = client.UnrevertSession(context.Background(), "ses_1")
+	if err != nil {
+		t.Fatalf("UnrevertSession failed: %v", err)
+	}
+	if sess.Revert != nil {
+		t.Fatalf("expected revert to be cleared, got %#v", sess.Revert)
+	}
+}
+
+func TestSummarizeSession(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/session/ses_1/summarize" {
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("failed to decode body: %v", err)
+		}
+		if body["providerID"] != "anthropic" || body["modelID"] != "claude" {
+			t.Errorf("unexpected summarize body: %v", body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`true`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 5)
+	if err := client.SummarizeSession(context.Background(), "ses_1", "anthropic", "claude"); err != nil {
+		t.Fatalf("SummarizeSession failed: %v", err)
+	}
+}
+
+func TestTokenUsageAndContextLimit(t *testing.T) {
+	var info MessageInfo
+	if err := json.Unmarshal([]byte(`{"id":"msg_1","role":"assistant","summary":true,"tokens":{"input":100,"output":20,"reasoning":5,"cache":{"read":1000,"write":10}}}`), &info); err != nil {
+		t.Fatalf("failed to decode message info: %v", err)
+	}
+	messages := convertMessageResponses([]MessageResponse{{Info: info}})
+	if !messages[0].Summary {
+		t.Fatalf("expected summary flag to be set")
+	}
+	if got := messages[0].Tokens.Context(); got != 1135 {
+		t.Fatalf("expected 1135 context tokens, got %d", got)
+	}
+	if _, ok := ParseTokenUsage(nil); ok {
+		t.Fatalf("nil tokens should not parse")
+	}
+
+	var model Model
+	if err := json.Unmarshal([]byte(`{"id":"claude","limit":{"context":200000,"output":8192}}`), &model); err != nil {
+		t.Fatalf("failed to decode model: %v", err)
+	}
+	if got := model.ContextLimit(); got != 200000 {
+		t.Fatalf("expected context limit 200000, got %d", got)
+	}
+	if got := (Model{}).ContextLimit(); got != 0 {
+		t.Fatalf("expected unknown limit to be 0, got %d", got)
+	}
+}
+
+func TestForkSession(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/session/ses_1/fork" {
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("failed to decode body: %v", err)
+		}
+		if body["messageID"] != "msg_3" {
+			t.Errorf("unexpected fork body: %v", body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"ses_2","title":"Fork"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 5)
+	sess, err := client.ForkSession(context.Background(), "ses_1", "msg_3")
+	if err != nil {
+		t.Fatalf("ForkSession failed: %v", err)
+	}
+	if sess.ID != "ses_2" {
+		t.Fatalf("expected fork ses_2, got %s", sess.ID)
+	}
+}
+
+func TestGetTodos(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != "/session/ses_1/todo" {
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"id":"1","content":"Write tests","status":"in_progress","priority":"high"}]`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 5)
+	todos, err := client.GetTodos(context.Background(), "ses_1")
+	if err != nil {
+		t.Fatalf("GetTodos failed: %v", err)
+	}
+	if len(todos) != 1 || todos[0].Status != "in_progress" || todos[0].Priority != "high" {
+		t.Fatalf("unexpected todos: %#v", todos)
+	}
+}
+
+func TestGetSessionDiff(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != "/session/ses_1/diff" {
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"file":"main.go","before":"a\n","after":"b\n","additions":1,"deletions":1}]`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, 5)
+	diffs, err := client.GetSessionDiff(context.Background(), "ses_1")
+	if err != nil {
+		t.Fatalf("GetSessionDiff failed: %v", err)
+	}
+	if len(diffs) != 1 || diffs[0].File != "main.go" || diffs[0].After != "b\n" || diffs[0].Additions != 1 {
+		t.Fatalf("unexpected diffs: %#v", diffs)
+	}
+}
@@ -0,0 +1,82 @@
+package opencode
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Command is a custom slash command defined in the OpenCode configuration.
+type Command struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Agent       string `json:"agent,omitempty"`
+	Model       string `json:"model,omitempty"`
+	Template    string `json:"template,omitempty"`
+	Subtask     bool   `json:"subtask,omitempty"`
+}
+
+// CommandRequest runs a custom command in a session.
+type CommandRequest struct {
+	MessageID string `json:"messageID,omitempty"`
+	Agent     string `json:"agent,omitempty"`
+	Model     string `json:"model,omitempty"` // "providerID/modelID"
+	Command   string `json:"command"`
+	Arguments string `json:"arguments"`
+}
+
+// RunCommand executes a custom command in a session. OpenCode answers only once
+// the command has finished, so the call is bounded by ctx rather than the client
+// timeout; progress is observed through the event stream.
+func (c *Client) RunCommand(ctx context.Context, sessionID string, req *CommandRequest) error {
+	resp, err := c.longRequest(ctx, "POST", fmt.Sprintf("/session/%s/command", sessionID), req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("command /%s failed with status %d: %s", req.Command, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// longRequest is like request but without the client timeout, for endpoints
+// that only respond once the work they start is done.
+func (c *Client) longRequest(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	if c.shouldLogRequests() {
+		log.Infof("OpenCode API request: method=%s path=%s", method, path)
+	}
+	startTime := time.Now()
+	resp, err := (&http.Client{Transport: c.client.Transport}).Do(req)
+	elapsed := time.Since(startTime)
+	if err != nil {
+		log.Warnf("OpenCode API request failed: method=%s path=%s elapsed=%v err=%v", method, path, elapsed, err)
+		return nil, err
+	}
+	if c.shouldLogRequests() {
+		log.Infof("OpenCode API response: method=%s path=%s status=%d elapsed=%v", method, path, resp.StatusCode, elapsed)
+	}
+	return resp, nil
+}
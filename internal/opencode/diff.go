@@ -0,0 +1,29 @@
+package opencode
+
+import (
+	"context"
+	"fmt"
+)
+
+// FileDiff is the change a session made to one file.
+type FileDiff struct {
+	File      string `json:"file"`
+	Before    string `json:"before"`
+	After     string `json:"after"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+}
+
+// GetSessionDiff gets the file changes made in a session.
+func (c *Client) GetSessionDiff(ctx context.Context, sessionID string) ([]FileDiff, error) {
+	resp, err := c.request(ctx, "GET", fmt.Sprintf("/session/%s/diff", sessionID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []FileDiff
+	if err := decodeResponse(resp, &diffs); err != nil {
+		return nil, fmt.Errorf("failed to get session diff: %w", err)
+	}
+	return diffs, nil
+}
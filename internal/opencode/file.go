@@ -0,0 +1,132 @@
+package opencode
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// FileNode is an entry returned by the file listing endpoint.
+type FileNode struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	Absolute string `json:"absolute"`
+	Type     string `json:"type"` // "file" or "directory"
+	Ignored  bool   `json:"ignored"`
+}
+
+// FileContent is a file read from the project tree.
+type FileContent struct {
+	Type     string `json:"type"` // "text" or "binary"
+	Content  string `json:"content"`
+	Encoding string `json:"encoding,omitempty"` // "base64" for binary content
+	MimeType string `json:"mimeType,omitempty"`
+}
+
+// Bytes returns the decoded file content.
+func (f *FileContent) Bytes() ([]byte, error) {
+	if f.Encoding == "base64" {
+		return base64.StdEncoding.DecodeString(f.Content)
+	}
+	return []byte(f.Content), nil
+}
+
+// IsBinary reports whether OpenCode returned the content as binary data.
+func (f *FileContent) IsBinary() bool {
+	return f.Type == "binary" || f.Encoding == "base64"
+}
+
+func fileQuery(directory, path string) string {
+	query := url.Values{}
+	query.Set("path", path)
+	if directory != "" {
+		query.Set("directory", directory)
+	}
+	return query.Encode()
+}
+
+// ReadFile reads path, relative to the project directory, from the OpenCode workspace.
+func (c *Client) ReadFile(ctx context.Context, directory, path string) (*FileContent, error) {
+	resp, err := c.request(ctx, "GET", "/file/content?"+fileQuery(directory, path), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var content FileContent
+	if err := decodeResponse(resp, &content); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return &content, nil
+}
+
+// ListFiles lists the entries of the directory at path, relative to the project directory.
+func (c *Client) ListFiles(ctx context.Context, directory, path string) ([]FileNode, error) {
+	resp, err := c.request(ctx, "GET", "/file?"+fileQuery(directory, path), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []FileNode
+	if err := decodeResponse(resp, &nodes); err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", path, err)
+	}
+	return nodes, nil
+}
+
+// TextMatch is a single line matched by the text search endpoint.
+type TextMatch struct {
+	Path struct {
+		Text string `json:"text"`
+	} `json:"path"`
+	Lines struct {
+		Text string `json:"text"`
+	} `json:"lines"`
+	LineNumber int `json:"line_number"`
+}
+
+// FindFiles searches file names in the project matching query. Directories are
+// included when includeDirs is set; limit caps the result count when positive.
+func (c *Client) FindFiles(ctx context.Context, directory, query string, includeDirs bool, limit int) ([]string, error) {
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("dirs", strconv.FormatBool(includeDirs))
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+	if directory != "" {
+		params.Set("directory", directory)
+	}
+
+	resp, err := c.request(ctx, "GET", "/find/file?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	if err := decodeResponse(resp, &paths); err != nil {
+		return nil, fmt.Errorf("failed to find files: %w", err)
+	}
+	return paths, nil
+}
+
+// FindText searches file contents in the project for pattern.
+func (c *Client) FindText(ctx context.Context, directory, pattern string) ([]TextMatch, error) {
+	params := url.Values{}
+	params.Set("pattern", pattern)
+	if directory != "" {
+		params.Set("directory", directory)
+	}
+
+	resp, err := c.request(ctx, "GET", "/find?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []TextMatch
+	if err := decodeResponse(resp, &matches); err != nil {
+		return nil, fmt.Errorf("failed to search text: %w", err)
+	}
+	return matches, nil
+}
@@ -0,0 +1,25 @@
+package opencode
+
+import (
+	"context"
+	"fmt"
+)
+
+// ForkSession creates a new session holding the history of sessionID up to,
+// but not including, messageID. An empty messageID copies the whole session.
+func (c *Client) ForkSession(ctx context.Context, sessionID, messageID string) (*Session, error) {
+	body := map[string]string{}
+	if messageID != "" {
+		body["messageID"] = messageID
+	}
+	resp, err := c.request(ctx, "POST", fmt.Sprintf("/session/%s/fork", sessionID), body)
+	if err != nil {
+		return nil, err
+	}
+
+	var session Session
+	if err := decodeResponse(resp, &session); err != nil {
+		return nil, fmt.Errorf("failed to fork session: %w", err)
+	}
+	return &session, nil
+}
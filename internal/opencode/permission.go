@@ -0,0 +1,130 @@
+package opencode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Permission responses accepted by OpenCode.
+const (
+	PermissionResponseOnce   = "once"
+	PermissionResponseAlways = "always"
+	PermissionResponseReject = "reject"
+)
+
+// PermissionRequest is a tool call waiting for user approval.
+// It normalizes both the permission.updated and permission.asked event shapes.
+type PermissionRequest struct {
+	ID        string
+	SessionID string
+	Type      string // permission kind, e.g. "bash", "edit", "webfetch"
+	Title     string
+	Patterns  []string
+	Metadata  map[string]interface{}
+	MessageID string
+	CallID    string
+}
+
+// PermissionRepliedProperties represents properties for permission.replied events.
+type PermissionRepliedProperties struct {
+	SessionID    string `json:"sessionID"`
+	PermissionID string `json:"permissionID,omitempty"`
+	RequestID    string `json:"requestID,omitempty"`
+	Response     string `json:"response,omitempty"`
+	Reply        string `json:"reply,omitempty"`
+}
+
+// IsPermissionRequestEvent reports whether eventType asks the user for a permission.
+func IsPermissionRequestEvent(eventType string) bool {
+	return eventType == "permission.updated" || eventType == "permission.asked"
+}
+
+// ParsePermissionRequest decodes a permission.updated or permission.asked event.
+func ParsePermissionRequest(event SessionEvent) (*PermissionRequest, error) {
+	if !IsPermissionRequestEvent(event.Type) {
+		return nil, fmt.Errorf("not a permission request event: %s", event.Type)
+	}
+
+	var payload struct {
+		ID         string                 `json:"id"`
+		SessionID  string                 `json:"sessionID"`
+		Type       string                 `json:"type"`
+		Permission string                 `json:"permission"`
+		Title      string                 `json:"title"`
+		Pattern    json.RawMessage        `json:"pattern"`
+		Patterns   []string               `json:"patterns"`
+		Metadata   map[string]interface{} `json:"metadata"`
+		MessageID  string                 `json:"messageID"`
+		CallID     string                 `json:"callID"`
+		Tool       struct {
+			MessageID string `json:"messageID"`
+			CallID    string `json:"callID"`
+		} `json:"tool"`
+	}
+	if err := json.Unmarshal(event.Properties, &payload); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", event.Type, err)
+	}
+	if strings.TrimSpace(payload.ID) == "" || strings.TrimSpace(payload.SessionID) == "" {
+		return nil, fmt.Errorf("%s is missing id or sessionID", event.Type)
+	}
+
+	req := &PermissionRequest{
+		ID:        payload.ID,
+		SessionID: payload.SessionID,
+		Type:      payload.Type,
+		Title:     payload.Title,
+		Patterns:  payload.Patterns,
+		Metadata:  payload.Metadata,
+		MessageID: payload.MessageID,
+		CallID:    payload.CallID,
+	}
+	if req.Type == "" {
+		req.Type = payload.Permission
+	}
+	if req.MessageID == "" {
+		req.MessageID = payload.Tool.MessageID
+	}
+	if req.CallID == "" {
+		req.CallID = payload.Tool.CallID
+	}
+
+	// permission.updated carries pattern as either a string or a list.
+	if len(req.Patterns) == 0 && len(payload.Pattern) > 0 {
+		var single string
+		if err := json.Unmarshal(payload.Pattern, &single); err == nil && single != "" {
+			req.Patterns = []string{single}
+		} else {
+			var many []string
+			if err := json.Unmarshal(payload.Pattern, &many); err == nil {
+				req.Patterns = many
+			}
+		}
+	}
+	return req, nil
+}
+
+// RespondPermission answers a pending permission request with once, always or reject.
+func (c *Client) RespondPermission(ctx context.Context, sessionID, permissionID, response string) error {
+	switch response {
+	case PermissionResponseOnce, PermissionResponseAlways, PermissionResponseReject:
+	default:
+		return fmt.Errorf("invalid permission response: %q", response)
+	}
+
+	body := map[string]string{"response": response}
+	resp, err := c.request(ctx, "POST", fmt.Sprintf("/session/%s/permissions/%s", sessionID, permissionID), body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("permission response failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
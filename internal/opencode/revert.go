@@ -0,0 +1,44 @@
+package opencode
+
+import (
+	"context"
+	"fmt"
+)
+
+// SessionRevert marks the point a session has been reverted to. Messages from
+// MessageID on are hidden until the session is unreverted or a new prompt is sent.
+type SessionRevert struct {
+	MessageID string `json:"messageID"`
+	PartID    string `json:"partID,omitempty"`
+	Snapshot  string `json:"snapshot,omitempty"`
+	Diff      string `json:"diff,omitempty"`
+}
+
+// RevertSession reverts the session, including file changes, to before messageID.
+func (c *Client) RevertSession(ctx context.Context, sessionID, messageID string) (*Session, error) {
+	body := map[string]string{"messageID": messageID}
+	resp, err := c.request(ctx, "POST", fmt.Sprintf("/session/%s/revert", sessionID), body)
+	if err != nil {
+		return nil, err
+	}
+
+	var session Session
+	if err := decodeResponse(resp, &session); err != nil {
+		return nil, fmt.Errorf("failed to revert session: %w", err)
+	}
+	return &session, nil
+}
+
+// UnrevertSession restores the messages and file changes hidden by the last revert.
+func (c *Client) UnrevertSession(ctx context.Context, sessionID string) (*Session, error) {
+	resp, err := c.request(ctx, "POST", fmt.Sprintf("/session/%s/unrevert", sessionID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var session Session
+	if err := decodeResponse(resp, &session); err != nil {
+		return nil, fmt.Errorf("failed to unrevert session: %w", err)
+	}
+	return &session, nil
+}
@@ -0,0 +1,39 @@
+package opencode
+
+import (
+	"context"
+	"fmt"
+)
+
+// ShellRequest runs a shell command in a session's project directory.
+type ShellRequest struct {
+	Agent   string        `json:"agent"`
+	Model   *MessageModel `json:"model,omitempty"`
+	Command string        `json:"command"`
+}
+
+// RunShell runs a shell command directly, without the model, and returns the
+// assistant message holding its tool part. Like RunCommand it blocks until the
+// command exits, bounded only by ctx.
+func (c *Client) RunShell(ctx context.Context, sessionID string, req *ShellRequest) (*MessageResponse, error) {
+	resp, err := c.longRequest(ctx, "POST", fmt.Sprintf("/session/%s/shell", sessionID), req)
+	if err != nil {
+		return nil, err
+	}
+
+	var result MessageResponse
+	if err := decodeResponse(resp, &result); err != nil {
+		return nil, fmt.Errorf("shell command failed: %w", err)
+	}
+	return &result, nil
+}
+
+// ToolPart returns the first tool part of the message, if any.
+func (m *MessageResponse) ToolPart() (MessagePartResponse, bool) {
+	for _, part := range m.Parts {
+		if part.Type == "tool" {
+			return part, true
+		}
+	}
+	return MessagePartResponse{}, false
+}
@@ -0,0 +1,68 @@
+package opencode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// TokenUsage is the token accounting OpenCode reports for an assistant message.
+type TokenUsage struct {
+	Input     int `json:"input"`
+	Output    int `json:"output"`
+	Reasoning int `json:"reasoning"`
+	Cache     struct {
+		Read  int `json:"read"`
+		Write int `json:"write"`
+	} `json:"cache"`
+}
+
+// Context is the number of tokens the message occupied in the model's context window.
+func (t TokenUsage) Context() int {
+	return t.Input + t.Output + t.Reasoning + t.Cache.Read + t.Cache.Write
+}
+
+// ParseTokenUsage decodes the loosely typed tokens field of a message.
+func ParseTokenUsage(v interface{}) (TokenUsage, bool) {
+	var usage TokenUsage
+	if v == nil {
+		return usage, false
+	}
+	data, err := json.Marshal(v)
+	if err != nil || json.Unmarshal(data, &usage) != nil {
+		return TokenUsage{}, false
+	}
+	return usage, usage.Context() > 0
+}
+
+// ContextLimit returns the model's context window in tokens, or 0 when unknown.
+func (m Model) ContextLimit() int {
+	var limit struct {
+		Context int `json:"context"`
+	}
+	data, err := json.Marshal(m.Limit)
+	if err != nil || json.Unmarshal(data, &limit) != nil {
+		return 0
+	}
+	return limit.Context
+}
+
+// SummarizeSession compacts the session history into a summary written by the
+// given model. Like RunCommand it only answers once the summary is complete.
+func (c *Client) SummarizeSession(ctx context.Context, sessionID, providerID, modelID string) error {
+	body := map[string]string{"providerID": providerID, "modelID": modelID}
+	resp, err := c.longRequest(ctx, "POST", fmt.Sprintf("/session/%s/summarize", sessionID), body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		data, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("summarize failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,34 @@
+package opencode
+
+import (
+	"context"
+	"fmt"
+)
+
+// Todo is an item of the task list an agent keeps with the todowrite tool.
+type Todo struct {
+	ID       string `json:"id"`
+	Content  string `json:"content"`
+	Status   string `json:"status"`   // pending | in_progress | completed | cancelled
+	Priority string `json:"priority"` // high | medium | low
+}
+
+// TodoUpdatedProperties represents properties for todo.updated events.
+type TodoUpdatedProperties struct {
+	SessionID string `json:"sessionID"`
+	Todos     []Todo `json:"todos"`
+}
+
+// GetTodos gets the current todo list of a session.
+func (c *Client) GetTodos(ctx context.Context, sessionID string) ([]Todo, error) {
+	resp, err := c.request(ctx, "GET", fmt.Sprintf("/session/%s/todo", sessionID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var todos []Todo
+	if err := decodeResponse(resp, &todos); err != nil {
+		return nil, fmt.Errorf("failed to get todos: %w", err)
+	}
+	return todos, nil
+}
@@ -0,0 +1,58 @@
+package render
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// TestGoldenBackends renders every testdata/golden/*.md input with both the
+// HTML and the MarkdownV2 backend and compares against the stored outputs.
+// Run with -update to regenerate them after an intended change.
+func TestGoldenBackends(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "golden", "*.md"))
+	if err != nil {
+		t.Fatalf("failed to list golden inputs: %v", err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no golden inputs found")
+	}
+
+	backends := []struct {
+		ext     string
+		convert func(string) string
+	}{
+		{".html", MarkdownToTelegramHTML},
+		{".mdv2", MarkdownToTelegramMarkdownV2},
+	}
+
+	for _, input := range inputs {
+		source, err := os.ReadFile(input)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", input, err)
+		}
+		for _, backend := range backends {
+			goldenPath := strings.TrimSuffix(input, ".md") + backend.ext
+			t.Run(filepath.Base(goldenPath), func(t *testing.T) {
+				got := backend.convert(string(source))
+				if *updateGolden {
+					if err := os.WriteFile(goldenPath, []byte(got), 0644); err != nil {
+						t.Fatalf("failed to update %s: %v", goldenPath, err)
+					}
+					return
+				}
+				want, err := os.ReadFile(goldenPath)
+				if err != nil {
+					t.Fatalf("failed to read %s (run with -update to create it): %v", goldenPath, err)
+				}
+				if got != string(want) {
+					t.Errorf("output differs from %s:\ngot:\n%s\nwant:\n%s", goldenPath, got, want)
+				}
+			})
+		}
+	}
+}
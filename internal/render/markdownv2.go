@@ -0,0 +1,147 @@
+package render
+
+import (
+	"strings"
+)
+
+// markdownV2Reserved are the characters Telegram MarkdownV2 requires to be
+// escaped outside of entities.
+const markdownV2Reserved = "_*[]()~`>#+-=|{}.!\\"
+
+// Formatting markers stand in for MarkdownV2 entity delimiters until the rest
+// of the line has been escaped.
+const (
+	markdownV2BoldMarker   = "\uE000"
+	markdownV2ItalicMarker = "\uE001"
+	markdownV2StrikeMarker = "\uE002"
+)
+
+var markdownV2Backend = markdownBackend{
+	escape:      escapeMarkdownV2,
+	line:        renderMarkdownV2Line,
+	fence:       renderMarkdownV2Fence,
+	quote:       renderMarkdownV2Blockquote,
+	quotedFence: renderMarkdownV2QuotedFence,
+	table:       renderTableMarkdownV2,
+}
+
+// MarkdownToTelegramMarkdownV2 converts the markdown subset understood by
+// MarkdownToTelegramHTML to Telegram MarkdownV2.
+func MarkdownToTelegramMarkdownV2(input string) string {
+	return convertMarkdown(input, markdownV2Backend)
+}
+
+func escapeMarkdownV2(text string) string {
+	return escapeWithBackslash(text, markdownV2Reserved)
+}
+
+// escapeMarkdownV2Code escapes the contents of code and pre entities.
+func escapeMarkdownV2Code(text string) string {
+	return escapeWithBackslash(text, "`\\")
+}
+
+// escapeMarkdownV2URL escapes the URL part of an inline link.
+func escapeMarkdownV2URL(url string) string {
+	return escapeWithBackslash(url, ")\\")
+}
+
+func escapeWithBackslash(text, reserved string) string {
+	var sb strings.Builder
+	sb.Grow(len(text))
+	for _, r := range text {
+		if r < 128 && strings.ContainsRune(reserved, r) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+func renderMarkdownV2Line(line string) string {
+	if matches := headingRe.FindStringSubmatch(line); matches != nil {
+		// The heading is bold already; bold markers inside it would end it early.
+		title := boldStarRe.ReplaceAllString(matches[2], "${1}")
+		title = boldUndRe.ReplaceAllString(title, "${1}")
+		return "*" + renderInlineMarkdownV2(title) + "*"
+	}
+	if isHorizontalRule(strings.TrimSpace(line)) {
+		return "───────────────"
+	}
+	if stripped, hadQuote := stripQuotePrefix(line); hadQuote {
+		return renderMarkdownV2Blockquote([]string{stripped})
+	}
+	return renderInlineMarkdownV2(line)
+}
+
+func renderInlineMarkdownV2(line string) string {
+	if line == "" {
+		return ""
+	}
+
+	spans := scanInlineSpans(line,
+		func(label, url string) string {
+			return "[" + escapeMarkdownV2(label) + "](" + escapeMarkdownV2URL(url) + ")"
+		},
+		func(code string) string {
+			return "`" + escapeMarkdownV2Code(code) + "`"
+		})
+	processed := replaceSpansWithPlaceholders(line, spans)
+
+	// Mark entities on the raw text, escape it, then turn markers into delimiters.
+	processed = boldItalicRe.ReplaceAllString(processed, markdownV2BoldMarker+markdownV2ItalicMarker+"${1}"+markdownV2ItalicMarker+markdownV2BoldMarker)
+	processed = boldStarRe.ReplaceAllString(processed, markdownV2BoldMarker+"${1}"+markdownV2BoldMarker)
+	processed = boldUndRe.ReplaceAllString(processed, markdownV2BoldMarker+"${1}"+markdownV2BoldMarker)
+	processed = strikeRe.ReplaceAllString(processed, markdownV2StrikeMarker+"${1}"+markdownV2StrikeMarker)
+	processed = italicStarRe.ReplaceAllString(processed, markdownV2ItalicMarker+"${1}"+markdownV2ItalicMarker)
+	processed = italicUndRe.ReplaceAllString(processed, markdownV2ItalicMarker+"${1}"+markdownV2ItalicMarker)
+
+	escaped := strings.NewReplacer(
+		markdownV2BoldMarker, "*",
+		markdownV2ItalicMarker, "_",
+		markdownV2StrikeMarker, "~",
+	).Replace(escapeMarkdownV2(processed))
+	return restoreSpans(escaped, spans)
+}
+
+func renderMarkdownV2Fence(lines []string) string {
+	return "```\n" + escapeMarkdownV2Code(strings.Join(lines, "\n")) + "\n```"
+}
+
+// renderMarkdownV2Blockquote renders lines as an expandable blockquote: the
+// first line starts with **> and the last one ends with ||.
+func renderMarkdownV2Blockquote(lines []string) string {
+	rendered := make([]string, len(lines))
+	for i, line := range lines {
+		rendered[i] = renderInlineMarkdownV2(line)
+	}
+	return expandableMarkdownV2Quote(rendered)
+}
+
+// renderMarkdownV2QuotedFence keeps quoted code monospace line by line, since
+// MarkdownV2 blockquotes cannot hold a pre block.
+func renderMarkdownV2QuotedFence(lines []string) string {
+	rendered := make([]string, len(lines))
+	for i, line := range lines {
+		if line != "" {
+			rendered[i] = "`" + escapeMarkdownV2Code(line) + "`"
+		}
+	}
+	return expandableMarkdownV2Quote(rendered)
+}
+
+func expandableMarkdownV2Quote(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	for i, line := range lines {
+		if i == 0 {
+			sb.WriteString("**>")
+		} else {
+			sb.WriteString("\n>")
+		}
+		sb.WriteString(line)
+	}
+	sb.WriteString("||")
+	return sb.String()
+}
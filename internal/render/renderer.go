@@ -9,15 +9,28 @@ import (
 	"time"
 )
 
+// Render modes.
 const (
+	// ModePlain sends text as-is without a parse mode.
+	ModePlain = "plain"
+	// ModeMarkdownFinal streams plain text and converts to HTML on the final edit.
+	ModeMarkdownFinal = "markdown_final"
+	// ModeMarkdownStream converts to HTML on every edit.
 	ModeMarkdownStream = "markdown_stream"
+	// ModeMarkdownV2 converts to Telegram MarkdownV2 on every edit.
+	ModeMarkdownV2 = "markdownv2"
 )
 
+// Modes lists the supported render modes.
+var Modes = []string{ModePlain, ModeMarkdownFinal, ModeMarkdownStream, ModeMarkdownV2}
+
 // Result describes how a message should be sent to Telegram.
+// When Telegram rejects Text, FallbackText is sent without a parse mode.
 type Result struct {
-	Text         string
-	FallbackText string
-	UseHTML      bool
+	Text          string
+	FallbackText  string
+	UseHTML       bool
+	UseMarkdownV2 bool
 }
 
 // Renderer formats OpenCode output for Telegram.
@@ -40,12 +53,25 @@ func New(mode string) *Renderer {
 	}
 }
 
+// NormalizeMode returns the canonical form of mode, defaulting to markdown_stream
+// for empty or unknown values.
 func NormalizeMode(mode string) string {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	if IsValidMode(mode) {
+		return mode
+	}
 	return ModeMarkdownStream
 }
 
+// IsValidMode reports whether mode names a supported render mode.
 func IsValidMode(mode string) bool {
-	return true // All modes are normalized to markdown_stream anyway
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	for _, m := range Modes {
+		if mode == m {
+			return true
+		}
+	}
+	return false
 }
 
 func (r *Renderer) Mode() string {
@@ -68,30 +94,53 @@ func (r *Renderer) ClearCache() {
 
 // Render converts markdown text to Telegram-safe HTML depending on mode.
 func (r *Renderer) Render(text string, streaming bool) Result {
+	return r.RenderMode(r.Mode(), text, streaming)
+}
+
+// RenderMode renders text like Render but with the given mode instead of the
+// renderer's own, e.g. for a per-chat override.
+func (r *Renderer) RenderMode(mode, text string, streaming bool) Result {
 	result := Result{
 		Text:         text,
 		FallbackText: text,
 		UseHTML:      false,
 	}
 
+	switch NormalizeMode(mode) {
+	case ModePlain:
+		return result
+	case ModeMarkdownFinal:
+		if streaming {
+			return result
+		}
+	}
+
+	convert := MarkdownToTelegramHTML
+	cacheKey := text
+	if NormalizeMode(mode) == ModeMarkdownV2 {
+		convert = MarkdownToTelegramMarkdownV2
+		cacheKey = ModeMarkdownV2 + "\x00" + text
+		result.UseMarkdownV2 = true
+	} else {
+		result.UseHTML = true
+	}
+
 	// Check cache first for non-streaming or completed streaming
 	if !streaming {
-		if cached := r.getFromCache(text); cached != "" {
+		if cached := r.getFromCache(cacheKey); cached != "" {
 			result.Text = cached
-			result.UseHTML = true
 			return result
 		}
 
 	}
 
 	// Render and cache
-	rendered := MarkdownToTelegramHTML(text)
+	rendered := convert(text)
 	result.Text = rendered
-	result.UseHTML = true
 
 	// Cache non-streaming results
 	if !streaming {
-		r.addToCache(text, rendered)
+		r.addToCache(cacheKey, rendered)
 	}
 
 	return result
@@ -163,9 +212,52 @@ var (
 	headingRe = regexp.MustCompile(`^(#{1,6})\s+(.+)$`)
 )
 
+// markdownBackend renders the pieces the markdown converter splits its input
+// into for one Telegram parse mode.
+type markdownBackend struct {
+	escape      func(text string) string
+	line        func(line string) string
+	fence       func(lines []string) string
+	quote       func(lines []string) string
+	quotedFence func(lines []string) string
+	table       func(table markdownTable) string
+}
+
+var htmlBackend = markdownBackend{
+	escape:      html.EscapeString,
+	line:        renderMarkdownLine,
+	fence:       renderFenceBlock,
+	quote:       renderBlockquote,
+	quotedFence: renderQuotedFenceBlock,
+	table:       renderTableHTML,
+}
+
 // MarkdownToTelegramHTML converts a conservative markdown subset to Telegram HTML.
 // It intentionally avoids complex constructs that are fragile during streaming updates.
 func MarkdownToTelegramHTML(input string) string {
+	return convertMarkdown(input, htmlBackend)
+}
+
+// CodeFenceLength returns the length of the backtick run that opens a code
+// block on the trimmed line, or 0 if the line does not open one.
+func CodeFenceLength(trimmed string) int {
+	n := 0
+	for n < len(trimmed) && trimmed[n] == '`' {
+		n++
+	}
+	if n < 3 {
+		return 0
+	}
+	return n
+}
+
+// ClosesCodeFence reports whether the trimmed line closes a code block opened
+// with n backticks: it must be a bare backtick run at least n long.
+func ClosesCodeFence(trimmed string, n int) bool {
+	return len(trimmed) >= n && strings.Trim(trimmed, "`") == ""
+}
+
+func convertMarkdown(input string, backend markdownBackend) string {
 	if input == "" {
 		return ""
 	}
@@ -175,7 +267,7 @@ func MarkdownToTelegramHTML(input string) string {
 	if len(input) > maxInputSize {
 		// Return truncated version to avoid processing oversized input
 		truncated := input[:maxInputSize]
-		return html.EscapeString(truncated) + "... (truncated)"
+		return backend.escape(truncated + "... (truncated)")
 	}
 
 	input = strings.ReplaceAll(input, "\r\n", "\n")
@@ -183,6 +275,7 @@ func MarkdownToTelegramHTML(input string) string {
 	rendered := make([]string, 0, len(lines))
 	inFence := false
 	fenceHasQuote := false
+	fenceLen := 0
 	fenceStart := ""
 	fenceLines := make([]string, 0, 16)
 
@@ -190,61 +283,24 @@ func MarkdownToTelegramHTML(input string) string {
 	inBlockquote := false
 	blockquoteLines := make([]string, 0, 8)
 
-	for _, line := range lines {
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
 		// Check for quote prefix
 		strippedLine, hadQuote := stripQuotePrefix(line)
 		trimmed := strings.TrimSpace(strippedLine)
 
-		// Check if it's the start/end of a code block
-		// Note: single-line ```code``` should be treated as inline code, not code block
-		if strings.HasPrefix(trimmed, "```") {
-			// Count number of backticks
-			backtickCount := 0
-			for i := 0; i < len(trimmed) && trimmed[i] == '`'; i++ {
-				backtickCount++
-			}
-
-			// Check if it ends on the same line
-			if !inFence {
-				// Check if there are closing backticks on the same line
-				if strings.HasSuffix(trimmed, strings.Repeat("`", backtickCount)) && len(trimmed) > backtickCount*2 {
-					// Single-line code block, treat as inline
-					// Flush any pending blockquote first
-					if inBlockquote {
-						rendered = append(rendered, renderBlockquote(blockquoteLines))
-						inBlockquote = false
-						blockquoteLines = blockquoteLines[:0]
-					}
-					rendered = append(rendered, renderMarkdownLine(line))
-					continue
-				}
-
-				// Multi-line code block starts
-				// Flush any pending blockquote first
-				if inBlockquote {
-					rendered = append(rendered, renderBlockquote(blockquoteLines))
-					inBlockquote = false
-					blockquoteLines = blockquoteLines[:0]
-				}
-				inFence = true
-				fenceHasQuote = hadQuote
-				fenceStart = line
-				fenceLines = fenceLines[:0]
-
-			} else {
-				// Code block ends
+		if inFence {
+			// Only a bare backtick run at least as long as the opening one
+			// closes the block; anything else is part of it
+			if ClosesCodeFence(trimmed, fenceLen) {
 				inFence = false
 				if fenceHasQuote {
-					rendered = append(rendered, renderQuotedFenceBlock(fenceLines))
+					rendered = append(rendered, backend.quotedFence(fenceLines))
 				} else {
-					rendered = append(rendered, renderFenceBlock(fenceLines))
+					rendered = append(rendered, backend.fence(fenceLines))
 				}
-
+				continue
 			}
-			continue
-		}
-
-		if inFence {
 			// If fence has quote prefix, strip it from the line
 			if fenceHasQuote {
 				stripped, _ := stripQuotePrefix(line)
@@ -255,6 +311,45 @@ func MarkdownToTelegramHTML(input string) string {
 			continue
 		}
 
+		// Check if it's the start of a code block
+		// Note: single-line ```code``` should be treated as inline code, not code block
+		if backtickCount := CodeFenceLength(trimmed); backtickCount > 0 {
+			// Flush any pending blockquote first
+			if inBlockquote {
+				rendered = append(rendered, backend.quote(blockquoteLines))
+				inBlockquote = false
+				blockquoteLines = blockquoteLines[:0]
+			}
+
+			// Check if there are closing backticks on the same line
+			if strings.HasSuffix(trimmed, strings.Repeat("`", backtickCount)) && len(trimmed) > backtickCount*2 {
+				// Single-line code block, treat as inline
+				rendered = append(rendered, backend.line(line))
+				continue
+			}
+
+			// Multi-line code block starts
+			inFence = true
+			fenceLen = backtickCount
+			fenceHasQuote = hadQuote
+			fenceStart = line
+			fenceLines = fenceLines[:0]
+			continue
+		}
+
+		if !hadQuote {
+			if table, end, ok := parseTableBlock(lines, i); ok {
+				if inBlockquote {
+					rendered = append(rendered, backend.quote(blockquoteLines))
+					inBlockquote = false
+					blockquoteLines = blockquoteLines[:0]
+				}
+				rendered = append(rendered, backend.table(table))
+				i = end - 1
+				continue
+			}
+		}
+
 		// Check if this line is a blockquote (using hadQuote from stripQuotePrefix)
 		if hadQuote {
 			// This is a blockquote line (could be empty)
@@ -269,18 +364,18 @@ func MarkdownToTelegramHTML(input string) string {
 			// Not a blockquote line
 			if inBlockquote {
 				// Flush the accumulated blockquote
-				rendered = append(rendered, renderBlockquote(blockquoteLines))
+				rendered = append(rendered, backend.quote(blockquoteLines))
 				inBlockquote = false
 				blockquoteLines = blockquoteLines[:0]
 			}
 			// Render the non-blockquote line
-			rendered = append(rendered, renderMarkdownLine(line))
+			rendered = append(rendered, backend.line(line))
 		}
 	}
 
 	// Handle any trailing blockquote
 	if inBlockquote {
-		rendered = append(rendered, renderBlockquote(blockquoteLines))
+		rendered = append(rendered, backend.quote(blockquoteLines))
 	}
 
 	if inFence {
@@ -288,12 +383,12 @@ func MarkdownToTelegramHTML(input string) string {
 		// If fence has quote prefix, strip it from fenceStart
 		if fenceHasQuote {
 			strippedStart, _ := stripQuotePrefix(fenceStart)
-			rendered = append(rendered, html.EscapeString(strippedStart))
+			rendered = append(rendered, backend.escape(strippedStart))
 		} else {
-			rendered = append(rendered, html.EscapeString(fenceStart))
+			rendered = append(rendered, backend.escape(fenceStart))
 		}
 		for _, line := range fenceLines {
-			rendered = append(rendered, html.EscapeString(line))
+			rendered = append(rendered, backend.escape(line))
 		}
 	}
 
@@ -388,19 +483,23 @@ func applyInlineFormatting(text string) string {
 	return renderInline(escaped)
 }
 
-func renderInline(line string) string {
-	if line == "" {
-		return ""
-	}
+// Placeholders stand in for links and code spans while the rest of a line is
+// escaped and formatted. Private-use runes cannot clash with model output.
+const (
+	placeholderStart = "\uE010"
+	placeholderEnd   = "\uE011"
+)
 
-	// Step 1: Extract links and code blocks, replace with placeholders
-	type placeholder struct {
-		start, end    int
-		html          string
-		placeholderID string
-	}
-	var placeholders []placeholder
-	placeholderIndex := 0
+// inlineSpan is a link or code span cut out of a line before formatting.
+type inlineSpan struct {
+	start, end int
+	rendered   string
+}
+
+// scanInlineSpans finds http(s) links and code spans in line and renders them
+// with renderLink and renderCode.
+func scanInlineSpans(line string, renderLink func(label, url string) string, renderCode func(code string) string) []inlineSpan {
+	var spans []inlineSpan
 
 	// Scan the string to identify links and code blocks
 	i := 0
@@ -411,22 +510,11 @@ func renderInline(line string) string {
 			if ok {
 				// Security check: only allow http:// or https:// protocols
 				if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
-					// Handle parentheses in URL
-					url = balanceParentheses(url)
-					// Escape label and url
-					escapedLabel := html.EscapeString(label)
-					escapedUrl := html.EscapeString(url)
-					// Generate link HTML
-					linkHTML := fmt.Sprintf(`<a href="%s">%s</a>`, escapedUrl, escapedLabel)
-					// Create placeholder
-					placeholderID := fmt.Sprintf("{{LINK%d}}", placeholderIndex)
-					placeholderIndex++
-					// Record the placeholder
-					placeholders = append(placeholders, placeholder{
-						start:         i,
-						end:           i + len(label) + len(url) + 4, // []() four characters
-						html:          linkHTML,
-						placeholderID: placeholderID,
+					spans = append(spans, inlineSpan{
+						start: i,
+						end:   i + len(label) + len(url) + 4, // []() four characters
+						// Handle parentheses in URL
+						rendered: renderLink(label, balanceParentheses(url)),
 					})
 					// Skip the link
 					i += len(label) + len(url) + 4
@@ -466,21 +554,10 @@ func renderInline(line string) string {
 			}
 
 			if end != -1 {
-				// Extract code content
-				code := line[i+backtickCount : end]
-				// Escape HTML special characters in code content
-				escapedCode := html.EscapeString(code)
-				// Generate code HTML
-				codeHTML := "<code>" + escapedCode + "</code>"
-				// Create placeholder
-				placeholderID := fmt.Sprintf("{{CODE%d}}", placeholderIndex)
-				placeholderIndex++
-				// Record the placeholder
-				placeholders = append(placeholders, placeholder{
-					start:         i,
-					end:           end + backtickCount,
-					html:          codeHTML,
-					placeholderID: placeholderID,
+				spans = append(spans, inlineSpan{
+					start:    i,
+					end:      end + backtickCount,
+					rendered: renderCode(line[i+backtickCount : end]),
 				})
 				// Skip the code block
 				i = end + backtickCount
@@ -494,39 +571,59 @@ func renderInline(line string) string {
 
 		i++
 	}
+	return spans
+}
 
-	// Step 2: Build string with placeholders
-	// For simplicity, we build the new string from left to right
+// replaceSpansWithPlaceholders swaps each span of line for a numbered placeholder.
+func replaceSpansWithPlaceholders(line string, spans []inlineSpan) string {
 	var processed strings.Builder
 	lastPos := 0
-	for _, ph := range placeholders {
+	for i, span := range spans {
 		// Add text before the placeholder
-		if ph.start > lastPos {
-			processed.WriteString(line[lastPos:ph.start])
+		if span.start > lastPos {
+			processed.WriteString(line[lastPos:span.start])
 		}
-		// Add the placeholder
-		processed.WriteString(ph.placeholderID)
-		lastPos = ph.end
+		fmt.Fprintf(&processed, "%s%d%s", placeholderStart, i, placeholderEnd)
+		lastPos = span.end
 	}
 	// Add remaining text
 	if lastPos < len(line) {
 		processed.WriteString(line[lastPos:])
 	}
-	processedStr := processed.String()
+	return processed.String()
+}
 
-	// Step 3: HTML escape the entire string (placeholders are unaffected as they contain no special characters)
+// restoreSpans replaces the placeholders in text with the rendered spans.
+func restoreSpans(text string, spans []inlineSpan) string {
+	for i, span := range spans {
+		text = strings.Replace(text, fmt.Sprintf("%s%d%s", placeholderStart, i, placeholderEnd), span.rendered, 1)
+	}
+	return text
+}
+
+func renderInline(line string) string {
+	if line == "" {
+		return ""
+	}
+
+	// Step 1: Extract links and code blocks, replace with placeholders
+	spans := scanInlineSpans(line,
+		func(label, url string) string {
+			return fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(url), html.EscapeString(label))
+		},
+		func(code string) string {
+			return "<code>" + html.EscapeString(code) + "</code>"
+		})
+	processedStr := replaceSpansWithPlaceholders(line, spans)
+
+	// Step 2: HTML escape the entire string (placeholders are unaffected as they contain no special characters)
 	escapedStr := html.EscapeString(processedStr)
 
-	// Step 4: Apply markdown formatting
+	// Step 3: Apply markdown formatting
 	formattedStr := applyFormatting(escapedStr)
 
-	// Step 5: Replace placeholders with actual HTML
-	result := formattedStr
-	for _, ph := range placeholders {
-		result = strings.Replace(result, ph.placeholderID, ph.html, 1)
-	}
-
-	return result
+	// Step 4: Replace placeholders with actual HTML
+	return restoreSpans(formattedStr, spans)
 }
 
 // applyFormatting applies markdown formatting to escaped text
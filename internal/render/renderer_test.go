@@ -6,26 +6,24 @@ import (
 )
 
 func TestNormalizeMode(t *testing.T) {
-	// NormalizeMode now always returns markdown_stream
-	if got := NormalizeMode(""); got != ModeMarkdownStream {
-		t.Fatalf("NormalizeMode(\"\") = %q, want %q", got, ModeMarkdownStream)
-	}
-	if got := NormalizeMode("plain"); got != ModeMarkdownStream {
-		t.Fatalf("NormalizeMode(\"plain\") = %q, want %q", got, ModeMarkdownStream)
-	}
-	if got := NormalizeMode("markdown_final"); got != ModeMarkdownStream {
-		t.Fatalf("NormalizeMode(\"markdown_final\") = %q, want %q", got, ModeMarkdownStream)
-	}
-	if got := NormalizeMode("markdown_stream"); got != ModeMarkdownStream {
-		t.Fatalf("NormalizeMode(\"markdown_stream\") = %q, want %q", got, ModeMarkdownStream)
+	tests := map[string]string{
+		"":                 ModeMarkdownStream,
+		"plain":            ModePlain,
+		" Markdown_Final ": ModeMarkdownFinal,
+		"markdown_stream":  ModeMarkdownStream,
+		"unknown":          ModeMarkdownStream,
+	}
+	for input, want := range tests {
+		if got := NormalizeMode(input); got != want {
+			t.Fatalf("NormalizeMode(%q) = %q, want %q", input, got, want)
+		}
 	}
-	if got := NormalizeMode("unknown"); got != ModeMarkdownStream {
-		t.Fatalf("NormalizeMode(\"unknown\") = %q, want %q", got, ModeMarkdownStream)
+	if IsValidMode("unknown") || IsValidMode("") || !IsValidMode("plain") {
+		t.Fatal("IsValidMode should accept only the supported modes")
 	}
 }
 
 func TestRenderer_RenderMode(t *testing.T) {
-	// Renderer now always uses HTML rendering (markdown_stream mode)
 	r := New("markdown_stream")
 	streaming := r.Render("**hello**", true)
 	if !streaming.UseHTML {
@@ -44,6 +42,33 @@ func TestRenderer_RenderMode(t *testing.T) {
 	}
 }
 
+func TestRenderer_PlainMode(t *testing.T) {
+	r := New("plain")
+	for _, streaming := range []bool{true, false} {
+		got := r.Render("**a** < b", streaming)
+		if got.UseHTML || got.Text != "**a** < b" {
+			t.Fatalf("plain mode should send text as-is (streaming=%v), got %#v", streaming, got)
+		}
+	}
+}
+
+func TestRenderer_MarkdownFinalMode(t *testing.T) {
+	r := New("markdown_final")
+	streaming := r.Render("**hello**", true)
+	if streaming.UseHTML || streaming.Text != "**hello**" {
+		t.Fatalf("markdown_final should stream plain text, got %#v", streaming)
+	}
+	final := r.Render("**hello**", false)
+	if !final.UseHTML || !strings.Contains(final.Text, "<b>hello</b>") {
+		t.Fatalf("markdown_final should convert the final edit, got %#v", final)
+	}
+
+	// A per-chat override takes precedence over the renderer's mode.
+	if got := r.RenderMode(ModeMarkdownStream, "**hello**", true); !got.UseHTML {
+		t.Fatalf("override should render HTML while streaming, got %#v", got)
+	}
+}
+
 func TestMarkdownToTelegramHTML(t *testing.T) {
 	input := "# Title\nA **bold** and ~~strike~~ text with [link](https://example.com?q=1&k=2)\n`code`\n***both***"
 	got := MarkdownToTelegramHTML(input)
@@ -75,6 +100,22 @@ func TestMarkdownToTelegramHTML_FencePreserved(t *testing.T) {
 	}
 }
 
+func TestMarkdownToTelegramHTML_LongerFenceKeepsInnerFences(t *testing.T) {
+	input := "````md\nRun:\n```sh\nmake\n```\n````\nafter **bold**"
+	got := MarkdownToTelegramHTML(input)
+
+	want := "<pre><code>Run:\n```sh\nmake\n```</code></pre>\nafter <b>bold</b>"
+	if got != want {
+		t.Fatalf("expected inner fences kept inside the block, got %q", got)
+	}
+
+	// A shorter run or a line with text after the backticks does not close it.
+	got = MarkdownToTelegramHTML("````\n```\n```` not yet\n````")
+	if got != "<pre><code>```\n```` not yet</code></pre>" {
+		t.Fatalf("expected only a bare, long enough run to close the block, got %q", got)
+	}
+}
+
 func TestMarkdownToTelegramHTML_UnclosedFenceKeptRaw(t *testing.T) {
 	input := "```go\nfmt.Println(\"hi\")"
 	got := MarkdownToTelegramHTML(input)
@@ -110,3 +151,28 @@ func TestMarkdownToTelegramHTML_NestedFormatting(t *testing.T) {
 		})
 	}
 }
+
+func TestRenderer_MarkdownV2Mode(t *testing.T) {
+	r := New("markdownv2")
+	got := r.Render("**hi** v1.2", false)
+	if got.UseHTML || !got.UseMarkdownV2 || got.Text != "*hi* v1\\.2" || got.FallbackText != "**hi** v1.2" {
+		t.Fatalf("unexpected MarkdownV2 result: %#v", got)
+	}
+
+	// The cache must not hand out one backend's output to the other.
+	if html := r.RenderMode(ModeMarkdownStream, "**hi** v1.2", false); !html.UseHTML || html.Text != "<b>hi</b> v1.2" {
+		t.Fatalf("unexpected HTML result after MarkdownV2 render: %#v", html)
+	}
+	if again := r.Render("**hi** v1.2", false); again.Text != got.Text {
+		t.Fatalf("cached MarkdownV2 result changed: %q", again.Text)
+	}
+}
+
+func TestEscapeMarkdownV2(t *testing.T) {
+	if got := escapeMarkdownV2(`_*[]()~` + "`" + `>#+-=|{}.!\ ok`); got != `\_\*\[\]\(\)\~\`+"`"+`\>\#\+\-\=\|\{\}\.\!\\ ok` {
+		t.Fatalf("unexpected escaping: %q", got)
+	}
+	if got := MarkdownToTelegramMarkdownV2("[a.b](https://x.io/p_(1))"); got != `[a\.b](https://x.io/p_(1\))` {
+		t.Fatalf("unexpected link: %q", got)
+	}
+}
@@ -0,0 +1,238 @@
+package render
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// tableMaxColumnWidth caps a column of a monospace table; longer cells are cut.
+	tableMaxColumnWidth = 20
+	// tablePhoneWidth is roughly how many monospace characters fit on a phone
+	// screen. Wider tables are shown as one card per row instead.
+	tablePhoneWidth = 40
+)
+
+type tableAlign int
+
+const (
+	alignLeft tableAlign = iota
+	alignCenter
+	alignRight
+)
+
+// markdownTable is a GitHub-style table: a header row, a delimiter row giving
+// the column alignment, and body rows padded to the header's column count.
+type markdownTable struct {
+	header []string
+	aligns []tableAlign
+	rows   [][]string
+}
+
+// parseTableBlock parses the table starting at lines[start], if any, and
+// returns the index of the first line after it. A header row followed by a
+// delimiter row is enough, so tables are recognized while still streaming.
+func parseTableBlock(lines []string, start int) (markdownTable, int, bool) {
+	if start+1 >= len(lines) || !isTableRow(lines[start]) {
+		return markdownTable{}, start, false
+	}
+	aligns, ok := parseTableDelimiter(lines[start+1])
+	if !ok {
+		return markdownTable{}, start, false
+	}
+	header := splitTableRow(lines[start])
+	if len(header) != len(aligns) {
+		return markdownTable{}, start, false
+	}
+
+	table := markdownTable{header: header, aligns: aligns}
+	end := start + 2
+	for ; end < len(lines) && isTableRow(lines[end]); end++ {
+		row := splitTableRow(lines[end])
+		// Pad rows that are still streaming in and drop cells beyond the header.
+		for len(row) < len(header) {
+			row = append(row, "")
+		}
+		table.rows = append(table.rows, row[:len(header)])
+	}
+	return table, end, true
+}
+
+func isTableRow(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed != "" && strings.Contains(trimmed, "|")
+}
+
+// parseTableDelimiter parses a delimiter row such as |:---|:--:|---:|.
+func parseTableDelimiter(line string) ([]tableAlign, bool) {
+	if !isTableRow(line) {
+		return nil, false
+	}
+	cells := splitTableRow(line)
+	aligns := make([]tableAlign, 0, len(cells))
+	for _, cell := range cells {
+		dashes := strings.TrimSuffix(strings.TrimPrefix(cell, ":"), ":")
+		if dashes == "" || strings.Trim(dashes, "-") != "" {
+			return nil, false
+		}
+		switch left, right := strings.HasPrefix(cell, ":"), strings.HasSuffix(cell, ":"); {
+		case left && right:
+			aligns = append(aligns, alignCenter)
+		case right:
+			aligns = append(aligns, alignRight)
+		default:
+			aligns = append(aligns, alignLeft)
+		}
+	}
+	return aligns, true
+}
+
+// splitTableRow splits a row on unescaped pipes outside code spans.
+func splitTableRow(line string) []string {
+	trimmed := strings.TrimSpace(line)
+	trimmed = strings.TrimPrefix(trimmed, "|")
+	if strings.HasSuffix(trimmed, "|") && !strings.HasSuffix(trimmed, `\|`) {
+		trimmed = trimmed[:len(trimmed)-1]
+	}
+
+	var cells []string
+	var cell strings.Builder
+	inCode := false
+	for i := 0; i < len(trimmed); i++ {
+		ch := trimmed[i]
+		switch {
+		case ch == '\\' && i+1 < len(trimmed) && trimmed[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case ch == '`':
+			inCode = !inCode
+			cell.WriteByte(ch)
+		case ch == '|' && !inCode:
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(ch)
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// plainCellText drops inline markdown markers, which a monospace block cannot show.
+func plainCellText(cell string) string {
+	return strings.NewReplacer("**", "", "__", "", "~~", "", "`", "").Replace(cell)
+}
+
+func truncateCell(cell string, width int) string {
+	if utf8.RuneCountInString(cell) <= width {
+		return cell
+	}
+	return string([]rune(cell)[:width-1]) + "…"
+}
+
+func padCell(cell string, width int, align tableAlign) string {
+	gap := width - utf8.RuneCountInString(cell)
+	if gap <= 0 {
+		return cell
+	}
+	switch align {
+	case alignRight:
+		return strings.Repeat(" ", gap) + cell
+	case alignCenter:
+		return strings.Repeat(" ", gap/2) + cell + strings.Repeat(" ", gap-gap/2)
+	default:
+		return cell + strings.Repeat(" ", gap)
+	}
+}
+
+// layoutTable lays the table out as aligned monospace text with capped column
+// widths. It returns false when the result is too wide for a phone screen.
+func layoutTable(table markdownTable) (string, bool) {
+	widths := make([]int, len(table.header))
+	cells := make([][]string, 0, len(table.rows)+1)
+	for _, row := range append([][]string{table.header}, table.rows...) {
+		plain := make([]string, len(row))
+		for i, cell := range row {
+			plain[i] = truncateCell(plainCellText(cell), tableMaxColumnWidth)
+			if n := utf8.RuneCountInString(plain[i]); n > widths[i] {
+				widths[i] = n
+			}
+		}
+		cells = append(cells, plain)
+	}
+
+	total := 3 * (len(widths) - 1)
+	for _, w := range widths {
+		total += w
+	}
+	if total > tablePhoneWidth {
+		return "", false
+	}
+
+	lines := make([]string, 0, len(cells)+1)
+	for r, row := range cells {
+		padded := make([]string, len(row))
+		for i, cell := range row {
+			padded[i] = padCell(cell, widths[i], table.aligns[i])
+		}
+		lines = append(lines, strings.TrimRight(strings.Join(padded, " │ "), " "))
+		if r == 0 {
+			rules := make([]string, len(widths))
+			for i, w := range widths {
+				rules[i] = strings.Repeat("─", w)
+			}
+			lines = append(lines, strings.Join(rules, "─┼─"))
+		}
+	}
+	return strings.Join(lines, "\n"), true
+}
+
+// tableCards renders each row as a card of "header: value" lines, using key
+// and value to format the two sides.
+func tableCards(table markdownTable, key, value func(string) string) string {
+	cards := make([]string, 0, len(table.rows))
+	for _, row := range table.rows {
+		lines := make([]string, 0, len(row))
+		for i, cell := range row {
+			if cell == "" {
+				continue
+			}
+			name := plainCellText(table.header[i])
+			if name == "" {
+				name = fmt.Sprintf("Column %d", i+1)
+			}
+			lines = append(lines, key(name)+": "+value(cell))
+		}
+		if len(lines) > 0 {
+			cards = append(cards, strings.Join(lines, "\n"))
+		}
+	}
+	if len(cards) == 0 {
+		// Only the header has streamed in so far.
+		names := make([]string, len(table.header))
+		for i, name := range table.header {
+			names[i] = plainCellText(name)
+		}
+		return key(strings.Join(names, " · "))
+	}
+	return strings.Join(cards, "\n\n")
+}
+
+func renderTableHTML(table markdownTable) string {
+	if text, ok := layoutTable(table); ok {
+		return "<pre>" + html.EscapeString(text) + "</pre>"
+	}
+	return tableCards(table,
+		func(name string) string { return "<b>" + html.EscapeString(name) + "</b>" },
+		renderInline)
+}
+
+func renderTableMarkdownV2(table markdownTable) string {
+	if text, ok := layoutTable(table); ok {
+		return "```\n" + escapeMarkdownV2Code(text) + "\n```"
+	}
+	return tableCards(table,
+		func(name string) string { return "*" + escapeMarkdownV2(name) + "*" },
+		renderInlineMarkdownV2)
+}
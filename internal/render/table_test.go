@@ -0,0 +1,39 @@
+package render
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTableBlock_RequiresDelimiterRow(t *testing.T) {
+	for _, input := range []string{
+		"run `ls | wc -l` to count\nthen continue",
+		"| just a header |",
+		"a | b\n---",
+	} {
+		lines := strings.Split(input, "\n")
+		if _, _, ok := parseTableBlock(lines, 0); ok {
+			t.Fatalf("%q should not be parsed as a table", input)
+		}
+	}
+
+	lines := strings.Split("| a | b |\n|---|:-:|\n| 1 |", "\n")
+	table, end, ok := parseTableBlock(lines, 0)
+	if !ok || end != 3 || len(table.rows) != 1 || table.rows[0][1] != "" || table.aligns[1] != alignCenter {
+		t.Fatalf("unexpected table: %#v end=%d ok=%v", table, end, ok)
+	}
+}
+
+func TestMarkdownToTelegramHTML_TableHeaderOnly(t *testing.T) {
+	got := MarkdownToTelegramHTML("| Name | Size |\n|---|---|")
+	if got != "<pre>Name │ Size\n─────┼─────</pre>" {
+		t.Fatalf("unexpected header-only table: %q", got)
+	}
+}
+
+func TestMarkdownToTelegramHTML_TableCapsColumnWidth(t *testing.T) {
+	got := MarkdownToTelegramHTML("| Key | Value |\n|---|---|\n| a | " + strings.Repeat("x", 30) + " |")
+	if !strings.Contains(got, strings.Repeat("x", tableMaxColumnWidth-1)+"…") || strings.Contains(got, strings.Repeat("x", tableMaxColumnWidth)) {
+		t.Fatalf("long cells should be cut to the column cap: %q", got)
+	}
+}
@@ -270,6 +270,7 @@ func (m *Manager) SyncSessions(ctx context.Context) error {
 	for _, sess := range existingSessions {
 		existingSessionMap[sess.SessionID] = true
 	}
+	cleaned := m.cleanedSessions()
 
 	// Add or update sessions from OpenCode
 	for _, ocSession := range opencodeSessions {
@@ -279,13 +280,26 @@ func (m *Manager) SyncSessions(ctx context.Context) error {
 		default:
 		}
 
+		// Sessions the janitor cleaned up stay forgotten until they are used again
+		if cleaned[ocSession.ID] {
+			delete(cleaned, ocSession.ID)
+			continue
+		}
+
 		// Use getOrCreateSessionMeta to ensure session metadata is stored
 		// We use 0 as userID since we don't know the owner at sync time
 		// getOrCreateSessionMeta will determine ownership from metadata
-		m.getOrCreateSessionMeta(ocSession.ID, 0, ocSession.Metadata, ocSession.Title)
+		m.getOrCreateSessionMeta(&ocSession, 0, true)
 		delete(existingSessionMap, ocSession.ID)
 	}
 
+	// Cleaned sessions that are gone from OpenCode need not be remembered
+	for sessionID := range cleaned {
+		if err := m.store.DeleteSessionMeta(sessionID); err != nil {
+			log.Warnf("Failed to forget cleaned session %s: %v", sessionID, err)
+		}
+	}
+
 	// Remove sessions that no longer exist in OpenCode (orphaned sessions)
 	for sessionID := range existingSessionMap {
 		log.Debugf("Removing orphaned session from local storage: %s", sessionID)
@@ -308,6 +322,16 @@ func (m *Manager) SetUserLastModel(userID int64, providerID, modelID string) err
 	return m.store.StoreUserLastModel(userID, providerID, modelID)
 }
 
+// GetChatRenderMode returns the render mode override of a chat, if any.
+func (m *Manager) GetChatRenderMode(chatID int64) (string, bool, error) {
+	return m.store.GetChatRenderMode(chatID)
+}
+
+// SetChatRenderMode overrides the render mode of a chat; an empty mode resets it.
+func (m *Manager) SetChatRenderMode(chatID int64, mode string) error {
+	return m.store.StoreChatRenderMode(chatID, mode)
+}
+
 // GetAllModels returns all preloaded models from storage
 func (m *Manager) GetAllModels() ([]*storage.ModelMeta, error) {
 	return m.store.ListModels()
@@ -583,21 +607,64 @@ func (m *Manager) ListUserSessions(ctx context.Context, userID int64) ([]*Sessio
 		}
 	}
 
-	// Process all OpenCode sessions, filter out child sessions (those with parentID)
+	// Process all OpenCode sessions, filter out child sessions (those with parentID).
+	// Cleaned sessions are listed but not stored until the user switches to one.
+	cleaned := m.cleanedSessions()
 	for _, ocSession := range opencodeSessions {
 		// Skip sessions with parentID (child sessions like @explore subagent)
 		if ocSession.ParentID != "" {
 			log.Debugf("Skipping child session %s (parent: %s)", ocSession.ID, ocSession.ParentID)
 			continue
 		}
-		meta := m.getOrCreateSessionMeta(ocSession.ID, userID, ocSession.Metadata, ocSession.Title)
+		meta := m.getOrCreateSessionMeta(&ocSession, userID, !cleaned[ocSession.ID])
 		allSessions = append(allSessions, meta)
 	}
 
 	// Sync message count and model info from OpenCode to avoid stale local counters.
 	m.syncSessionRuntimeInfo(ctx, allSessions)
 
-	return allSessions, nil
+	return orderSessionTree(allSessions), nil
+}
+
+// orderSessionTree places forks right after the session they were forked from,
+// keeping the original order among siblings. Sessions whose parent is not in
+// the list are treated as roots.
+func orderSessionTree(sessions []*SessionMeta) []*SessionMeta {
+	listed := make(map[string]bool, len(sessions))
+	for _, sess := range sessions {
+		listed[sess.SessionID] = true
+	}
+	children := make(map[string][]*SessionMeta)
+	var roots []*SessionMeta
+	for _, sess := range sessions {
+		if sess.ParentID != "" && sess.ParentID != sess.SessionID && listed[sess.ParentID] {
+			children[sess.ParentID] = append(children[sess.ParentID], sess)
+		} else {
+			roots = append(roots, sess)
+		}
+	}
+
+	ordered := make([]*SessionMeta, 0, len(sessions))
+	visited := make(map[string]bool, len(sessions))
+	var visit func(sess *SessionMeta)
+	visit = func(sess *SessionMeta) {
+		if visited[sess.SessionID] {
+			return
+		}
+		visited[sess.SessionID] = true
+		ordered = append(ordered, sess)
+		for _, child := range children[sess.SessionID] {
+			visit(child)
+		}
+	}
+	for _, root := range roots {
+		visit(root)
+	}
+	// Parent cycles have no root; keep those sessions rather than dropping them.
+	for _, sess := range sessions {
+		visit(sess)
+	}
+	return ordered
 }
 
 // CreateNewSession creates a new session for a user
@@ -763,6 +830,126 @@ func (m *Manager) SetSessionModel(ctx context.Context, sessionID, providerID, mo
 	return nil
 }
 
+// SetSessionAgent pins the agent used for prompts in a session. An empty agent
+// restores the OpenCode default.
+func (m *Manager) SetSessionAgent(sessionID, agent string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	meta, exists, err := m.store.GetSessionMeta(sessionID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("session not found: %s", sessionID)
+	}
+
+	meta.Agent = strings.TrimSpace(agent)
+	meta.LastUsedAt = time.Now()
+	if err := m.store.StoreSessionMeta(meta); err != nil {
+		return err
+	}
+
+	log.Infof("Updated session %s agent to %q", sessionID, meta.Agent)
+	return nil
+}
+
+// SetSessionMessageCount records the number of visible messages in a session,
+// e.g. after a revert hid some of them.
+func (m *Manager) SetSessionMessageCount(sessionID string, count int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	meta, exists, err := m.store.GetSessionMeta(sessionID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("session not found: %s", sessionID)
+	}
+	if meta.MessageCount == count {
+		return nil
+	}
+	meta.MessageCount = count
+	return m.store.StoreSessionMeta(meta)
+}
+
+// ForkSession forks parentID before messageID (the whole session when empty)
+// and makes the fork userID's current session. The fork inherits the parent's
+// model and agent and is named after it.
+func (m *Manager) ForkSession(ctx context.Context, userID int64, parentID, messageID string) (*SessionMeta, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	parent, exists, err := m.store.GetSessionMeta(parentID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("session not found: %s", parentID)
+	}
+
+	fork, err := m.client.ForkSession(ctx, parentID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := m.forkName(parent)
+	if err != nil {
+		return nil, err
+	}
+	// Rename upstream too, otherwise the next sync replaces the name with OpenCode's title.
+	if err := m.client.RenameSession(ctx, fork.ID, name, userID); err != nil {
+		log.Warnf("Failed to name forked session %s: %v", fork.ID, err)
+	}
+
+	meta := &storage.SessionMeta{
+		SessionID:  fork.ID,
+		UserID:     userID,
+		Name:       name,
+		Status:     "owned",
+		CreatedAt:  time.Now(),
+		LastUsedAt: time.Now(),
+		ProviderID: parent.ProviderID,
+		ModelID:    parent.ModelID,
+		Agent:      parent.Agent,
+		ParentID:   parentID,
+	}
+	if err := m.store.StoreSessionMeta(meta); err != nil {
+		return nil, err
+	}
+	if err := m.store.StoreUserSession(userID, fork.ID); err != nil {
+		return nil, err
+	}
+	if meta.ProviderID != "" && meta.ModelID != "" {
+		if err := m.store.StoreUserLastModel(userID, meta.ProviderID, meta.ModelID); err != nil {
+			log.Warnf("Failed to update user current model: %v", err)
+		}
+	}
+
+	log.Infof("Forked session %s from %s at message %q as %s for user %d", fork.ID, parentID, messageID, name, userID)
+	return meta, nil
+}
+
+// forkName derives a name for the next fork of parent, e.g. "Refactor (fork 2)".
+func (m *Manager) forkName(parent *SessionMeta) (string, error) {
+	sessions, err := m.store.ListSessions()
+	if err != nil {
+		return "", err
+	}
+	forks := 0
+	for _, sess := range sessions {
+		if sess.ParentID == parent.SessionID {
+			forks++
+		}
+	}
+	base := strings.TrimSpace(parent.Name)
+	if base == "" {
+		base = "Session"
+	}
+	return fmt.Sprintf("%s (fork %d)", base, forks+1), nil
+}
+
 // RenameSession renames a session (allowed for owned or orphaned sessions)
 func (m *Manager) RenameSession(ctx context.Context, userID int64, sessionID string, newName string) error {
 	m.mu.Lock()
@@ -897,6 +1084,30 @@ func (m *Manager) GetSessionMeta(sessionID string) (*SessionMeta, bool) {
 	return meta, exists
 }
 
+// InactiveSessions lists the sessions CleanupInactiveSessions would remove
+func (m *Manager) InactiveSessions(maxAge time.Duration) []*SessionMeta {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sessions, err := m.store.ListSessions()
+	if err != nil {
+		log.Errorf("Failed to list sessions: %v", err)
+		return nil
+	}
+
+	now := time.Now()
+	var inactive []*SessionMeta
+	for _, meta := range sessions {
+		if now.Sub(meta.LastUsedAt) > maxAge {
+			inactive = append(inactive, meta)
+		}
+	}
+	sort.Slice(inactive, func(i, j int) bool {
+		return inactive[i].LastUsedAt.Before(inactive[j].LastUsedAt)
+	})
+	return inactive
+}
+
 // CleanupInactiveSessions removes sessions that haven't been used for a while
 func (m *Manager) CleanupInactiveSessions(maxAge time.Duration) []string {
 	m.mu.Lock()
@@ -947,11 +1158,41 @@ func (m *Manager) listLocalUserSessions(userID int64) []*SessionMeta {
 	return userSessions
 }
 
-// getOrCreateSessionMeta gets or creates session metadata for an OpenCode session
-func (m *Manager) getOrCreateSessionMeta(sessionID string, currentUserID int64, metadata map[string]interface{}, title string) *SessionMeta {
+// cleanedSessions returns the set of sessions the janitor cleaned up
+func (m *Manager) cleanedSessions() map[string]bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids, err := m.store.ListCleanedSessions()
+	if err != nil {
+		log.Warnf("Failed to list cleaned sessions: %v", err)
+	}
+	cleaned := make(map[string]bool, len(ids))
+	for _, sessionID := range ids {
+		cleaned[sessionID] = true
+	}
+	return cleaned
+}
+
+// openCodeTime converts an OpenCode timestamp in milliseconds, using now when
+// it is missing
+func openCodeTime(ms int64) time.Time {
+	if ms <= 0 {
+		return time.Now()
+	}
+	return time.UnixMilli(ms)
+}
+
+// getOrCreateSessionMeta gets or creates session metadata for an OpenCode
+// session. New metadata is only stored if store is set. Listing a session is
+// not using it, so LastUsedAt of known sessions is left alone and new ones
+// take OpenCode's last update time.
+func (m *Manager) getOrCreateSessionMeta(ocSession *opencode.Session, currentUserID int64, store bool) *SessionMeta {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	sessionID, metadata, title := ocSession.ID, ocSession.Metadata, ocSession.Title
+
 	// Check if we already have metadata for this session
 	meta, exists, err := m.store.GetSessionMeta(sessionID)
 	if err != nil {
@@ -962,9 +1203,6 @@ func (m *Manager) getOrCreateSessionMeta(sessionID string, currentUserID int64,
 	if exists {
 		updated := false
 
-		// Update last used time and recalculate status based on current user
-		meta.LastUsedAt = time.Now()
-
 		// Keep local metadata in sync with upstream session metadata.
 		if title != "" && title != meta.Name {
 			meta.Name = title
@@ -988,7 +1226,7 @@ func (m *Manager) getOrCreateSessionMeta(sessionID string, currentUserID int64,
 		} else {
 			meta.Status = "other"
 		}
-		updated = true // status/last used are refreshed on each list call.
+		updated = true // status is refreshed on each list call.
 
 		if updated {
 			if err := m.store.StoreSessionMeta(meta); err != nil {
@@ -1010,8 +1248,8 @@ func (m *Manager) getOrCreateSessionMeta(sessionID string, currentUserID int64,
 	meta = &storage.SessionMeta{
 		SessionID:  sessionID,
 		UserID:     ownerID,
-		CreatedAt:  time.Now(),
-		LastUsedAt: time.Now(),
+		CreatedAt:  openCodeTime(ocSession.Time.Created),
+		LastUsedAt: openCodeTime(ocSession.Time.Updated),
 	}
 
 	// Extract name from provided title, metadata, or use default
@@ -1042,6 +1280,10 @@ func (m *Manager) getOrCreateSessionMeta(sessionID string, currentUserID int64,
 		meta.Status = "other"
 	}
 
+	if !store {
+		return meta
+	}
+
 	// Store in local cache
 	if err := m.store.StoreSessionMeta(meta); err != nil {
 		log.Warnf("Failed to store new session meta: %v", err)
@@ -78,6 +78,20 @@ func mockOpenCodeServer(t *testing.T) *httptest.Server {
 			}
 			json.NewEncoder(w).Encode(response)
 
+		case r.Method == "POST" && strings.HasPrefix(r.URL.Path, "/session/") && strings.HasSuffix(r.URL.Path, "/fork"):
+			parentID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/session/"), "/fork")
+			if !sessions[parentID] {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			sessionCounter++
+			sessionID := fmt.Sprintf("test-session-%d", sessionCounter)
+			sessions[sessionID] = true
+			json.NewEncoder(w).Encode(opencode.Session{ID: sessionID, Title: "Forked"})
+
+		case r.Method == "PATCH" && strings.HasPrefix(r.URL.Path, "/session/"):
+			w.WriteHeader(http.StatusOK)
+
 		case r.Method == "POST" && len(r.URL.Path) > len("/session/") && strings.Contains(r.URL.Path, "/message"):
 			// Simplified message response
 			response := opencode.Message{
@@ -498,6 +512,86 @@ func TestSyncModelsPersistsProviderModelMappingAndRecyclesNumbers(t *testing.T)
 	}
 }
 
+func TestForkSession(t *testing.T) {
+	server := mockOpenCodeServer(t)
+	defer server.Close()
+
+	client := opencode.NewClient(server.URL, 5)
+	manager := createTestManager(t, client)
+	ctx := context.Background()
+
+	parentID, err := manager.CreateNewSessionWithModel(ctx, 12345, "Refactor", "anthropic", "claude")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if err := manager.SetSessionAgent(parentID, "plan"); err != nil {
+		t.Fatalf("Failed to set agent: %v", err)
+	}
+	otherID, err := manager.CreateNewSession(ctx, 12345, "Other")
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	fork, err := manager.ForkSession(ctx, 12345, parentID, "msg_2")
+	if err != nil {
+		t.Fatalf("ForkSession failed: %v", err)
+	}
+	if fork.Name != "Refactor (fork 1)" || fork.ParentID != parentID {
+		t.Fatalf("unexpected fork meta: %#v", fork)
+	}
+	if fork.ProviderID != "anthropic" || fork.ModelID != "claude" || fork.Agent != "plan" {
+		t.Fatalf("fork should inherit model and agent, got %#v", fork)
+	}
+	if current, _ := manager.GetUserSession(12345); current != fork.SessionID {
+		t.Fatalf("expected user to be switched to the fork, got %s", current)
+	}
+
+	second, err := manager.ForkSession(ctx, 12345, parentID, "")
+	if err != nil {
+		t.Fatalf("ForkSession failed: %v", err)
+	}
+	if second.Name != "Refactor (fork 2)" {
+		t.Fatalf("expected numbered fork name, got %q", second.Name)
+	}
+
+	if _, err := manager.ForkSession(ctx, 12345, "missing", ""); err == nil {
+		t.Fatalf("expected error when forking an unknown session")
+	}
+
+	sessions, err := manager.ListUserSessions(ctx, 12345)
+	if err != nil {
+		t.Fatalf("ListUserSessions failed: %v", err)
+	}
+	position := make(map[string]int, len(sessions))
+	for i, sess := range sessions {
+		position[sess.SessionID] = i
+	}
+	if position[fork.SessionID] <= position[parentID] || position[second.SessionID] <= position[parentID] {
+		t.Fatalf("forks should follow their parent: %v", position)
+	}
+	if position[otherID] > position[parentID] && position[otherID] < position[second.SessionID] {
+		t.Fatalf("unrelated session must not sit between a parent and its forks: %v", position)
+	}
+}
+
+func TestOrderSessionTree(t *testing.T) {
+	sessions := []*SessionMeta{
+		{SessionID: "c", ParentID: "b"},
+		{SessionID: "a"},
+		{SessionID: "b", ParentID: "a"},
+		{SessionID: "d", ParentID: "gone"},
+		{SessionID: "x", ParentID: "y"},
+		{SessionID: "y", ParentID: "x"},
+	}
+	var ids []string
+	for _, sess := range orderSessionTree(sessions) {
+		ids = append(ids, sess.SessionID)
+	}
+	if got := strings.Join(ids, ","); got != "a,b,c,d,x,y" {
+		t.Fatalf("unexpected tree order: %s", got)
+	}
+}
+
 func TestListUserSessions(t *testing.T) {
 	server := mockOpenCodeServer(t)
 	defer server.Close()
@@ -907,6 +1001,33 @@ func TestCleanupInactiveSessions(t *testing.T) {
 	}
 }
 
+func TestInactiveSessions(t *testing.T) {
+	manager := createTestManager(t, nil)
+	now := time.Now()
+	for id, lastUsed := range map[string]time.Time{
+		"ses_old":    now.Add(-72 * time.Hour),
+		"ses_older":  now.Add(-96 * time.Hour),
+		"ses_recent": now.Add(-time.Hour),
+	} {
+		if err := manager.store.StoreSessionMeta(&SessionMeta{SessionID: id, UserID: 1, CreatedAt: lastUsed, LastUsedAt: lastUsed}); err != nil {
+			t.Fatalf("Failed to store session: %v", err)
+		}
+	}
+
+	inactive := manager.InactiveSessions(48 * time.Hour)
+	if len(inactive) != 2 || inactive[0].SessionID != "ses_older" || inactive[1].SessionID != "ses_old" {
+		t.Fatalf("Expected ses_older and ses_old, oldest first, got %#v", inactive)
+	}
+	if count := manager.GetSessionCount(); count != 3 {
+		t.Fatalf("Listing must not remove sessions, got %d left", count)
+	}
+
+	removed := manager.CleanupInactiveSessions(48 * time.Hour)
+	if len(removed) != 2 || manager.GetSessionCount() != 1 {
+		t.Fatalf("Expected 2 sessions removed and 1 left, got %v and %d", removed, manager.GetSessionCount())
+	}
+}
+
 func TestGetOrCreateSessionFailsWhenListSessionsFails(t *testing.T) {
 	var createCalls int32
 
@@ -0,0 +1,427 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ArchiveVersion is the archive format this build writes. Archives from a
+// newer build are rejected rather than partially imported.
+const ArchiveVersion = 1
+
+// Archive formats accepted by WriteArchive.
+const (
+	ArchiveJSON   = "json"
+	ArchiveNDJSON = "ndjson"
+)
+
+// UserSessionRecord is a user's current session in an archive.
+type UserSessionRecord struct {
+	UserID    int64  `json:"user_id"`
+	SessionID string `json:"session_id"`
+}
+
+// UserModelRecord is a user's model preference in an archive.
+type UserModelRecord struct {
+	UserID int64 `json:"user_id"`
+	ModelPreference
+}
+
+// ChatRenderModeRecord is a chat's render mode override in an archive.
+type ChatRenderModeRecord struct {
+	ChatID int64  `json:"chat_id"`
+	Mode   string `json:"mode"`
+}
+
+// Archive is a portable copy of everything in a Store.
+type Archive struct {
+	Version         int                    `json:"version"`
+	ExportedAt      time.Time              `json:"exported_at"`
+	UserSessions    []UserSessionRecord    `json:"user_sessions"`
+	Sessions        []*SessionMeta         `json:"sessions"`
+	Models          []*ModelMeta           `json:"models"`
+	UserLastModels  []UserModelRecord      `json:"user_last_models"`
+	ChatRenderModes []ChatRenderModeRecord `json:"chat_render_modes"`
+}
+
+// ExportArchive reads every entity from store, sorted for stable output.
+func ExportArchive(store Store) (*Archive, error) {
+	archive := &Archive{Version: ArchiveVersion, ExportedAt: time.Now().UTC()}
+
+	userSessions, err := store.ListUserSessions()
+	if err != nil {
+		return nil, err
+	}
+	for userID, sessionID := range userSessions {
+		archive.UserSessions = append(archive.UserSessions, UserSessionRecord{UserID: userID, SessionID: sessionID})
+	}
+	sort.Slice(archive.UserSessions, func(i, j int) bool { return archive.UserSessions[i].UserID < archive.UserSessions[j].UserID })
+
+	if archive.Sessions, err = store.ListSessions(); err != nil {
+		return nil, err
+	}
+	sort.Slice(archive.Sessions, func(i, j int) bool { return archive.Sessions[i].SessionID < archive.Sessions[j].SessionID })
+
+	if archive.Models, err = store.ListModels(); err != nil {
+		return nil, err
+	}
+	sort.Slice(archive.Models, func(i, j int) bool {
+		return ModelKey(archive.Models[i].ProviderID, archive.Models[i].ID) < ModelKey(archive.Models[j].ProviderID, archive.Models[j].ID)
+	})
+
+	prefs, err := store.ListUserLastModels()
+	if err != nil {
+		return nil, err
+	}
+	for userID, pref := range prefs {
+		archive.UserLastModels = append(archive.UserLastModels, UserModelRecord{UserID: userID, ModelPreference: pref})
+	}
+	sort.Slice(archive.UserLastModels, func(i, j int) bool { return archive.UserLastModels[i].UserID < archive.UserLastModels[j].UserID })
+
+	modes, err := store.ListChatRenderModes()
+	if err != nil {
+		return nil, err
+	}
+	for chatID, mode := range modes {
+		archive.ChatRenderModes = append(archive.ChatRenderModes, ChatRenderModeRecord{ChatID: chatID, Mode: mode})
+	}
+	sort.Slice(archive.ChatRenderModes, func(i, j int) bool { return archive.ChatRenderModes[i].ChatID < archive.ChatRenderModes[j].ChatID })
+
+	return archive, nil
+}
+
+// archiveLine is one line of an NDJSON archive: a header line followed by
+// one line per entity.
+type archiveLine struct {
+	Kind       string          `json:"kind"`
+	Version    int             `json:"version,omitempty"`
+	ExportedAt *time.Time      `json:"exported_at,omitempty"`
+	Data       json.RawMessage `json:"data,omitempty"`
+}
+
+const (
+	lineHeader         = "header"
+	lineUserSession    = "user_session"
+	lineSession        = "session"
+	lineModel          = "model"
+	lineUserLastModel  = "user_last_model"
+	lineChatRenderMode = "chat_render_mode"
+)
+
+// WriteArchive writes archive to w as a single JSON document or as NDJSON.
+func WriteArchive(w io.Writer, archive *Archive, format string) error {
+	switch format {
+	case ArchiveJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(archive)
+	case ArchiveNDJSON:
+		enc := json.NewEncoder(w)
+		if err := enc.Encode(archiveLine{Kind: lineHeader, Version: archive.Version, ExportedAt: &archive.ExportedAt}); err != nil {
+			return err
+		}
+		write := func(kind string, v interface{}) error {
+			data, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			return enc.Encode(archiveLine{Kind: kind, Data: data})
+		}
+		for _, r := range archive.UserSessions {
+			if err := write(lineUserSession, r); err != nil {
+				return err
+			}
+		}
+		for _, meta := range archive.Sessions {
+			if err := write(lineSession, meta); err != nil {
+				return err
+			}
+		}
+		for _, meta := range archive.Models {
+			if err := write(lineModel, meta); err != nil {
+				return err
+			}
+		}
+		for _, r := range archive.UserLastModels {
+			if err := write(lineUserLastModel, r); err != nil {
+				return err
+			}
+		}
+		for _, r := range archive.ChatRenderModes {
+			if err := write(lineChatRenderMode, r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported archive format: %s, must be '%s' or '%s'", format, ArchiveJSON, ArchiveNDJSON)
+}
+
+// ReadArchive reads an archive written by WriteArchive in either format.
+func ReadArchive(r io.Reader) (*Archive, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	var probe struct {
+		Kind string `json:"kind"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(&probe); err != nil {
+		return nil, fmt.Errorf("failed to parse archive: %w", err)
+	}
+
+	var archive *Archive
+	if probe.Kind == "" {
+		archive = &Archive{}
+		if err := json.Unmarshal(data, archive); err != nil {
+			return nil, fmt.Errorf("failed to parse archive: %w", err)
+		}
+	} else if archive, err = readNDJSONArchive(data); err != nil {
+		return nil, err
+	}
+
+	if archive.Version == 0 {
+		return nil, errors.New("archive has no version; was it written by export?")
+	}
+	if archive.Version > ArchiveVersion {
+		return nil, fmt.Errorf("archive version %d is newer than supported version %d; upgrade the bot", archive.Version, ArchiveVersion)
+	}
+	return archive, nil
+}
+
+func readNDJSONArchive(data []byte) (*Archive, error) {
+	archive := &Archive{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var line archiveLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+
+		var err error
+		switch line.Kind {
+		case lineHeader:
+			archive.Version = line.Version
+			if line.ExportedAt != nil {
+				archive.ExportedAt = *line.ExportedAt
+			}
+		case lineUserSession:
+			var r UserSessionRecord
+			err = json.Unmarshal(line.Data, &r)
+			archive.UserSessions = append(archive.UserSessions, r)
+		case lineSession:
+			meta := &SessionMeta{}
+			err = json.Unmarshal(line.Data, meta)
+			archive.Sessions = append(archive.Sessions, meta)
+		case lineModel:
+			meta := &ModelMeta{}
+			err = json.Unmarshal(line.Data, meta)
+			archive.Models = append(archive.Models, meta)
+		case lineUserLastModel:
+			var r UserModelRecord
+			err = json.Unmarshal(line.Data, &r)
+			archive.UserLastModels = append(archive.UserLastModels, r)
+		case lineChatRenderMode:
+			var r ChatRenderModeRecord
+			err = json.Unmarshal(line.Data, &r)
+			archive.ChatRenderModes = append(archive.ChatRenderModes, r)
+		default:
+			err = fmt.Errorf("unknown record kind %q", line.Kind)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	return archive, nil
+}
+
+// ImportConflict is an archived entry that differs from one already stored.
+type ImportConflict struct {
+	Kind     string
+	Key      string
+	Existing string
+	Incoming string
+}
+
+// ImportReport summarizes what an import did, or would do on a dry run.
+type ImportReport struct {
+	Added     int
+	Unchanged int
+	Replaced  int // conflicts overwritten with the archived entry
+	Skipped   int // conflicts where the stored entry was kept
+	Conflicts []ImportConflict
+}
+
+// ImportOptions controls ImportArchive.
+type ImportOptions struct {
+	DryRun    bool // report only, write nothing
+	Overwrite bool // replace conflicting entries instead of keeping them
+}
+
+// checkEntries rejects entries no store can hold, before any is written.
+func (a *Archive) checkEntries() error {
+	for _, meta := range a.Sessions {
+		if meta == nil || meta.SessionID == "" {
+			return fmt.Errorf("session metadata has no session ID")
+		}
+	}
+	for _, meta := range a.Models {
+		if meta == nil {
+			return fmt.Errorf("model metadata is nil")
+		}
+		if ModelKey(meta.ProviderID, meta.ID) == "" {
+			return fmt.Errorf("model key is empty")
+		}
+	}
+	return nil
+}
+
+// ImportArchive loads archive into store. Entries missing from store are
+// added; entries that differ are conflicts, kept unless opts.Overwrite is set.
+// The entries to write are collected first and stored in one step, so a
+// failed import leaves store unchanged.
+func ImportArchive(store Store, archive *Archive, opts ImportOptions) (*ImportReport, error) {
+	report := &ImportReport{}
+	changes := &Archive{}
+
+	// apply records one entry. exists and same describe the stored entry;
+	// it reports whether the archived one should be written.
+	apply := func(kind, key string, exists, same bool, existing, incoming string) bool {
+		switch {
+		case !exists:
+			report.Added++
+		case same:
+			report.Unchanged++
+			return false
+		default:
+			report.Conflicts = append(report.Conflicts, ImportConflict{Kind: kind, Key: key, Existing: existing, Incoming: incoming})
+			if !opts.Overwrite {
+				report.Skipped++
+				return false
+			}
+			report.Replaced++
+		}
+		return true
+	}
+
+	for _, meta := range archive.Sessions {
+		if meta == nil || meta.SessionID == "" {
+			continue
+		}
+		current, exists, err := store.GetSessionMeta(meta.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		if apply(lineSession, meta.SessionID, exists, exists && sameSessionMeta(current, meta),
+			describeSessionMeta(current), describeSessionMeta(meta)) {
+			changes.Sessions = append(changes.Sessions, meta)
+		}
+	}
+
+	for _, r := range archive.UserSessions {
+		current, exists, err := store.GetUserSession(r.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if apply(lineUserSession, strconv.FormatInt(r.UserID, 10), exists, current == r.SessionID,
+			current, r.SessionID) {
+			changes.UserSessions = append(changes.UserSessions, r)
+		}
+	}
+
+	for _, meta := range archive.Models {
+		if meta == nil {
+			continue
+		}
+		key := ModelKey(meta.ProviderID, meta.ID)
+		if key == "" {
+			continue
+		}
+		current, exists, err := store.GetModel(meta.ProviderID, meta.ID)
+		if err != nil {
+			return nil, err
+		}
+		// GetModel may match by model ID alone; only an exact key is the same entry.
+		exists = exists && ModelKey(current.ProviderID, current.ID) == key
+		if apply(lineModel, key, exists, exists && *current == *meta,
+			describeModel(current), describeModel(meta)) {
+			changes.Models = append(changes.Models, meta)
+		}
+	}
+
+	for _, r := range archive.UserLastModels {
+		providerID, modelID, exists, err := store.GetUserLastModel(r.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if apply(lineUserLastModel, strconv.FormatInt(r.UserID, 10), exists,
+			providerID == r.ProviderID && modelID == r.ModelID,
+			ModelKey(providerID, modelID), ModelKey(r.ProviderID, r.ModelID)) {
+			changes.UserLastModels = append(changes.UserLastModels, r)
+		}
+	}
+
+	for _, r := range archive.ChatRenderModes {
+		if r.Mode == "" {
+			continue
+		}
+		current, exists, err := store.GetChatRenderMode(r.ChatID)
+		if err != nil {
+			return nil, err
+		}
+		if apply(lineChatRenderMode, strconv.FormatInt(r.ChatID, 10), exists, current == r.Mode,
+			current, r.Mode) {
+			changes.ChatRenderModes = append(changes.ChatRenderModes, r)
+		}
+	}
+
+	if opts.DryRun {
+		return report, nil
+	}
+	if err := store.StoreArchive(changes); err != nil {
+		return nil, fmt.Errorf("failed to import archive: %w", err)
+	}
+	return report, nil
+}
+
+func sameSessionMeta(a, b *SessionMeta) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	x, y := *a, *b
+	if !x.CreatedAt.Equal(y.CreatedAt) || !x.LastUsedAt.Equal(y.LastUsedAt) {
+		return false
+	}
+	x.CreatedAt, x.LastUsedAt = y.CreatedAt, y.LastUsedAt
+	return x == y
+}
+
+func describeSessionMeta(meta *SessionMeta) string {
+	if meta == nil {
+		return ""
+	}
+	return fmt.Sprintf("user %d, %q, %d message(s), last used %s", meta.UserID, meta.Name, meta.MessageCount, meta.LastUsedAt.Format(time.RFC3339))
+}
+
+func describeModel(meta *ModelMeta) string {
+	if meta == nil {
+		return ""
+	}
+	return fmt.Sprintf("#%d %s", meta.Number, meta.Name)
+}
@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func seedStore(t *testing.T, store Store) {
+	t.Helper()
+	created := time.Date(2026, 5, 1, 9, 30, 0, 0, time.UTC)
+	steps := []error{
+		store.StoreSessionMeta(&SessionMeta{SessionID: "ses_1", UserID: 42, Name: "Main", CreatedAt: created, LastUsedAt: created, MessageCount: 4, Agent: "plan", Status: "owned"}),
+		store.StoreSessionMeta(&SessionMeta{SessionID: "ses_2", UserID: 43, Name: "Fork", ParentID: "ses_1", Status: "owned"}),
+		store.StoreUserSession(42, "ses_1"),
+		store.StoreUserSession(43, "ses_2"),
+		store.StoreModel(&ModelMeta{ID: "sonnet", Number: 1, ProviderID: "anthropic", Name: "Sonnet"}),
+		store.StoreUserLastModel(42, "anthropic", "sonnet"),
+		store.StoreChatRenderMode(-100, "plain"),
+	}
+	for _, err := range steps {
+		if err != nil {
+			t.Fatalf("seeding store failed: %v", err)
+		}
+	}
+}
+
+func TestArchive_RoundTripAcrossBackends(t *testing.T) {
+	for _, format := range []string{ArchiveJSON, ArchiveNDJSON} {
+		t.Run(format, func(t *testing.T) {
+			source, err := NewFileStore(createTempFile(t))
+			if err != nil {
+				t.Fatalf("NewFileStore failed: %v", err)
+			}
+			defer source.Close()
+			seedStore(t, source)
+
+			exported, err := ExportArchive(source)
+			if err != nil {
+				t.Fatalf("ExportArchive failed: %v", err)
+			}
+			var buf bytes.Buffer
+			if err := WriteArchive(&buf, exported, format); err != nil {
+				t.Fatalf("WriteArchive failed: %v", err)
+			}
+			archive, err := ReadArchive(&buf)
+			if err != nil {
+				t.Fatalf("ReadArchive failed: %v", err)
+			}
+
+			target, err := NewSQLiteStore(storeBackends[1].tempPath(t))
+			if err != nil {
+				t.Fatalf("NewSQLiteStore failed: %v", err)
+			}
+			defer target.Close()
+
+			report, err := ImportArchive(target, archive, ImportOptions{})
+			if err != nil {
+				t.Fatalf("ImportArchive failed: %v", err)
+			}
+			if report.Added != 7 || len(report.Conflicts) != 0 {
+				t.Fatalf("unexpected import report: %+v", report)
+			}
+
+			reexported, err := ExportArchive(target)
+			if err != nil {
+				t.Fatalf("ExportArchive of target failed: %v", err)
+			}
+			reexported.ExportedAt = exported.ExportedAt
+			// Backends may hand times back in a different location.
+			for _, meta := range reexported.Sessions {
+				meta.CreatedAt, meta.LastUsedAt = meta.CreatedAt.UTC(), meta.LastUsedAt.UTC()
+			}
+			var want, got bytes.Buffer
+			WriteArchive(&want, exported, ArchiveJSON)
+			WriteArchive(&got, reexported, ArchiveJSON)
+			if want.String() != got.String() {
+				t.Errorf("imported state differs from the source:\nwant %s\ngot  %s", want.String(), got.String())
+			}
+
+			// Importing the same archive again changes nothing.
+			report, err = ImportArchive(target, archive, ImportOptions{})
+			if err != nil || report.Unchanged != 7 || report.Added != 0 {
+				t.Errorf("re-import should be a no-op, got %+v (err %v)", report, err)
+			}
+		})
+	}
+}
+
+func TestArchive_DryRunReportsConflicts(t *testing.T) {
+	source, err := NewFileStore(createTempFile(t))
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	defer source.Close()
+	seedStore(t, source)
+	archive, err := ExportArchive(source)
+	if err != nil {
+		t.Fatalf("ExportArchive failed: %v", err)
+	}
+
+	forEachBackend(t, func(t *testing.T, backend storeBackend) {
+		target, err := backend.open(backend.tempPath(t))
+		if err != nil {
+			t.Fatalf("Opening store failed: %v", err)
+		}
+		defer target.Close()
+		target.StoreUserSession(42, "ses_other")
+		target.StoreChatRenderMode(-100, "plain")
+
+		report, err := ImportArchive(target, archive, ImportOptions{DryRun: true, Overwrite: true})
+		if err != nil {
+			t.Fatalf("ImportArchive failed: %v", err)
+		}
+		if len(report.Conflicts) != 1 || report.Conflicts[0].Kind != "user_session" || report.Conflicts[0].Key != "42" {
+			t.Fatalf("expected one user session conflict, got %+v", report.Conflicts)
+		}
+		if report.Added != 5 || report.Unchanged != 1 || report.Replaced != 1 {
+			t.Errorf("unexpected dry run counts: %+v", report)
+		}
+		if sessions, _ := target.ListSessions(); len(sessions) != 0 {
+			t.Error("a dry run must not write anything")
+		}
+
+		report, err = ImportArchive(target, archive, ImportOptions{})
+		if err != nil {
+			t.Fatalf("ImportArchive failed: %v", err)
+		}
+		if report.Skipped != 1 {
+			t.Errorf("conflicts should be kept without Overwrite, got %+v", report)
+		}
+		if sessionID, _, _ := target.GetUserSession(42); sessionID != "ses_other" {
+			t.Errorf("existing entry should be kept, got %q", sessionID)
+		}
+	})
+}
+
+func TestStoreArchive_WritesAllOrNothing(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storeBackend) {
+		store, err := backend.open(backend.tempPath(t))
+		if err != nil {
+			t.Fatalf("Opening store failed: %v", err)
+		}
+		defer store.Close()
+
+		archive := &Archive{
+			Sessions:     []*SessionMeta{{SessionID: "ses_1", UserID: 42}},
+			UserSessions: []UserSessionRecord{{UserID: 42, SessionID: "ses_1"}},
+			Models:       []*ModelMeta{{Name: "No ID"}},
+		}
+		if err := store.StoreArchive(archive); err == nil {
+			t.Fatal("expected an archive with an invalid model to be refused")
+		}
+		if sessions, _ := store.ListSessions(); len(sessions) != 0 {
+			t.Errorf("a refused archive must not write anything, got %d sessions", len(sessions))
+		}
+		if _, exists, _ := store.GetUserSession(42); exists {
+			t.Error("a refused archive must not write anything")
+		}
+	})
+}
+
+func TestImportArchive_FailedSaveLeavesFileStoreUnchanged(t *testing.T) {
+	source, err := NewFileStore(createTempFile(t))
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	defer source.Close()
+	seedStore(t, source)
+	archive, err := ExportArchive(source)
+	if err != nil {
+		t.Fatalf("ExportArchive failed: %v", err)
+	}
+
+	path := createTempFile(t)
+	target, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	defer target.Close()
+	// A non-empty directory in place of the temporary file makes the save fail.
+	if err := os.MkdirAll(filepath.Join(path+".tmp", "busy"), 0700); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+
+	if report, err := ImportArchive(target, archive, ImportOptions{}); err == nil {
+		t.Fatalf("expected the import to fail, got %+v", report)
+	}
+	if sessions, _ := target.ListSessions(); len(sessions) != 0 {
+		t.Errorf("a failed import must leave the store unchanged, got %d sessions", len(sessions))
+	}
+	if _, exists, _ := target.GetUserSession(42); exists {
+		t.Error("a failed import must leave the store unchanged")
+	}
+}
+
+func TestReadArchive_RejectsNewerVersion(t *testing.T) {
+	for _, input := range []string{
+		`{"version": 99, "sessions": []}`,
+		`{"kind": "header", "version": 99}` + "\n",
+	} {
+		if _, err := ReadArchive(strings.NewReader(input)); err == nil || !strings.Contains(err.Error(), "newer") {
+			t.Errorf("expected a newer archive to be rejected, got %v for %s", err, input)
+		}
+	}
+	if _, err := ReadArchive(strings.NewReader(`{"sessions": []}`)); err == nil {
+		t.Error("expected an archive without version to be rejected")
+	}
+}
@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// encryptionScheme names the cipher in the envelope of an encrypted state file.
+const encryptionScheme = "aes-256-gcm"
+
+// encryptionAAD binds the ciphertext to its purpose, so a key shared with
+// another tool cannot be used to swap files between them.
+var encryptionAAD = []byte("tg-bot state")
+
+// encryptedEnvelope is the on-disk layout of an encrypted state file.
+type encryptedEnvelope struct {
+	Encryption string `json:"encryption"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// errNoKey is returned when an encrypted state file is opened without a key.
+var errNoKey = errors.New("state file is encrypted but no key is configured; set storage.encryption_key_env or storage.encryption_key_file")
+
+// encryptedMarkerPath is written next to a state file once it has been saved
+// encrypted. A plaintext file is then no longer accepted in its place.
+func encryptedMarkerPath(path string) string {
+	return path + ".encrypted"
+}
+
+// errPlaintextAfterEncryption is returned when a state file that was saved
+// encrypted has been replaced by a plaintext one.
+func errPlaintextAfterEncryption(path string) error {
+	return fmt.Errorf("state file %s is not encrypted although it was before; restore the encrypted file, or delete %s to encrypt this one",
+		path, encryptedMarkerPath(path))
+}
+
+// LoadKey reads a base64-encoded 32-byte key from the environment variable
+// envName or from keyFile. It returns nil when neither is set.
+func LoadKey(envName, keyFile string) ([]byte, error) {
+	var encoded string
+	switch {
+	case envName != "" && keyFile != "":
+		return nil, errors.New("set only one of the encryption key env var and key file")
+	case envName != "":
+		encoded = os.Getenv(envName)
+		if encoded == "" {
+			return nil, fmt.Errorf("encryption key env var %s is empty", envName)
+		}
+	case keyFile != "":
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read encryption key file: %w", err)
+		}
+		encoded = string(data)
+	default:
+		return nil, nil
+	}
+	return ParseKey(encoded)
+}
+
+// ParseKey decodes a base64-encoded AES-256 key, e.g. from `openssl rand -base64 32`.
+func ParseKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("encryption key is not valid base64: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// encryptState seals plaintext into an envelope.
+func encryptState(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return json.MarshalIndent(encryptedEnvelope{
+		Encryption: encryptionScheme,
+		Nonce:      nonce,
+		Ciphertext: gcm.Seal(nil, nonce, plaintext, encryptionAAD),
+	}, "", "  ")
+}
+
+// decryptState returns the plaintext of data. Data that is not an envelope is
+// returned as is; the caller decides whether a plaintext file is acceptable.
+func decryptState(key, data []byte) ([]byte, error) {
+	var envelope encryptedEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil || envelope.Encryption == "" {
+		return data, nil
+	}
+	if envelope.Encryption != encryptionScheme {
+		return nil, fmt.Errorf("unsupported state file encryption: %s", envelope.Encryption)
+	}
+	if key == nil {
+		return nil, errNoKey
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(envelope.Nonce) != gcm.NonceSize() {
+		return nil, errors.New("encrypted state file has an invalid nonce")
+	}
+	plaintext, err := gcm.Open(nil, envelope.Nonce, envelope.Ciphertext, encryptionAAD)
+	if err != nil {
+		return nil, errors.New("failed to decrypt state file: wrong key or corrupted file")
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// RekeyFile re-encrypts the state file at path from oldKey to newKey. Either
+// key may be nil for a plaintext file. The file is replaced atomically, but
+// nothing stops a running bot from saving over it with the old key, so the
+// bot must be stopped first.
+func RekeyFile(path string, oldKey, newKey []byte) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	store, err := newFileStore(path, oldKey)
+	if err != nil {
+		return err
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.key = newKey
+	if err := store.saveLocked(); err != nil {
+		return err
+	}
+	if newKey == nil {
+		if err := os.Remove(encryptedMarkerPath(path)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		store.encrypted = false
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testKey(fill byte) []byte {
+	return bytes.Repeat([]byte{fill}, 32)
+}
+
+func TestEncryptedFileStore_RoundTrip(t *testing.T) {
+	path := createTempFile(t)
+	key := testKey(1)
+
+	store, err := NewEncryptedFileStore(path, key)
+	if err != nil {
+		t.Fatalf("NewEncryptedFileStore failed: %v", err)
+	}
+	if err := store.StoreUserSession(424242, "ses_secret"); err != nil {
+		t.Fatalf("StoreUserSession failed: %v", err)
+	}
+	store.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read state file: %v", err)
+	}
+	if bytes.Contains(data, []byte("ses_secret")) || bytes.Contains(data, []byte("424242")) {
+		t.Fatal("state file should not contain cleartext session data")
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("state file should be private, got %v (err %v)", info.Mode().Perm(), err)
+	}
+
+	store, err = NewEncryptedFileStore(path, key)
+	if err != nil {
+		t.Fatalf("reopening encrypted store failed: %v", err)
+	}
+	defer store.Close()
+	if sessionID, exists, _ := store.GetUserSession(424242); !exists || sessionID != "ses_secret" {
+		t.Fatalf("expected the session to survive a reload, got %q exists=%v", sessionID, exists)
+	}
+}
+
+func TestEncryptedFileStore_RejectsWrongOrMissingKey(t *testing.T) {
+	path := createTempFile(t)
+	store, err := NewEncryptedFileStore(path, testKey(1))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileStore failed: %v", err)
+	}
+	store.StoreUserSession(1, "ses_1")
+	store.Close()
+
+	if _, err := NewEncryptedFileStore(path, testKey(2)); err == nil || !strings.Contains(err.Error(), "wrong key") {
+		t.Errorf("expected a wrong key to be rejected, got %v", err)
+	}
+	if _, err := NewFileStore(path); err == nil || !strings.Contains(err.Error(), "no key") {
+		t.Errorf("expected a missing key to be reported, got %v", err)
+	}
+}
+
+func TestEncryptedFileStore_EncryptsPlaintextFile(t *testing.T) {
+	path := createTempFile(t)
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	store.StoreUserSession(7, "ses_plain")
+	store.Close()
+
+	store, err = NewEncryptedFileStore(path, testKey(3))
+	if err != nil {
+		t.Fatalf("NewEncryptedFileStore failed: %v", err)
+	}
+	defer store.Close()
+
+	if data, _ := os.ReadFile(path); bytes.Contains(data, []byte("ses_plain")) {
+		t.Error("a plaintext file should be encrypted once a key is configured")
+	}
+	if sessionID, _, _ := store.GetUserSession(7); sessionID != "ses_plain" {
+		t.Errorf("expected the plaintext state to be kept, got %q", sessionID)
+	}
+
+	// Once encrypted, a plaintext file put in its place is refused.
+	if err := os.WriteFile(path, []byte(`{"version": 1, "user_sessions": {"7": "ses_swapped"}}`), 0600); err != nil {
+		t.Fatalf("failed to replace state file: %v", err)
+	}
+	if _, err := NewEncryptedFileStore(path, testKey(3)); err == nil || !strings.Contains(err.Error(), "not encrypted") {
+		t.Errorf("expected a plaintext file to be refused after encryption, got %v", err)
+	}
+}
+
+func TestEncryptedFileStore_EncryptsLegacyBackup(t *testing.T) {
+	path := createTempFile(t)
+	legacy := []byte(`{"user_sessions": {"42": "ses_legacy"}}`)
+	if err := os.WriteFile(path, legacy, 0600); err != nil {
+		t.Fatalf("failed to write legacy state: %v", err)
+	}
+	key := testKey(6)
+	store, err := NewEncryptedFileStore(path, key)
+	if err != nil {
+		t.Fatalf("NewEncryptedFileStore failed: %v", err)
+	}
+	store.Close()
+
+	backup, err := os.ReadFile(backupPath(path, 0))
+	if err != nil {
+		t.Fatalf("expected a backup of the legacy file: %v", err)
+	}
+	if bytes.Contains(backup, []byte("ses_legacy")) {
+		t.Fatal("backup should not contain cleartext session data when a key is set")
+	}
+	if plaintext, err := decryptState(key, backup); err != nil || string(plaintext) != string(legacy) {
+		t.Errorf("backup should decrypt to the legacy file, got %q (err %v)", plaintext, err)
+	}
+}
+
+func TestRekeyFile(t *testing.T) {
+	path := createTempFile(t)
+	oldKey, newKey := testKey(4), testKey(5)
+	store, err := NewEncryptedFileStore(path, oldKey)
+	if err != nil {
+		t.Fatalf("NewEncryptedFileStore failed: %v", err)
+	}
+	store.StoreUserSession(9, "ses_rekey")
+	store.Close()
+
+	if err := RekeyFile(path, oldKey, newKey); err != nil {
+		t.Fatalf("RekeyFile failed: %v", err)
+	}
+	if _, err := NewEncryptedFileStore(path, oldKey); err == nil {
+		t.Error("the old key should no longer open the file")
+	}
+	store, err = NewEncryptedFileStore(path, newKey)
+	if err != nil {
+		t.Fatalf("the new key should open the file: %v", err)
+	}
+	defer store.Close()
+	if sessionID, _, _ := store.GetUserSession(9); sessionID != "ses_rekey" {
+		t.Errorf("expected the state to survive rekeying, got %q", sessionID)
+	}
+
+	if err := RekeyFile(filepath.Join(t.TempDir(), "missing.json"), oldKey, newKey); err == nil {
+		t.Error("rekeying a missing file should fail")
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString(testKey(6))
+
+	t.Setenv("TG_BOT_TEST_KEY", encoded)
+	key, err := LoadKey("TG_BOT_TEST_KEY", "")
+	if err != nil || !bytes.Equal(key, testKey(6)) {
+		t.Fatalf("expected the key from the env var, got %v (err %v)", key, err)
+	}
+
+	keyFile := filepath.Join(t.TempDir(), "bot.key")
+	os.WriteFile(keyFile, []byte(encoded+"\n"), 0600)
+	if key, err := LoadKey("", keyFile); err != nil || !bytes.Equal(key, testKey(6)) {
+		t.Fatalf("expected the key from the key file, got %v (err %v)", key, err)
+	}
+
+	if key, err := LoadKey("", ""); key != nil || err != nil {
+		t.Errorf("no key source should mean no encryption, got %v (err %v)", key, err)
+	}
+	if _, err := LoadKey("TG_BOT_TEST_KEY", keyFile); err == nil {
+		t.Error("expected two key sources to be rejected")
+	}
+	if _, err := ParseKey(base64.StdEncoding.EncodeToString([]byte("short"))); err == nil {
+		t.Error("expected a short key to be rejected")
+	}
+}
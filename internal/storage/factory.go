@@ -6,13 +6,28 @@ import (
 
 // NewStore creates a new store based on options
 func NewStore(opts Options) (Store, error) {
-	// Only file storage is supported
-	storageType := opts.Type
-	if storageType == "" || storageType == "file" {
+	key, err := LoadKey(opts.KeyEnv, opts.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	switch opts.Type {
+	case "", "file":
 		if opts.FilePath == "" {
 			return nil, fmt.Errorf("file path is required for file storage")
 		}
+		if key != nil {
+			return NewEncryptedFileStore(opts.FilePath, key)
+		}
 		return NewFileStore(opts.FilePath)
+	case "sqlite":
+		if opts.FilePath == "" {
+			return nil, fmt.Errorf("file path is required for sqlite storage")
+		}
+		if key != nil {
+			return nil, fmt.Errorf("encryption is only supported for file storage")
+		}
+		return NewSQLiteStore(opts.FilePath)
 	}
-	return nil, fmt.Errorf("unsupported storage type: %s, only 'file' storage is supported", storageType)
+	return nil, fmt.Errorf("unsupported storage type: %s, must be 'file' or 'sqlite'", opts.Type)
 }
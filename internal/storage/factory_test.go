@@ -6,32 +6,33 @@ import (
 	"testing"
 )
 
-func TestNewStore_File(t *testing.T) {
-	tmpDir := t.TempDir()
-	path := filepath.Join(tmpDir, "test.json")
-	opts := Options{
-		Type:     "file",
-		FilePath: path,
-	}
-	store, err := NewStore(opts)
-	if err != nil {
-		t.Fatalf("NewStore failed for file type: %v", err)
-	}
-	if store == nil {
-		t.Fatal("NewStore should return non-nil store for file type")
-	}
-	defer store.Close()
+func TestNewStore(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storeBackend) {
+		path := backend.tempPath(t)
+		opts := Options{
+			Type:     backend.name,
+			FilePath: path,
+		}
+		store, err := NewStore(opts)
+		if err != nil {
+			t.Fatalf("NewStore failed for %s type: %v", backend.name, err)
+		}
+		if store == nil {
+			t.Fatalf("NewStore should return non-nil store for %s type", backend.name)
+		}
+		defer store.Close()
 
-	// Store something to ensure file is created
-	err = store.StoreUserSession(1, "test-session")
-	if err != nil {
-		t.Fatalf("StoreUserSession failed: %v", err)
-	}
+		// Store something to ensure file is created
+		err = store.StoreUserSession(1, "test-session")
+		if err != nil {
+			t.Fatalf("StoreUserSession failed: %v", err)
+		}
 
-	// Verify file created
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		t.Errorf("Storage file should be created at %s", path)
-	}
+		// Verify file created
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			t.Errorf("Storage file should be created at %s", path)
+		}
+	})
 }
 
 func TestNewStore_DefaultType(t *testing.T) {
@@ -51,19 +52,21 @@ func TestNewStore_DefaultType(t *testing.T) {
 	defer store.Close()
 }
 
-func TestNewStore_FileMissingPath(t *testing.T) {
-	opts := Options{
-		Type: "file",
-		// FilePath empty
-	}
-	store, err := NewStore(opts)
-	if err == nil {
-		t.Error("NewStore should return error for file type without path")
-	}
-	if store != nil {
-		t.Error("NewStore should return nil store on error")
-		store.Close()
-	}
+func TestNewStore_MissingPath(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storeBackend) {
+		opts := Options{
+			Type: backend.name,
+			// FilePath empty
+		}
+		store, err := NewStore(opts)
+		if err == nil {
+			t.Errorf("NewStore should return error for %s type without path", backend.name)
+		}
+		if store != nil {
+			t.Error("NewStore should return nil store on error")
+			store.Close()
+		}
+	})
 }
 
 func TestNewStore_InvalidType(t *testing.T) {
@@ -3,10 +3,13 @@ package storage
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
 	"strings"
 	"sync"
 	"time"
+
+	log "github.com/sirupsen/logrus"
 )
 
 // fileStore implements Store interface using JSON file storage
@@ -15,31 +18,58 @@ type fileStore struct {
 
 	// file path for storage
 	filePath string
+	// AES-256 key the file is encrypted with; nil stores plaintext
+	key []byte
+	// whether the marker recording an encrypted save exists
+	encrypted bool
 
 	// in-memory data
 	userSessions   map[int64]string
 	sessions       map[string]*SessionMeta
 	models         map[string]*ModelMeta
-	userLastModels map[int64]*modelPreference
+	userLastModels map[int64]*ModelPreference
+	chatRender     map[int64]string
+	cleaned        map[string]time.Time
 
 	// dirty flag to track changes
 	dirty bool
 }
 
-// modelPreference stores provider and model ID for a user
-type modelPreference struct {
-	ProviderID string `json:"providerID"`
-	ModelID    string `json:"modelID"`
+// stateFile is the on-disk layout of the JSON state file
+type stateFile struct {
+	Version        int                        `json:"version"`
+	UserSessions   map[int64]string           `json:"user_sessions"`
+	Sessions       map[string]*SessionMeta    `json:"sessions"`
+	Models         map[string]*ModelMeta      `json:"models,omitempty"`
+	UserLastModels map[int64]*ModelPreference `json:"user_last_models,omitempty"`
+	ChatRender     map[int64]string           `json:"chat_render_modes,omitempty"`
+	Cleaned        map[string]time.Time       `json:"cleaned_sessions,omitempty"`
 }
 
 // NewFileStore creates a new file-based store
 func NewFileStore(filePath string) (Store, error) {
+	return newFileStore(filePath, nil)
+}
+
+// NewEncryptedFileStore creates a file-based store encrypted with key. An
+// existing plaintext file is encrypted on load.
+func NewEncryptedFileStore(filePath string, key []byte) (Store, error) {
+	if _, err := newGCM(key); err != nil {
+		return nil, err
+	}
+	return newFileStore(filePath, key)
+}
+
+func newFileStore(filePath string, key []byte) (*fileStore, error) {
 	store := &fileStore{
 		filePath:       filePath,
+		key:            key,
 		userSessions:   make(map[int64]string),
 		sessions:       make(map[string]*SessionMeta),
 		models:         make(map[string]*ModelMeta),
-		userLastModels: make(map[int64]*modelPreference),
+		userLastModels: make(map[int64]*ModelPreference),
+		chatRender:     make(map[int64]string),
+		cleaned:        make(map[string]time.Time),
 		dirty:          false,
 	}
 
@@ -56,18 +86,38 @@ func (f *fileStore) load() error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	data, err := os.ReadFile(f.filePath)
+	raw, err := os.ReadFile(f.filePath)
 	if err != nil {
 		return err
 	}
+	data, err := decryptState(f.key, raw)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(encryptedMarkerPath(f.filePath)); err == nil {
+		f.encrypted = true
+	}
+	// A plaintext file is rewritten encrypted once a key is configured, but
+	// only the first time: afterwards it is a file that was swapped out
+	encrypt := f.key != nil && string(data) == string(raw)
+	if encrypt {
+		if f.encrypted {
+			return errPlaintextAfterEncryption(f.filePath)
+		}
+		log.Warnf("Storage file %s is not encrypted; encrypting it with the configured key", f.filePath)
+	}
 
-	var storedData struct {
-		UserSessions   map[int64]string           `json:"user_sessions"`
-		Sessions       map[string]*SessionMeta    `json:"sessions"`
-		Models         map[string]*ModelMeta      `json:"models,omitempty"`
-		UserLastModels map[int64]*modelPreference `json:"user_last_models,omitempty"`
+	// Bring older files up to date before decoding them
+	doc, migrated, err := migrateStateFile(f.filePath, f.key, raw, data)
+	if err != nil {
+		return err
+	}
+	data, err = json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to marshal migrated storage data: %w", err)
 	}
 
+	var storedData stateFile
 	if err := json.Unmarshal(data, &storedData); err != nil {
 		return fmt.Errorf("failed to unmarshal storage data: %w", err)
 	}
@@ -81,16 +131,33 @@ func (f *fileStore) load() error {
 		f.sessions = make(map[string]*SessionMeta)
 	}
 	f.models = storedData.Models
-	f.models = normalizeModelCache(storedData.Models)
+	if f.models == nil {
+		f.models = make(map[string]*ModelMeta)
+	}
 	f.userLastModels = storedData.UserLastModels
 	if f.userLastModels == nil {
-		f.userLastModels = make(map[int64]*modelPreference)
+		f.userLastModels = make(map[int64]*ModelPreference)
+	}
+	f.chatRender = storedData.ChatRender
+	if f.chatRender == nil {
+		f.chatRender = make(map[int64]string)
+	}
+	f.cleaned = storedData.Cleaned
+	if f.cleaned == nil {
+		f.cleaned = make(map[string]time.Time)
 	}
 	f.dirty = false
 
+	if migrated || encrypt {
+		if err := f.saveLocked(); err != nil {
+			return fmt.Errorf("failed to save migrated storage data: %w", err)
+		}
+	}
 	return nil
 }
 
+// normalizeModelCache re-keys models by ModelKey, keeping numbered entries
+// over unnumbered duplicates.
 func normalizeModelCache(raw map[string]*ModelMeta) map[string]*ModelMeta {
 	normalized := make(map[string]*ModelMeta)
 	if raw == nil {
@@ -141,26 +208,31 @@ func (f *fileStore) save() error {
 // saveLocked writes data to file without acquiring locks
 // Caller must hold at least a read lock
 func (f *fileStore) saveLocked() error {
-	storedData := struct {
-		UserSessions   map[int64]string           `json:"user_sessions"`
-		Sessions       map[string]*SessionMeta    `json:"sessions"`
-		Models         map[string]*ModelMeta      `json:"models,omitempty"`
-		UserLastModels map[int64]*modelPreference `json:"user_last_models,omitempty"`
-	}{
+	storedData := stateFile{
+		Version:        fileSchemaVersion(),
 		UserSessions:   f.userSessions,
 		Sessions:       f.sessions,
 		Models:         f.models,
 		UserLastModels: f.userLastModels,
+		ChatRender:     f.chatRender,
+		Cleaned:        f.cleaned,
 	}
 
 	data, err := json.MarshalIndent(storedData, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal storage data: %w", err)
 	}
+	if f.key != nil {
+		if data, err = encryptState(f.key, data); err != nil {
+			return fmt.Errorf("failed to encrypt storage data: %w", err)
+		}
+	}
 
-	// Write to temporary file first
+	// Write to temporary file first; the state names users and their
+	// sessions, so only the bot's user may read it
 	tmpPath := f.filePath + ".tmp"
-	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+	os.Remove(tmpPath)
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
 		return fmt.Errorf("failed to write temporary file: %w", err)
 	}
 
@@ -172,6 +244,12 @@ func (f *fileStore) saveLocked() error {
 	}
 
 	f.dirty = false
+	if f.key != nil && !f.encrypted {
+		if err := os.WriteFile(encryptedMarkerPath(f.filePath), nil, 0600); err != nil {
+			return fmt.Errorf("failed to write encryption marker: %w", err)
+		}
+		f.encrypted = true
+	}
 	return nil
 }
 
@@ -215,6 +293,7 @@ func (f *fileStore) StoreSessionMeta(meta *SessionMeta) error {
 	defer f.mu.Unlock()
 
 	f.sessions[meta.SessionID] = meta
+	delete(f.cleaned, meta.SessionID)
 	f.markDirty()
 	return f.saveLocked()
 }
@@ -234,6 +313,7 @@ func (f *fileStore) DeleteSessionMeta(sessionID string) error {
 
 	// Remove session metadata
 	delete(f.sessions, sessionID)
+	delete(f.cleaned, sessionID)
 
 	// Remove any user session mappings that reference this session
 	for userID, userSessionID := range f.userSessions {
@@ -275,8 +355,9 @@ func (f *fileStore) CleanupInactiveSessions(maxAge time.Duration) ([]string, err
 					break
 				}
 			}
-			// Remove session metadata
+			// Remove session metadata, remembering it was cleaned up
 			delete(f.sessions, sessionID)
+			f.cleaned[sessionID] = now
 			removed = append(removed, sessionID)
 		}
 	}
@@ -291,6 +372,18 @@ func (f *fileStore) CleanupInactiveSessions(maxAge time.Duration) ([]string, err
 	return removed, nil
 }
 
+// ListCleanedSessions returns the IDs of sessions CleanupInactiveSessions removed
+func (f *fileStore) ListCleanedSessions() ([]string, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	cleaned := make([]string, 0, len(f.cleaned))
+	for sessionID := range f.cleaned {
+		cleaned = append(cleaned, sessionID)
+	}
+	return cleaned, nil
+}
+
 // StoreModel stores model metadata
 func (f *fileStore) StoreModel(meta *ModelMeta) error {
 	f.mu.Lock()
@@ -379,7 +472,7 @@ func (f *fileStore) StoreUserLastModel(userID int64, providerID, modelID string)
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	f.userLastModels[userID] = &modelPreference{
+	f.userLastModels[userID] = &ModelPreference{
 		ProviderID: providerID,
 		ModelID:    modelID,
 	}
@@ -399,6 +492,117 @@ func (f *fileStore) GetUserLastModel(userID int64) (providerID, modelID string,
 	return pref.ProviderID, pref.ModelID, true, nil
 }
 
+// StoreChatRenderMode stores the render mode override of a chat.
+func (f *fileStore) StoreChatRenderMode(chatID int64, mode string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if mode == "" {
+		delete(f.chatRender, chatID)
+	} else {
+		f.chatRender[chatID] = mode
+	}
+	f.markDirty()
+	return f.saveLocked()
+}
+
+// GetChatRenderMode retrieves the render mode override of a chat.
+func (f *fileStore) GetChatRenderMode(chatID int64) (string, bool, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	mode, exists := f.chatRender[chatID]
+	return mode, exists, nil
+}
+
+// ListUserSessions returns all user-to-session mappings
+func (f *fileStore) ListUserSessions() (map[int64]string, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	sessions := make(map[int64]string, len(f.userSessions))
+	for userID, sessionID := range f.userSessions {
+		sessions[userID] = sessionID
+	}
+	return sessions, nil
+}
+
+// ListUserLastModels returns the model preference of every user
+func (f *fileStore) ListUserLastModels() (map[int64]ModelPreference, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	prefs := make(map[int64]ModelPreference, len(f.userLastModels))
+	for userID, pref := range f.userLastModels {
+		if pref != nil {
+			prefs[userID] = *pref
+		}
+	}
+	return prefs, nil
+}
+
+// ListChatRenderModes returns the render mode override of every chat
+func (f *fileStore) ListChatRenderModes() (map[int64]string, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	modes := make(map[int64]string, len(f.chatRender))
+	for chatID, mode := range f.chatRender {
+		modes[chatID] = mode
+	}
+	return modes, nil
+}
+
+// StoreArchive stores every entry of archive with a single save. If the save
+// fails, the store is left as it was.
+func (f *fileStore) StoreArchive(archive *Archive) error {
+	if err := archive.checkEntries(); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	userSessions, sessions, models := f.userSessions, f.sessions, f.models
+	userLastModels, chatRender, cleaned := f.userLastModels, f.chatRender, f.cleaned
+	f.userSessions = maps.Clone(userSessions)
+	f.sessions = maps.Clone(sessions)
+	f.models = maps.Clone(models)
+	f.userLastModels = maps.Clone(userLastModels)
+	f.chatRender = maps.Clone(chatRender)
+	f.cleaned = maps.Clone(cleaned)
+
+	for _, meta := range archive.Sessions {
+		f.sessions[meta.SessionID] = meta
+		delete(f.cleaned, meta.SessionID)
+	}
+	for _, r := range archive.UserSessions {
+		f.userSessions[r.UserID] = r.SessionID
+	}
+	for _, meta := range archive.Models {
+		f.models[ModelKey(meta.ProviderID, meta.ID)] = meta
+	}
+	for _, r := range archive.UserLastModels {
+		pref := r.ModelPreference
+		f.userLastModels[r.UserID] = &pref
+	}
+	for _, r := range archive.ChatRenderModes {
+		if r.Mode == "" {
+			delete(f.chatRender, r.ChatID)
+		} else {
+			f.chatRender[r.ChatID] = r.Mode
+		}
+	}
+
+	f.markDirty()
+	if err := f.saveLocked(); err != nil {
+		f.userSessions, f.sessions, f.models = userSessions, sessions, models
+		f.userLastModels, f.chatRender, f.cleaned = userLastModels, chatRender, cleaned
+		return err
+	}
+	return nil
+}
+
 // Close implements Store interface
 func (f *fileStore) Close() error {
 	// Save any pending changes
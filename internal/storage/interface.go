@@ -15,6 +15,8 @@ type SessionMeta struct {
 	MessageCount int
 	ProviderID   string
 	ModelID      string
+	Agent        string // empty means the OpenCode default agent
+	ParentID     string // session this one was forked from, if any
 	Status       string // "owned", "orphaned", "other"
 }
 
@@ -29,6 +31,12 @@ type ModelMeta struct {
 	ReleaseDate string `json:"release_date,omitempty"`
 }
 
+// ModelPreference is the model a user last picked
+type ModelPreference struct {
+	ProviderID string `json:"providerID"`
+	ModelID    string `json:"modelID"`
+}
+
 // ModelKey returns the canonical storage key for a provider/model pair.
 func ModelKey(providerID, modelID string) string {
 	providerID = strings.TrimSpace(providerID)
@@ -54,9 +62,12 @@ type Store interface {
 	GetSessionMeta(sessionID string) (*SessionMeta, bool, error)
 	DeleteSessionMeta(sessionID string) error
 
-	// Batch operations
+	// Batch operations. CleanupInactiveSessions remembers the sessions it
+	// removed, listed by ListCleanedSessions, until they are stored or
+	// deleted again
 	ListSessions() ([]*SessionMeta, error)
 	CleanupInactiveSessions(maxAge time.Duration) ([]string, error)
+	ListCleanedSessions() ([]string, error)
 
 	// ModelMeta operations
 	StoreModel(meta *ModelMeta) error
@@ -68,12 +79,30 @@ type Store interface {
 	StoreUserLastModel(userID int64, providerID, modelID string) error
 	GetUserLastModel(userID int64) (providerID, modelID string, exists bool, err error)
 
+	// ChatPreference operations; an empty mode removes the override
+	StoreChatRenderMode(chatID int64, mode string) error
+	GetChatRenderMode(chatID int64) (string, bool, error)
+
+	// Listing operations, used to export the whole state
+	ListUserSessions() (map[int64]string, error)
+	ListUserLastModels() (map[int64]ModelPreference, error)
+	ListChatRenderModes() (map[int64]string, error)
+
+	// StoreArchive stores every entry of archive at once: either all of
+	// them are written or, on error, none are
+	StoreArchive(archive *Archive) error
+
 	// Maintenance
 	Close() error
 }
 
 // Options contains configuration options for storage
 type Options struct {
-	Type     string // "file" (only file storage is supported)
-	FilePath string // path to JSON file for session storage
+	Type     string // "file" or "sqlite"
+	FilePath string // path to the JSON file or SQLite database
+
+	// Encrypt the JSON file with a base64 AES-256 key read from this
+	// environment variable or key file; at most one may be set
+	KeyEnv  string
+	KeyFile string
 }
@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// stateDocument is the raw JSON state file, keyed by top-level field.
+type stateDocument map[string]json.RawMessage
+
+// fileMigration upgrades a state file from version-1 to version.
+type fileMigration struct {
+	version     int
+	description string
+	apply       func(doc stateDocument) error
+}
+
+// fileMigrations are applied in order to state files older than the last one.
+// A file without a "version" field predates versioning and is version 0.
+var fileMigrations = []fileMigration{
+	{version: 1, description: "key models by provider/model", apply: migrateModelKeys},
+}
+
+// sqliteMigration upgrades a database from version-1 to version, tracked in
+// PRAGMA user_version.
+type sqliteMigration struct {
+	version     int
+	description string
+	apply       func(tx *sql.Tx) error
+}
+
+var sqliteMigrations = []sqliteMigration{
+	{version: 1, description: "initial schema", apply: func(tx *sql.Tx) error {
+		_, err := tx.Exec(sqliteSchema)
+		return err
+	}},
+	{version: 2, description: "remember cleaned sessions", apply: func(tx *sql.Tx) error {
+		_, err := tx.Exec(sqliteCleanedSessionsSchema)
+		return err
+	}},
+}
+
+// fileSchemaVersion is the state file version this build writes.
+func fileSchemaVersion() int {
+	return fileMigrations[len(fileMigrations)-1].version
+}
+
+// sqliteSchemaVersion is the database version this build writes.
+func sqliteSchemaVersion() int {
+	return sqliteMigrations[len(sqliteMigrations)-1].version
+}
+
+// newerSchemaError is returned for state written by a newer build, which this
+// one could silently corrupt.
+func newerSchemaError(path string, version, supported int) error {
+	return fmt.Errorf("%s has schema version %d, but this build supports up to version %d; upgrade the bot or restore a backup", path, version, supported)
+}
+
+// backupPath names the copy kept of a state file before migrating it.
+func backupPath(path string, version int) string {
+	return fmt.Sprintf("%s.v%d.bak", path, version)
+}
+
+// documentVersion reads the schema version of a state document.
+func documentVersion(doc stateDocument) (int, error) {
+	raw, ok := doc["version"]
+	if !ok {
+		return 0, nil
+	}
+	var version int
+	if err := json.Unmarshal(raw, &version); err != nil {
+		return 0, fmt.Errorf("invalid schema version: %w", err)
+	}
+	return version, nil
+}
+
+// migrateDocument upgrades doc from version to the current version. It
+// reports whether any migration ran.
+func migrateDocument(path string, doc stateDocument) (bool, error) {
+	version, err := documentVersion(doc)
+	if err != nil {
+		return false, err
+	}
+	if current := fileSchemaVersion(); version > current {
+		return false, newerSchemaError(path, version, current)
+	}
+
+	migrated := false
+	for _, m := range fileMigrations {
+		if m.version <= version {
+			continue
+		}
+		if err := m.apply(doc); err != nil {
+			return false, fmt.Errorf("migration to version %d (%s) failed: %w", m.version, m.description, err)
+		}
+		migrated = true
+	}
+	return migrated, nil
+}
+
+// migrateStateFile upgrades the JSON state in data to the current version.
+// The original file contents are copied aside before anything is changed,
+// encrypted with key if they were still plaintext; the caller writes the
+// migrated state back.
+func migrateStateFile(path string, key, original, data []byte) (stateDocument, bool, error) {
+	var doc stateDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, false, fmt.Errorf("failed to unmarshal storage data: %w", err)
+	}
+	if doc == nil {
+		doc = stateDocument{}
+	}
+
+	version, err := documentVersion(doc)
+	if err != nil {
+		return nil, false, err
+	}
+	if version < fileSchemaVersion() {
+		backup := original
+		if key != nil && string(original) == string(data) {
+			if backup, err = encryptState(key, original); err != nil {
+				return nil, false, fmt.Errorf("failed to encrypt storage backup: %w", err)
+			}
+		}
+		if err := os.WriteFile(backupPath(path, version), backup, 0600); err != nil {
+			return nil, false, fmt.Errorf("failed to back up storage file: %w", err)
+		}
+	}
+
+	migrated, err := migrateDocument(path, doc)
+	if err != nil {
+		return nil, false, err
+	}
+	return doc, migrated, nil
+}
+
+// migrateModelKeys re-keys the model cache by ModelKey, as older files keyed
+// it by model ID alone.
+func migrateModelKeys(doc stateDocument) error {
+	raw, ok := doc["models"]
+	if !ok {
+		return nil
+	}
+	var models map[string]*ModelMeta
+	if err := json.Unmarshal(raw, &models); err != nil {
+		return err
+	}
+	normalized, err := json.Marshal(normalizeModelCache(models))
+	if err != nil {
+		return err
+	}
+	doc["models"] = normalized
+	return nil
+}
+
+// migrateSQLite upgrades the database to the current version, taking a copy
+// of an existing database first.
+func migrateSQLite(db *sql.DB, path string) error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	current := sqliteSchemaVersion()
+	if version > current {
+		return newerSchemaError(path, version, current)
+	}
+	if version == current {
+		return nil
+	}
+	if version > 0 {
+		os.Remove(backupPath(path, version))
+		if _, err := db.Exec(`VACUUM INTO ?`, backupPath(path, version)); err != nil {
+			return fmt.Errorf("failed to back up database: %w", err)
+		}
+	}
+
+	for _, m := range sqliteMigrations {
+		if m.version <= version {
+			continue
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin migration: %w", err)
+		}
+		if err := m.apply(tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration to version %d (%s) failed: %w", m.version, m.description, err)
+		}
+		// PRAGMA does not take parameters; the version is a trusted integer.
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, m.version)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record schema version %d: %w", m.version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration to version %d: %w", m.version, err)
+		}
+	}
+	return nil
+}
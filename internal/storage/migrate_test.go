@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileStore_MigratesLegacyState(t *testing.T) {
+	path := createTempFile(t)
+	legacy := []byte(`{
+  "user_sessions": {"42": "ses_1"},
+  "sessions": {"ses_1": {"SessionID": "ses_1", "UserID": 42, "Name": "Old"}},
+  "models": {
+    "deepseek/deepseek-chat": {"providerID": "deepseek", "name": "DeepSeek Chat"},
+    "gpt-4o": {"id": "gpt-4o", "number": 3, "providerID": "openai", "name": "GPT-4o"}
+  }
+}`)
+	if err := os.WriteFile(path, legacy, 0644); err != nil {
+		t.Fatalf("failed to write legacy state: %v", err)
+	}
+
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	defer store.Close()
+
+	if meta, exists, _ := store.GetModel("deepseek", "deepseek-chat"); !exists || meta.ID != "deepseek-chat" {
+		t.Errorf("legacy model key should be migrated, got %+v exists=%v", meta, exists)
+	}
+	if meta, exists, _ := store.GetModel("openai", "gpt-4o"); !exists || meta.Number != 3 {
+		t.Errorf("model keyed by ID should be re-keyed, got %+v exists=%v", meta, exists)
+	}
+	if sessionID, exists, _ := store.GetUserSession(42); !exists || sessionID != "ses_1" {
+		t.Errorf("user session should survive the migration, got %q exists=%v", sessionID, exists)
+	}
+
+	backup, err := os.ReadFile(backupPath(path, 0))
+	if err != nil {
+		t.Fatalf("expected a backup of the legacy file: %v", err)
+	}
+	if string(backup) != string(legacy) {
+		t.Error("backup should hold the file as it was before migrating")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read migrated state: %v", err)
+	}
+	var doc struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil || doc.Version != fileSchemaVersion() {
+		t.Errorf("migrated file should record version %d, got %d (err %v)", fileSchemaVersion(), doc.Version, err)
+	}
+}
+
+func TestFileStore_CurrentStateIsNotBackedUp(t *testing.T) {
+	path := createTempFile(t)
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	store.StoreUserSession(1, "ses_1")
+	store.Close()
+
+	store, err = NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore failed on reload: %v", err)
+	}
+	defer store.Close()
+
+	matches, _ := filepath.Glob(path + ".v*.bak")
+	if len(matches) != 0 {
+		t.Errorf("an up-to-date file should not be backed up, found %v", matches)
+	}
+}
+
+func TestFileStore_RefusesNewerVersion(t *testing.T) {
+	path := createTempFile(t)
+	newer := fmt.Sprintf(`{"version": %d, "user_sessions": {}, "sessions": {}}`, fileSchemaVersion()+1)
+	if err := os.WriteFile(path, []byte(newer), 0644); err != nil {
+		t.Fatalf("failed to write state: %v", err)
+	}
+
+	store, err := NewFileStore(path)
+	if err == nil {
+		store.Close()
+		t.Fatal("expected a state file from a newer build to be rejected")
+	}
+	if !strings.Contains(err.Error(), "schema version") {
+		t.Errorf("error should explain the version mismatch, got %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != newer {
+		t.Error("a rejected state file must be left untouched")
+	}
+}
+
+func TestSQLiteStore_SchemaVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore failed: %v", err)
+	}
+	store.Close()
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		t.Fatalf("failed to read version: %v", err)
+	}
+	if version != sqliteSchemaVersion() {
+		t.Errorf("expected schema version %d, got %d", sqliteSchemaVersion(), version)
+	}
+	if _, err := db.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, sqliteSchemaVersion()+1)); err != nil {
+		t.Fatalf("failed to bump version: %v", err)
+	}
+	db.Close()
+
+	store, err = NewSQLiteStore(path)
+	if err == nil {
+		store.Close()
+		t.Fatal("expected a database from a newer build to be rejected")
+	}
+	if !strings.Contains(err.Error(), "schema version") {
+		t.Errorf("error should explain the version mismatch, got %v", err)
+	}
+}
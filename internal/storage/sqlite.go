@@ -0,0 +1,576 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the pure-Go "sqlite" driver
+)
+
+// sqliteSchema is the version 1 schema. Times are stored as Unix
+// nanoseconds, with 0 for the zero time.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS user_sessions (
+	user_id    INTEGER PRIMARY KEY,
+	session_id TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_user_sessions_session ON user_sessions(session_id);
+
+CREATE TABLE IF NOT EXISTS sessions (
+	session_id    TEXT PRIMARY KEY,
+	user_id       INTEGER NOT NULL DEFAULT 0,
+	name          TEXT NOT NULL DEFAULT '',
+	created_at    INTEGER NOT NULL DEFAULT 0,
+	last_used_at  INTEGER NOT NULL DEFAULT 0,
+	message_count INTEGER NOT NULL DEFAULT 0,
+	provider_id   TEXT NOT NULL DEFAULT '',
+	model_id      TEXT NOT NULL DEFAULT '',
+	agent         TEXT NOT NULL DEFAULT '',
+	parent_id     TEXT NOT NULL DEFAULT '',
+	status        TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_last_used ON sessions(last_used_at);
+
+CREATE TABLE IF NOT EXISTS models (
+	provider_id  TEXT NOT NULL,
+	model_id     TEXT NOT NULL,
+	number       INTEGER NOT NULL DEFAULT 0,
+	name         TEXT NOT NULL DEFAULT '',
+	family       TEXT NOT NULL DEFAULT '',
+	status       TEXT NOT NULL DEFAULT '',
+	release_date TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (provider_id, model_id)
+);
+CREATE INDEX IF NOT EXISTS idx_models_model ON models(model_id);
+
+CREATE TABLE IF NOT EXISTS user_last_models (
+	user_id     INTEGER PRIMARY KEY,
+	provider_id TEXT NOT NULL,
+	model_id    TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS chat_render_modes (
+	chat_id INTEGER PRIMARY KEY,
+	mode    TEXT NOT NULL
+);
+`
+
+// sqliteCleanedSessionsSchema is added in version 2: sessions removed by
+// CleanupInactiveSessions, so they are not picked up again.
+const sqliteCleanedSessionsSchema = `
+CREATE TABLE IF NOT EXISTS cleaned_sessions (
+	session_id TEXT PRIMARY KEY,
+	cleaned_at INTEGER NOT NULL
+);
+`
+
+const sessionColumns = `session_id, user_id, name, created_at, last_used_at, message_count,
+	provider_id, model_id, agent, parent_id, status`
+
+// sqliteStore implements Store interface using a SQLite database
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens or creates the SQLite database at filePath
+func NewSQLiteStore(filePath string) (Store, error) {
+	dsn := "file:" + filePath + "?" + url.Values{
+		"_pragma": {"busy_timeout(5000)", "journal_mode(WAL)"},
+	}.Encode()
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	// SQLite allows a single writer; one connection serializes writes without
+	// SQLITE_BUSY errors between the bot's goroutines.
+	db.SetMaxOpenConns(1)
+
+	if err := migrateSQLite(db, filePath); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+// withTx runs fn in a transaction, committing only if it succeeds
+func (s *sqliteStore) withTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func timeToUnixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func unixNanoToTime(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSessionMeta(row rowScanner) (*SessionMeta, error) {
+	var meta SessionMeta
+	var createdAt, lastUsedAt int64
+	if err := row.Scan(&meta.SessionID, &meta.UserID, &meta.Name, &createdAt, &lastUsedAt, &meta.MessageCount,
+		&meta.ProviderID, &meta.ModelID, &meta.Agent, &meta.ParentID, &meta.Status); err != nil {
+		return nil, err
+	}
+	meta.CreatedAt = unixNanoToTime(createdAt)
+	meta.LastUsedAt = unixNanoToTime(lastUsedAt)
+	return &meta, nil
+}
+
+func scanModelMeta(row rowScanner) (*ModelMeta, error) {
+	var meta ModelMeta
+	if err := row.Scan(&meta.ProviderID, &meta.ID, &meta.Number, &meta.Name, &meta.Family, &meta.Status, &meta.ReleaseDate); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// execer is a *sql.DB or a *sql.Tx, so single writes and StoreArchive share
+// their statements.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// StoreUserSession stores a user-to-session mapping
+func (s *sqliteStore) StoreUserSession(userID int64, sessionID string) error {
+	return storeUserSession(s.db, userID, sessionID)
+}
+
+func storeUserSession(db execer, userID int64, sessionID string) error {
+	_, err := db.Exec(`INSERT INTO user_sessions (user_id, session_id) VALUES (?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET session_id = excluded.session_id`, userID, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to store user session: %w", err)
+	}
+	return nil
+}
+
+// GetUserSession retrieves a session ID for a user
+func (s *sqliteStore) GetUserSession(userID int64) (string, bool, error) {
+	var sessionID string
+	err := s.db.QueryRow(`SELECT session_id FROM user_sessions WHERE user_id = ?`, userID).Scan(&sessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get user session: %w", err)
+	}
+	return sessionID, true, nil
+}
+
+// DeleteUserSession removes a user-to-session mapping
+func (s *sqliteStore) DeleteUserSession(userID int64) error {
+	if _, err := s.db.Exec(`DELETE FROM user_sessions WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to delete user session: %w", err)
+	}
+	return nil
+}
+
+// StoreSessionMeta stores session metadata
+func (s *sqliteStore) StoreSessionMeta(meta *SessionMeta) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		return storeSessionMeta(tx, meta)
+	})
+}
+
+func storeSessionMeta(db execer, meta *SessionMeta) error {
+	if meta == nil {
+		return fmt.Errorf("session metadata is nil")
+	}
+	_, err := db.Exec(`INSERT OR REPLACE INTO sessions (`+sessionColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		meta.SessionID, meta.UserID, meta.Name, timeToUnixNano(meta.CreatedAt), timeToUnixNano(meta.LastUsedAt),
+		meta.MessageCount, meta.ProviderID, meta.ModelID, meta.Agent, meta.ParentID, meta.Status)
+	if err != nil {
+		return fmt.Errorf("failed to store session metadata: %w", err)
+	}
+	if _, err := db.Exec(`DELETE FROM cleaned_sessions WHERE session_id = ?`, meta.SessionID); err != nil {
+		return fmt.Errorf("failed to store session metadata: %w", err)
+	}
+	return nil
+}
+
+// GetSessionMeta retrieves session metadata
+func (s *sqliteStore) GetSessionMeta(sessionID string) (*SessionMeta, bool, error) {
+	meta, err := scanSessionMeta(s.db.QueryRow(`SELECT `+sessionColumns+` FROM sessions WHERE session_id = ?`, sessionID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get session metadata: %w", err)
+	}
+	return meta, true, nil
+}
+
+// DeleteSessionMeta removes session metadata and any user mappings to it
+func (s *sqliteStore) DeleteSessionMeta(sessionID string) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM sessions WHERE session_id = ?`, sessionID); err != nil {
+			return fmt.Errorf("failed to delete session metadata: %w", err)
+		}
+		if _, err := tx.Exec(`DELETE FROM user_sessions WHERE session_id = ?`, sessionID); err != nil {
+			return fmt.Errorf("failed to delete user sessions: %w", err)
+		}
+		if _, err := tx.Exec(`DELETE FROM cleaned_sessions WHERE session_id = ?`, sessionID); err != nil {
+			return fmt.Errorf("failed to delete cleaned session: %w", err)
+		}
+		return nil
+	})
+}
+
+// ListSessions returns all session metadata
+func (s *sqliteStore) ListSessions() ([]*SessionMeta, error) {
+	rows, err := s.db.Query(`SELECT ` + sessionColumns + ` FROM sessions`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := make([]*SessionMeta, 0)
+	for rows.Next() {
+		meta, err := scanSessionMeta(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read session: %w", err)
+		}
+		sessions = append(sessions, meta)
+	}
+	return sessions, rows.Err()
+}
+
+// CleanupInactiveSessions removes sessions that haven't been used for a while
+func (s *sqliteStore) CleanupInactiveSessions(maxAge time.Duration) ([]string, error) {
+	now := time.Now()
+	cutoff := now.Add(-maxAge).UnixNano()
+	var removed []string
+	err := s.withTx(func(tx *sql.Tx) error {
+		rows, err := tx.Query(`SELECT session_id FROM sessions WHERE last_used_at < ?`, cutoff)
+		if err != nil {
+			return fmt.Errorf("failed to find inactive sessions: %w", err)
+		}
+		for rows.Next() {
+			var sessionID string
+			if err := rows.Scan(&sessionID); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to read inactive session: %w", err)
+			}
+			removed = append(removed, sessionID)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to find inactive sessions: %w", err)
+		}
+
+		for _, sessionID := range removed {
+			if _, err := tx.Exec(`DELETE FROM user_sessions WHERE session_id = ?`, sessionID); err != nil {
+				return fmt.Errorf("failed to delete user sessions: %w", err)
+			}
+			if _, err := tx.Exec(`DELETE FROM sessions WHERE session_id = ?`, sessionID); err != nil {
+				return fmt.Errorf("failed to delete session metadata: %w", err)
+			}
+			if _, err := tx.Exec(`INSERT OR REPLACE INTO cleaned_sessions (session_id, cleaned_at) VALUES (?, ?)`,
+				sessionID, now.UnixNano()); err != nil {
+				return fmt.Errorf("failed to record cleaned session: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
+
+// ListCleanedSessions returns the IDs of sessions CleanupInactiveSessions removed
+func (s *sqliteStore) ListCleanedSessions() ([]string, error) {
+	rows, err := s.db.Query(`SELECT session_id FROM cleaned_sessions`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cleaned sessions: %w", err)
+	}
+	defer rows.Close()
+
+	cleaned := make([]string, 0)
+	for rows.Next() {
+		var sessionID string
+		if err := rows.Scan(&sessionID); err != nil {
+			return nil, fmt.Errorf("failed to read cleaned session: %w", err)
+		}
+		cleaned = append(cleaned, sessionID)
+	}
+	return cleaned, rows.Err()
+}
+
+// StoreModel stores model metadata
+func (s *sqliteStore) StoreModel(meta *ModelMeta) error {
+	return storeModel(s.db, meta)
+}
+
+func storeModel(db execer, meta *ModelMeta) error {
+	if meta == nil {
+		return fmt.Errorf("model metadata is nil")
+	}
+	if ModelKey(meta.ProviderID, meta.ID) == "" {
+		return fmt.Errorf("model key is empty")
+	}
+	_, err := db.Exec(`INSERT OR REPLACE INTO models (provider_id, model_id, number, name, family, status, release_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		strings.TrimSpace(meta.ProviderID), strings.TrimSpace(meta.ID), meta.Number, meta.Name, meta.Family, meta.Status, meta.ReleaseDate)
+	if err != nil {
+		return fmt.Errorf("failed to store model: %w", err)
+	}
+	return nil
+}
+
+// GetModel retrieves model metadata
+func (s *sqliteStore) GetModel(providerID, modelID string) (*ModelMeta, bool, error) {
+	const query = `SELECT provider_id, model_id, number, name, family, status, release_date FROM models`
+	providerID = strings.TrimSpace(providerID)
+	modelID = strings.TrimSpace(modelID)
+
+	meta, err := scanModelMeta(s.db.QueryRow(query+` WHERE provider_id = ? AND model_id = ?`, providerID, modelID))
+	if err == nil {
+		return meta, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, fmt.Errorf("failed to get model: %w", err)
+	}
+
+	// Backward-compatible lookup: if providerID is unknown, find unique modelID match.
+	if providerID != "" || modelID == "" {
+		return nil, false, nil
+	}
+	rows, err := s.db.Query(query+` WHERE model_id = ? LIMIT 2`, modelID)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get model: %w", err)
+	}
+	defer rows.Close()
+
+	var matched []*ModelMeta
+	for rows.Next() {
+		meta, err := scanModelMeta(rows)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read model: %w", err)
+		}
+		matched = append(matched, meta)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("failed to get model: %w", err)
+	}
+	if len(matched) != 1 {
+		return nil, false, nil
+	}
+	return matched[0], true, nil
+}
+
+// ListModels returns all model metadata
+func (s *sqliteStore) ListModels() ([]*ModelMeta, error) {
+	rows, err := s.db.Query(`SELECT provider_id, model_id, number, name, family, status, release_date FROM models`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list models: %w", err)
+	}
+	defer rows.Close()
+
+	models := make([]*ModelMeta, 0)
+	for rows.Next() {
+		meta, err := scanModelMeta(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read model: %w", err)
+		}
+		models = append(models, meta)
+	}
+	return models, rows.Err()
+}
+
+// DeleteModel removes model metadata
+func (s *sqliteStore) DeleteModel(providerID, modelID string) error {
+	_, err := s.db.Exec(`DELETE FROM models WHERE provider_id = ? AND model_id = ?`,
+		strings.TrimSpace(providerID), strings.TrimSpace(modelID))
+	if err != nil {
+		return fmt.Errorf("failed to delete model: %w", err)
+	}
+	return nil
+}
+
+// StoreUserLastModel stores the current model preference for a user.
+func (s *sqliteStore) StoreUserLastModel(userID int64, providerID, modelID string) error {
+	return storeUserLastModel(s.db, userID, providerID, modelID)
+}
+
+func storeUserLastModel(db execer, userID int64, providerID, modelID string) error {
+	_, err := db.Exec(`INSERT INTO user_last_models (user_id, provider_id, model_id) VALUES (?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET provider_id = excluded.provider_id, model_id = excluded.model_id`,
+		userID, providerID, modelID)
+	if err != nil {
+		return fmt.Errorf("failed to store user model: %w", err)
+	}
+	return nil
+}
+
+// GetUserLastModel retrieves the current model preference for a user.
+func (s *sqliteStore) GetUserLastModel(userID int64) (providerID, modelID string, exists bool, err error) {
+	err = s.db.QueryRow(`SELECT provider_id, model_id FROM user_last_models WHERE user_id = ?`, userID).Scan(&providerID, &modelID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", false, nil
+	}
+	if err != nil {
+		return "", "", false, fmt.Errorf("failed to get user model: %w", err)
+	}
+	return providerID, modelID, true, nil
+}
+
+// StoreChatRenderMode stores the render mode override of a chat.
+func (s *sqliteStore) StoreChatRenderMode(chatID int64, mode string) error {
+	return storeChatRenderMode(s.db, chatID, mode)
+}
+
+func storeChatRenderMode(db execer, chatID int64, mode string) error {
+	var err error
+	if mode == "" {
+		_, err = db.Exec(`DELETE FROM chat_render_modes WHERE chat_id = ?`, chatID)
+	} else {
+		_, err = db.Exec(`INSERT INTO chat_render_modes (chat_id, mode) VALUES (?, ?)
+			ON CONFLICT(chat_id) DO UPDATE SET mode = excluded.mode`, chatID, mode)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store chat render mode: %w", err)
+	}
+	return nil
+}
+
+// GetChatRenderMode retrieves the render mode override of a chat.
+func (s *sqliteStore) GetChatRenderMode(chatID int64) (string, bool, error) {
+	var mode string
+	err := s.db.QueryRow(`SELECT mode FROM chat_render_modes WHERE chat_id = ?`, chatID).Scan(&mode)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get chat render mode: %w", err)
+	}
+	return mode, true, nil
+}
+
+// ListUserSessions returns all user-to-session mappings
+func (s *sqliteStore) ListUserSessions() (map[int64]string, error) {
+	rows, err := s.db.Query(`SELECT user_id, session_id FROM user_sessions`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := make(map[int64]string)
+	for rows.Next() {
+		var userID int64
+		var sessionID string
+		if err := rows.Scan(&userID, &sessionID); err != nil {
+			return nil, fmt.Errorf("failed to read user session: %w", err)
+		}
+		sessions[userID] = sessionID
+	}
+	return sessions, rows.Err()
+}
+
+// ListUserLastModels returns the model preference of every user
+func (s *sqliteStore) ListUserLastModels() (map[int64]ModelPreference, error) {
+	rows, err := s.db.Query(`SELECT user_id, provider_id, model_id FROM user_last_models`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user models: %w", err)
+	}
+	defer rows.Close()
+
+	prefs := make(map[int64]ModelPreference)
+	for rows.Next() {
+		var userID int64
+		var pref ModelPreference
+		if err := rows.Scan(&userID, &pref.ProviderID, &pref.ModelID); err != nil {
+			return nil, fmt.Errorf("failed to read user model: %w", err)
+		}
+		prefs[userID] = pref
+	}
+	return prefs, rows.Err()
+}
+
+// ListChatRenderModes returns the render mode override of every chat
+func (s *sqliteStore) ListChatRenderModes() (map[int64]string, error) {
+	rows, err := s.db.Query(`SELECT chat_id, mode FROM chat_render_modes`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chat render modes: %w", err)
+	}
+	defer rows.Close()
+
+	modes := make(map[int64]string)
+	for rows.Next() {
+		var chatID int64
+		var mode string
+		if err := rows.Scan(&chatID, &mode); err != nil {
+			return nil, fmt.Errorf("failed to read chat render mode: %w", err)
+		}
+		modes[chatID] = mode
+	}
+	return modes, rows.Err()
+}
+
+// StoreArchive stores every entry of archive in one transaction.
+func (s *sqliteStore) StoreArchive(archive *Archive) error {
+	if err := archive.checkEntries(); err != nil {
+		return err
+	}
+	return s.withTx(func(tx *sql.Tx) error {
+		for _, meta := range archive.Sessions {
+			if err := storeSessionMeta(tx, meta); err != nil {
+				return err
+			}
+		}
+		for _, r := range archive.UserSessions {
+			if err := storeUserSession(tx, r.UserID, r.SessionID); err != nil {
+				return err
+			}
+		}
+		for _, meta := range archive.Models {
+			if err := storeModel(tx, meta); err != nil {
+				return err
+			}
+		}
+		for _, r := range archive.UserLastModels {
+			if err := storeUserLastModel(tx, r.UserID, r.ProviderID, r.ModelID); err != nil {
+				return err
+			}
+		}
+		for _, r := range archive.ChatRenderModes {
+			if err := storeChatRenderMode(tx, r.ChatID, r.Mode); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Close implements Store interface
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,724 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// storeBackend is a Store implementation the conformance tests run against.
+type storeBackend struct {
+	name string // storage type, as in Options.Type
+	ext  string
+	open func(path string) (Store, error)
+}
+
+var storeBackends = []storeBackend{
+	{name: "file", ext: ".json", open: NewFileStore},
+	{name: "sqlite", ext: ".db", open: NewSQLiteStore},
+}
+
+func (b storeBackend) tempPath(t *testing.T) string {
+	return filepath.Join(t.TempDir(), "test-storage"+b.ext)
+}
+
+// forEachBackend runs fn as a subtest for every Store implementation.
+func forEachBackend(t *testing.T, fn func(t *testing.T, backend storeBackend)) {
+	for _, backend := range storeBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			fn(t, backend)
+		})
+	}
+}
+
+func TestStore_LoadExisting(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storeBackend) {
+		path := backend.tempPath(t)
+
+		// Create initial store and add data
+		store1, err := backend.open(path)
+		if err != nil {
+			t.Fatalf("Opening store failed: %v", err)
+		}
+		meta := &SessionMeta{
+			SessionID: "session-123",
+			UserID:    12345,
+			Name:      "Test Session",
+		}
+		err = store1.StoreSessionMeta(meta)
+		if err != nil {
+			t.Fatalf("StoreSessionMeta failed: %v", err)
+		}
+		err = store1.StoreUserSession(12345, "session-123")
+		if err != nil {
+			t.Fatalf("StoreUserSession failed: %v", err)
+		}
+		store1.Close()
+
+		// Create new store that loads existing data
+		store2, err := backend.open(path)
+		if err != nil {
+			t.Fatalf("Reopening store failed: %v", err)
+		}
+		defer store2.Close()
+
+		// Verify data persisted
+		sessionID, exists, err := store2.GetUserSession(12345)
+		if err != nil {
+			t.Fatalf("GetUserSession failed: %v", err)
+		}
+		if !exists {
+			t.Error("User session should exist after reload")
+		}
+		if sessionID != "session-123" {
+			t.Errorf("Expected session ID 'session-123', got %s", sessionID)
+		}
+
+		meta2, exists, err := store2.GetSessionMeta("session-123")
+		if err != nil {
+			t.Fatalf("GetSessionMeta failed: %v", err)
+		}
+		if !exists {
+			t.Error("Session meta should exist after reload")
+		}
+		if meta2.Name != "Test Session" {
+			t.Errorf("Expected session name 'Test Session', got %s", meta2.Name)
+		}
+	})
+}
+
+func TestStore_StoreUserSession(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storeBackend) {
+		path := backend.tempPath(t)
+		store, err := backend.open(path)
+		if err != nil {
+			t.Fatalf("Opening store failed: %v", err)
+		}
+		defer store.Close()
+
+		userID := int64(12345)
+		sessionID := "session-123"
+
+		err = store.StoreUserSession(userID, sessionID)
+		if err != nil {
+			t.Fatalf("StoreUserSession failed: %v", err)
+		}
+
+		// Retrieve and verify
+		retrievedID, exists, err := store.GetUserSession(userID)
+		if err != nil {
+			t.Fatalf("GetUserSession failed: %v", err)
+		}
+		if !exists {
+			t.Error("GetUserSession should return exists = true")
+		}
+		if retrievedID != sessionID {
+			t.Errorf("Expected session ID %s, got %s", sessionID, retrievedID)
+		}
+	})
+}
+
+func TestStore_GetUserSession_NonExistent(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storeBackend) {
+		path := backend.tempPath(t)
+		store, err := backend.open(path)
+		if err != nil {
+			t.Fatalf("Opening store failed: %v", err)
+		}
+		defer store.Close()
+
+		userID := int64(99999)
+
+		sessionID, exists, err := store.GetUserSession(userID)
+		if err != nil {
+			t.Fatalf("GetUserSession failed: %v", err)
+		}
+		if exists {
+			t.Error("GetUserSession should return exists = false for non-existent user")
+		}
+		if sessionID != "" {
+			t.Errorf("Expected empty session ID, got %s", sessionID)
+		}
+	})
+}
+
+func TestStore_DeleteUserSession(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storeBackend) {
+		path := backend.tempPath(t)
+		store, err := backend.open(path)
+		if err != nil {
+			t.Fatalf("Opening store failed: %v", err)
+		}
+		defer store.Close()
+
+		userID := int64(12345)
+		sessionID := "session-123"
+
+		// Store then delete
+		err = store.StoreUserSession(userID, sessionID)
+		if err != nil {
+			t.Fatalf("StoreUserSession failed: %v", err)
+		}
+
+		err = store.DeleteUserSession(userID)
+		if err != nil {
+			t.Fatalf("DeleteUserSession failed: %v", err)
+		}
+
+		// Verify deleted
+		_, exists, err := store.GetUserSession(userID)
+		if err != nil {
+			t.Fatalf("GetUserSession failed: %v", err)
+		}
+		if exists {
+			t.Error("User session should be deleted")
+		}
+	})
+}
+
+func TestStore_StoreSessionMeta(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storeBackend) {
+		path := backend.tempPath(t)
+		store, err := backend.open(path)
+		if err != nil {
+			t.Fatalf("Opening store failed: %v", err)
+		}
+		defer store.Close()
+
+		meta := &SessionMeta{
+			SessionID:    "session-123",
+			UserID:       12345,
+			Name:         "Test Session",
+			CreatedAt:    time.Now(),
+			LastUsedAt:   time.Now(),
+			MessageCount: 5,
+			ProviderID:   "provider1",
+			ModelID:      "model1",
+			Status:       "owned",
+		}
+
+		err = store.StoreSessionMeta(meta)
+		if err != nil {
+			t.Fatalf("StoreSessionMeta failed: %v", err)
+		}
+
+		// Retrieve and verify
+		retrievedMeta, exists, err := store.GetSessionMeta(meta.SessionID)
+		if err != nil {
+			t.Fatalf("GetSessionMeta failed: %v", err)
+		}
+		if !exists {
+			t.Error("GetSessionMeta should return exists = true")
+		}
+		if retrievedMeta.SessionID != meta.SessionID {
+			t.Errorf("SessionID mismatch: expected %s, got %s", meta.SessionID, retrievedMeta.SessionID)
+		}
+		if retrievedMeta.UserID != meta.UserID {
+			t.Errorf("UserID mismatch: expected %d, got %d", meta.UserID, retrievedMeta.UserID)
+		}
+		if retrievedMeta.Name != meta.Name {
+			t.Errorf("Name mismatch: expected %s, got %s", meta.Name, retrievedMeta.Name)
+		}
+	})
+}
+
+func TestStore_GetSessionMeta_NonExistent(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storeBackend) {
+		path := backend.tempPath(t)
+		store, err := backend.open(path)
+		if err != nil {
+			t.Fatalf("Opening store failed: %v", err)
+		}
+		defer store.Close()
+
+		meta, exists, err := store.GetSessionMeta("non-existent")
+		if err != nil {
+			t.Fatalf("GetSessionMeta failed: %v", err)
+		}
+		if exists {
+			t.Error("GetSessionMeta should return exists = false for non-existent session")
+		}
+		if meta != nil {
+			t.Errorf("Expected nil meta, got %v", meta)
+		}
+	})
+}
+
+func TestStore_DeleteSessionMeta(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storeBackend) {
+		path := backend.tempPath(t)
+		store, err := backend.open(path)
+		if err != nil {
+			t.Fatalf("Opening store failed: %v", err)
+		}
+		defer store.Close()
+
+		meta := &SessionMeta{
+			SessionID: "session-123",
+			UserID:    12345,
+		}
+
+		err = store.StoreSessionMeta(meta)
+		if err != nil {
+			t.Fatalf("StoreSessionMeta failed: %v", err)
+		}
+
+		err = store.DeleteSessionMeta(meta.SessionID)
+		if err != nil {
+			t.Fatalf("DeleteSessionMeta failed: %v", err)
+		}
+
+		// Verify deleted
+		_, exists, err := store.GetSessionMeta(meta.SessionID)
+		if err != nil {
+			t.Fatalf("GetSessionMeta failed: %v", err)
+		}
+		if exists {
+			t.Error("Session meta should be deleted")
+		}
+	})
+}
+
+func TestStore_ListSessions(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storeBackend) {
+		path := backend.tempPath(t)
+		store, err := backend.open(path)
+		if err != nil {
+			t.Fatalf("Opening store failed: %v", err)
+		}
+		defer store.Close()
+
+		// Initially empty
+		sessions, err := store.ListSessions()
+		if err != nil {
+			t.Fatalf("ListSessions failed: %v", err)
+		}
+		if len(sessions) != 0 {
+			t.Errorf("Expected 0 sessions initially, got %d", len(sessions))
+		}
+
+		// Add two sessions
+		meta1 := &SessionMeta{SessionID: "session-1", UserID: 1}
+		meta2 := &SessionMeta{SessionID: "session-2", UserID: 2}
+		store.StoreSessionMeta(meta1)
+		store.StoreSessionMeta(meta2)
+
+		sessions, err = store.ListSessions()
+		if err != nil {
+			t.Fatalf("ListSessions failed: %v", err)
+		}
+		if len(sessions) != 2 {
+			t.Errorf("Expected 2 sessions, got %d", len(sessions))
+		}
+	})
+}
+
+func TestStore_CleanupInactiveSessions(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storeBackend) {
+		path := backend.tempPath(t)
+		store, err := backend.open(path)
+		if err != nil {
+			t.Fatalf("Opening store failed: %v", err)
+		}
+		defer store.Close()
+
+		// Create a session with recent last used time
+		meta1 := &SessionMeta{
+			SessionID:  "session-recent",
+			UserID:     1,
+			LastUsedAt: time.Now(),
+		}
+		// Create a session with old last used time
+		meta2 := &SessionMeta{
+			SessionID:  "session-old",
+			UserID:     2,
+			LastUsedAt: time.Now().Add(-2 * time.Hour),
+		}
+		store.StoreSessionMeta(meta1)
+		store.StoreSessionMeta(meta2)
+
+		// Cleanup with 1 hour max age
+		removed, err := store.CleanupInactiveSessions(1 * time.Hour)
+		if err != nil {
+			t.Fatalf("CleanupInactiveSessions failed: %v", err)
+		}
+		if len(removed) != 1 {
+			t.Errorf("Expected 1 removed session, got %d", len(removed))
+		}
+		if len(removed) > 0 && removed[0] != "session-old" {
+			t.Errorf("Expected removed session 'session-old', got %s", removed[0])
+		}
+
+		// Verify remaining sessions
+		sessions, err := store.ListSessions()
+		if err != nil {
+			t.Fatalf("ListSessions failed: %v", err)
+		}
+		if len(sessions) != 1 {
+			t.Errorf("Expected 1 remaining session, got %d", len(sessions))
+		}
+		if len(sessions) > 0 && sessions[0].SessionID != "session-recent" {
+			t.Errorf("Expected remaining session 'session-recent', got %s", sessions[0].SessionID)
+		}
+	})
+}
+
+func TestStore_RemembersCleanedSessions(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storeBackend) {
+		path := backend.tempPath(t)
+		store, err := backend.open(path)
+		if err != nil {
+			t.Fatalf("Opening store failed: %v", err)
+		}
+		old := time.Now().Add(-2 * time.Hour)
+		store.StoreSessionMeta(&SessionMeta{SessionID: "session-a", LastUsedAt: old})
+		store.StoreSessionMeta(&SessionMeta{SessionID: "session-b", LastUsedAt: old})
+		if _, err := store.CleanupInactiveSessions(time.Hour); err != nil {
+			t.Fatalf("CleanupInactiveSessions failed: %v", err)
+		}
+		store.Close()
+
+		store, err = backend.open(path)
+		if err != nil {
+			t.Fatalf("Reopening store failed: %v", err)
+		}
+		defer store.Close()
+		cleaned, err := store.ListCleanedSessions()
+		if err != nil {
+			t.Fatalf("ListCleanedSessions failed: %v", err)
+		}
+		if len(cleaned) != 2 {
+			t.Fatalf("expected both cleaned sessions to be remembered, got %v", cleaned)
+		}
+
+		// Storing a session again or deleting it forgets that it was cleaned.
+		store.StoreSessionMeta(&SessionMeta{SessionID: "session-a", LastUsedAt: time.Now()})
+		store.DeleteSessionMeta("session-b")
+		if cleaned, _ := store.ListCleanedSessions(); len(cleaned) != 0 {
+			t.Errorf("expected no cleaned sessions left, got %v", cleaned)
+		}
+	})
+}
+
+func TestStore_Close(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storeBackend) {
+		path := backend.tempPath(t)
+		store, err := backend.open(path)
+		if err != nil {
+			t.Fatalf("Opening store failed: %v", err)
+		}
+		err = store.Close()
+		if err != nil {
+			t.Errorf("Close should not return error, got %v", err)
+		}
+		// Closing twice should be safe
+		err = store.Close()
+		if err != nil {
+			t.Errorf("Second Close should be safe, got %v", err)
+		}
+	})
+}
+
+func TestStore_PersistModelNumberAndCurrentPreferences(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storeBackend) {
+		path := backend.tempPath(t)
+
+		store1, err := backend.open(path)
+		if err != nil {
+			t.Fatalf("Opening store failed: %v", err)
+		}
+		if err := store1.StoreModel(&ModelMeta{
+			ID:         "deepseek-chat",
+			Number:     12,
+			ProviderID: "deepseek",
+			Name:       "DeepSeek Chat",
+			Family:     "deepseek",
+		}); err != nil {
+			t.Fatalf("StoreModel failed: %v", err)
+		}
+		if err := store1.StoreUserLastModel(12345, "deepseek", "deepseek-chat"); err != nil {
+			t.Fatalf("StoreUserLastModel failed: %v", err)
+		}
+		if err := store1.StoreUserSession(12345, "ses_abc"); err != nil {
+			t.Fatalf("StoreUserSession failed: %v", err)
+		}
+		if err := store1.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+
+		store2, err := backend.open(path)
+		if err != nil {
+			t.Fatalf("Reopening store failed: %v", err)
+		}
+		defer store2.Close()
+
+		modelMeta, exists, err := store2.GetModel("deepseek", "deepseek-chat")
+		if err != nil {
+			t.Fatalf("GetModel failed: %v", err)
+		}
+		if !exists {
+			t.Fatal("expected persisted model to exist after reload")
+		}
+		if modelMeta.Number != 12 {
+			t.Fatalf("unexpected persisted model number: got %d, want %d", modelMeta.Number, 12)
+		}
+
+		providerID, modelID, exists, err := store2.GetUserLastModel(12345)
+		if err != nil {
+			t.Fatalf("GetUserLastModel failed: %v", err)
+		}
+		if !exists || providerID != "deepseek" || modelID != "deepseek-chat" {
+			t.Fatalf("unexpected last model preference: exists=%v provider=%s model=%s", exists, providerID, modelID)
+		}
+
+		sessionID, exists, err := store2.GetUserSession(12345)
+		if err != nil {
+			t.Fatalf("GetUserSession failed: %v", err)
+		}
+		if !exists || sessionID != "ses_abc" {
+			t.Fatalf("unexpected current session mapping: exists=%v session=%s", exists, sessionID)
+		}
+	})
+}
+
+func TestStore_StoresSameModelIDAcrossProviders(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storeBackend) {
+		path := backend.tempPath(t)
+
+		store, err := backend.open(path)
+		if err != nil {
+			t.Fatalf("Opening store failed: %v", err)
+		}
+		defer store.Close()
+
+		if err := store.StoreModel(&ModelMeta{
+			ID:         "shared-model",
+			Number:     1,
+			ProviderID: "provider-a",
+			Name:       "Shared Model",
+		}); err != nil {
+			t.Fatalf("StoreModel provider-a failed: %v", err)
+		}
+		if err := store.StoreModel(&ModelMeta{
+			ID:         "shared-model",
+			Number:     2,
+			ProviderID: "provider-b",
+			Name:       "Shared Model",
+		}); err != nil {
+			t.Fatalf("StoreModel provider-b failed: %v", err)
+		}
+
+		modelA, exists, err := store.GetModel("provider-a", "shared-model")
+		if err != nil {
+			t.Fatalf("GetModel provider-a failed: %v", err)
+		}
+		if !exists {
+			t.Fatal("expected provider-a/shared-model to exist")
+		}
+		if modelA.Number != 1 {
+			t.Fatalf("unexpected number for provider-a/shared-model: got %d want 1", modelA.Number)
+		}
+
+		modelB, exists, err := store.GetModel("provider-b", "shared-model")
+		if err != nil {
+			t.Fatalf("GetModel provider-b failed: %v", err)
+		}
+		if !exists {
+			t.Fatal("expected provider-b/shared-model to exist")
+		}
+		if modelB.Number != 2 {
+			t.Fatalf("unexpected number for provider-b/shared-model: got %d want 2", modelB.Number)
+		}
+
+		models, err := store.ListModels()
+		if err != nil {
+			t.Fatalf("ListModels failed: %v", err)
+		}
+		if len(models) != 2 {
+			t.Fatalf("expected 2 models in cache, got %d", len(models))
+		}
+	})
+}
+
+func TestStore_ChatRenderMode(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storeBackend) {
+		path := backend.tempPath(t)
+
+		store1, err := backend.open(path)
+		if err != nil {
+			t.Fatalf("Opening store failed: %v", err)
+		}
+		if err := store1.StoreChatRenderMode(-100, "plain"); err != nil {
+			t.Fatalf("StoreChatRenderMode failed: %v", err)
+		}
+		if err := store1.StoreChatRenderMode(42, "markdown_final"); err != nil {
+			t.Fatalf("StoreChatRenderMode failed: %v", err)
+		}
+		if err := store1.StoreChatRenderMode(42, ""); err != nil {
+			t.Fatalf("StoreChatRenderMode reset failed: %v", err)
+		}
+		if err := store1.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+
+		store2, err := backend.open(path)
+		if err != nil {
+			t.Fatalf("Reopening store failed: %v", err)
+		}
+		defer store2.Close()
+
+		mode, exists, err := store2.GetChatRenderMode(-100)
+		if err != nil || !exists || mode != "plain" {
+			t.Fatalf("unexpected render mode: mode=%q exists=%v err=%v", mode, exists, err)
+		}
+		if _, exists, _ := store2.GetChatRenderMode(42); exists {
+			t.Fatal("an empty mode should remove the override")
+		}
+	})
+}
+
+func TestStore_SessionMetaRoundTrip(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storeBackend) {
+		path := backend.tempPath(t)
+		store, err := backend.open(path)
+		if err != nil {
+			t.Fatalf("Opening store failed: %v", err)
+		}
+
+		created := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+		meta := &SessionMeta{
+			SessionID:    "ses_child",
+			UserID:       7,
+			Name:         "Fork",
+			CreatedAt:    created,
+			LastUsedAt:   created.Add(time.Hour),
+			MessageCount: 3,
+			ProviderID:   "anthropic",
+			ModelID:      "sonnet",
+			Agent:        "plan",
+			ParentID:     "ses_parent",
+			Status:       "owned",
+		}
+		if err := store.StoreSessionMeta(meta); err != nil {
+			t.Fatalf("StoreSessionMeta failed: %v", err)
+		}
+		if err := store.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+
+		store, err = backend.open(path)
+		if err != nil {
+			t.Fatalf("Reopening store failed: %v", err)
+		}
+		defer store.Close()
+
+		got, exists, err := store.GetSessionMeta("ses_child")
+		if err != nil || !exists {
+			t.Fatalf("GetSessionMeta failed: exists=%v err=%v", exists, err)
+		}
+		if !got.CreatedAt.Equal(meta.CreatedAt) || !got.LastUsedAt.Equal(meta.LastUsedAt) {
+			t.Errorf("times not preserved: created=%v last used=%v", got.CreatedAt, got.LastUsedAt)
+		}
+		got.CreatedAt, got.LastUsedAt = meta.CreatedAt, meta.LastUsedAt
+		if *got != *meta {
+			t.Errorf("session metadata mismatch:\n got  %+v\n want %+v", *got, *meta)
+		}
+	})
+}
+
+func TestStore_DeleteSessionMetaRemovesUserMappings(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storeBackend) {
+		store, err := backend.open(backend.tempPath(t))
+		if err != nil {
+			t.Fatalf("Opening store failed: %v", err)
+		}
+		defer store.Close()
+
+		store.StoreSessionMeta(&SessionMeta{SessionID: "ses_1", UserID: 1})
+		store.StoreUserSession(1, "ses_1")
+		store.StoreUserSession(2, "ses_1")
+		store.StoreUserSession(3, "ses_2")
+
+		if err := store.DeleteSessionMeta("ses_1"); err != nil {
+			t.Fatalf("DeleteSessionMeta failed: %v", err)
+		}
+		for _, userID := range []int64{1, 2} {
+			if _, exists, _ := store.GetUserSession(userID); exists {
+				t.Errorf("user %d should no longer point at the deleted session", userID)
+			}
+		}
+		if sessionID, exists, _ := store.GetUserSession(3); !exists || sessionID != "ses_2" {
+			t.Errorf("unrelated mapping should be kept, got %q exists=%v", sessionID, exists)
+		}
+	})
+}
+
+func TestStore_GetModelByUniqueModelID(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storeBackend) {
+		store, err := backend.open(backend.tempPath(t))
+		if err != nil {
+			t.Fatalf("Opening store failed: %v", err)
+		}
+		defer store.Close()
+
+		store.StoreModel(&ModelMeta{ID: "unique", ProviderID: "provider-a", Number: 1})
+		store.StoreModel(&ModelMeta{ID: "shared", ProviderID: "provider-a", Number: 2})
+		store.StoreModel(&ModelMeta{ID: "shared", ProviderID: "provider-b", Number: 3})
+
+		if meta, exists, err := store.GetModel("", "unique"); err != nil || !exists || meta.Number != 1 {
+			t.Errorf("expected a unique model ID to resolve without provider, got %+v exists=%v err=%v", meta, exists, err)
+		}
+		if _, exists, _ := store.GetModel("", "shared"); exists {
+			t.Error("an ambiguous model ID should not resolve without provider")
+		}
+
+		if err := store.DeleteModel("provider-a", "shared"); err != nil {
+			t.Fatalf("DeleteModel failed: %v", err)
+		}
+		if meta, exists, _ := store.GetModel("", "shared"); !exists || meta.ProviderID != "provider-b" {
+			t.Errorf("expected the remaining model to resolve, got %+v exists=%v", meta, exists)
+		}
+	})
+}
+
+func TestStore_ConcurrentWrites(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storeBackend) {
+		store, err := backend.open(backend.tempPath(t))
+		if err != nil {
+			t.Fatalf("Opening store failed: %v", err)
+		}
+		defer store.Close()
+
+		const users = 20
+		var wg sync.WaitGroup
+		for i := 0; i < users; i++ {
+			wg.Add(1)
+			go func(userID int64) {
+				defer wg.Done()
+				sessionID := fmt.Sprintf("ses_%d", userID)
+				if err := store.StoreSessionMeta(&SessionMeta{SessionID: sessionID, UserID: userID}); err != nil {
+					t.Errorf("StoreSessionMeta failed: %v", err)
+				}
+				if err := store.StoreUserSession(userID, sessionID); err != nil {
+					t.Errorf("StoreUserSession failed: %v", err)
+				}
+			}(int64(i))
+		}
+		wg.Wait()
+
+		sessions, err := store.ListSessions()
+		if err != nil {
+			t.Fatalf("ListSessions failed: %v", err)
+		}
+		if len(sessions) != users {
+			t.Errorf("expected %d sessions, got %d", users, len(sessions))
+		}
+		for i := int64(0); i < users; i++ {
+			if sessionID, exists, _ := store.GetUserSession(i); !exists || sessionID != fmt.Sprintf("ses_%d", i) {
+				t.Errorf("user %d: got session %q exists=%v", i, sessionID, exists)
+			}
+		}
+	})
+}